@@ -0,0 +1,551 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mapper provides a seed-and-extend short read aligner. Reads are seeded with
+// minimizers, seeds are chained, chains are extended by banded Smith-Waterman alignment
+// and paired reads lacking a consistent pairing are rescued by local alignment near their
+// mate.
+package mapper
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/index/minimizer"
+	"code.google.com/p/biogo/io/seqio"
+	"code.google.com/p/biogo/seq"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A Mapper aligns reads to a set of reference sequences.
+type Mapper struct {
+	Scoring
+	Band      int // Half width of the band about the seed diagonal used for extension.
+	MinScore  int // Minimum alignment score for a read to be mapped.
+	MaxChains int // Maximum number of chains extended for each read.
+	MaxInsert int // Maximum insert size for a proper pair.
+	BatchSize int // Number of reads or pairs aligned in each concurrent work unit.
+
+	Chainer minimizer.Chainer
+
+	refs  []*seq.Seq
+	index *minimizer.Index
+}
+
+// Default mapping parameters.
+var (
+	DefaultK         = 15
+	DefaultW         = 5
+	DefaultMaxOcc    = 500
+	DefaultBand      = 16
+	DefaultMinScore  = 30
+	DefaultMaxChains = 5
+	DefaultMaxInsert = 1000
+	DefaultBatchSize = 256
+)
+
+// Return a new Mapper indexing refs.
+func New(refs ...*seq.Seq) (*Mapper, error) {
+	if len(refs) == 0 {
+		return nil, bio.NewError("mapper: no reference sequences", 0)
+	}
+	sampler, err := minimizer.NewWindow(DefaultW, DefaultK)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := minimizer.New(sampler, refs...)
+	if err != nil {
+		return nil, err
+	}
+	idx.MaxOcc = DefaultMaxOcc
+	idx.Build()
+
+	return &Mapper{
+		Scoring:   DefaultScoring,
+		Band:      DefaultBand,
+		MinScore:  DefaultMinScore,
+		MaxChains: DefaultMaxChains,
+		MaxInsert: DefaultMaxInsert,
+		BatchSize: DefaultBatchSize,
+		Chainer: minimizer.Chainer{
+			MaxGap:     100,
+			Bandwidth:  DefaultBand,
+			Lookback:   50,
+			MinScore:   DefaultK,
+			MinAnchors: 1,
+		},
+		refs:  refs,
+		index: idx,
+	}, nil
+}
+
+// A candidate is a placement of a read.
+type candidate struct {
+	ref    int
+	strand int8
+	hit
+}
+
+// oriented returns the read sequence and qualities on the given strand.
+func oriented(r *seq.Seq, strand int8) (s, q []byte) {
+	s = r.Seq
+	var qual []seq.Qsanger
+	if r.Quality != nil {
+		qual = r.Quality.Qual
+	}
+	if strand < 0 {
+		s = make([]byte, len(r.Seq))
+		for i, b := range r.Seq {
+			s[len(s)-1-i] = complement[b]
+		}
+	}
+	if qual != nil {
+		q = make([]byte, len(qual))
+		for i, v := range qual {
+			if strand < 0 {
+				i = len(q) - 1 - i
+			}
+			q[i] = v.Encode(seq.Sanger)
+		}
+	}
+	return
+}
+
+var complement = func() (t [256]byte) {
+	for i := range t {
+		t[i] = 'N'
+	}
+	for _, p := range []string{"AT", "CG", "GC", "TA", "at", "cg", "gc", "ta"} {
+		t[p[0]] = p[1]
+	}
+	return
+}()
+
+// extend aligns read s on strand to reference ref about the diagonal d.
+func (self *Mapper) extend(s []byte, ref int, strand int8, d, w int) (candidate, bool) {
+	r := self.refs[ref].Seq
+	lo, hi := d-w, d+len(s)+w
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(r) {
+		hi = len(r)
+	}
+	if lo >= hi {
+		return candidate{}, false
+	}
+	h, ok := self.align(r[lo:hi], s, d-lo, w)
+	if !ok || h.score < self.MinScore {
+		return candidate{}, false
+	}
+	h.rStart += lo
+	h.rEnd += lo
+	return candidate{ref: ref, strand: strand, hit: h}, true
+}
+
+// candidates returns the placements of the read r ordered by descending score.
+func (self *Mapper) candidates(r *seq.Seq) []candidate {
+	anchors, err := self.index.Anchors(r.Seq)
+	if err != nil {
+		return nil
+	}
+	k := self.index.Sampler.KmerLen()
+	chains := self.Chainer.Chain(anchors, k, r.Len())
+	if len(chains) > self.MaxChains {
+		chains = chains[:self.MaxChains]
+	}
+	var (
+		c    []candidate
+		seqs = map[int8][]byte{}
+	)
+	for _, ch := range chains {
+		s, ok := seqs[ch.Strand]
+		if !ok {
+			s, _ = oriented(r, ch.Strand)
+			seqs[ch.Strand] = s
+		}
+		a := ch.Anchors[0]
+		qp := a.QPos
+		if ch.Strand < 0 {
+			qp = r.Len() - (a.QPos + k)
+		}
+		cand, ok := self.extend(s, ch.Target, ch.Strand, a.TPos-qp, self.Band)
+		if !ok {
+			continue
+		}
+		dup := false
+		for _, o := range c {
+			if o.ref == cand.ref && o.strand == cand.strand && o.rStart == cand.rStart {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			c = append(c, cand)
+		}
+	}
+	sort.Stable(byScore(c))
+	return c
+}
+
+type byScore []candidate
+
+func (self byScore) Len() int           { return len(self) }
+func (self byScore) Less(i, j int) bool { return self[i].score > self[j].score }
+func (self byScore) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// mapq returns a mapping quality from the best and second best alignment scores.
+func mapq(best, second int) int {
+	if best <= 0 {
+		return 0
+	}
+	if second < 0 {
+		second = 0
+	}
+	q := 60 * (best - second) / best
+	if q > 60 {
+		q = 60
+	}
+	return q
+}
+
+func second(c []candidate) int {
+	if len(c) < 2 {
+		return 0
+	}
+	return c[1].score
+}
+
+// record returns the SAM record of read r placed at c.
+func (self *Mapper) record(r *seq.Seq, c candidate, q int) *Record {
+	s, qual := oriented(r, c.strand)
+	rec := &Record{
+		Name:    r.ID,
+		Ref:     self.refs[c.ref].ID,
+		Pos:     c.rStart,
+		MapQual: q,
+		Seq:     s,
+		Qual:    qual,
+		Score:   c.score,
+		Edits:   c.edits,
+	}
+	if c.strand < 0 {
+		rec.Flags |= Reverse
+	}
+	if c.qStart > 0 {
+		rec.Cigar = append(rec.Cigar, CigarOp{Type: 'S', Len: c.qStart})
+	}
+	rec.Cigar = append(rec.Cigar, c.cigar...)
+	if c.qEnd < len(s) {
+		rec.Cigar = append(rec.Cigar, CigarOp{Type: 'S', Len: len(s) - c.qEnd})
+	}
+	return rec
+}
+
+func unmapped(r *seq.Seq) *Record {
+	s, q := oriented(r, 1)
+	return &Record{Name: r.ID, Flags: Unmapped, Seq: s, Qual: q}
+}
+
+// Return the alignment record of the single-end read r.
+func (self *Mapper) MapRead(r *seq.Seq) *Record {
+	c := self.candidates(r)
+	if len(c) == 0 {
+		return unmapped(r)
+	}
+	return self.record(r, c[0], mapq(c[0].score, second(c)))
+}
+
+// proper returns whether placements a and b form a forward-reverse pair within MaxInsert,
+// and the template length.
+func (self *Mapper) proper(a, b candidate) (bool, int) {
+	if a.ref != b.ref || a.strand == b.strand {
+		return false, 0
+	}
+	f, r := a, b
+	if a.strand < 0 {
+		f, r = b, a
+	}
+	if f.rStart > r.rEnd {
+		return false, 0
+	}
+	lo, hi := f.rStart, r.rEnd
+	if r.rStart < lo {
+		lo = r.rStart
+	}
+	if f.rEnd > hi {
+		hi = f.rEnd
+	}
+	return hi-lo <= self.MaxInsert, hi - lo
+}
+
+// rescue searches for the mate m of a read placed at c within MaxInsert of c.
+func (self *Mapper) rescue(m *seq.Seq, c candidate) (candidate, bool) {
+	strand := -c.strand
+	s, _ := oriented(m, strand)
+	var lo, hi int
+	if c.strand > 0 {
+		lo, hi = c.rStart, c.rStart+self.MaxInsert
+	} else {
+		lo, hi = c.rEnd-self.MaxInsert, c.rEnd
+	}
+	// Centre the band over the window so every alignment is within it.
+	w := (hi - lo) / 2
+	cand, ok := self.extend(s, c.ref, strand, lo+w-len(s)/2, w+len(s))
+	if !ok {
+		return cand, false
+	}
+	if p, _ := self.proper(c, cand); !p {
+		return cand, false
+	}
+	return cand, true
+}
+
+// Return the alignment records of the read pair r1 and r2.
+func (self *Mapper) MapPair(r1, r2 *seq.Seq) (*Record, *Record) {
+	c1, c2 := self.candidates(r1), self.candidates(r2)
+
+	// Find the best scoring proper pair of placements.
+	var (
+		best, next = -1, -1
+		b1, b2     candidate
+		paired     bool
+	)
+	for _, a := range c1 {
+		for _, b := range c2 {
+			if ok, _ := self.proper(a, b); !ok {
+				continue
+			}
+			if s := a.score + b.score; s > best {
+				best, next = s, best
+				b1, b2, paired = a, b, true
+			} else if s > next {
+				next = s
+			}
+		}
+	}
+
+	// Rescue mates of the best placements if they are not properly paired.
+	if !paired {
+		switch {
+		case len(c1) > 0 && (len(c2) == 0 || c1[0].score >= c2[0].score):
+			if m, ok := self.rescue(r2, c1[0]); ok {
+				b1, b2, paired = c1[0], m, true
+				c2 = append(c2, m)
+			}
+		case len(c2) > 0:
+			if m, ok := self.rescue(r1, c2[0]); ok {
+				b1, b2, paired = m, c2[0], true
+				c1 = append(c1, m)
+			}
+		}
+		if paired {
+			best = b1.score + b2.score
+		}
+	}
+
+	var rec1, rec2 *Record
+	if paired {
+		pq := mapq(best, next)
+		rec1 = self.record(r1, b1, max(mapq(b1.score, secondTo(c1, b1)), pq))
+		rec2 = self.record(r2, b2, max(mapq(b2.score, secondTo(c2, b2)), pq))
+		_, tlen := self.proper(b1, b2)
+		rec1.Flags |= ProperPair
+		rec2.Flags |= ProperPair
+		if rec1.Pos <= rec2.Pos {
+			rec1.TempLen, rec2.TempLen = tlen, -tlen
+		} else {
+			rec1.TempLen, rec2.TempLen = -tlen, tlen
+		}
+	} else {
+		rec1, rec2 = self.MapRead(r1), self.MapRead(r2)
+	}
+	mate(rec1, rec2)
+	rec1.Flags |= Paired | Read1
+	rec2.Flags |= Paired | Read2
+	return rec1, rec2
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// secondTo returns the best score among c other than that of the placement b.
+func secondTo(c []candidate, b candidate) int {
+	var s int
+	for _, o := range c {
+		if o.ref == b.ref && o.strand == b.strand && o.rStart == b.rStart {
+			continue
+		}
+		if o.score > s {
+			s = o.score
+		}
+	}
+	return s
+}
+
+// mate sets the mate fields of a and b, placing an unmapped read at its mate's position.
+func mate(a, b *Record) {
+	for _, p := range [2][2]*Record{{a, b}, {b, a}} {
+		r, m := p[0], p[1]
+		if r.Flags&Unmapped != 0 && m.Flags&Unmapped == 0 {
+			r.Ref, r.Pos = m.Ref, m.Pos
+		}
+	}
+	for _, p := range [2][2]*Record{{a, b}, {b, a}} {
+		r, m := p[0], p[1]
+		if m.Flags&Unmapped != 0 {
+			r.Flags |= MateUnmapped
+		}
+		if m.Flags&Reverse != 0 {
+			r.Flags |= MateReverse
+		}
+		r.MateRef, r.MatePos = m.Ref, m.Pos
+	}
+}
+
+type batch struct {
+	index   int
+	reads   []*seq.Seq
+	records []*Record
+}
+
+// run aligns batches of reads obtained from next using the given number of goroutines,
+// writing records to w in input order.
+func (self *Mapper) run(next func() ([]*seq.Seq, error), work func([]*seq.Seq) []*Record, w *Writer, threads int) (n int, err error) {
+	if threads < 1 {
+		threads = 1
+	}
+	var (
+		jobs    = make(chan *batch, threads)
+		results = make(chan *batch, threads)
+		readErr error
+		wg      sync.WaitGroup
+	)
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			reads, err := next()
+			if len(reads) > 0 {
+				jobs <- &batch{index: i, reads: reads}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+		}
+	}()
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				b.records = work(b.reads)
+				results <- b
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]*batch)
+	want := 0
+	for b := range results {
+		pending[b.index] = b
+		for b, ok := pending[want]; ok; b, ok = pending[want] {
+			delete(pending, want)
+			want++
+			if err != nil {
+				continue
+			}
+			for _, r := range b.records {
+				if _, err = w.Write(r); err != nil {
+					break
+				}
+			}
+			n += len(b.reads)
+		}
+	}
+	if err == nil {
+		err = readErr
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	return
+}
+
+// Map aligns the single-end reads of r using threads goroutines, writing records to w in input
+// order. It returns the number of reads aligned.
+func (self *Mapper) Map(r seqio.Reader, w *Writer, threads int) (int, error) {
+	next := func() (reads []*seq.Seq, err error) {
+		for len(reads) < self.BatchSize {
+			var s *seq.Seq
+			if s, err = r.Read(); err != nil {
+				return
+			}
+			reads = append(reads, s)
+		}
+		return
+	}
+	work := func(reads []*seq.Seq) []*Record {
+		recs := make([]*Record, len(reads))
+		for i, s := range reads {
+			recs[i] = self.MapRead(s)
+		}
+		return recs
+	}
+	return self.run(next, work, w, threads)
+}
+
+// MapPairs aligns the read pairs obtained from r1 and r2 using threads goroutines, writing
+// records to w in input order. It returns the number of pairs aligned.
+func (self *Mapper) MapPairs(r1, r2 seqio.Reader, w *Writer, threads int) (int, error) {
+	next := func() (reads []*seq.Seq, err error) {
+		for len(reads) < 2*self.BatchSize {
+			var a, b *seq.Seq
+			a, err = r1.Read()
+			if err != nil && err != io.EOF {
+				return
+			}
+			var err2 error
+			b, err2 = r2.Read()
+			if (err == io.EOF) != (err2 == io.EOF) {
+				return reads, bio.NewError("mapper: read files have different numbers of reads", 0)
+			}
+			if err2 != nil {
+				return reads, err2
+			}
+			reads = append(reads, a, b)
+		}
+		return
+	}
+	work := func(reads []*seq.Seq) []*Record {
+		recs := make([]*Record, len(reads))
+		for i := 0; i < len(reads); i += 2 {
+			recs[i], recs[i+1] = self.MapPair(reads[i], reads[i+1])
+		}
+		return recs
+	}
+	n, err := self.run(next, work, w, threads)
+	return n / 2, err
+}
@@ -0,0 +1,285 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mapper
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/io/seqio/fastq"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func random(n int, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rnd.Intn(4)]
+	}
+	return s
+}
+
+func revComp(s []byte) []byte {
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = complement[b]
+	}
+	return r
+}
+
+// mutate substitutes the bases of s at the given positions.
+func mutate(s []byte, pos ...int) []byte {
+	m := append([]byte(nil), s...)
+	for _, p := range pos {
+		m[p] = "CGTA"[strings.IndexByte("ACGT", m[p])]
+	}
+	return m
+}
+
+func read(id string, s []byte) *seq.Seq {
+	q := &seq.Quality{ID: id, Qual: make([]seq.Qsanger, len(s))}
+	for i := range q.Qual {
+		q.Qual[i] = 30
+	}
+	return seq.New(id, s, q)
+}
+
+func fq(reads ...*seq.Seq) *fastq.Reader {
+	var b bytes.Buffer
+	w := fastq.NewWriter(nopCloser{&b})
+	for _, r := range reads {
+		w.Write(r)
+	}
+	w.Close()
+	return fastq.NewReader(ioutil.NopCloser(&b))
+}
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	refs []*seq.Seq
+	m    *Mapper
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpSuite(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	s.refs = []*seq.Seq{
+		seq.New("chr1", random(20000, rnd), nil),
+		seq.New("chr2", random(10000, rnd), nil),
+	}
+	var err error
+	s.m, err = New(s.refs...)
+	c.Assert(err, check.Equals, nil)
+}
+
+// Tests
+func (s *S) TestNew(c *check.C) {
+	_, err := New()
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestMapRead(c *check.C) {
+	ref := s.refs[0].Seq
+	for _, t := range []struct {
+		read  []byte
+		pos   int
+		flags int
+		cigar string
+		edits int
+	}{
+		{ref[1000:1100], 1000, 0, "100M", 0},
+		{mutate(ref[5000:5100], 10, 50, 90), 5000, 0, "100M", 3},
+		{revComp(ref[7000:7100]), 7000, Reverse, "100M", 0},
+		{revComp(mutate(ref[12000:12100], 40)), 12000, Reverse, "100M", 1},
+		{append(append([]byte(nil), ref[3000:3050]...), ref[3053:3103]...), 3000, 0, "50M3D50M", 3},
+		{append(append(append([]byte(nil), ref[9000:9050]...), "ACGT"...), ref[9050:9100]...), 9000, 0, "50M4I50M", 4},
+	} {
+		r := s.m.MapRead(read("r", t.read))
+		c.Check(r.Ref, check.Equals, "chr1")
+		c.Check(r.Pos, check.Equals, t.pos)
+		c.Check(r.Flags, check.Equals, t.flags)
+		c.Check(r.Cigar.String(), check.Equals, t.cigar)
+		c.Check(r.Edits, check.Equals, t.edits)
+		c.Check(r.MapQual, check.Equals, 60)
+	}
+
+	// Reads are reported on the reference strand.
+	r := s.m.MapRead(read("r", revComp(s.refs[1].Seq[200:300])))
+	c.Check(r.Ref, check.Equals, "chr2")
+	c.Check(r.Seq, check.DeepEquals, s.refs[1].Seq[200:300])
+	c.Check(r.Orientation(), check.Equals, int8(-1))
+
+	// Unmatched read ends are soft clipped.
+	rnd := rand.New(rand.NewSource(2))
+	cl := append(random(20, rnd), ref[15000:15080]...)
+	cl[19] = complement[ref[14999]]
+	r = s.m.MapRead(read("r", cl))
+	c.Check(r.Pos, check.Equals, 15000)
+	c.Check(r.Cigar.String(), check.Equals, "20S80M")
+}
+
+func (s *S) TestUnmapped(c *check.C) {
+	rnd := rand.New(rand.NewSource(3))
+	r := s.m.MapRead(read("u", random(100, rnd)))
+	c.Check(r.Flags, check.Equals, Unmapped)
+	c.Check(r.Ref, check.Equals, "")
+	c.Check(r.Orientation(), check.Equals, int8(0))
+	c.Check(r.Blocks(), check.IsNil)
+	c.Check(r.String(), check.Matches, "u\t4\t\\*\t0\t0\t\\*\t\\*\t0\t0\t[ACGT]{100}\t\\?{100}")
+}
+
+func (s *S) TestRepeat(c *check.C) {
+	rnd := rand.New(rand.NewSource(4))
+	rep := random(100, rnd)
+	a := append(append(random(1000, rnd), rep...), random(1000, rnd)...)
+	a = append(append(a, rep...), random(1000, rnd)...)
+	m, err := New(seq.New("rep", a, nil))
+	c.Assert(err, check.Equals, nil)
+	r := m.MapRead(read("r", rep))
+	c.Check(r.MapQual, check.Equals, 0)
+}
+
+func (s *S) TestBlocks(c *check.C) {
+	ref := s.refs[0].Seq
+	r := s.m.MapRead(read("r", append(append([]byte(nil), ref[3000:3050]...), ref[3053:3103]...)))
+	c.Check(r.Reference(), check.Equals, "chr1")
+	c.Check(fmt.Sprint(r.Blocks()), check.Equals, "[{3000 3050} {3053 3103}]")
+	c.Check(r.End(), check.Equals, 3103)
+}
+
+func (s *S) TestMapPair(c *check.C) {
+	ref := s.refs[0].Seq
+	r1, r2 := s.m.MapPair(read("p", ref[2000:2100]), read("p", revComp(ref[2300:2400])))
+	c.Check(r1.Flags, check.Equals, Paired|ProperPair|MateReverse|Read1)
+	c.Check(r2.Flags, check.Equals, Paired|ProperPair|Reverse|Read2)
+	c.Check(r1.Pos, check.Equals, 2000)
+	c.Check(r2.Pos, check.Equals, 2300)
+	c.Check(r1.MatePos, check.Equals, 2300)
+	c.Check(r2.MatePos, check.Equals, 2000)
+	c.Check(r1.TempLen, check.Equals, 400)
+	c.Check(r2.TempLen, check.Equals, -400)
+	c.Check(r1.String(), check.Matches, "p\t99\tchr1\t2001\t60\t100M\t=\t2301\t400\t.*")
+
+	// Pairs too far apart are not proper.
+	r1, r2 = s.m.MapPair(read("p", ref[2000:2100]), read("p", revComp(ref[8300:8400])))
+	c.Check(r1.Flags&ProperPair, check.Equals, 0)
+	c.Check(r2.Pos, check.Equals, 8300)
+	c.Check(r1.TempLen, check.Equals, 0)
+}
+
+func (s *S) TestRescue(c *check.C) {
+	ref := s.refs[0].Seq
+	// A mate too divergent to be seeded is rescued by alignment near its pair.
+	m := revComp(mutate(ref[4300:4360], 12, 24, 36, 48))
+	r1, r2 := s.m.MapPair(read("p", ref[4000:4100]), read("p", m))
+	c.Check(s.m.MapRead(read("p", m)).Flags, check.Equals, Unmapped)
+	c.Check(r2.Flags, check.Equals, Paired|ProperPair|Reverse|Read2)
+	c.Check(r2.Pos, check.Equals, 4300)
+	c.Check(r2.Edits, check.Equals, 4)
+	c.Check(r1.TempLen, check.Equals, 360)
+
+	// An unplaced mate takes the position of its pair.
+	rnd := rand.New(rand.NewSource(5))
+	r1, r2 = s.m.MapPair(read("p", ref[4000:4100]), read("p", random(100, rnd)))
+	c.Check(r1.Flags, check.Equals, Paired|MateUnmapped|Read1)
+	c.Check(r2.Flags, check.Equals, Paired|Unmapped|Read2)
+	c.Check(r2.Ref, check.Equals, "chr1")
+	c.Check(r2.Pos, check.Equals, 4000)
+	c.Check(r1.MatePos, check.Equals, 4000)
+}
+
+func (s *S) TestMap(c *check.C) {
+	rnd := rand.New(rand.NewSource(6))
+	var (
+		reads []*seq.Seq
+		want  []int
+	)
+	for i := 0; i < 100; i++ {
+		p := rnd.Intn(s.refs[0].Len() - 100)
+		r := s.refs[0].Seq[p : p+100]
+		if i%2 == 1 {
+			r = revComp(r)
+		}
+		reads = append(reads, read(fmt.Sprintf("r%d", i), r))
+		want = append(want, p)
+	}
+	s.m.BatchSize = 7
+	defer func() { s.m.BatchSize = DefaultBatchSize }()
+	var serial string
+	for _, threads := range []int{1, 4} {
+		var b bytes.Buffer
+		w, err := NewWriter(&b, s.refs)
+		c.Assert(err, check.Equals, nil)
+		n, err := s.m.Map(fq(reads...), w, threads)
+		c.Check(err, check.Equals, nil)
+		c.Check(n, check.Equals, 100)
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		c.Assert(len(lines), check.Equals, 104)
+		c.Check(lines[:4], check.DeepEquals, []string{
+			"@HD\tVN:1.6\tSO:unsorted",
+			"@SQ\tSN:chr1\tLN:20000",
+			"@SQ\tSN:chr2\tLN:10000",
+			"@PG\tID:biogo-mapper\tPN:mapper",
+		})
+		for i, l := range lines[4:] {
+			f := strings.Split(l, "\t")
+			c.Check(f[0], check.Equals, fmt.Sprintf("r%d", i))
+			c.Check(f[3], check.Equals, fmt.Sprint(want[i]+1))
+			c.Check(f[10], check.Equals, strings.Repeat("?", 100))
+		}
+		if threads == 1 {
+			serial = b.String()
+		} else {
+			c.Check(b.String(), check.Equals, serial)
+		}
+	}
+}
+
+func (s *S) TestMapPairs(c *check.C) {
+	ref := s.refs[1].Seq
+	var r1, r2 []*seq.Seq
+	for i := 0; i < 10; i++ {
+		p := 500 * (i + 1)
+		r1 = append(r1, read(fmt.Sprintf("p%d", i), ref[p:p+100]))
+		r2 = append(r2, read(fmt.Sprintf("p%d", i), revComp(ref[p+200:p+300])))
+	}
+	var b bytes.Buffer
+	w, err := NewWriter(&b, s.refs)
+	c.Assert(err, check.Equals, nil)
+	n, err := s.m.MapPairs(fq(r1...), fq(r2...), w, 3)
+	c.Check(err, check.Equals, nil)
+	c.Check(n, check.Equals, 10)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")[4:]
+	c.Assert(len(lines), check.Equals, 20)
+	for i, l := range lines {
+		f := strings.Split(l, "\t")
+		c.Check(f[0], check.Equals, fmt.Sprintf("p%d", i/2))
+		c.Check(f[1], check.Equals, []string{"99", "147"}[i%2])
+	}
+
+	_, err = s.m.MapPairs(fq(r1...), fq(r2[:5]...), w, 2)
+	c.Check(err, check.NotNil)
+}
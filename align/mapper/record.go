@@ -0,0 +1,195 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mapper
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/coverage"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A CigarOp is a single CIGAR operation.
+type CigarOp struct {
+	Type byte // One of 'M', 'I', 'D', 'S'.
+	Len  int
+}
+
+// A Cigar describes the alignment of a read to a reference.
+type Cigar []CigarOp
+
+// String returns the SAM representation of the Cigar.
+func (self Cigar) String() string {
+	if len(self) == 0 {
+		return "*"
+	}
+	var b []byte
+	for _, o := range self {
+		b = strconv.AppendInt(b, int64(o.Len), 10)
+		b = append(b, o.Type)
+	}
+	return string(b)
+}
+
+// Return the number of reference bases covered by the Cigar.
+func (self Cigar) RefLen() (n int) {
+	for _, o := range self {
+		if o.Type == 'M' || o.Type == 'D' {
+			n += o.Len
+		}
+	}
+	return
+}
+
+// SAM flag bits.
+const (
+	Paired       = 0x1
+	ProperPair   = 0x2
+	Unmapped     = 0x4
+	MateUnmapped = 0x8
+	Reverse      = 0x10
+	MateReverse  = 0x20
+	Read1        = 0x40
+	Read2        = 0x80
+	Secondary    = 0x100
+)
+
+// A Record is a SAM-compatible alignment record.
+type Record struct {
+	Name    string
+	Flags   int
+	Ref     string // Empty for unplaced reads.
+	Pos     int    // Zero-based leftmost reference position.
+	MapQual int
+	Cigar   Cigar
+	MateRef string
+	MatePos int
+	TempLen int
+	Seq     []byte // Read sequence on the reference strand.
+	Qual    []byte // Phred+33 encoded qualities on the reference strand, or nil.
+	Score   int    // Alignment score.
+	Edits   int    // Edit distance to the reference.
+}
+
+// Return the reference name.
+func (self *Record) Reference() string { return self.Ref }
+
+// Return the strand of the alignment, or 0 if the read is unmapped.
+func (self *Record) Orientation() int8 {
+	switch {
+	case self.Flags&Unmapped != 0:
+		return 0
+	case self.Flags&Reverse != 0:
+		return -1
+	}
+	return 1
+}
+
+// Return the mapping quality.
+func (self *Record) MapQ() int { return self.MapQual }
+
+// Return the reference blocks covered by aligned bases.
+func (self *Record) Blocks() (b []coverage.Block) {
+	if self.Flags&Unmapped != 0 {
+		return nil
+	}
+	p := self.Pos
+	for _, o := range self.Cigar {
+		switch o.Type {
+		case 'M':
+			if n := len(b); n > 0 && b[n-1].End == p {
+				b[n-1].End += o.Len
+			} else {
+				b = append(b, coverage.Block{Start: p, End: p + o.Len})
+			}
+			p += o.Len
+		case 'D':
+			p += o.Len
+		}
+	}
+	return
+}
+
+// Return the exclusive end of the alignment on the reference.
+func (self *Record) End() int { return self.Pos + self.Cigar.RefLen() }
+
+var _ coverage.Aligned = &Record{}
+
+// String returns the SAM line for the Record without a trailing newline.
+func (self *Record) String() string {
+	ref, pos := "*", 0
+	if self.Ref != "" {
+		ref, pos = self.Ref, self.Pos+1
+	}
+	mref, mpos := "*", 0
+	if self.MateRef != "" {
+		mref, mpos = self.MateRef, self.MatePos+1
+		if self.MateRef == self.Ref {
+			mref = "="
+		}
+	}
+	s, q := "*", "*"
+	if len(self.Seq) > 0 {
+		s = string(self.Seq)
+	}
+	if len(self.Qual) > 0 {
+		q = string(self.Qual)
+	}
+	line := fmt.Sprintf("%s\t%d\t%s\t%d\t%d\t%v\t%s\t%d\t%d\t%s\t%s",
+		self.Name, self.Flags, ref, pos, self.MapQual, self.Cigar, mref, mpos, self.TempLen, s, q)
+	if self.Flags&Unmapped == 0 {
+		line += fmt.Sprintf("\tNM:i:%d\tAS:i:%d", self.Edits, self.Score)
+	}
+	return line
+}
+
+// A Writer writes SAM records.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// Return a new Writer writing to w, after writing a SAM header describing the reference
+// sequences.
+func NewWriter(w io.Writer, refs []*seq.Seq) (*Writer, error) {
+	self := &Writer{w: bufio.NewWriter(w)}
+	if _, err := fmt.Fprintln(self.w, "@HD\tVN:1.6\tSO:unsorted"); err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		if _, err := fmt.Fprintf(self.w, "@SQ\tSN:%s\tLN:%d\n", r.ID, r.Len()); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := fmt.Fprintln(self.w, "@PG\tID:biogo-mapper\tPN:mapper"); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+// Write a record.
+func (self *Writer) Write(r *Record) (n int, err error) {
+	n, err = self.w.WriteString(r.String())
+	if err != nil {
+		return
+	}
+	err = self.w.WriteByte('\n')
+	return n + 1, err
+}
+
+// Flush buffered records to the underlying writer.
+func (self *Writer) Flush() error { return self.w.Flush() }
@@ -0,0 +1,187 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mapper
+
+import (
+	"math"
+)
+
+// Scoring holds affine gap local alignment scores. Penalties are positive.
+type Scoring struct {
+	Match, Mismatch    int
+	GapOpen, GapExtend int // A gap of length l costs GapOpen + l*GapExtend.
+}
+
+// DefaultScoring is the default alignment scoring scheme.
+var DefaultScoring = Scoring{Match: 1, Mismatch: 4, GapOpen: 6, GapExtend: 1}
+
+// hit is a local alignment of a query to a reference window.
+type hit struct {
+	score        int
+	rStart, rEnd int
+	qStart, qEnd int
+	cigar        Cigar
+	edits        int
+}
+
+const (
+	fromZero = iota
+	fromDiag
+	fromE
+	fromF
+	extE = 1 << 2
+	extF = 1 << 3
+)
+
+var baseCode = func() (t [256]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i, b := range "ACGT" {
+		t[b], t[b+'a'-'A'] = int8(i), int8(i)
+	}
+	return
+}()
+
+func (self Scoring) score(a, b byte) int {
+	if ca := baseCode[a]; ca >= 0 && ca == baseCode[b] {
+		return self.Match
+	}
+	return -self.Mismatch
+}
+
+// align performs a banded local alignment of q to r restricted to cells whose diagonal,
+// r index minus q index, is within w of d. It returns false if no positive scoring alignment
+// exists.
+func (self Scoring) align(r, q []byte, d, w int) (h hit, ok bool) {
+	m, width := len(q), 2*w+1
+	var (
+		minInf = math.MinInt32 / 2
+		hs     = make([]int, (m+1)*width)
+		es     = make([]int, (m+1)*width)
+		fs     = make([]int, (m+1)*width)
+		tb     = make([]byte, (m+1)*width)
+		best   int
+		bi, bk int
+	)
+	for i := range hs {
+		es[i], fs[i] = minInf, minInf
+	}
+	at := func(i, k int) int { return i*width + k }
+	open := self.GapOpen + self.GapExtend
+	for i := 1; i <= m; i++ {
+		lo := i + d - w // Reference column of k = 0.
+		for k := 0; k < width; k++ {
+			j := lo + k
+			if j < 1 || j > len(r) {
+				continue
+			}
+			c := at(i, k)
+			var dir byte
+
+			// E: gap in the query consuming reference, from the left.
+			if k > 0 {
+				e, ee := hs[c-1]-open, es[c-1]-self.GapExtend
+				if ee > e {
+					e = ee
+					dir |= extE
+				}
+				es[c] = e
+			}
+			// F: gap in the reference consuming query, from above.
+			if k+1 < width {
+				u := at(i-1, k+1)
+				f, ff := hs[u]-open, fs[u]-self.GapExtend
+				if ff > f {
+					f = ff
+					dir |= extF
+				}
+				fs[c] = f
+			}
+
+			v, from := 0, fromZero
+			if dg := hs[at(i-1, k)] + self.score(q[i-1], r[j-1]); dg > v {
+				v, from = dg, fromDiag
+			}
+			if es[c] > v {
+				v, from = es[c], fromE
+			}
+			if fs[c] > v {
+				v, from = fs[c], fromF
+			}
+			hs[c] = v
+			tb[c] = dir | byte(from)
+			if v > best {
+				best, bi, bk = v, i, k
+			}
+		}
+	}
+	if best <= 0 {
+		return h, false
+	}
+
+	h.score = best
+	h.qEnd, h.rEnd = bi, bi+d-w+bk
+	i, k, state := bi, bk, fromDiag
+	var ops []byte
+	for i > 0 {
+		c := at(i, k)
+		if state == fromDiag {
+			state = int(tb[c] & 3)
+			if state == fromZero {
+				break
+			}
+		}
+		j := i + d - w + k
+		switch state {
+		case fromDiag:
+			ops = append(ops, 'M')
+			if baseCode[q[i-1]] < 0 || baseCode[q[i-1]] != baseCode[r[j-1]] {
+				h.edits++
+			}
+			i--
+			state = fromDiag
+		case fromE:
+			ops = append(ops, 'D')
+			h.edits++
+			if tb[c]&extE == 0 {
+				state = fromDiag
+			}
+			k--
+		case fromF:
+			ops = append(ops, 'I')
+			h.edits++
+			if tb[c]&extF == 0 {
+				state = fromDiag
+			}
+			i--
+			k++
+		}
+	}
+	h.qStart, h.rStart = i, i+d-w+k
+	for a, b := 0, len(ops)-1; a < b; a, b = a+1, b-1 {
+		ops[a], ops[b] = ops[b], ops[a]
+	}
+	for _, o := range ops {
+		if n := len(h.cigar); n > 0 && h.cigar[n-1].Type == o {
+			h.cigar[n-1].Len++
+		} else {
+			h.cigar = append(h.cigar, CigarOp{Type: o, Len: 1})
+		}
+	}
+
+	return h, true
+}
@@ -0,0 +1,345 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mum
+
+import (
+	"code.google.com/p/biogo/align/nw"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/seq"
+	"math"
+	"sort"
+)
+
+// A Clusterer groups matches into colinear clusters in the manner of nucmer.
+type Clusterer struct {
+	MaxGap     int     // Maximum gap between adjacent matches in a cluster.
+	DiagFactor float64 // Maximum diagonal difference of adjacent matches as a fraction of the gap.
+	DiagDiff   int     // Maximum diagonal difference of adjacent matches irrespective of the gap.
+	MinCluster int     // Minimum total length of matches in a cluster.
+}
+
+// Default clustering parameters, following the nucmer defaults.
+var DefaultClusterer = Clusterer{
+	MaxGap:     90,
+	DiagFactor: 0.12,
+	DiagDiff:   5,
+	MinCluster: 65,
+}
+
+// A Cluster is a colinear set of matches between a reference and a query sequence.
+type Cluster struct {
+	Ref, Query int
+	Strand     int8
+	Matches    []Match // Matches in order of position.
+}
+
+// Return the clusters of matches, ordered by reference, query, strand and position. Each match
+// is used in at most one cluster.
+func (self Clusterer) Cluster(matches []Match) []Cluster {
+	m := make([]Match, len(matches))
+	copy(m, matches)
+	sort.Sort(byPosition(m))
+
+	var clusters []Cluster
+	for lo := 0; lo < len(m); {
+		hi := lo + 1
+		for hi < len(m) && m[hi].Ref == m[lo].Ref && m[hi].Query == m[lo].Query && m[hi].Strand == m[lo].Strand {
+			hi++
+		}
+		clusters = append(clusters, self.cluster(m[lo:hi])...)
+		lo = hi
+	}
+	sort.Sort(byStart(clusters))
+
+	return clusters
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// cluster chains matches sharing a reference, query and strand, sorted by reference position.
+func (self Clusterer) cluster(m []Match) (clusters []Cluster) {
+	var longest int
+	for _, a := range m {
+		longest = max(longest, a.Length)
+	}
+	f := make([]int, len(m))
+	p := make([]int, len(m))
+	for i, a := range m {
+		f[i], p[i] = a.Length, -1
+		for j := i - 1; j >= 0 && a.RefPos-m[j].RefPos <= self.MaxGap+longest; j-- {
+			b := m[j]
+			if a.QueryPos <= b.QueryPos || a.RefPos+a.Length <= b.RefPos+b.Length || a.QueryPos+a.Length <= b.QueryPos+b.Length {
+				continue
+			}
+			gap := max(a.RefPos-(b.RefPos+b.Length), a.QueryPos-(b.QueryPos+b.Length))
+			if gap > self.MaxGap {
+				continue
+			}
+			diag := (a.RefPos - a.QueryPos) - (b.RefPos - b.QueryPos)
+			if diag < 0 {
+				diag = -diag
+			}
+			if float64(diag) > math.Max(float64(self.DiagDiff), self.DiagFactor*float64(gap)) {
+				continue
+			}
+			overlap := max(0, max(b.RefPos+b.Length-a.RefPos, b.QueryPos+b.Length-a.QueryPos))
+			if s := f[j] + a.Length - overlap; s > f[i] {
+				f[i], p[i] = s, j
+			}
+		}
+	}
+
+	order := make([]int, len(m))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byScore{order, f})
+	used := make([]bool, len(m))
+	for _, end := range order {
+		if used[end] {
+			continue
+		}
+		var idx []int
+		score := f[end]
+		i := end
+		for ; i >= 0 && !used[i]; i = p[i] {
+			idx = append(idx, i)
+			used[i] = true
+		}
+		if i >= 0 {
+			score -= f[i]
+		}
+		if score < self.MinCluster {
+			continue
+		}
+		c := Cluster{Ref: m[end].Ref, Query: m[end].Query, Strand: m[end].Strand, Matches: make([]Match, len(idx))}
+		for j, k := range idx {
+			c.Matches[len(idx)-1-j] = m[k]
+		}
+		clusters = append(clusters, c)
+	}
+
+	return
+}
+
+type byScore struct {
+	idx []int
+	v   []int
+}
+
+func (self byScore) Len() int           { return len(self.idx) }
+func (self byScore) Less(i, j int) bool { return self.v[self.idx[i]] > self.v[self.idx[j]] }
+func (self byScore) Swap(i, j int)      { self.idx[i], self.idx[j] = self.idx[j], self.idx[i] }
+
+type byStart []Cluster
+
+func (self byStart) Len() int { return len(self) }
+func (self byStart) Less(i, j int) bool {
+	a, b := self[i].Matches[0], self[j].Matches[0]
+	if a.Ref != b.Ref || a.Query != b.Query || a.Strand != b.Strand {
+		return byPosition{a, b}.Less(0, 1)
+	}
+	return a.RefPos < b.RefPos
+}
+func (self byStart) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+// An Alignment is a gapped alignment between a reference and a query sequence. Coordinates are
+// zero-based half-open on the forward strands. Deltas follow the nucmer delta encoding: each value
+// is the distance from the previous indel to the next, positive for a base present only in the
+// reference and negative for a base present only in the query, counted along the matched strand
+// of the query.
+type Alignment struct {
+	RefName, QueryName   string
+	RefLen, QueryLen     int
+	RefStart, RefEnd     int
+	QueryStart, QueryEnd int
+	Strand               int8
+	Errors               int // Number of mismatched and unaligned bases.
+	Deltas               []int
+}
+
+// Return the number of alignment columns.
+func (self *Alignment) Len() int {
+	n := self.RefEnd - self.RefStart
+	for _, d := range self.Deltas {
+		if d < 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Return the fractional identity of the alignment.
+func (self *Alignment) Identity() float64 {
+	n := self.Len()
+	if n == 0 {
+		return 0
+	}
+	return float64(n-self.Errors) / float64(n)
+}
+
+// GapAligner is used to align the sequence between adjacent matches of a cluster.
+var GapAligner = &nw.Aligner{
+	Matrix: [][]int{
+		{2, -3, -3, -3, -4},
+		{-3, 2, -3, -3, -4},
+		{-3, -3, 2, -3, -4},
+		{-3, -3, -3, 2, -4},
+		{-4, -4, -4, -4, 0},
+	},
+	LookUp:  nw.LookUpN,
+	GapChar: '-',
+}
+
+// matchable replaces bases that cannot be aligned by GapAligner so that gap alignment is
+// always possible. Such bases are scored as mismatches when the alignment is evaluated.
+func matchable(s []byte) []byte {
+	c := make([]byte, len(s))
+	for i, b := range s {
+		if baseCode[b] >= codeOther {
+			b = 'A'
+		}
+		c[i] = b
+	}
+	return c
+}
+
+// Return the alignment of the reference and query sequences covered by cluster c, filling the
+// gaps between matches with GapAligner. Overlapping matches are trimmed.
+func Align(c Cluster, refs, queries []*seq.Seq) (*Alignment, error) {
+	if len(c.Matches) == 0 {
+		return nil, bio.NewError("mum: empty cluster", 0, c)
+	}
+	if c.Ref < 0 || c.Ref >= len(refs) || c.Query < 0 || c.Query >= len(queries) {
+		return nil, bio.NewError("mum: cluster sequence out of range", 0, c)
+	}
+	ref, query := refs[c.Ref], queries[c.Query]
+	q := query.Seq
+	if c.Strand < 0 {
+		rc, err := query.RevComp()
+		if err != nil {
+			return nil, err
+		}
+		q = rc.Seq
+	}
+
+	first := c.Matches[0]
+	a := &Alignment{
+		RefName:   ref.ID,
+		QueryName: query.ID,
+		RefLen:    ref.Len(),
+		QueryLen:  query.Len(),
+		RefStart:  first.RefPos,
+		Strand:    c.Strand,
+	}
+	var (
+		since      int
+		rEnd, qEnd = first.RefPos, first.QueryPos
+	)
+	for i, m := range c.Matches {
+		shift := max(0, max(rEnd-m.RefPos, qEnd-m.QueryPos))
+		if shift >= m.Length {
+			continue
+		}
+		rs, qs := m.RefPos+shift, m.QueryPos+shift
+		if i > 0 {
+			rg, qg := ref.Seq[rEnd:rs], q[qEnd:qs]
+			switch {
+			case len(rg) == 0 && len(qg) == 0:
+			case len(rg) == 0 || len(qg) == 0:
+				for range rg {
+					since++
+					a.Deltas = append(a.Deltas, since)
+					since = 0
+				}
+				for range qg {
+					since++
+					a.Deltas = append(a.Deltas, -since)
+					since = 0
+				}
+				a.Errors += len(rg) + len(qg)
+			default:
+				aln, err := GapAligner.Align(seq.New("", matchable(rg), nil), seq.New("", matchable(qg), nil))
+				if err != nil {
+					return nil, err
+				}
+				ri, qi := 0, 0
+				for k, rb := range aln[0].Seq {
+					qb := aln[1].Seq[k]
+					since++
+					switch {
+					case qb == GapAligner.GapChar:
+						a.Deltas = append(a.Deltas, since)
+						since = 0
+						a.Errors++
+						ri++
+					case rb == GapAligner.GapChar:
+						a.Deltas = append(a.Deltas, -since)
+						since = 0
+						a.Errors++
+						qi++
+					default:
+						if !same(rg[ri], qg[qi]) {
+							a.Errors++
+						}
+						ri++
+						qi++
+					}
+				}
+			}
+		}
+		l := m.Length - shift
+		since += l
+		rEnd, qEnd = rs+l, qs+l
+	}
+	a.RefEnd = rEnd
+	if c.Strand < 0 {
+		a.QueryStart, a.QueryEnd = len(q)-qEnd, len(q)-first.QueryPos
+	} else {
+		a.QueryStart, a.QueryEnd = first.QueryPos, qEnd
+	}
+
+	return a, nil
+}
+
+// same returns whether two bases match.
+func same(a, b byte) bool {
+	ca := baseCode[a]
+	return ca < codeOther && ca == baseCode[b]
+}
+
+// Return the alignments of the clusters of matches between refs and queries found with Find
+// in MUM mode on both strands and grouped by DefaultClusterer.
+func Compare(refs, queries []*seq.Seq, minLen int) ([]*Alignment, error) {
+	m, err := Find(refs, queries, minLen, MUM, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	var alns []*Alignment
+	for _, c := range DefaultClusterer.Cluster(m) {
+		a, err := Align(c, refs, queries)
+		if err != nil {
+			return nil, err
+		}
+		alns = append(alns, a)
+	}
+	return alns, nil
+}
@@ -0,0 +1,320 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mum finds maximal unique and maximal exact matches between two sets of nucleic acid
+// sequences and builds MUMmer-style whole genome alignments from them, as described in:
+//  Versatile and open software for comparing large genomes.
+//   S. Kurtz, A. Phillippy, A. L. Delcher, et al. Genome Biology 5:R12 (2004).
+//  Replacing suffix trees with enhanced suffix arrays.
+//   M. I. Abouelhoda, S. Kurtz and E. Ohlebusch. J. Discrete Algorithms 2:53-86 (2004).
+//
+// Matches are found using a generalised suffix array of the reference and query sequences.
+// Bases other than A, C, G and T never match.
+package mum
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/index/fmindex"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Match modes.
+const (
+	MUM = iota // Matches unique in both the reference and query sets.
+	MEM        // All maximal exact matches.
+)
+
+// Default minimum match length.
+var DefaultMinLength = 20
+
+// A Match is an exact match between a reference and a query sequence.
+type Match struct {
+	Ref      int  // Index of the reference sequence.
+	Query    int  // Index of the query sequence.
+	RefPos   int  // Start of the match on the reference.
+	QueryPos int  // Start of the match on the matched strand of the query.
+	Length   int  // Length of the match.
+	Strand   int8 // Strand of the query; for -1 QueryPos is in reverse complement coordinates.
+}
+
+// Symbol codes used in the generalised text.
+const (
+	codeEnd   = 0
+	codeOther = 5 // Bases that never match.
+	codeSep   = 6
+	codeCount = 7
+)
+
+var baseCode = func() (t [256]int32) {
+	for i := range t {
+		t[i] = codeOther
+	}
+	for i, b := range "ACGT" {
+		t[b], t[b+'a'-'A'] = int32(i+1), int32(i+1)
+	}
+	return
+}()
+
+// text is a generalised text of reference and query sequences.
+type text struct {
+	t      []int32
+	starts []int // Text start of each sequence.
+	nRef   int
+}
+
+func newText(refs, queries []*seq.Seq) *text {
+	var n int
+	for _, s := range refs {
+		n += s.Len() + 1
+	}
+	for _, s := range queries {
+		n += s.Len() + 1
+	}
+	self := &text{t: make([]int32, 0, n+1), nRef: len(refs)}
+	for _, set := range [][]*seq.Seq{refs, queries} {
+		for _, s := range set {
+			self.starts = append(self.starts, len(self.t))
+			for _, b := range s.Seq {
+				self.t = append(self.t, baseCode[b])
+			}
+			self.t = append(self.t, codeSep)
+		}
+	}
+	self.t = append(self.t, codeEnd)
+	return self
+}
+
+// locate returns the sequence index and offset of text position p, and whether the sequence
+// is a reference.
+func (self *text) locate(p int) (index, offset int, ref bool) {
+	i := sort.SearchInts(self.starts, p+1) - 1
+	if i < self.nRef {
+		return i, p - self.starts[i], true
+	}
+	return i - self.nRef, p - self.starts[i], false
+}
+
+// left returns the code of the base preceding text position p, or 0 if that base cannot match.
+func (self *text) left(p int) int32 {
+	if p == 0 || self.t[p-1] >= codeOther {
+		return 0
+	}
+	return self.t[p-1]
+}
+
+// lcp returns the longest common prefix array of the suffix array sa where lcp[i] is the length
+// of the matching prefix of the suffixes at sa[i-1] and sa[i], computed as described in:
+//  Linear-time longest-common-prefix computation in suffix arrays and its applications.
+//   T. Kasai, G. Lee, H. Arimura, et al. Proc. 12th Symp. Combinatorial Pattern Matching 181-192 (2001).
+func (self *text) lcp(sa []int32) []int32 {
+	t := self.t
+	rank := make([]int32, len(sa))
+	for i, p := range sa {
+		rank[p] = int32(i)
+	}
+	lcp := make([]int32, len(sa)+1)
+	h := 0
+	for p := range t {
+		r := rank[p]
+		if r == 0 {
+			h = 0
+			continue
+		}
+		q := int(sa[r-1])
+		for p+h < len(t) && q+h < len(t) && t[p+h] == t[q+h] && t[p+h] < codeOther && t[p+h] != codeEnd {
+			h++
+		}
+		lcp[r] = int32(h)
+		if h > 0 {
+			h--
+		}
+	}
+	return lcp
+}
+
+// Return the matches of at least minLen bases between the reference and query sequences on
+// the given query strands, ordered by reference, query, strand and positions. For the MUM mode,
+// matches are unique in both the reference set and the query set.
+func Find(refs, queries []*seq.Seq, minLen, mode int, strands ...int8) ([]Match, error) {
+	switch {
+	case minLen < 1:
+		return nil, bio.NewError(fmt.Sprintf("mum: illegal minimum length: %d", minLen), 0, minLen)
+	case mode != MUM && mode != MEM:
+		return nil, bio.NewError(fmt.Sprintf("mum: unknown mode: %d", mode), 0, mode)
+	case len(strands) == 0:
+		strands = []int8{1}
+	}
+
+	var m []Match
+	for _, strand := range strands {
+		q := queries
+		switch strand {
+		case 1:
+		case -1:
+			q = make([]*seq.Seq, len(queries))
+			for i, s := range queries {
+				var err error
+				if q[i], err = s.RevComp(); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, bio.NewError(fmt.Sprintf("mum: illegal strand: %d", strand), 0, strand)
+		}
+		t := newText(refs, q)
+		if int64(len(t.t)) > math.MaxInt32 {
+			return nil, bio.NewError("mum: sequences too long", 0)
+		}
+		sa := fmindex.SuffixArray(t.t, codeCount)
+		lcp := t.lcp(sa)
+		emit := func(p, q, l int) {
+			ri, ro, _ := t.locate(p)
+			qi, qo, _ := t.locate(q)
+			m = append(m, Match{Ref: ri, Query: qi, RefPos: ro, QueryPos: qo, Length: l, Strand: strand})
+		}
+		if mode == MUM {
+			t.mums(sa, lcp, minLen, emit)
+		} else {
+			t.mems(sa, lcp, minLen, emit)
+		}
+	}
+	sort.Sort(byPosition(m))
+
+	return m, nil
+}
+
+// mums calls emit with the reference and query text positions and length of each maximal
+// unique match.
+func (self *text) mums(sa, lcp []int32, minLen int, emit func(r, q, l int)) {
+	for i := 1; i < len(sa); i++ {
+		l := lcp[i]
+		if int(l) < minLen || lcp[i-1] >= l || lcp[i+1] >= l {
+			continue
+		}
+		a, b := int(sa[i-1]), int(sa[i])
+		_, _, ra := self.locate(a)
+		_, _, rb := self.locate(b)
+		if ra == rb {
+			continue
+		}
+		if la, lb := self.left(a), self.left(b); la != 0 && la == lb {
+			continue
+		}
+		if !ra {
+			a, b = b, a
+		}
+		emit(a, b, int(l))
+	}
+}
+
+// node is an lcp-interval holding suffix positions partitioned by sequence set and left base.
+type node struct {
+	lcp int
+	pos [2][codeOther][]int32
+}
+
+// add merges the positions of c into the node, first calling emit for each pair of
+// reference and query positions with differing left bases if the node is deep enough.
+func (self *node) add(c *node, minLen int, emit func(r, q, l int)) {
+	if self.lcp < minLen {
+		return
+	}
+	for a := range c.pos[0] {
+		for b := range self.pos[1] {
+			if a == b && a != 0 {
+				continue
+			}
+			for _, r := range c.pos[0][a] {
+				for _, q := range self.pos[1][b] {
+					emit(int(r), int(q), self.lcp)
+				}
+			}
+			for _, r := range self.pos[0][b] {
+				for _, q := range c.pos[1][a] {
+					emit(int(r), int(q), self.lcp)
+				}
+			}
+		}
+	}
+	for s := range c.pos {
+		for a := range c.pos[s] {
+			if len(c.pos[s][a]) > len(self.pos[s][a]) {
+				self.pos[s][a], c.pos[s][a] = c.pos[s][a], self.pos[s][a]
+			}
+			self.pos[s][a] = append(self.pos[s][a], c.pos[s][a]...)
+		}
+	}
+}
+
+// mems calls emit with the reference and query text positions and length of each maximal
+// exact match by a bottom-up traversal of the lcp-interval tree.
+func (self *text) mems(sa, lcp []int32, minLen int, emit func(r, q, l int)) {
+	stack := []*node{{}}
+	for i, p := range sa {
+		leaf := &node{lcp: math.MaxInt32}
+		if _, _, ref := self.locate(int(p)); self.t[p] < codeOther {
+			set := 1
+			if ref {
+				set = 0
+			}
+			leaf.pos[set][self.left(int(p))] = []int32{p}
+		}
+		l := 0
+		if i+1 < len(sa) {
+			l = int(lcp[i+1])
+		}
+		if top := stack[len(stack)-1]; l > top.lcp {
+			n := &node{lcp: l}
+			n.add(leaf, minLen, emit)
+			stack = append(stack, n)
+			continue
+		} else {
+			top.add(leaf, minLen, emit)
+		}
+		for l < stack[len(stack)-1].lcp {
+			done := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top := stack[len(stack)-1]; top.lcp >= l {
+				top.add(done, minLen, emit)
+			} else {
+				n := &node{lcp: l}
+				n.add(done, minLen, emit)
+				stack = append(stack, n)
+			}
+		}
+	}
+}
+
+type byPosition []Match
+
+func (self byPosition) Len() int { return len(self) }
+func (self byPosition) Less(i, j int) bool {
+	a, b := self[i], self[j]
+	switch {
+	case a.Ref != b.Ref:
+		return a.Ref < b.Ref
+	case a.Query != b.Query:
+		return a.Query < b.Query
+	case a.Strand != b.Strand:
+		return a.Strand > b.Strand
+	case a.RefPos != b.RefPos:
+		return a.RefPos < b.RefPos
+	}
+	return a.QueryPos < b.QueryPos
+}
+func (self byPosition) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
@@ -0,0 +1,243 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mum
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/seq"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func random(n int, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rnd.Intn(4)]
+	}
+	return s
+}
+
+var comp = map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A', 'N': 'N'}
+
+func revComp(s []byte) []byte {
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = comp[b]
+	}
+	return r
+}
+
+func count(set []*seq.Seq, p []byte) (n int) {
+	for _, s := range set {
+		for i := 0; i+len(p) <= len(s.Seq); i++ {
+			if bytes.Equal(s.Seq[i:i+len(p)], p) {
+				n++
+			}
+		}
+	}
+	return
+}
+
+func naive(refs, queries []*seq.Seq, minLen, mode int) (m []Match) {
+	for ri, r := range refs {
+		for qi, q := range queries {
+			for i := range r.Seq {
+				for j := range q.Seq {
+					if i > 0 && j > 0 && same(r.Seq[i-1], q.Seq[j-1]) {
+						continue
+					}
+					l := 0
+					for i+l < len(r.Seq) && j+l < len(q.Seq) && same(r.Seq[i+l], q.Seq[j+l]) {
+						l++
+					}
+					if l < minLen {
+						continue
+					}
+					if mode == MUM && (count(refs, r.Seq[i:i+l]) != 1 || count(queries, r.Seq[i:i+l]) != 1) {
+						continue
+					}
+					m = append(m, Match{Ref: ri, Query: qi, RefPos: i, QueryPos: j, Length: l, Strand: 1})
+				}
+			}
+		}
+	}
+	sort.Sort(byPosition(m))
+	return
+}
+
+// mutant returns a copy of s with substitutions at sub, a deletion of del bases at delAt, an
+// insertion of ins at insAt and the reverse complement of s[inv[0]:inv[1]].
+func mutant(s []byte, sub []int, delAt, del, insAt int, ins string, inv [2]int) []byte {
+	m := append([]byte(nil), s...)
+	for _, p := range sub {
+		m[p] = "ACGT"[(strings.IndexByte("ACGT", m[p])+1)%4]
+	}
+	copy(m[inv[0]:inv[1]], revComp(s[inv[0]:inv[1]]))
+	m = append(m[:insAt], append([]byte(ins), m[insAt:]...)...)
+	return append(m[:delAt], m[delAt+del:]...)
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestFind(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	shared := random(60, rnd)
+	refs := []*seq.Seq{
+		seq.New("r1", append(append(random(100, rnd), shared...), random(50, rnd)...), nil),
+		seq.New("r2", append(append(random(40, rnd), shared[:30]...), 'N'), nil),
+	}
+	queries := []*seq.Seq{
+		seq.New("q1", append(append(random(30, rnd), shared...), random(80, rnd)...), nil),
+		seq.New("q2", append(append(random(70, rnd), shared[20:]...), []byte("NNNN")...), nil),
+	}
+	for _, mode := range []int{MUM, MEM} {
+		for _, minLen := range []int{5, 12} {
+			m, err := Find(refs, queries, minLen, mode)
+			c.Assert(err, check.Equals, nil)
+			c.Check(m, check.DeepEquals, naive(refs, queries, minLen, mode), check.Commentf("mode %d min %d", mode, minLen))
+		}
+	}
+
+	// Reverse strand matches are reported in reverse complement query coordinates.
+	rq := []*seq.Seq{seq.New("q", revComp(queries[0].Seq), nil)}
+	m, err := Find(refs[:1], rq, 20, MUM, -1)
+	c.Assert(err, check.Equals, nil)
+	c.Check(m, check.DeepEquals, []Match{{Ref: 0, Query: 0, RefPos: 100, QueryPos: 30, Length: 60, Strand: -1}})
+
+	_, err = Find(refs, queries, 0, MUM)
+	c.Check(err, check.NotNil)
+	_, err = Find(refs, queries, 10, MUM, 2)
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestCompare(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	r := random(20000, rnd)
+	sub := []int{1000, 3000, 3500, 9000}
+	q := mutant(r, sub, 5000, 1, 7000, "GA", [2]int{12000, 14000})
+	refs := []*seq.Seq{seq.New("ref", r, nil)}
+	queries := []*seq.Seq{seq.New("qry", q, nil)}
+
+	alns, err := Compare(refs, queries, DefaultMinLength)
+	c.Assert(err, check.Equals, nil)
+	c.Assert(len(alns), check.Equals, 3)
+
+	// Forward alignments either side of the inversion precede the reverse alignment.
+	a := alns[0]
+	c.Check(a.Strand, check.Equals, int8(1))
+	c.Check(a.RefStart < 50, check.Equals, true)
+	c.Check(a.RefEnd > 11950 && a.RefEnd < 12010, check.Equals, true)
+	c.Check(a.RefEnd-a.RefStart-(a.QueryEnd-a.QueryStart), check.Equals, 1-2)
+	c.Check(a.Errors, check.Equals, 4+1+2)
+	snps, err := SNPs(a, refs[0], queries[0])
+	c.Assert(err, check.Equals, nil)
+	var subs, indels int
+	for _, s := range snps {
+		if s.RefBase == '.' || s.QueryBase == '.' {
+			indels++
+			continue
+		}
+		subs++
+		c.Check(r[s.RefPos], check.Equals, s.RefBase)
+		c.Check(q[s.QueryPos], check.Equals, s.QueryBase)
+	}
+	c.Check(subs, check.Equals, 4)
+	c.Check(indels, check.Equals, 3)
+	c.Check(snps[0].RefPos, check.Equals, 1000)
+	c.Check(snps[0].QueryPos, check.Equals, 1000)
+
+	c.Check(alns[1].Strand, check.Equals, int8(1))
+	c.Check(alns[1].RefStart > 13990 && alns[1].RefStart < 14050, check.Equals, true)
+	c.Check(alns[1].Errors, check.Equals, 0)
+	c.Check(alns[1].RefEnd, check.Equals, 20000)
+	c.Check(alns[1].QueryEnd, check.Equals, len(q))
+
+	// The inverted segment lies one base downstream in the query, after the 2 base insertion
+	// and 1 base deletion.
+	inv := alns[2]
+	c.Check(inv.Strand, check.Equals, int8(-1))
+	c.Check(inv.RefStart >= 12000 && inv.RefStart < 12050, check.Equals, true)
+	c.Check(inv.RefEnd > 13950 && inv.RefEnd <= 14000, check.Equals, true)
+	c.Check(inv.QueryStart, check.Equals, 12001+14000-inv.RefEnd)
+	c.Check(inv.QueryEnd, check.Equals, 12001+14000-inv.RefStart)
+	c.Check(inv.Errors, check.Equals, 0)
+	c.Check(inv.Identity(), check.Equals, 1.)
+
+	var b bytes.Buffer
+	_, err = WriteCoords(&b, alns)
+	c.Check(err, check.Equals, nil)
+	lines := strings.Split(b.String(), "\n")
+	c.Check(lines[0], check.Equals, "[S1]\t[E1]\t[S2]\t[E2]\t[LEN 1]\t[LEN 2]\t[% IDY]\t[TAGS]")
+	f := strings.Split(lines[3], "\t")
+	c.Check(f[8], check.Equals, "qry")
+	c.Check(f[2], check.Equals, strconv.Itoa(inv.QueryEnd))
+	c.Check(f[3], check.Equals, strconv.Itoa(inv.QueryStart+1))
+
+	b.Reset()
+	_, err = WriteSNPs(&b, snps[:1])
+	c.Check(err, check.Equals, nil)
+	c.Check(b.String(), check.Equals, "[P1]\t[SUB]\t[SUB]\t[P2]\t[TAGS]\n"+
+		"1001\t"+string(r[1000])+"\t"+string(q[1000])+"\t1001\tref\tqry\n")
+}
+
+func (s *S) TestDelta(c *check.C) {
+	rnd := rand.New(rand.NewSource(2))
+	r := random(5000, rnd)
+	q := mutant(r, []int{100}, 1500, 3, 2500, "T", [2]int{3000, 4000})
+	refs := []*seq.Seq{seq.New("ref", r, nil)}
+	queries := []*seq.Seq{seq.New("qry", q, nil)}
+	alns, err := Compare(refs, queries, DefaultMinLength)
+	c.Assert(err, check.Equals, nil)
+	c.Assert(len(alns) > 0, check.Equals, true)
+
+	d := &Delta{RefPath: "/ref.fa", QueryPath: "/qry.fa", Alignments: alns}
+	var b bytes.Buffer
+	n, err := d.WriteTo(&b)
+	c.Check(err, check.Equals, nil)
+	c.Check(n, check.Equals, int64(b.Len()))
+	c.Check(strings.HasPrefix(b.String(), "/ref.fa /qry.fa\nNUCMER\n>ref qry 5000 4998\n"), check.Equals, true)
+
+	got, err := ReadDelta(&b)
+	c.Assert(err, check.Equals, nil)
+	d.Program = "NUCMER"
+	c.Check(got, check.DeepEquals, d)
+	for _, a := range got.Alignments {
+		snps, err := SNPs(a, refs[0], queries[0])
+		c.Check(err, check.Equals, nil)
+		c.Check(len(snps), check.Equals, a.Errors)
+	}
+
+	for _, bad := range []string{
+		"",
+		"/ref.fa\nNUCMER\n",
+		"a b\nNUCMER\n1 2 3 4 0 0 0\n0\n",
+		"a b\nNUCMER\n>r q 10 10\n1 10 1 10 0 0 0\n",
+		"a b\nNUCMER\n>r q 10 10\n1 10 1 10 0 0 0\nx\n0\n",
+	} {
+		_, err = ReadDelta(strings.NewReader(bad))
+		c.Check(err, check.NotNil, check.Commentf("%q", bad))
+	}
+}
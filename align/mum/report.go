@@ -0,0 +1,319 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mum
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// walk calls f for each column of the alignment a of ref and q, the query sequence on the
+// aligned strand. Positions are on the reference and the aligned query strand and gaps are
+// reported as a position of -1 and a base of '.'.
+func walk(a *Alignment, ref, q []byte, f func(rpos, qpos int, rb, qb byte)) error {
+	qs := a.QueryStart
+	if a.Strand < 0 {
+		qs = a.QueryLen - a.QueryEnd
+	}
+	if a.RefEnd > len(ref) || a.QueryEnd > len(q) || a.RefStart < 0 || a.QueryStart < 0 {
+		return bio.NewError("mum: alignment out of sequence range", 0, a)
+	}
+	r := a.RefStart
+	match := func(n int) error {
+		if r+n > a.RefEnd || qs+n > len(q) {
+			return bio.NewError("mum: deltas inconsistent with alignment", 0, a)
+		}
+		for ; n > 0; n-- {
+			f(r, qs, ref[r], q[qs])
+			r++
+			qs++
+		}
+		return nil
+	}
+	for _, d := range a.Deltas {
+		n := d
+		if n < 0 {
+			n = -n
+		}
+		if err := match(n - 1); err != nil {
+			return err
+		}
+		if d > 0 {
+			if r >= a.RefEnd {
+				return bio.NewError("mum: deltas inconsistent with alignment", 0, a)
+			}
+			f(r, -1, ref[r], '.')
+			r++
+		} else {
+			f(-1, qs, '.', q[qs])
+			qs++
+		}
+	}
+	return match(a.RefEnd - r)
+}
+
+// A SNP is a single base difference between a reference and a query sequence. Positions are
+// zero-based on the forward strands. For indels the position on the sequence with the gap is
+// that of the preceding aligned base.
+type SNP struct {
+	Ref, Query         string
+	RefPos, QueryPos   int
+	RefBase, QueryBase byte // Bases, with '.' indicating a gap; QueryBase is given on the reference strand.
+	Strand             int8
+}
+
+// Return the substitutions and single base indels of the alignment a between ref and query.
+func SNPs(a *Alignment, ref, query *seq.Seq) (snps []SNP, err error) {
+	q := query.Seq
+	if a.Strand < 0 {
+		rc, err := query.RevComp()
+		if err != nil {
+			return nil, err
+		}
+		q = rc.Seq
+	}
+	lastR, lastQ := a.RefStart-1, -1
+	if a.Strand < 0 {
+		lastQ = a.QueryLen - a.QueryEnd - 1
+	} else {
+		lastQ = a.QueryStart - 1
+	}
+	err = walk(a, ref.Seq, q, func(r, qp int, rb, qb byte) {
+		if r >= 0 {
+			lastR = r
+		}
+		if qp >= 0 {
+			lastQ = qp
+		}
+		if r >= 0 && qp >= 0 && same(rb, qb) {
+			return
+		}
+		p := lastQ
+		if a.Strand < 0 {
+			p = len(q) - 1 - lastQ
+			if qp < 0 {
+				p--
+			}
+		}
+		snps = append(snps, SNP{
+			Ref:       a.RefName,
+			Query:     a.QueryName,
+			RefPos:    lastR,
+			QueryPos:  p,
+			RefBase:   rb,
+			QueryBase: qb,
+			Strand:    a.Strand,
+		})
+	})
+	return
+}
+
+// Write a tab-delimited report of alignment coordinates in the style of show-coords -T.
+// Coordinates are one-based and inclusive, and reverse strand alignments are reported with
+// the query start greater than the query end.
+func WriteCoords(w io.Writer, alns []*Alignment) (n int, err error) {
+	c, err := fmt.Fprintln(w, "[S1]\t[E1]\t[S2]\t[E2]\t[LEN 1]\t[LEN 2]\t[% IDY]\t[TAGS]")
+	n += c
+	if err != nil {
+		return
+	}
+	for _, a := range alns {
+		s2, e2 := queryCoords(a)
+		c, err = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%s\t%s\n",
+			a.RefStart+1, a.RefEnd, s2, e2, a.RefEnd-a.RefStart, a.QueryEnd-a.QueryStart,
+			a.Identity()*100, a.RefName, a.QueryName)
+		n += c
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Write a tab-delimited report of SNPs in the style of show-snps -T. Positions are one-based.
+func WriteSNPs(w io.Writer, snps []SNP) (n int, err error) {
+	c, err := fmt.Fprintln(w, "[P1]\t[SUB]\t[SUB]\t[P2]\t[TAGS]")
+	n += c
+	if err != nil {
+		return
+	}
+	for _, s := range snps {
+		c, err = fmt.Fprintf(w, "%d\t%c\t%c\t%d\t%s\t%s\n", s.RefPos+1, s.RefBase, s.QueryBase, s.QueryPos+1, s.Ref, s.Query)
+		n += c
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func queryCoords(a *Alignment) (s, e int) {
+	if a.Strand < 0 {
+		return a.QueryEnd, a.QueryStart + 1
+	}
+	return a.QueryStart + 1, a.QueryEnd
+}
+
+// A Delta is the content of a nucmer-style delta file.
+type Delta struct {
+	RefPath, QueryPath string
+	Program            string
+	Alignments         []*Alignment
+}
+
+// Write the Delta to w.
+func (self *Delta) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	p := func(format string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		var c int
+		c, err = fmt.Fprintf(bw, format, args...)
+		n += int64(c)
+	}
+	prog := self.Program
+	if prog == "" {
+		prog = "NUCMER"
+	}
+	p("%s %s\n%s\n", self.RefPath, self.QueryPath, prog)
+	var last *Alignment
+	for _, a := range self.Alignments {
+		if last == nil || a.RefName != last.RefName || a.QueryName != last.QueryName {
+			p(">%s %s %d %d\n", a.RefName, a.QueryName, a.RefLen, a.QueryLen)
+		}
+		s2, e2 := queryCoords(a)
+		p("%d %d %d %d %d %d 0\n", a.RefStart+1, a.RefEnd, s2, e2, a.Errors, a.Errors)
+		for _, d := range a.Deltas {
+			p("%d\n", d)
+		}
+		p("0\n")
+		last = a
+	}
+	if err != nil {
+		return
+	}
+	return n, bw.Flush()
+}
+
+// Read a Delta from r.
+func ReadDelta(r io.Reader) (*Delta, error) {
+	sc := bufio.NewReader(r)
+	var line int
+	next := func() (string, error) {
+		l, err := sc.ReadString('\n')
+		if err == io.EOF && len(l) > 0 {
+			err = nil
+		}
+		line++
+		return strings.TrimSpace(l), err
+	}
+	fail := func(msg string) error {
+		return bio.NewError(fmt.Sprintf("mum: %s at line %d", msg, line), 0, line)
+	}
+
+	l, err := next()
+	if err != nil {
+		return nil, fail("missing delta header")
+	}
+	paths := strings.Fields(l)
+	if len(paths) != 2 {
+		return nil, fail("malformed delta header")
+	}
+	prog, err := next()
+	if err != nil {
+		return nil, fail("missing delta program")
+	}
+	d := &Delta{RefPath: paths[0], QueryPath: paths[1], Program: prog}
+
+	var (
+		rName, qName string
+		rLen, qLen   int
+		pair         bool
+	)
+	for {
+		l, err = next()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if l == "" {
+			continue
+		}
+		f := strings.Fields(l)
+		if l[0] == '>' {
+			if len(f) != 4 {
+				return nil, fail("malformed sequence header")
+			}
+			rName, qName = f[0][1:], f[1]
+			if rLen, err = strconv.Atoi(f[2]); err != nil {
+				return nil, fail("malformed sequence header")
+			}
+			if qLen, err = strconv.Atoi(f[3]); err != nil {
+				return nil, fail("malformed sequence header")
+			}
+			pair = true
+			continue
+		}
+		if !pair || len(f) != 7 {
+			return nil, fail("malformed alignment header")
+		}
+		var v [7]int
+		for i, s := range f {
+			if v[i], err = strconv.Atoi(s); err != nil {
+				return nil, fail("malformed alignment header")
+			}
+		}
+		a := &Alignment{
+			RefName:   rName,
+			QueryName: qName,
+			RefLen:    rLen,
+			QueryLen:  qLen,
+			RefStart:  v[0] - 1,
+			RefEnd:    v[1],
+			Errors:    v[4],
+			Strand:    1,
+		}
+		if v[2] > v[3] {
+			a.Strand = -1
+			a.QueryStart, a.QueryEnd = v[3]-1, v[2]
+		} else {
+			a.QueryStart, a.QueryEnd = v[2]-1, v[3]
+		}
+		for {
+			l, err = next()
+			if err != nil {
+				return nil, fail("truncated alignment")
+			}
+			x, err := strconv.Atoi(l)
+			if err != nil {
+				return nil, fail("malformed delta")
+			}
+			if x == 0 {
+				break
+			}
+			a.Deltas = append(a.Deltas, x)
+		}
+		d.Alignments = append(d.Alignments, a)
+	}
+}
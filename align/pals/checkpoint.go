@@ -0,0 +1,222 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"code.google.com/p/biogo/align/pals/dp"
+	"code.google.com/p/biogo/align/pals/filter"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/morass"
+	"code.google.com/p/biogo/seq"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A manifest identifies the sequences and parameters of a run so that a checkpoint is only
+// resumed by an equivalent run.
+type manifest struct {
+	Target, Query       string
+	TargetLen, QueryLen int
+	TargetSum, QuerySum uint32
+	SelfCompare         bool
+	FilterParams        filter.Params
+	DPParams            dp.Params
+	FilterChunk         int
+	MaxIGap             int
+	DiffCost            int
+	SameCost            int
+	MatchCost           int
+	BlockCost           int
+	RMatchCost          float64
+}
+
+func (p *PALS) manifest() manifest {
+	return manifest{
+		Target:       p.target.ID,
+		Query:        p.query.ID,
+		TargetLen:    p.target.Len(),
+		QueryLen:     p.query.Len(),
+		TargetSum:    crc32.ChecksumIEEE(p.target.Seq),
+		QuerySum:     crc32.ChecksumIEEE(p.query.Seq),
+		SelfCompare:  p.selfCompare,
+		FilterParams: *p.FilterParams,
+		DPParams:     *p.DPParams,
+		FilterChunk:  FilterChunk,
+		MaxIGap:      p.MaxIGap,
+		DiffCost:     p.DiffCost,
+		SameCost:     p.SameCost,
+		MatchCost:    p.MatchCost,
+		BlockCost:    p.BlockCost,
+		RMatchCost:   p.RMatchCost,
+	}
+}
+
+// Checkpoint causes the filter hits of each query chunk, and the merged trapezoids and aligned
+// hits of each strand to be saved in dir as they are completed, and allows a later equivalent
+// run to resume from the phases already saved there. Checkpoint must be called after the filter
+// and alignment parameters have been set by Optimise or Share. An error is returned if dir holds
+// a checkpoint from a run with different sequences or parameters. The directory is not removed
+// by CleanUp and may be removed once the run has completed.
+func (p *PALS) Checkpoint(dir string) error {
+	if p.FilterParams == nil || p.DPParams == nil {
+		return bio.NewError("pals: checkpoint requires optimised parameters", 0)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	c := &checkpoint{dir: dir}
+	m := p.manifest()
+	var saved manifest
+	ok, err := c.load("manifest", &saved)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if saved != m {
+			return bio.NewError("pals: checkpoint does not match run", 0, dir)
+		}
+		p.notifyf("Resuming from checkpoint in %s", dir)
+	} else if err = c.save("manifest", m); err != nil {
+		return err
+	}
+	p.checkpoint = c
+
+	return nil
+}
+
+// A checkpoint saves and loads the results of completed phases of a run. The methods of a nil
+// checkpoint do nothing, loading nothing.
+type checkpoint struct {
+	dir string
+}
+
+func strandName(complement bool) string {
+	if complement {
+		return "reverse"
+	}
+	return "forward"
+}
+
+func (c *checkpoint) path(name string) string { return filepath.Join(c.dir, name+".gob") }
+
+// load decodes the saved value name into v, returning false if no value has been saved.
+func (c *checkpoint) load(name string, v interface{}) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	f, err := os.Open(c.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	if err = gob.NewDecoder(f).Decode(v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// save encodes v as name. The value is written to a temporary file which is renamed once
+// complete, so an interrupted save does not leave a partial value.
+func (c *checkpoint) save(name string, v interface{}) error {
+	if c == nil {
+		return nil
+	}
+	f, err := ioutil.TempFile(c.dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// clearSegments removes the saved filter hits of the segments of a strand.
+func (c *checkpoint) clearSegments(complement bool) error {
+	if c == nil {
+		return nil
+	}
+	segs, err := filepath.Glob(c.path(segmentName(complement, -1)))
+	if err != nil {
+		return err
+	}
+	for _, s := range segs {
+		if err = os.Remove(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentName returns the name of the filter hits of segment i of a strand, or a glob pattern
+// matching all segments of the strand if i is negative.
+func segmentName(complement bool, i int) string {
+	if i < 0 {
+		return strandName(complement) + ".filter.*"
+	}
+	return fmt.Sprintf("%s.filter.%d", strandName(complement), i)
+}
+
+// hitBuffer is a filter.Sink collecting the filter hits of a segment.
+type hitBuffer []filter.FilterHit
+
+func (b *hitBuffer) Push(e morass.LessInterface) error {
+	*b = append(*b, e.(filter.FilterHit))
+	return nil
+}
+
+// filterRange filters segment i of query using f, loading the filter hits from the checkpoint
+// if they have been saved, and saving them otherwise. The hits are then pushed onto m.
+func (c *checkpoint) filterRange(f *filter.Filter, query *seq.Seq, i, from, to int, selfCompare, complement bool, m *morass.Morass) error {
+	var hits hitBuffer
+	name := segmentName(complement, i)
+	ok, err := c.load(name, &hits)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err = f.FilterRange(query, from, to, selfCompare, complement, &hits); err != nil {
+			return err
+		}
+		if err = c.save(name, hits); err != nil {
+			return err
+		}
+	}
+	for _, h := range hits {
+		if err = m.Push(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
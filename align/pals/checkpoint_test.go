@@ -0,0 +1,99 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"code.google.com/p/biogo/align/pals/dp"
+	"code.google.com/p/biogo/align/pals/filter"
+	"code.google.com/p/biogo/morass"
+	"code.google.com/p/biogo/seq"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+)
+
+// checkpointed returns an optimised and indexed PALS self comparison of t checkpointing to dir.
+func checkpointed(c *check.C, t *seq.Seq, dir string) *PALS {
+	m, err := morass.New(filter.FilterHit{}, "", "", 2<<20, false)
+	c.Assert(err, check.Equals, nil)
+	mem := uintptr(32 << 20)
+	p := New(t, t, true, m, 2, 0, &mem, nil)
+	c.Assert(p.Optimise(DefaultLength, DefaultMinIdentity), check.Equals, nil)
+	c.Assert(p.BuildIndex(), check.Equals, nil)
+	c.Assert(p.Checkpoint(dir), check.Equals, nil)
+	return p
+}
+
+func saved(c *check.C, dir, pattern string) int {
+	f, err := filepath.Glob(filepath.Join(dir, pattern))
+	c.Assert(err, check.Equals, nil)
+	return len(f)
+}
+
+func (s *S) TestCheckpoint(c *check.C) {
+	defer func(n int) { FilterChunk = n }(FilterChunk)
+	FilterChunk = 10000
+	t := chromosome(100000, 1000, 4, 1)
+
+	mem := uintptr(32 << 20)
+	want, err := selfAlign(t, 1, &mem)
+	c.Assert(err, check.Equals, nil)
+
+	dir, err := ioutil.TempDir("", "pals_checkpoint_")
+	c.Assert(err, check.Equals, nil)
+	defer os.RemoveAll(dir)
+
+	// Interrupt a run after filtering half of the query segments.
+	p := checkpointed(c, t, dir)
+	segs := (t.Len() + FilterChunk - 1) / FilterChunk
+	for i := 0; i < segs/2; i++ {
+		to := (i+1)*FilterChunk + p.FilterParams.MinMatch
+		c.Assert(p.checkpoint.filterRange(p.hitFilter, t, i, i*FilterChunk, to, true, false, p.morass), check.Equals, nil)
+	}
+	p.CleanUp()
+	c.Check(saved(c, dir, "forward.filter.*.gob"), check.Equals, segs/2)
+
+	// The resumed run finds the same hits and keeps only the phase results.
+	p = checkpointed(c, t, dir)
+	hits, err := p.Align(false)
+	c.Assert(err, check.Equals, nil)
+	p.CleanUp()
+	c.Check(hits, check.DeepEquals, want)
+	c.Check(saved(c, dir, "forward.filter.*.gob"), check.Equals, 0)
+	c.Check(saved(c, dir, "forward.traps.gob"), check.Equals, 1)
+	c.Check(saved(c, dir, "forward.hits.gob"), check.Equals, 1)
+
+	// Completed phases are not repeated.
+	p = checkpointed(c, t, dir)
+	c.Assert(p.checkpoint.save("forward.hits", dp.DPHits{{Abpos: 1, Aepos: 2}}), check.Equals, nil)
+	hits, err = p.Align(false)
+	c.Assert(err, check.Equals, nil)
+	c.Check(hits, check.DeepEquals, dp.DPHits{{Abpos: 1, Aepos: 2}})
+	os.Remove(filepath.Join(dir, "forward.hits.gob"))
+	hits, err = p.Align(false)
+	c.Assert(err, check.Equals, nil)
+	p.CleanUp()
+	c.Check(hits, check.DeepEquals, want)
+
+	// A different run may not use the checkpoint.
+	m, err := morass.New(filter.FilterHit{}, "", "", 2<<20, false)
+	c.Assert(err, check.Equals, nil)
+	p = New(t, t, true, m, 1, 0, &mem, nil)
+	defer p.CleanUp()
+	c.Assert(p.Optimise(2*DefaultLength, DefaultMinIdentity), check.Equals, nil)
+	c.Check(p.Checkpoint(dir), check.Not(check.Equals), nil)
+}
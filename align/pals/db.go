@@ -0,0 +1,181 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"code.google.com/p/biogo/align/pals/filter"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/io/seqio"
+	"code.google.com/p/biogo/morass"
+	"code.google.com/p/biogo/seq"
+	"io"
+)
+
+// Default database parameters.
+var (
+	DefaultBatchSize   = 1 << 24 // Maximum number of query bases aligned in a batch.
+	DefaultMorassChunk = 1 << 20 // Number of filter hits sorted in memory.
+)
+
+// A PairWriter writes feature pairs.
+type PairWriter interface {
+	Write(*FeaturePair) (int, error)
+}
+
+// A Database holds a packed and indexed collection of target sequences against which
+// collections of query sequences can be aligned. Packing of sequences and the translation
+// of hits back to sequence coordinates are handled by the Database.
+type Database struct {
+	MinHitLen  int
+	MinId      float64
+	TubeOffset int
+	MaxMem     *uintptr
+	Threads    int
+	BatchSize  int    // Maximum number of query bases packed into each batch.
+	TempDir    string // Directory used for filter hit sorting.
+	Log        Logger
+
+	target *seq.Seq
+	base   *PALS
+}
+
+// Return a new Database holding the sequences read from r.
+func NewDatabase(r seqio.Reader) (*Database, error) {
+	db := &Database{
+		MinHitLen: DefaultLength,
+		MinId:     DefaultMinIdentity,
+		Threads:   1,
+		BatchSize: DefaultBatchSize,
+	}
+	var err error
+	db.target, _, err = pack("target", r, 0, db.notify)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if db.target.Len() == 0 {
+		return nil, bio.NewError("pals: empty database", 0)
+	}
+	return db, nil
+}
+
+// pack reads sequences from r into a packed sequence until at least limit bases have been
+// read, or until r is exhausted if limit is zero. It returns the packed sequence, the number
+// of sequences packed and any error, returning io.EOF if r has been exhausted.
+func pack(id string, r seqio.Reader, limit int, log func(string)) (*seq.Seq, int, error) {
+	p := NewPacker(id)
+	var n, length int
+	for limit == 0 || length < limit {
+		s, err := r.Read()
+		if err != nil {
+			if n > 0 {
+				p.FinalisePack()
+			}
+			return p.Packed, n, err
+		}
+		if s.Len() == 0 {
+			continue
+		}
+		log(p.Pack(s))
+		n++
+		length += s.Len()
+	}
+	p.FinalisePack()
+	return p.Packed, n, nil
+}
+
+// Align aligns the sequences read from query against the database on both strands, writing
+// feature pairs to w. Query sequences are aligned in batches of at most BatchSize bases, plus
+// the length of the last sequence in the batch. If query is nil the database is compared with
+// itself. Feature pairs have the target as A and the query as B, with IDs and Locations set to
+// the sequence IDs. Align returns the number of feature pairs written.
+func (db *Database) Align(query seqio.Reader, w PairWriter) (n int, err error) {
+	if query == nil {
+		return db.align(db.target, true, w)
+	}
+	for {
+		batch, c, err := pack("query", query, db.BatchSize, db.notify)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if c > 0 {
+			db.notifyf("Aligning batch of %d sequences", c)
+			m, aerr := db.align(batch, false, w)
+			n += m
+			if aerr != nil {
+				return n, aerr
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+	}
+}
+
+// align aligns the packed query against the database on both strands.
+func (db *Database) align(query *seq.Seq, self bool, w PairWriter) (n int, err error) {
+	m, err := morass.New(filter.FilterHit{}, "pals_", db.TempDir, DefaultMorassChunk, false)
+	if err != nil {
+		return 0, err
+	}
+	p := New(db.target, query, self, m, db.Threads, db.TubeOffset, db.MaxMem, db.Log)
+	defer func() {
+		if cerr := p.CleanUp(); err == nil {
+			err = cerr
+		}
+	}()
+	if db.base == nil {
+		if err = p.Optimise(db.MinHitLen, db.MinId); err != nil {
+			return 0, err
+		}
+		if err = p.BuildIndex(); err != nil {
+			return 0, err
+		}
+		db.base = p
+	} else {
+		p.Share(db.base)
+	}
+
+	for _, comp := range [...]bool{false, true} {
+		hits, err := p.Align(comp)
+		if err != nil {
+			return n, err
+		}
+		pairs, err := NewFeaturePairs(db.target, query, hits, comp)
+		if err != nil {
+			return n, err
+		}
+		for _, fp := range pairs {
+			fp.A.Location, fp.B.Location = fp.A.ID, fp.B.ID
+			if _, err = w.Write(fp); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (db *Database) notify(n string) {
+	if db.Log != nil {
+		db.Log.Print(n)
+	}
+}
+
+func (db *Database) notifyf(f string, n ...interface{}) {
+	if db.Log != nil {
+		db.Log.Printf(f, n...)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/io/seqio/fasta"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"sort"
+)
+
+type pairs []*FeaturePair
+
+func (p *pairs) Write(fp *FeaturePair) (int, error) { *p = append(*p, fp); return 1, nil }
+
+// dbSeq describes a database test sequence: its name, length and the placement and
+// orientation of a shared repeat, with a negative position indicating no repeat.
+type dbSeq struct {
+	id     string
+	length int
+	repeat int
+	rev    bool
+}
+
+const dbRepeat = 600
+
+// dbFasta returns a FASTA reader holding random sequences described by d, each containing
+// a copy of a common repeat if repeat is non-negative.
+func dbFasta(d []dbSeq, seed int64) *fasta.Reader {
+	rnd := rand.New(rand.NewSource(0))
+	rep := make([]byte, dbRepeat)
+	for i := range rep {
+		rep[i] = l[rnd.Intn(Q)]
+	}
+	rc, err := (&seq.Seq{Seq: rep}).RevComp()
+	if err != nil {
+		panic(err)
+	}
+
+	rnd = rand.New(rand.NewSource(seed))
+
+	b := &bytes.Buffer{}
+	for _, s := range d {
+		sq := make([]byte, s.length)
+		for i := range sq {
+			sq[i] = l[rnd.Intn(Q)]
+		}
+		if s.repeat >= 0 {
+			r := rep
+			if s.rev {
+				r = rc.Seq
+			}
+			copy(sq[s.repeat:], r)
+		}
+		fmt.Fprintf(b, ">%s\n%s\n", s.id, sq)
+	}
+	return fasta.NewReader(&B{b})
+}
+
+func repeatOf(d []dbSeq, id string) (int, bool) {
+	for _, s := range d {
+		if s.id == id {
+			return s.repeat, s.repeat >= 0
+		}
+	}
+	return 0, false
+}
+
+func dbAlign(c *check.C, target, query []dbSeq, batch int) pairs {
+	db, err := NewDatabase(dbFasta(target, 1))
+	c.Assert(err, check.Equals, nil)
+	mem := uintptr(32 << 20)
+	db.MaxMem = &mem
+	db.MinHitLen = 200
+	db.BatchSize = batch
+	var p pairs
+	if query == nil {
+		_, err = db.Align(nil, &p)
+	} else {
+		_, err = db.Align(dbFasta(query, 2), &p)
+	}
+	c.Assert(err, check.Equals, nil)
+	return p
+}
+
+// checkPairs checks that every pair lies within the repeat copies of the named sequences
+// and returns the set of sequence pairings found.
+func checkPairs(c *check.C, p pairs, target, query []dbSeq) map[string]bool {
+	found := map[string]bool{}
+	for _, fp := range p {
+		c.Check(fp.A.Location, check.Equals, fp.A.ID)
+		c.Check(fp.B.Location, check.Equals, fp.B.ID)
+		for _, f := range []struct {
+			d    []dbSeq
+			s, e int
+			id   string
+		}{{target, fp.A.Start, fp.A.End, fp.A.ID}, {query, fp.B.Start, fp.B.End, fp.B.ID}} {
+			r, ok := repeatOf(f.d, f.id)
+			c.Assert(ok, check.Equals, true, check.Commentf("unexpected hit to %s", f.id))
+			c.Check(f.s >= r-10 && f.e <= r+dbRepeat+10, check.Equals, true,
+				check.Commentf("%s:%d..%d outside repeat at %d", f.id, f.s, f.e, r))
+		}
+		found[fmt.Sprintf("%s/%s/%d", fp.A.ID, fp.B.ID, fp.Strand)] = true
+	}
+	return found
+}
+
+var (
+	dbTarget = []dbSeq{
+		{"s1", 3000, 500, false},
+		{"s2", 2500, 1200, false},
+		{"s3", 2000, -1, false},
+	}
+	dbQuery = []dbSeq{
+		{"q1", 1500, 300, false},
+		{"q2", 1500, 700, true},
+		{"q3", 1000, -1, false},
+	}
+)
+
+func (s *S) TestDatabaseSelf(c *check.C) {
+	p := dbAlign(c, dbTarget, nil, DefaultBatchSize)
+	c.Check(len(p) > 0, check.Equals, true)
+	found := checkPairs(c, p, dbTarget, dbTarget)
+	for k := range found {
+		c.Check(k == "s1/s2/1" || k == "s2/s1/1", check.Equals, true, check.Commentf("unexpected pairing %s", k))
+	}
+}
+
+func (s *S) TestDatabaseQuery(c *check.C) {
+	p := dbAlign(c, dbTarget, dbQuery, DefaultBatchSize)
+	found := checkPairs(c, p, dbTarget, dbQuery)
+	c.Check(found, check.DeepEquals, map[string]bool{
+		"s1/q1/1":  true,
+		"s2/q1/1":  true,
+		"s1/q2/-1": true,
+		"s2/q2/-1": true,
+	})
+
+	// Batching must not change the hits found.
+	b := dbAlign(c, dbTarget, dbQuery, 1)
+	c.Check(pairStrings(b), check.DeepEquals, pairStrings(p))
+}
+
+func pairStrings(p pairs) []string {
+	s := make([]string, len(p))
+	for i, fp := range p {
+		s[i] = fmt.Sprintf("%s:%d-%d %s:%d-%d %d %d", fp.A.ID, fp.A.Start, fp.A.End, fp.B.ID, fp.B.Start, fp.B.End, fp.Strand, fp.Score)
+	}
+	sort.Strings(s)
+	return s
+}
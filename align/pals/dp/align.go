@@ -21,6 +21,8 @@ import (
 	"code.google.com/p/biogo/bio"
 	"code.google.com/p/biogo/seq"
 	"sort"
+	"sync/atomic"
+	"unsafe"
 )
 
 // Holds dp alignment parameters.
@@ -71,15 +73,128 @@ func NewAligner(target, query *seq.Seq, k, minLength int, minId float64) *Aligne
 // Align pairs of sequence segments defined by trapezoids.
 // Returns aligning segment pairs satisfying length and identity requirements.
 func (a *Aligner) AlignTraps(trapezoids filter.Trapezoids) DPHits {
-	covered := make([]bool, len(trapezoids))
+	return a.AlignTrapsConcurrent(trapezoids, 1)
+}
+
+// AlignTrapsConcurrent aligns pairs of sequence segments defined by trapezoids using up
+// to workers goroutines. The returned segment pairs are identical to those returned by
+// AlignTraps and are independent of the number of workers.
+func (a *Aligner) AlignTrapsConcurrent(trapezoids filter.Trapezoids, workers int) DPHits {
+	var segs DPHits
+	if workers < 2 || len(trapezoids) < 2 {
+		covered := make([]bool, len(trapezoids))
+		mark := func(i int) { covered[i] = true }
+		dp := a.kernel()
+		for i, t := range trapezoids {
+			if covered[i] || t.Top-t.Bottom < a.k {
+				continue
+			}
+			dp.result = nil
+			dp.alignRecursion(t)
+			for _, h := range dp.result {
+				cover(trapezoids, i, h, mark)
+			}
+			segs = append(segs, dp.result...)
+		}
+	} else {
+		segs = a.alignConcurrent(trapezoids, workers)
+	}
+
+	return unique(segs)
+}
+
+// slotsPerWorker is the number of trapezoid results per worker that may be held awaiting
+// collection by alignConcurrent.
+const slotsPerWorker = 2
+
+// chanSize is the approximate size of a buffered result channel.
+const chanSize = 128
+
+// alignConcurrent aligns trapezoids speculatively in parallel. Results are collected in
+// trapezoid order, discarding those of trapezoids covered by an earlier alignment so
+// that the result matches the serial algorithm. Workers may run at most slotsPerWorker*workers
+// trapezoids ahead of collection, so the results held at any time are bounded.
+func (a *Aligner) alignConcurrent(trapezoids filter.Trapezoids, workers int) DPHits {
+	var (
+		next    int64 = -1
+		covered       = make([]int32, len(trapezoids))
+		slots         = make([]chan DPHits, slotsPerWorker*workers)
+		tokens        = make(chan struct{}, len(slots))
+	)
+	for i := range slots {
+		slots[i] = make(chan DPHits, 1)
+		tokens <- struct{}{}
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			dp := a.kernel()
+			for {
+				// Holding a token guarantees that trapezoid i's slot has been collected
+				// for trapezoid i-len(slots).
+				<-tokens
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(trapezoids) {
+					return
+				}
+				if t := trapezoids[i]; atomic.LoadInt32(&covered[i]) == 0 && t.Top-t.Bottom >= a.k {
+					dp.result = nil
+					dp.alignRecursion(t)
+					slots[i%len(slots)] <- dp.result
+				} else {
+					slots[i%len(slots)] <- nil
+				}
+			}
+		}()
+	}
 
-	dp := &kernel{
-		target:     a.target,
-		query:      a.query,
-		trapezoids: trapezoids,
-		covered:    covered,
-		minLen:     a.minHitLength,
-		maxDiff:    1 - a.minId,
+	var segs DPHits
+	mark := func(i int) { atomic.StoreInt32(&covered[i], 1) }
+	for i := range trapezoids {
+		hits := <-slots[i%len(slots)]
+		tokens <- struct{}{}
+		if covered[i] != 0 {
+			continue
+		}
+		for _, h := range hits {
+			cover(trapezoids, i, h, mark)
+		}
+		segs = append(segs, hits...)
+	}
+
+	return segs
+}
+
+// Return an estimate of the amount of memory required by each concurrent worker aligning
+// trapezoids, including the results held for the worker awaiting collection.
+func (a *Aligner) MemRequired(trapezoids filter.Trapezoids) uintptr {
+	var width, height int
+	for _, t := range trapezoids {
+		if w := t.Right - t.Left; w > width {
+			width = w
+		}
+		if h := t.Top - t.Bottom; h > height {
+			height = h
+		}
+	}
+	width += a.Config.MaxIGap
+	kernel := 2 * unsafe.Sizeof(0) * uintptr(width+width>>2+vecBuffering)
+
+	hits := 1
+	if a.minHitLength > 0 {
+		hits += height / a.minHitLength
+	}
+	slot := chanSize + unsafe.Sizeof(DPHits(nil)) + uintptr(hits)*unsafe.Sizeof(DPHit{})
+
+	return kernel + slotsPerWorker*slot
+}
+
+// kernel returns a dp kernel configured by the receiver.
+func (a *Aligner) kernel() *kernel {
+	return &kernel{
+		target:  a.target,
+		query:   a.query,
+		minLen:  a.minHitLength,
+		maxDiff: 1 - a.minId,
 
 		maxIGap:    a.Config.MaxIGap,
 		diffCost:   a.Config.DiffCost,
@@ -87,29 +202,54 @@ func (a *Aligner) AlignTraps(trapezoids filter.Trapezoids) DPHits {
 		matchCost:  a.Config.MatchCost,
 		blockCost:  a.Config.BlockCost,
 		rMatchCost: a.Config.RMatchCost,
-
-		result: make(chan DPHit),
 	}
-	w := make(chan struct{})
-	var segs DPHits
-	go func() {
-		defer close(w)
-		for h := range dp.result {
-			segs = append(segs, h)
+}
+
+// cover calls mark with the index of each trapezoid following slot that is almost
+// entirely covered by the alignment h found in the trapezoid at slot.
+func cover(trapezoids filter.Trapezoids, slot int, h DPHit, mark func(int)) {
+	// Diagonals of h are query-target, not target-query.
+	low, high := -h.HighDiagonal, -h.LowDiagonal
+	for i, trap := range trapezoids[slot+1:] {
+		var trapAProjection, trapBProjection, coverageA, coverageB int
+
+		if trap.Bottom >= h.Bepos {
+			break
 		}
-	}()
-	for i, t := range trapezoids {
-		if !dp.covered[i] && t.Top-t.Bottom >= a.k {
-			dp.slot = i
-			dp.alignRecursion(t)
+
+		trapBProjection = trap.Top - trap.Bottom + 1
+		trapAProjection = trap.Right - trap.Left + 1
+		if trap.Left < low {
+			coverageA = low
+		} else {
+			coverageA = trap.Left
+		}
+		if trap.Right > high {
+			coverageB = high
+		} else {
+			coverageB = trap.Right
+		}
+
+		if coverageA > coverageB {
+			continue
+		}
+
+		coverageA = coverageB - coverageA + 1
+		if trap.Top > h.Bepos {
+			coverageB = h.Bepos - trap.Bottom + 1
+		} else {
+			coverageB = trapBProjection
 		}
-	}
-	close(dp.result)
-	<-w
 
-	/* Remove lower scoring segments that begin or end at
-	   the same point as a higher scoring segment.       */
+		if (float64(coverageA)/float64(trapAProjection))*(float64(coverageB)/float64(trapBProjection)) > 0.99 {
+			mark(slot + 1 + i)
+		}
+	}
+}
 
+// unique removes lower scoring segments that begin or end at the same point as a
+// higher scoring segment.
+func unique(segs DPHits) DPHits {
 	if len(segs) > 0 {
 		var i, j int
 
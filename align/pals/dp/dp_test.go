@@ -59,18 +59,18 @@ type S struct{}
 
 var _ = check.Suite(&S{})
 
-func (s *S) TestAlignment(c *check.C) {
+func deBruijnAligner() (a, b *seq.Seq, aligner *Aligner) {
 	l := [...]byte{'A', 'C', 'G', 'T'}
 	Q := len(l)
-	a := &seq.Seq{Seq: make([]byte, 0, util.Pow(Q, k))}
+	a = &seq.Seq{Seq: make([]byte, 0, util.Pow(Q, k))}
 	for _, i := range util.DeBruijn(byte(Q), k) {
 		a.Seq = append(a.Seq, l[i])
 	}
-	b := &seq.Seq{Seq: make([]byte, 0, util.Pow(Q, k-1))}
+	b = &seq.Seq{Seq: make([]byte, 0, util.Pow(Q, k-1))}
 	for _, i := range util.DeBruijn(byte(Q), k-1) {
 		b.Seq = append(b.Seq, l[i])
 	}
-	aligner := NewAligner(a, b, int(k), 50, 0.80)
+	aligner = NewAligner(a, b, int(k), 50, 0.80)
 	aligner.Config = &AlignConfig{
 		MaxIGap:    maxIGap,
 		DiffCost:   diffCost,
@@ -79,8 +79,16 @@ func (s *S) TestAlignment(c *check.C) {
 		BlockCost:  blockCost,
 		RMatchCost: rMatchCost,
 	}
+	return a, b, aligner
+}
+
+func (s *S) TestAlignment(c *check.C) {
+	a, b, aligner := deBruijnAligner()
 	hits := aligner.AlignTraps(T)
 	c.Check(hits, check.DeepEquals, H)
+	for w := 2; w <= 4; w++ {
+		c.Check(aligner.AlignTrapsConcurrent(T, w), check.DeepEquals, H)
+	}
 	la, lb, err := hits.Sum()
 	c.Check(la, check.Equals, 791)
 	c.Check(lb, check.Equals, 664)
@@ -100,3 +108,22 @@ func (s *S) TestAlignment(c *check.C) {
 		c.Logf("a: %s\nb: %s\n", swa[0], swa[1])
 	}
 }
+
+func (s *S) TestCover(c *check.C) {
+	_, _, aligner := deBruijnAligner()
+
+	// The third trapezoid lies within the diagonals of the hit H[3] found in the first, and
+	// so is covered by it. The second is not and must still be aligned to find the alignment
+	// of H[4].
+	other := &filter.Trapezoid{Top: 1024, Bottom: 640, Left: -3072, Right: -3005}
+	covered := &filter.Trapezoid{Top: 873, Bottom: 642, Left: -2610, Right: -2553}
+	traps := filter.Trapezoids{T[3], other, covered}
+	want := aligner.AlignTraps(traps[:2])
+	c.Assert(len(want), check.Equals, 2)
+	c.Check(want[0], check.DeepEquals, H[3])
+	c.Check([]int{want[1].Abpos, want[1].Aepos, want[1].Bbpos, want[1].Bepos}, check.DeepEquals, []int{H[4].Abpos, H[4].Aepos, H[4].Bbpos, H[4].Bepos})
+	c.Check(aligner.AlignTraps(traps), check.DeepEquals, want)
+	for w := 2; w <= 4; w++ {
+		c.Check(aligner.AlignTrapsConcurrent(traps, w), check.DeepEquals, want)
+	}
+}
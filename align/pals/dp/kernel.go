@@ -39,13 +39,10 @@ type kernel struct {
 	blockCost  int
 	rMatchCost float64
 
-	lowEnd     DPHit
-	highEnd    DPHit
-	vectors    [2][]int
-	trapezoids []*filter.Trapezoid
-	covered    []bool
-	slot       int
-	result     chan DPHit
+	lowEnd  DPHit
+	highEnd DPHit
+	vectors [2][]int
+	result  DPHits
 }
 
 // An offset slice seems to be the easiest way to implement the C idiom used in PALS to implement
@@ -93,46 +90,10 @@ func (k *kernel) alignRecursion(workingTrap *filter.Trapezoid) {
 		if identity <= k.maxDiff {
 			k.highEnd.Error = identity
 
-			for i, trap := range k.trapezoids[k.slot+1:] {
-				var trapAProjection, trapBProjection, coverageA, coverageB int
-
-				if trap.Bottom >= k.highEnd.Bepos {
-					break
-				}
-
-				trapBProjection = trap.Top - trap.Bottom + 1
-				trapAProjection = trap.Right - trap.Left + 1
-				if trap.Left < k.highEnd.LowDiagonal {
-					coverageA = k.highEnd.LowDiagonal
-				} else {
-					coverageA = trap.Left
-				}
-				if trap.Right > k.highEnd.HighDiagonal {
-					coverageB = k.highEnd.HighDiagonal
-				} else {
-					coverageB = trap.Right
-				}
-
-				if coverageA > coverageB {
-					continue
-				}
-
-				coverageA = coverageB - coverageA + 1
-				if trap.Top > k.highEnd.Bepos {
-					coverageB = k.highEnd.Bepos - trap.Bottom + 1
-				} else {
-					coverageB = trapBProjection
-				}
-
-				if (float64(coverageA)/float64(trapAProjection))*(float64(coverageB)/float64(trapBProjection)) > 0.99 {
-					k.covered[i] = true
-				}
-			}
-
 			// diagonals to this point are query-target, not target-query.
 			k.highEnd.LowDiagonal, k.highEnd.HighDiagonal = -k.highEnd.HighDiagonal, -k.highEnd.LowDiagonal
 
-			k.result <- k.highEnd
+			k.result = append(k.result, k.highEnd)
 		}
 	}
 
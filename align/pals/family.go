@@ -0,0 +1,503 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"code.google.com/p/biogo/align/nw"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/gff"
+	"code.google.com/p/biogo/io/seqio/fasta"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"sort"
+)
+
+// A Class describes the organisation of a repeat family.
+type Class int
+
+// Repeat family classes described in Edgar and Myers (2005).
+const (
+	Dispersed Class = iota // Interspersed copies aligning over their full length.
+	Tandem                 // Tandemly arrayed copies of a repeat unit.
+	Pyramid                // Piles of nested local images without a regular period.
+)
+
+func (c Class) String() string {
+	switch c {
+	case Dispersed:
+		return "dispersed"
+	case Tandem:
+		return "tandem"
+	case Pyramid:
+		return "pyramid"
+	}
+	return fmt.Sprintf("Class(%d)", int(c))
+}
+
+// A Family is a set of repeat copies with their multiple alignment and consensus sequence.
+type Family struct {
+	ID        string
+	Class     Class
+	Period    int             // Length of the repeat unit of a tandem family.
+	Members   []*feat.Feature // Member Meta fields point to the Pile containing the member.
+	Alignment seq.Alignment
+	Consensus *seq.Seq
+}
+
+// A Clusterer groups piles into repeat families.
+type Clusterer struct {
+	Coverage   float64 // Minimum fraction of each pile covered by a global image.
+	Local      float64 // Minimum fraction of images local to a pile for it to be tandem or pyramid.
+	PeriodSlop float64 // Maximum deviation of tandem image offsets from a multiple of the period, as a fraction of the offset.
+	MinCopies  int     // Minimum number of members of a dispersed family.
+}
+
+// DefaultClusterer provides the thresholds used by PILER.
+var DefaultClusterer = Clusterer{
+	Coverage:   0.95,
+	Local:      0.5,
+	PeriodSlop: 0.05,
+	MinCopies:  3,
+}
+
+// An edge links two piles by an image with the given strand relationship.
+type edge struct {
+	to     int
+	strand int8
+}
+
+// Families classifies piles and clusters them into repeat families. Tandem piles each form
+// a family whose members are the repeat units of the array. Dispersed piles linked by global
+// images form families of at least MinCopies members, and pyramid piles linked by images
+// form pyramid families. Families are ordered by class and then by the position of their
+// first member. Piles must have been obtained from Piler.Piles.
+func (c Clusterer) Families(piles []*Pile) []*Family {
+	piles = append([]*Pile(nil), piles...)
+	sort.Sort(pilesByPos(piles))
+	index := make(map[*Pile]int, len(piles))
+	for i, p := range piles {
+		index[p] = i
+	}
+
+	var (
+		class    = make([]Class, len(piles))
+		classed  = make([]bool, len(piles))
+		families []*Family
+	)
+	for i, p := range piles {
+		var local, global int
+		for _, im := range p.Images {
+			pb, ok := im.B.Meta.(*Pile)
+			if !ok {
+				continue
+			}
+			switch {
+			case pb == p:
+				local++
+			case c.global(im, p, pb):
+				global++
+			}
+		}
+		switch {
+		case len(p.Images) > 0 && float64(local) >= c.Local*float64(len(p.Images)):
+			if period := c.period(p); period > 0 {
+				class[i] = Tandem
+				families = append(families, tandem(p, period))
+			} else {
+				class[i] = Pyramid
+			}
+			classed[i] = true
+		case global > 0:
+			class[i] = Dispersed
+			classed[i] = true
+		}
+	}
+
+	// Link dispersed piles by global images and pyramid piles by any image.
+	edges := make([][]edge, len(piles))
+	for i, p := range piles {
+		if !classed[i] || class[i] == Tandem {
+			continue
+		}
+		for _, im := range p.Images {
+			pb, ok := im.B.Meta.(*Pile)
+			if !ok || pb == p {
+				continue
+			}
+			j := index[pb]
+			if !classed[j] || class[j] != class[i] || (class[i] == Dispersed && !c.global(im, p, pb)) {
+				continue
+			}
+			edges[i] = append(edges[i], edge{to: j, strand: im.Strand})
+		}
+	}
+
+	// Find connected components, orienting each pile relative to the first of its component.
+	strand := make([]int8, len(piles))
+	for i := range piles {
+		if !classed[i] || class[i] == Tandem || strand[i] != 0 {
+			continue
+		}
+		strand[i] = 1
+		f := &Family{Class: class[i]}
+		for queue := []int{i}; len(queue) > 0; queue = queue[1:] {
+			j := queue[0]
+			f.Members = append(f.Members, member(piles[j], piles[j].Pile.Start, piles[j].Pile.End, strand[j]))
+			for _, e := range edges[j] {
+				if strand[e.to] == 0 {
+					strand[e.to] = strand[j] * e.strand
+					queue = append(queue, e.to)
+				}
+			}
+		}
+		if f.Class == Dispersed && len(f.Members) < c.MinCopies {
+			continue
+		}
+		sort.Sort(membersByPos(f.Members))
+		families = append(families, f)
+	}
+
+	sort.Stable(familiesByClass(families))
+	for i, f := range families {
+		f.ID = fmt.Sprintf("family%d", i+1)
+		for _, m := range f.Members {
+			m.Attributes = fmt.Sprintf("Family %s; Class %v", f.ID, f.Class)
+		}
+	}
+
+	return families
+}
+
+// global returns whether the image im covers almost all of both pa and pb.
+func (c Clusterer) global(im *FeaturePair, pa, pb *Pile) bool {
+	return float64(im.A.Len()) >= c.Coverage*float64(pa.Pile.Len()) &&
+		float64(im.B.Len()) >= c.Coverage*float64(pb.Pile.Len())
+}
+
+// period returns the tandem repeat period of the local images of p, or 0 if the local
+// images are not consistent with a tandem array of at least two units.
+func (c Clusterer) period(p *Pile) int {
+	var offsets []int
+	period := 0
+	for _, im := range p.Images {
+		if im.B.Meta != p || im.Strand < 0 {
+			continue
+		}
+		o := im.B.Start - im.A.Start
+		if o < 0 {
+			o = -o
+		}
+		if o == 0 {
+			continue
+		}
+		offsets = append(offsets, o)
+		if period == 0 || o < period {
+			period = o
+		}
+	}
+	if period == 0 || p.Pile.Len() < 2*period {
+		return 0
+	}
+	for _, o := range offsets {
+		d := o % period
+		if period-d < d {
+			d = period - d
+		}
+		if float64(d) > c.PeriodSlop*float64(o) {
+			return 0
+		}
+	}
+	return period
+}
+
+// tandem returns a family of the complete repeat units of the tandem pile p.
+func tandem(p *Pile, period int) *Family {
+	f := &Family{Class: Tandem, Period: period}
+	for s := p.Pile.Start; s+period <= p.Pile.End; s += period {
+		f.Members = append(f.Members, member(p, s, s+period, 1))
+	}
+	return f
+}
+
+func member(p *Pile, start, end int, strand int8) *feat.Feature {
+	return &feat.Feature{
+		ID:       fmt.Sprintf("%s:%d..%d", p.Pile.Location, start, end),
+		Source:   "piler",
+		Location: p.Pile.Location,
+		Start:    start,
+		End:      end,
+		Feature:  "repeat",
+		Strand:   strand,
+		Frame:    -1,
+		Moltype:  bio.DNA,
+		Meta:     p,
+	}
+}
+
+type pilesByPos []*Pile
+
+func (p pilesByPos) Len() int { return len(p) }
+func (p pilesByPos) Less(i, j int) bool {
+	a, b := p[i].Pile, p[j].Pile
+	if a.Location != b.Location {
+		return a.Location < b.Location
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	return a.End < b.End
+}
+func (p pilesByPos) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+type membersByPos []*feat.Feature
+
+func (m membersByPos) Len() int { return len(m) }
+func (m membersByPos) Less(i, j int) bool {
+	if m[i].Location != m[j].Location {
+		return m[i].Location < m[j].Location
+	}
+	return m[i].Start < m[j].Start
+}
+func (m membersByPos) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+
+type familiesByClass []*Family
+
+func (f familiesByClass) Len() int { return len(f) }
+func (f familiesByClass) Less(i, j int) bool {
+	if f[i].Class != f[j].Class {
+		return f[i].Class < f[j].Class
+	}
+	return membersByPos{f[i].Members[0], f[j].Members[0]}.Less(0, 1)
+}
+func (f familiesByClass) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+
+// Extract returns the sequences of the members of f from seqs, keyed by location. Members
+// on the reverse strand are reverse complemented.
+func (f *Family) Extract(seqs map[string]*seq.Seq) ([]*seq.Seq, error) {
+	ms := make([]*seq.Seq, 0, len(f.Members))
+	for _, m := range f.Members {
+		s, ok := seqs[m.Location]
+		if !ok {
+			return nil, bio.NewError(fmt.Sprintf("pals: no sequence for %s", m.Location), 0, m)
+		}
+		if m.Start < 0 || m.End > s.Len() || m.Start >= m.End {
+			return nil, bio.NewError(fmt.Sprintf("pals: member %s out of range", m.ID), 0, m)
+		}
+		ms = append(ms, seq.New(m.ID, append([]byte(nil), s.Seq[m.Start:m.End]...), nil))
+		if m.Strand < 0 {
+			rc, err := ms[len(ms)-1].RevComp()
+			if err != nil {
+				return nil, err
+			}
+			ms[len(ms)-1] = rc
+		}
+	}
+	return ms, nil
+}
+
+// ConsensusAligner is used to align family members to the central member of the family.
+var ConsensusAligner = &nw.Aligner{
+	Matrix: [][]int{
+		{2, -3, -3, -3, -4},
+		{-3, 2, -3, -3, -4},
+		{-3, -3, 2, -3, -4},
+		{-3, -3, -3, 2, -4},
+		{-4, -4, -4, -4, 0},
+	},
+	LookUp:  nw.LookUpN,
+	GapChar: '-',
+}
+
+// Build extracts the member sequences of f from seqs and constructs a centre star multiple
+// alignment of the members and the consensus sequence of the alignment.
+func (f *Family) Build(seqs map[string]*seq.Seq) error {
+	ms, err := f.Extract(seqs)
+	if err != nil {
+		return err
+	}
+	if len(ms) == 0 {
+		return bio.NewError("pals: empty family", 0, f)
+	}
+	f.Alignment, err = star(ms)
+	if err != nil {
+		return err
+	}
+	f.Consensus = &seq.Seq{ID: f.ID, Seq: consensus(f.Alignment, ConsensusAligner.GapChar), Moltype: bio.DNA}
+	return nil
+}
+
+// alignable replaces bases that cannot be aligned by ConsensusAligner.
+func alignable(s []byte) []byte {
+	c := make([]byte, len(s))
+	for i, b := range s {
+		if ConsensusAligner.LookUp.ValueToCode[b] < 0 {
+			b = 'A'
+		}
+		c[i] = b
+	}
+	return c
+}
+
+// star returns the centre star multiple alignment of ms using the member of median length
+// as the centre.
+func star(ms []*seq.Seq) (seq.Alignment, error) {
+	order := make([]int, len(ms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byLen{order, ms})
+	centre := ms[order[len(order)/2]]
+	cs := seq.New(centre.ID, alignable(centre.Seq), nil)
+
+	// For each member, record the inserted bases preceding each centre position
+	// and the base aligned to each centre position.
+	gap := ConsensusAligner.GapChar
+	var (
+		ins     = make([][][]byte, len(ms))
+		aligned = make([][]byte, len(ms))
+		maxIns  = make([]int, centre.Len()+1)
+	)
+	for i, m := range ms {
+		ins[i] = make([][]byte, centre.Len()+1)
+		aligned[i] = make([]byte, centre.Len())
+		if m == centre {
+			copy(aligned[i], m.Seq)
+			continue
+		}
+		pw, err := ConsensusAligner.Align(cs, seq.New(m.ID, alignable(m.Seq), nil))
+		if err != nil {
+			return nil, err
+		}
+		var c, q int
+		for k, b := range pw[0].Seq {
+			switch {
+			case b == gap:
+				ins[i][c] = append(ins[i][c], m.Seq[q])
+				q++
+			case pw[1].Seq[k] == gap:
+				aligned[i][c] = gap
+				c++
+			default:
+				aligned[i][c] = m.Seq[q]
+				c++
+				q++
+			}
+		}
+		for p, s := range ins[i] {
+			if len(s) > maxIns[p] {
+				maxIns[p] = len(s)
+			}
+		}
+	}
+
+	aln := make(seq.Alignment, len(ms))
+	for i, m := range ms {
+		var row []byte
+		for p := 0; p <= centre.Len(); p++ {
+			row = append(row, ins[i][p]...)
+			for k := len(ins[i][p]); k < maxIns[p]; k++ {
+				row = append(row, gap)
+			}
+			if p < centre.Len() {
+				row = append(row, aligned[i][p])
+			}
+		}
+		aln[i] = &seq.Seq{ID: m.ID, Seq: row, Moltype: bio.DNA}
+	}
+	return aln, nil
+}
+
+type byLen struct {
+	order []int
+	ms    []*seq.Seq
+}
+
+func (b byLen) Len() int           { return len(b.order) }
+func (b byLen) Less(i, j int) bool { return b.ms[b.order[i]].Len() < b.ms[b.order[j]].Len() }
+func (b byLen) Swap(i, j int)      { b.order[i], b.order[j] = b.order[j], b.order[i] }
+
+// consensus returns the majority base of each column of aln in which fewer than half the
+// rows are gaps. Ties are resolved in the order A, C, G, T and columns containing no A, C, G
+// or T give N.
+func consensus(aln seq.Alignment, gap byte) []byte {
+	var c []byte
+	for col := 0; col < len(aln[0].Seq); col++ {
+		var (
+			counts [4]int
+			gaps   int
+		)
+		for _, r := range aln {
+			switch b := r.Seq[col]; b {
+			case gap:
+				gaps++
+			case 'A', 'a':
+				counts[0]++
+			case 'C', 'c':
+				counts[1]++
+			case 'G', 'g':
+				counts[2]++
+			case 'T', 't':
+				counts[3]++
+			}
+		}
+		if 2*gaps >= len(aln) {
+			continue
+		}
+		best, base := 0, byte('N')
+		for i, n := range counts {
+			if n > best {
+				best, base = n, "ACGT"[i]
+			}
+		}
+		c = append(c, base)
+	}
+	return c
+}
+
+// WriteLibrary writes the consensus sequences of families to w as a repeat library, with
+// sequences named in the RepeatMasker "family#class" convention.
+func WriteLibrary(w *fasta.Writer, families []*Family) (n int, err error) {
+	for _, f := range families {
+		if f.Consensus == nil {
+			return n, bio.NewError("pals: family has no consensus", 0, f)
+		}
+		c := *f.Consensus
+		c.ID = fmt.Sprintf("%s#%v", f.ID, f.Class)
+		var m int
+		m, err = w.Write(&c)
+		n += m
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteMembers writes the members of families to w as GFF features.
+func WriteMembers(w *gff.Writer, families []*Family) (n int, err error) {
+	for _, f := range families {
+		for _, m := range f.Members {
+			var c int
+			c, err = w.Write(m)
+			n += c
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,196 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/gff"
+	"code.google.com/p/biogo/io/seqio/fasta"
+	"code.google.com/p/biogo/seq"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"strings"
+)
+
+// Helpers
+func randomBases(n int, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = l[rnd.Intn(Q)]
+	}
+	return s
+}
+
+func revCompBases(s []byte) []byte {
+	c := map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A'}
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = c[b]
+	}
+	return r
+}
+
+func pair(loc string, as, ae, bs, be int, strand int8) *FeaturePair {
+	return &FeaturePair{
+		A:      &feat.Feature{ID: "a", Location: loc, Start: as, End: ae},
+		B:      &feat.Feature{ID: "b", Location: loc, Start: bs, End: be},
+		Score:  1,
+		Strand: strand,
+	}
+}
+
+// repeatGenome returns a genome containing a dispersed repeat at 1000, 8000 (reversed) and
+// 15000, a tandem array of five 100 base units at 12000 and an inverted repeat at 18000,
+// with the feature pairs describing the repeats.
+func repeatGenome() (map[string]*seq.Seq, []byte, []byte, []*FeaturePair) {
+	rnd := rand.New(rand.NewSource(1))
+	g := randomBases(20000, rnd)
+	rep := randomBases(500, rnd)
+	copy(g[1000:], rep)
+	copy(g[8000:], revCompBases(rep))
+	mut := append([]byte(nil), rep...)
+	mut[100], mut[200] = 'N', 'N'
+	copy(g[15000:], mut)
+	unit := randomBases(100, rnd)
+	for i := 0; i < 5; i++ {
+		copy(g[12000+i*100:], unit)
+	}
+	copy(g[18300:], revCompBases(g[18000:18100]))
+
+	fps := []*FeaturePair{
+		pair("chr", 1000, 1500, 8000, 8500, -1),
+		pair("chr", 1000, 1500, 15000, 15500, 1),
+		pair("chr", 8000, 8500, 15000, 15500, -1),
+		pair("chr", 18000, 18300, 18100, 18400, -1),
+	}
+	for o := 100; o < 500; o += 100 {
+		fps = append(fps, pair("chr", 12000, 12500-o, 12000+o, 12500, 1))
+	}
+	return map[string]*seq.Seq{"chr": seq.New("chr", g, nil)}, rep, unit, fps
+}
+
+func families(c *check.C, fps []*FeaturePair) []*Family {
+	p := NewPiler(0)
+	for _, fp := range fps {
+		c.Assert(p.Add(fp), check.Equals, nil)
+	}
+	piles, err := p.Piles(nil)
+	c.Assert(err, check.Equals, nil)
+	return DefaultClusterer.Families(piles)
+}
+
+// Tests
+func (s *S) TestFamilies(c *check.C) {
+	seqs, rep, unit, fps := repeatGenome()
+	fams := families(c, fps)
+	c.Assert(len(fams), check.Equals, 3)
+
+	type m struct {
+		start, end int
+		strand     int8
+	}
+	for i, t := range []struct {
+		class  Class
+		period int
+		member []m
+		cons   []byte
+	}{
+		{Dispersed, 0, []m{{1000, 1500, 1}, {8000, 8500, -1}, {15000, 15500, 1}}, rep},
+		{Tandem, 100, []m{{12000, 12100, 1}, {12100, 12200, 1}, {12200, 12300, 1}, {12300, 12400, 1}, {12400, 12500, 1}}, unit},
+		{Pyramid, 0, []m{{18000, 18400, 1}}, seqs["chr"].Seq[18000:18400]},
+	} {
+		f := fams[i]
+		c.Check(f.ID, check.Equals, []string{"family1", "family2", "family3"}[i])
+		c.Check(f.Class, check.Equals, t.class)
+		c.Check(f.Period, check.Equals, t.period)
+		c.Assert(len(f.Members), check.Equals, len(t.member))
+		for j, mm := range f.Members {
+			c.Check(m{mm.Start, mm.End, mm.Strand}, check.Equals, t.member[j])
+			c.Check(mm.Meta, check.FitsTypeOf, &Pile{})
+		}
+		c.Assert(f.Build(seqs), check.Equals, nil)
+		c.Check(len(f.Alignment), check.Equals, len(t.member))
+		c.Check(string(f.Consensus.Seq), check.Equals, string(t.cons))
+	}
+
+	// Dispersed families need MinCopies members.
+	cl := DefaultClusterer
+	cl.MinCopies = 4
+	p := NewPiler(0)
+	for _, fp := range fps {
+		p.Add(fp)
+	}
+	piles, _ := p.Piles(nil)
+	c.Check(len(cl.Families(piles)), check.Equals, 2)
+
+	_, err := fams[0].Extract(map[string]*seq.Seq{})
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestStar(c *check.C) {
+	ms := []*seq.Seq{
+		seq.New("a", []byte("ACGTACGTTTGCA"), nil),
+		seq.New("b", []byte("ACGTACCCGTTTGCA"), nil),
+		seq.New("c", []byte("ACGTACGTTTGCA"), nil),
+		seq.New("d", []byte("ACGTAGTTTGCA"), nil),
+	}
+	aln, err := star(ms)
+	c.Assert(err, check.Equals, nil)
+	for i, r := range []string{
+		"ACGTA--CGTTTGCA",
+		"ACGTACCCGTTTGCA",
+		"ACGTA--CGTTTGCA",
+		"ACGTA---GTTTGCA",
+	} {
+		c.Check(aln[i].ID, check.Equals, ms[i].ID)
+		c.Check(string(aln[i].Seq), check.Equals, r)
+	}
+	c.Check(string(consensus(aln, '-')), check.Equals, "ACGTACGTTTGCA")
+}
+
+func (s *S) TestWriteFamilies(c *check.C) {
+	seqs, _, _, fps := repeatGenome()
+	fams := families(c, fps)
+	for _, f := range fams {
+		c.Assert(f.Build(seqs), check.Equals, nil)
+	}
+
+	b := &B{&bytes.Buffer{}}
+	fw := fasta.NewWriter(b, 60)
+	_, err := WriteLibrary(fw, fams)
+	c.Check(err, check.Equals, nil)
+	fw.Flush()
+	var ids []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasPrefix(line, ">") {
+			ids = append(ids, line)
+		}
+	}
+	c.Check(ids, check.DeepEquals, []string{">family1#dispersed", ">family2#tandem", ">family3#pyramid"})
+	c.Check(fams[0].Consensus.ID, check.Equals, "family1")
+
+	b.Reset()
+	gw := gff.NewWriter(b, 2, 60, false)
+	_, err = WriteMembers(gw, fams)
+	c.Check(err, check.Equals, nil)
+	gw.Close()
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	c.Assert(len(lines), check.Equals, 9)
+	c.Check(lines[0], check.Equals, "chr\tpiler\trepeat\t1001\t1500\t.\t+\t.\tFamily family1; Class dispersed")
+	c.Check(lines[1], check.Equals, "chr\tpiler\trepeat\t8001\t8500\t.\t-\t.\tFamily family1; Class dispersed")
+	c.Check(lines[3], check.Equals, "chr\tpiler\trepeat\t12001\t12100\t.\t+\t.\tFamily family2; Class tandem")
+}
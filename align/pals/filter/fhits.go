@@ -22,11 +22,16 @@ type FilterHit struct {
 	DiagIndex int
 }
 
-// This is a direct translation of the qsort compar function used by PALS.
-// However it results in a different sort order (with respect to the non-key
-// fields) for FilterHits because of differences in the underlying sort
-// algorithms and their respective sort stability.
-// This appears to have some impact on FilterHit merging.
+// FilterHits are ordered by QFrom as in PALS, with ties broken by DiagIndex and QTo.
+// The total order ensures that merging is independent of the order in which hits
+// are found, and so of the number of goroutines used for filtering.
 func (fh FilterHit) Less(y interface{}) bool {
-	return fh.QFrom < y.(FilterHit).QFrom
+	yh := y.(FilterHit)
+	switch {
+	case fh.QFrom != yh.QFrom:
+		return fh.QFrom < yh.QFrom
+	case fh.DiagIndex != yh.DiagIndex:
+		return fh.DiagIndex < yh.DiagIndex
+	}
+	return fh.QTo < yh.QTo
 }
@@ -38,13 +38,18 @@ type Params struct {
 	TubeOffset int
 }
 
+// A Sink accepts filter hits. *morass.Morass satisfies Sink.
+type Sink interface {
+	Push(morass.LessInterface) error
+}
+
 // Filter implements a q-gram filter similar to that described in Rassmussen 2005.
 // This implementation is a translation of the C++ code written by Edgar and Myers.
 type Filter struct {
 	target         *seq.Seq
 	index          *kmerindex.Index
 	tubes          []tubeState
-	morass         *morass.Morass
+	sink           Sink
 	k              int
 	minMatch       int
 	maxError       int
@@ -73,11 +78,28 @@ func New(index *kmerindex.Index, params *Params) (f *Filter) {
 // selfAlign can be used to avoid double seaching - behavior is undefined if the the sequences are not the same.
 // A morass is used to store and sort individual filter hits.
 func (f *Filter) Filter(query *seq.Seq, selfAlign, complement bool, morass *morass.Morass) error {
+	err := f.FilterRange(query, 0, query.Len(), selfAlign, complement, morass)
+	if err != nil {
+		return err
+	}
+
+	return morass.Finalise()
+}
+
+// FilterRange filters the query positions [from, to) against the stored index, adding filter hits
+// to sink. When sink is a morass it is not finalised. Distinct Filters may filter ranges of the same
+// query concurrently using a common sink safe for concurrent use; query ranges must overlap by at
+// least the minimum match length for all matches to be found.
+func (f *Filter) FilterRange(query *seq.Seq, from, to int, selfAlign, complement bool, sink Sink) error {
 	f.selfAlign = selfAlign
 	f.complement = complement
-	f.morass = morass
+	f.sink = sink
 	f.k = f.index.GetK()
 
+	if to-from < f.k {
+		return nil
+	}
+
 	// Ukonnen's Lemma
 	f.minKmersPerHit = MinWordsPerFilterHit(f.minMatch, f.k, f.maxError)
 
@@ -99,7 +121,7 @@ func (f *Filter) Filter(query *seq.Seq, selfAlign, complement bool, morass *mora
 	ticker := tubeWidth
 
 	var err error
-	err = f.index.ForEachKmerOf(query, 0, query.Len(), func(index *kmerindex.Index, position, kmer int) {
+	err = f.index.ForEachKmerOf(query, from, to, func(index *kmerindex.Index, position, kmer int) {
 		from := 0
 		if kmer > 0 {
 			from = index.FingerAt(kmer - 1)
@@ -120,13 +142,13 @@ func (f *Filter) Filter(query *seq.Seq, selfAlign, complement bool, morass *mora
 		return err
 	}
 
-	err = f.tubeEnd(query.Len() - 1)
+	err = f.tubeEnd(to - 1)
 	if err != nil {
 		return err
 	}
 
-	diagFrom := f.diagIndex(f.target.Len()-1, query.Len()-1) - tubeWidth
-	diagTo := f.diagIndex(0, query.Len()-1) + tubeWidth
+	diagFrom := f.diagIndex(f.target.Len()-1, to-1) - tubeWidth
+	diagTo := f.diagIndex(0, to-1) + tubeWidth
 
 	tubeFrom := f.tubeIndex(diagFrom)
 	if tubeFrom < 0 {
@@ -144,7 +166,7 @@ func (f *Filter) Filter(query *seq.Seq, selfAlign, complement bool, morass *mora
 
 	f.tubes = nil
 
-	return f.morass.Finalise()
+	return nil
 }
 
 // A tubeState stores active filter bin states.
@@ -263,5 +285,5 @@ func (f *Filter) addHit(tubeIndex, QLo, QHi int) error {
 		DiagIndex: f.target.Len() - tubeIndex*f.tubeOffset,
 	}
 
-	return f.morass.Push(fh)
+	return f.sink.Push(fh)
 }
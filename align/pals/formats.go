@@ -0,0 +1,487 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/align/pals/dp"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/gff"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// In the tabular formats, the A feature of a FeaturePair is the target and the B feature is
+// the query, matching the GFF output of Writer. Segments are given on the forward strand of
+// each sequence, with the strand relationship between them held in the FeaturePair's Strand.
+// Only the extent, score and error rate of PALS alignments are known, so match counts are
+// derived from the error rate and PSL records describe each alignment as one block, or as two
+// blocks separated by an insert when the aligned segments differ in length.
+
+// Lengths returns the lengths of the sequences packed into packed, keyed by name. Sequences
+// that are not packed are included with their own length.
+func Lengths(packed ...*seq.Seq) map[string]int {
+	l := make(map[string]int)
+	for _, p := range packed {
+		if m, ok := p.Meta.(seqMap); ok {
+			for _, c := range m.contigs {
+				l[c.seq.ID] = c.seq.Len()
+			}
+		} else {
+			l[p.ID] = p.Len()
+		}
+	}
+	return l
+}
+
+// Return the name of the sequence holding f.
+func name(f *feat.Feature) string {
+	if f.Location != "" {
+		return f.Location
+	}
+	return f.ID
+}
+
+func round(f float64) int { return int(math.Floor(f + 0.5)) }
+
+// A tabWriter is the basis of the tabular format writers.
+type tabWriter struct {
+	f       io.WriteCloser
+	w       *bufio.Writer
+	lengths map[string]int
+}
+
+func newTabWriter(f io.WriteCloser, lengths map[string]int) *tabWriter {
+	return &tabWriter{f: f, w: bufio.NewWriter(f), lengths: lengths}
+}
+
+// length returns the length of the sequence holding f.
+func (w *tabWriter) length(f *feat.Feature) (int, error) {
+	n, ok := w.lengths[name(f)]
+	if !ok {
+		return 0, bio.NewError(fmt.Sprintf("pals: no length for %s", name(f)), 0, f)
+	}
+	return n, nil
+}
+
+// Close the writer, flushing any unwritten data.
+func (w *tabWriter) Close() (err error) {
+	err = w.w.Flush()
+	if err != nil {
+		return
+	}
+	return w.f.Close()
+}
+
+// A PAFWriter writes feature pairs in the Pairwise mApping Format used by minimap2.
+// Alignment score and error rate are written in AS and dv tags.
+type PAFWriter struct {
+	*tabWriter
+}
+
+// Returns a new PAF writer using f. Sequence lengths are obtained from lengths.
+func NewPAFWriter(f io.WriteCloser, lengths map[string]int) *PAFWriter {
+	return &PAFWriter{newTabWriter(f, lengths)}
+}
+
+// Write a single feature pair and return the number of bytes written and any error.
+func (w *PAFWriter) Write(pair *FeaturePair) (n int, err error) {
+	ql, err := w.length(pair.B)
+	if err != nil {
+		return 0, err
+	}
+	tl, err := w.length(pair.A)
+	if err != nil {
+		return 0, err
+	}
+	strand := '+'
+	if pair.Strand < 0 {
+		strand = '-'
+	}
+	alnLen := max(pair.A.Len(), pair.B.Len())
+	return fmt.Fprintf(w.w, "%s\t%d\t%d\t%d\t%c\t%s\t%d\t%d\t%d\t%d\t%d\t255\tAS:i:%d\tdv:f:%.4f\n",
+		name(pair.B), ql, pair.B.Start, pair.B.End, strand,
+		name(pair.A), tl, pair.A.Start, pair.A.End,
+		round((1-pair.Error)*float64(alnLen)), alnLen,
+		pair.Score, pair.Error)
+}
+
+// WriteHit writes a DPHit between the packed target and query sequences.
+func (w *PAFWriter) WriteHit(target, query *seq.Seq, hit dp.DPHit, comp bool) (int, error) {
+	pair, err := NewFeaturePair(target, query, hit, comp)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(pair)
+}
+
+// A BlastWriter writes feature pairs in BLAST tabular (-outfmt 6) format. E-values are not
+// calculated and are written as zero, and the bit score field holds the PALS alignment score.
+type BlastWriter struct {
+	*tabWriter
+}
+
+// Returns a new BLAST tabular writer using f.
+func NewBlastWriter(f io.WriteCloser) *BlastWriter {
+	return &BlastWriter{newTabWriter(f, nil)}
+}
+
+// Write a single feature pair and return the number of bytes written and any error.
+func (w *BlastWriter) Write(pair *FeaturePair) (n int, err error) {
+	la, lb := pair.A.Len(), pair.B.Len()
+	alnLen := max(la, lb)
+	var gapOpen int
+	if la != lb {
+		gapOpen = 1
+	}
+	ss, se := pair.A.Start+1, pair.A.End
+	if pair.Strand < 0 {
+		ss, se = se, ss
+	}
+	return fmt.Fprintf(w.w, "%s\t%s\t%.2f\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t0\t%d\n",
+		name(pair.B), name(pair.A), 100*(1-pair.Error), alnLen,
+		round(pair.Error*float64(alnLen)), gapOpen,
+		pair.B.Start+1, pair.B.End, ss, se, pair.Score)
+}
+
+// WriteHit writes a DPHit between the packed target and query sequences.
+func (w *BlastWriter) WriteHit(target, query *seq.Seq, hit dp.DPHit, comp bool) (int, error) {
+	pair, err := NewFeaturePair(target, query, hit, comp)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(pair)
+}
+
+// A PSLWriter writes feature pairs in the BLAT PSL format without a header.
+type PSLWriter struct {
+	*tabWriter
+}
+
+// Returns a new PSL writer using f. Sequence lengths are obtained from lengths.
+func NewPSLWriter(f io.WriteCloser, lengths map[string]int) *PSLWriter {
+	return &PSLWriter{newTabWriter(f, lengths)}
+}
+
+// Write a single feature pair and return the number of bytes written and any error.
+func (w *PSLWriter) Write(pair *FeaturePair) (n int, err error) {
+	qSize, err := w.length(pair.B)
+	if err != nil {
+		return 0, err
+	}
+	tSize, err := w.length(pair.A)
+	if err != nil {
+		return 0, err
+	}
+	la, lb := pair.A.Len(), pair.B.Len()
+	block := min(la, lb)
+	misMatches := round(pair.Error * float64(block))
+	strand, qStart := '+', pair.B.Start
+	if pair.Strand < 0 {
+		strand, qStart = '-', qSize-pair.B.End
+	}
+
+	// Alignments of unequal extent are described as two blocks either side of a single
+	// insert of the length difference, so that the blocks span the whole of both segments.
+	var (
+		qNumInsert, tNumInsert  int
+		sizes, qStarts, tStarts string
+	)
+	switch h := block / 2; {
+	case la == lb:
+		sizes = fmt.Sprintf("%d,", block)
+		qStarts = fmt.Sprintf("%d,", qStart)
+		tStarts = fmt.Sprintf("%d,", pair.A.Start)
+	case h == 0:
+		return 0, bio.NewError("pals: alignment too short for PSL blocks", 0, pair)
+	default:
+		if lb > block {
+			qNumInsert = 1
+		}
+		if la > block {
+			tNumInsert = 1
+		}
+		sizes = fmt.Sprintf("%d,%d,", h, block-h)
+		qStarts = fmt.Sprintf("%d,%d,", qStart, qStart+h+lb-block)
+		tStarts = fmt.Sprintf("%d,%d,", pair.A.Start, pair.A.Start+h+la-block)
+	}
+	return fmt.Fprintf(w.w, "%d\t%d\t0\t0\t%d\t%d\t%d\t%d\t%c\t%s\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+		block-misMatches, misMatches, qNumInsert, lb-block, tNumInsert, la-block, strand,
+		name(pair.B), qSize, pair.B.Start, pair.B.End,
+		name(pair.A), tSize, pair.A.Start, pair.A.End,
+		strings.Count(sizes, ","), sizes, qStarts, tStarts)
+}
+
+// WriteHit writes a DPHit between the packed target and query sequences.
+func (w *PSLWriter) WriteHit(target, query *seq.Seq, hit dp.DPHit, comp bool) (int, error) {
+	pair, err := NewFeaturePair(target, query, hit, comp)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(pair)
+}
+
+// A tabReader is the basis of the tabular format readers.
+type tabReader struct {
+	f io.ReadCloser
+	r *bufio.Reader
+}
+
+func newTabReader(f io.ReadCloser) *tabReader {
+	return &tabReader{f: f, r: bufio.NewReader(f)}
+}
+
+// fields returns the tab separated fields of the next line that is not blank and does not
+// start with '#'.
+func (r *tabReader) fields() ([]string, error) {
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		return strings.Split(line, "\t"), nil
+	}
+}
+
+// Close the reader.
+func (r *tabReader) Close() error { return r.f.Close() }
+
+// ints parses the fields of f into integers.
+func ints(f []string) ([]int, error) {
+	v := make([]int, len(f))
+	for i, s := range f {
+		var err error
+		v[i], err = strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func newPair(tName string, tStart, tEnd int, qName string, qStart, qEnd int, strand int8) *FeaturePair {
+	return &FeaturePair{
+		A: &feat.Feature{
+			ID:       fmt.Sprintf("%s:%d..%d", tName, tStart, tEnd),
+			Location: tName,
+			Start:    tStart,
+			End:      tEnd,
+		},
+		B: &feat.Feature{
+			ID:       fmt.Sprintf("%s:%d..%d", qName, qStart, qEnd),
+			Location: qName,
+			Start:    qStart,
+			End:      qEnd,
+		},
+		Strand: strand,
+	}
+}
+
+// A PAFReader reads feature pairs from PAF format.
+type PAFReader struct {
+	*tabReader
+}
+
+// Returns a new PAF reader using f.
+func NewPAFReader(f io.ReadCloser) *PAFReader { return &PAFReader{newTabReader(f)} }
+
+// Read a single feature pair and return it or an error. If AS and dv tags are absent, the
+// score is the number of matching bases and the error rate is derived from it.
+func (r *PAFReader) Read() (*FeaturePair, error) {
+	f, err := r.fields()
+	if err != nil {
+		return nil, err
+	}
+	if len(f) < 12 {
+		return nil, bio.NewError("pals: short PAF line", 0, f)
+	}
+	v, err := ints([]string{f[2], f[3], f[7], f[8], f[9], f[10]})
+	if err != nil {
+		return nil, err
+	}
+	var strand int8
+	switch f[4] {
+	case "+":
+		strand = 1
+	case "-":
+		strand = -1
+	default:
+		return nil, bio.NewError("pals: bad PAF strand", 0, f)
+	}
+	fp := newPair(f[5], v[2], v[3], f[0], v[0], v[1], strand)
+	fp.Score = v[4]
+	if v[5] > 0 {
+		fp.Error = 1 - float64(v[4])/float64(v[5])
+	}
+	for _, t := range f[12:] {
+		switch {
+		case strings.HasPrefix(t, "AS:i:"):
+			if fp.Score, err = strconv.Atoi(t[5:]); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(t, "dv:f:"):
+			if fp.Error, err = strconv.ParseFloat(t[5:], 64); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fp, nil
+}
+
+// A BlastReader reads feature pairs from BLAST tabular (-outfmt 6) format.
+type BlastReader struct {
+	*tabReader
+}
+
+// Returns a new BLAST tabular reader using f.
+func NewBlastReader(f io.ReadCloser) *BlastReader { return &BlastReader{newTabReader(f)} }
+
+// Read a single feature pair and return it or an error. The score is the integer part of
+// the bit score.
+func (r *BlastReader) Read() (*FeaturePair, error) {
+	f, err := r.fields()
+	if err != nil {
+		return nil, err
+	}
+	if len(f) < 12 {
+		return nil, bio.NewError("pals: short BLAST tabular line", 0, f)
+	}
+	v, err := ints(f[6:10])
+	if err != nil {
+		return nil, err
+	}
+	pident, err := strconv.ParseFloat(f[2], 64)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := strconv.ParseFloat(f[11], 64)
+	if err != nil {
+		return nil, err
+	}
+	var strand int8 = 1
+	qs, qe, ss, se := v[0], v[1], v[2], v[3]
+	if qs > qe {
+		qs, qe = qe, qs
+		strand = -strand
+	}
+	if ss > se {
+		ss, se = se, ss
+		strand = -strand
+	}
+	fp := newPair(f[1], ss-1, se, f[0], qs-1, qe, strand)
+	fp.Score = int(bits)
+	fp.Error = 1 - pident/100
+	return fp, nil
+}
+
+// A PSLReader reads feature pairs from PSL format, skipping any psLayout header.
+type PSLReader struct {
+	*tabReader
+}
+
+// Returns a new PSL reader using f.
+func NewPSLReader(f io.ReadCloser) *PSLReader { return &PSLReader{newTabReader(f)} }
+
+// Read a single feature pair and return it or an error. The error rate is the fraction of
+// aligned bases that are mismatches and the score is calculated as by the UCSC pslScore.
+func (r *PSLReader) Read() (*FeaturePair, error) {
+	var f []string
+	for {
+		var err error
+		f, err = r.fields()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.Atoi(f[0]); err == nil {
+			break
+		}
+	}
+	if len(f) < 21 {
+		return nil, bio.NewError("pals: short PSL line", 0, f)
+	}
+	v, err := ints([]string{f[0], f[1], f[2], f[4], f[6], f[11], f[12], f[15], f[16]})
+	if err != nil {
+		return nil, err
+	}
+	var strand int8
+	switch f[8] {
+	case "+", "++", "--":
+		strand = 1
+	case "-", "+-", "-+":
+		strand = -1
+	default:
+		return nil, bio.NewError("pals: bad PSL strand", 0, f)
+	}
+	fp := newPair(f[13], v[7], v[8], f[9], v[5], v[6], strand)
+	matches, misMatches, repMatches := v[0], v[1], v[2]
+	if aligned := matches + misMatches + repMatches; aligned > 0 {
+		fp.Error = float64(misMatches) / float64(aligned)
+	}
+	fp.Score = matches + repMatches/2 - misMatches - v[3] - v[4]
+	return fp, nil
+}
+
+// A Reader reads feature pairs from PALS GFF output.
+type Reader struct {
+	r *gff.Reader
+}
+
+// Returns a new PALS reader using f.
+func NewReader(f io.ReadCloser) *Reader {
+	return &Reader{gff.NewReader(f)}
+}
+
+// Returns a new PALS reader using a filename.
+func NewReaderName(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(f), nil
+}
+
+// Read a single feature pair and return it or an error. Feature pairs are returned in the
+// orientation written by Writer and NewFeaturePair, with the target as A and the GFF feature,
+// the query, as B.
+func (r *Reader) Read() (*FeaturePair, error) {
+	for {
+		f, err := r.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if f == nil || f.Meta != nil {
+			continue
+		}
+		fp, err := ExpandFeature(f)
+		if err != nil {
+			return nil, err
+		}
+		return fp.Invert(), nil
+	}
+}
+
+// Close the reader.
+func (r *Reader) Close() error { return r.r.Close() }
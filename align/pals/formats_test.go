@@ -0,0 +1,193 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/align/pals/dp"
+	"code.google.com/p/biogo/feat"
+	"io"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"strings"
+)
+
+// Helpers
+var (
+	formatPairs = []*FeaturePair{
+		{
+			A:     &feat.Feature{ID: "chr1", Location: "chr1", Start: 100, End: 600},
+			B:     &feat.Feature{ID: "chr2", Location: "chr2", Start: 2000, End: 2490},
+			Score: 300, Error: 0.04, Strand: 1,
+		},
+		{
+			A:     &feat.Feature{ID: "chr1", Location: "chr1", Start: 5000, End: 5400},
+			B:     &feat.Feature{ID: "chr1", Location: "chr1", Start: 9000, End: 9400},
+			Score: 350, Error: 0.02, Strand: -1,
+		},
+	}
+	formatLengths = map[string]int{"chr1": 10000, "chr2": 3000}
+)
+
+type pairWriter interface {
+	Write(*FeaturePair) (int, error)
+	Close() error
+}
+
+type pairReader interface {
+	Read() (*FeaturePair, error)
+}
+
+func roundTrip(c *check.C, w pairWriter, b *B, r func(io.ReadCloser) pairReader) []*FeaturePair {
+	for _, fp := range formatPairs {
+		n, err := w.Write(fp)
+		c.Check(n, check.Not(check.Equals), 0)
+		c.Check(err, check.Equals, nil)
+	}
+	c.Check(w.Close(), check.Equals, nil)
+	rd := r(ioutil.NopCloser(bytes.NewReader(b.Bytes())))
+	var fps []*FeaturePair
+	for {
+		fp, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.Equals, nil)
+		fps = append(fps, fp)
+	}
+	c.Assert(len(fps), check.Equals, len(formatPairs))
+	for i, fp := range fps {
+		e := formatPairs[i]
+		c.Check(fp.A.Location, check.Equals, e.A.Location)
+		c.Check(fp.B.Location, check.Equals, e.B.Location)
+		c.Check([]int{fp.A.Start, fp.A.End, fp.B.Start, fp.B.End}, check.DeepEquals, []int{e.A.Start, e.A.End, e.B.Start, e.B.End})
+		c.Check(fp.Strand, check.Equals, e.Strand)
+		c.Check(fp.Error, floatApprox, e.Error, 0.05)
+	}
+	return fps
+}
+
+// Tests
+func (s *S) TestPAF(c *check.C) {
+	b := &B{&bytes.Buffer{}}
+	fps := roundTrip(c, NewPAFWriter(b, formatLengths), b, func(f io.ReadCloser) pairReader { return NewPAFReader(f) })
+	c.Check(strings.Split(b.String(), "\n")[0], check.Equals,
+		"chr2\t3000\t2000\t2490\t+\tchr1\t10000\t100\t600\t480\t500\t255\tAS:i:300\tdv:f:0.0400")
+	c.Check(fps[0].Score, check.Equals, 300)
+
+	_, err := NewPAFWriter(b, nil).Write(formatPairs[0])
+	c.Check(err, check.NotNil)
+
+	// Untagged records derive the error rate from the match count.
+	fp, err := NewPAFReader(ioutil.NopCloser(strings.NewReader("q\t100\t0\t100\t-\tt\t200\t50\t150\t90\t100\t60\n"))).Read()
+	c.Assert(err, check.Equals, nil)
+	c.Check(fp.Score, check.Equals, 90)
+	c.Check(fp.Error, floatApprox, 0.1, 1e-9)
+	c.Check(fp.Strand, check.Equals, int8(-1))
+}
+
+func (s *S) TestBlast(c *check.C) {
+	b := &B{&bytes.Buffer{}}
+	fps := roundTrip(c, NewBlastWriter(b), b, func(f io.ReadCloser) pairReader { return NewBlastReader(f) })
+	c.Check(strings.Split(b.String(), "\n")[1], check.Equals,
+		"chr1\tchr1\t98.00\t400\t8\t0\t9001\t9400\t5400\t5001\t0\t350")
+	c.Check(fps[1].Score, check.Equals, 350)
+}
+
+func (s *S) TestPSL(c *check.C) {
+	b := &B{&bytes.Buffer{}}
+	fps := roundTrip(c, NewPSLWriter(b, formatLengths), b, func(f io.ReadCloser) pairReader { return NewPSLReader(f) })
+	c.Check(strings.Split(b.String(), "\n")[:2], check.DeepEquals, []string{
+		"470\t20\t0\t0\t0\t0\t1\t10\t+\tchr2\t3000\t2000\t2490\tchr1\t10000\t100\t600\t2\t245,245,\t2000,2245,\t100,355,",
+		"392\t8\t0\t0\t0\t0\t0\t0\t-\tchr1\t10000\t9000\t9400\tchr1\t10000\t5000\t5400\t1\t400,\t600,\t5000,",
+	})
+	c.Check(fps[0].Score, check.Equals, 449)
+
+	// A psLayout header is skipped.
+	h := "psLayout version 3\n\nmatch\tmis-\trep.\n\tmatch\tmatch\n---------------------------------\n" +
+		strings.Split(b.String(), "\n")[1] + "\n"
+	fp, err := NewPSLReader(ioutil.NopCloser(strings.NewReader(h))).Read()
+	c.Assert(err, check.Equals, nil)
+	c.Check(fp.Strand, check.Equals, int8(-1))
+}
+
+func (s *S) TestWriteHit(c *check.C) {
+	l := Lengths(ps)
+	c.Check(l["deBruijn8"], check.Equals, 65536)
+	c.Check(len(l), check.Equals, int(maxk))
+	b := &B{&bytes.Buffer{}}
+	w := NewPAFWriter(b, l)
+	_, err := w.WriteHit(ps, ps, dp.DPHit{Abpos: 29*binSize + 10, Aepos: 29*binSize + 110, Bbpos: 29*binSize + 200, Bepos: 29*binSize + 300, Score: 100}, false)
+	c.Check(err, check.Equals, nil)
+	w.Close()
+	c.Check(b.String(), check.Equals, "deBruijn8\t65536\t1224\t1324\t+\tdeBruijn8\t65536\t1034\t1134\t100\t100\t255\tAS:i:100\tdv:f:0.0000\n")
+}
+
+func (s *S) TestGFF(c *check.C) {
+	b := &B{&bytes.Buffer{}}
+	fps := roundTrip(c, NewWriter(b, 2, 60, true), b, func(f io.ReadCloser) pairReader { return NewReader(f) })
+
+	// Converting PALS GFF to PAF keeps the query and target of directly written PAF.
+	gffPAF, direct := &B{&bytes.Buffer{}}, &B{&bytes.Buffer{}}
+	for _, t := range []struct {
+		b   *B
+		fps []*FeaturePair
+	}{{gffPAF, fps}, {direct, formatPairs}} {
+		w := NewPAFWriter(t.b, formatLengths)
+		for _, fp := range t.fps {
+			_, err := w.Write(fp)
+			c.Check(err, check.Equals, nil)
+		}
+		c.Check(w.Close(), check.Equals, nil)
+	}
+	got := strings.Split(strings.TrimSpace(gffPAF.String()), "\n")
+	want := strings.Split(strings.TrimSpace(direct.String()), "\n")
+	c.Assert(len(got), check.Equals, len(want))
+	for i := range want {
+		c.Check(strings.Fields(got[i])[:9], check.DeepEquals, strings.Fields(want[i])[:9])
+	}
+}
+
+func (s *S) TestReadRepile(c *check.C) {
+	b := &B{&bytes.Buffer{}}
+	w := NewWriter(b, 2, 60, true)
+	for _, fp := range formatPairs {
+		_, err := w.Write(fp)
+		c.Check(err, check.Equals, nil)
+	}
+	w.Close()
+
+	r := NewReader(ioutil.NopCloser(bytes.NewReader(b.Bytes())))
+	p := NewPiler(0)
+	var n int
+	for {
+		fp, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.Equals, nil)
+		c.Check(fp.A.Location, check.Equals, formatPairs[n].A.Location)
+		c.Check(fp.B.Location, check.Equals, formatPairs[n].B.Location)
+		c.Check(fp.A.Start, check.Equals, formatPairs[n].A.Start)
+		c.Check(fp.Score, check.Equals, formatPairs[n].Score)
+		c.Check(p.Add(fp), check.Equals, nil)
+		n++
+	}
+	c.Check(n, check.Equals, 2)
+	piles, err := p.Piles(nil)
+	c.Check(err, check.Equals, nil)
+	c.Check(len(piles), check.Equals, 4)
+}
@@ -119,6 +119,19 @@ func NewFeaturePair(target, query *seq.Seq, hit dp.DPHit, comp bool) (*FeaturePa
 	}, nil
 }
 
+// Convert DPHits and two packed sequences into FeaturePairs.
+func NewFeaturePairs(target, query *seq.Seq, hits dp.DPHits, comp bool) ([]*FeaturePair, error) {
+	fps := make([]*FeaturePair, 0, len(hits))
+	for _, hit := range hits {
+		fp, err := NewFeaturePair(target, query, hit, comp)
+		if err != nil {
+			return nil, err
+		}
+		fps = append(fps, fp)
+	}
+	return fps, nil
+}
+
 // Expand a feat.Feature containing a PALS-type feature attribute into a FeaturePair.
 func ExpandFeature(f *feat.Feature) (*FeaturePair, error) {
 	if len(f.Attributes) < 7 || f.Attributes[:7] != "Target " {
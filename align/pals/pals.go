@@ -26,6 +26,7 @@ import (
 	"code.google.com/p/biogo/util"
 	"io"
 	"os"
+	"sync"
 	"unsafe"
 )
 
@@ -47,6 +48,10 @@ var (
 	TubeOffsetDelta    = 32
 )
 
+// Length of query segments filtered concurrently. Queries no longer than FilterChunk are
+// filtered as a single segment.
+var FilterChunk = 1 << 20
+
 // Default word characteristics.
 var (
 	MinWordLength = 4  // For minimum word length, choose k=4 arbitrarily.
@@ -77,6 +82,7 @@ type PALS struct {
 	maxMem     *uintptr
 	hitFilter  *filter.Filter
 	morass     *morass.Morass
+	checkpoint *checkpoint
 	err        error
 	threads    int
 }
@@ -226,13 +232,35 @@ func (p *PALS) AvgIndexListLength(filterParams *filter.Params) float64 {
 // Return an estimate of the amount of memory required for the filter.
 func (p *PALS) filterMemRequired(filterParams *filter.Params) uintptr {
 	words := util.Pow4(filterParams.WordSize)
-	tubeWidth := filterParams.TubeOffset + filterParams.MaxError
-	maxActiveTubes := (p.target.Len()+tubeWidth-1)/filterParams.TubeOffset + 1
-	tubes := uintptr(maxActiveTubes) * unsafe.Sizeof(tubeState{})
 	finger := unsafe.Sizeof(uint32(0)) * uintptr(words)
 	pos := unsafe.Sizeof(0) * uintptr(p.target.Len())
 
-	return finger + pos + tubes
+	return finger + pos + p.tubesMemRequired(filterParams)
+}
+
+// Return an estimate of the amount of memory required for the tubes of each concurrent filter.
+func (p *PALS) tubesMemRequired(filterParams *filter.Params) uintptr {
+	tubeWidth := filterParams.TubeOffset + filterParams.MaxError
+	maxActiveTubes := (p.target.Len()+tubeWidth-1)/filterParams.TubeOffset + 1
+	return uintptr(maxActiveTubes) * unsafe.Sizeof(tubeState{})
+}
+
+// Return the number of concurrent workers, each requiring per bytes in addition to the base
+// requirement, that can be run within the memory limit and thread count of the receiver.
+func (p *PALS) workers(base, per uintptr) int {
+	n := p.threads
+	if n < 1 {
+		n = 1
+	}
+	if p.maxMem != nil && per > 0 {
+		if *p.maxMem < base+per {
+			return 1
+		}
+		if m := (*p.maxMem - base) / per; m < uintptr(n) {
+			n = int(m)
+		}
+	}
+	return n
 }
 
 // filter.tubeState is repeated here to allow memory calculation without exporting tubeState from filter package.
@@ -282,10 +310,17 @@ func (p *PALS) Align(complement bool) (dp.DPHits, error) {
 	if p.err != nil {
 		return nil, p.err
 	}
-	var (
-		working *seq.Seq
-		err     error
-	)
+	hits := dp.DPHits{}
+	ok, err := p.checkpoint.load(strandName(complement)+".hits", &hits)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		p.notifyf("Resumed %d hits from checkpoint", len(hits))
+		return hits, nil
+	}
+
+	var working *seq.Seq
 	if complement {
 		p.notify("Complementing query")
 		working, _ = p.query.RevComp()
@@ -294,8 +329,46 @@ func (p *PALS) Align(complement bool) (dp.DPHits, error) {
 		working = p.query
 	}
 
+	var trapezoids filter.Trapezoids
+	ok, err = p.checkpoint.load(strandName(complement)+".traps", &trapezoids)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		p.notifyf("Resumed %d trapezoids from checkpoint", len(trapezoids))
+	} else {
+		trapezoids, err = p.merge(working, complement)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.notify("Aligning")
+	aligner := dp.NewAligner(p.target, working, p.FilterParams.WordSize, p.DPParams.MinHitLength, p.DPParams.MinId)
+	aligner.Config = &dp.AlignConfig{
+		MaxIGap:    p.MaxIGap,
+		DiffCost:   p.DiffCost,
+		SameCost:   p.SameCost,
+		MatchCost:  p.MatchCost,
+		BlockCost:  p.BlockCost,
+		RMatchCost: p.RMatchCost,
+	}
+	base := p.MemRequired(p.FilterParams) - p.tubesMemRequired(p.FilterParams)
+	hits = aligner.AlignTrapsConcurrent(trapezoids, p.workers(base, aligner.MemRequired(trapezoids)))
+	hitCoverageA, hitCoverageB, err := hits.Sum()
+	if err != nil {
+		return nil, err
+	}
+	p.notifyf("Aligned %d hits covering %d x %d", len(hits), hitCoverageA, hitCoverageB)
+
+	return hits, p.checkpoint.save(strandName(complement)+".hits", hits)
+}
+
+// Filter working and merge the filter hits into trapezoids. If a checkpoint is set, the
+// trapezoids are saved and the filter hits of the completed segments discarded.
+func (p *PALS) merge(working *seq.Seq, complement bool) (filter.Trapezoids, error) {
 	p.notify("Filtering")
-	err = p.hitFilter.Filter(working, p.selfCompare, complement, p.morass)
+	err := p.filter(working, complement)
 	if err != nil {
 		return nil, err
 	}
@@ -318,24 +391,76 @@ func (p *PALS) Align(complement bool) (dp.DPHits, error) {
 	lt, lq := trapezoids.Sum()
 	p.notifyf("Merged %d trapezoids covering %d x %d", len(trapezoids), lt, lq)
 
-	p.notify("Aligning")
-	aligner := dp.NewAligner(p.target, working, p.FilterParams.WordSize, p.DPParams.MinHitLength, p.DPParams.MinId)
-	aligner.Config = &dp.AlignConfig{
-		MaxIGap:    p.MaxIGap,
-		DiffCost:   p.DiffCost,
-		SameCost:   p.SameCost,
-		MatchCost:  p.MatchCost,
-		BlockCost:  p.BlockCost,
-		RMatchCost: p.RMatchCost,
+	if err = p.checkpoint.save(strandName(complement)+".traps", trapezoids); err != nil {
+		return nil, err
 	}
-	hits := aligner.AlignTraps(trapezoids)
-	hitCoverageA, hitCoverageB, err := hits.Sum()
+	return trapezoids, p.checkpoint.clearSegments(complement)
+}
+
+// Filter working against the index, concurrently filtering overlapping segments of working
+// if it is longer than FilterChunk. The filter hits obtained are independent of the number
+// of segments filtered concurrently. If a checkpoint is set, the filter hits of each segment
+// are saved as the segment is completed, and loaded rather than filtered when resuming.
+func (p *PALS) filter(working *seq.Seq, complement bool) error {
+	if working.Len() <= FilterChunk && p.checkpoint == nil {
+		return p.hitFilter.Filter(working, p.selfCompare, complement, p.morass)
+	}
+
+	// Segments overlap by the minimum hit length so that every
+	// filter hit is contained within at least one segment.
+	type segment struct{ i, from, to int }
+	var segs []segment
+	for from := 0; from < working.Len(); from += FilterChunk {
+		to := from + FilterChunk + p.FilterParams.MinMatch
+		if to > working.Len() {
+			to = working.Len()
+		}
+		segs = append(segs, segment{len(segs), from, to})
+	}
+
+	base := p.MemRequired(p.FilterParams) - p.tubesMemRequired(p.FilterParams)
+	n := p.workers(base, p.tubesMemRequired(p.FilterParams))
+	if n > len(segs) {
+		n = len(segs)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+		work = make(chan segment)
+	)
+	for i := 0; i < n; i++ {
+		f := p.hitFilter
+		if i > 0 {
+			f = filter.New(p.index, p.FilterParams)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				var e error
+				if p.checkpoint == nil {
+					e = f.FilterRange(working, s.from, s.to, p.selfCompare, complement, p.morass)
+				} else {
+					e = p.checkpoint.filterRange(f, working, s.i, s.from, s.to, p.selfCompare, complement, p.morass)
+				}
+				if e != nil {
+					once.Do(func() { err = e })
+				}
+			}
+		}()
+	}
+	for _, s := range segs {
+		work <- s
+	}
+	close(work)
+	wg.Wait()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	p.notifyf("Aligned %d hits covering %d x %d", len(hits), hitCoverageA, hitCoverageB)
 
-	return hits, nil
+	return p.morass.Finalise()
 }
 
 // Remove filesystem components of filter. This should be called after the last use of the aligner.
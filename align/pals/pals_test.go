@@ -19,11 +19,13 @@ import (
 	"bytes"
 	"code.google.com/p/biogo/align/pals/dp"
 	"code.google.com/p/biogo/align/pals/filter"
+	"code.google.com/p/biogo/morass"
 	"code.google.com/p/biogo/seq"
 	"code.google.com/p/biogo/util"
 	"fmt"
 	check "launchpad.net/gocheck"
 	"math"
+	"math/rand"
 	"testing"
 )
 
@@ -44,6 +46,47 @@ type B struct {
 
 func (b *B) Close() error { return nil }
 
+// chromosome returns a random sequence of length n containing copies copies of a
+// repeat of length r, each with approximately 2% substitutions.
+func chromosome(n, r, copies int, seed int64) *seq.Seq {
+	rnd := rand.New(rand.NewSource(seed))
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = l[rnd.Intn(Q)]
+	}
+	rep := make([]byte, r)
+	for i := range rep {
+		rep[i] = l[rnd.Intn(Q)]
+	}
+	for c := 0; c < copies; c++ {
+		p := (c*n)/copies + rnd.Intn(n/copies-r)
+		for i, b := range rep {
+			if rnd.Float64() < 0.02 {
+				b = l[rnd.Intn(Q)]
+			}
+			s[p+i] = b
+		}
+	}
+	return &seq.Seq{ID: "chr", Seq: s}
+}
+
+// selfAlign returns the hits of a self comparison of t using the given number of threads.
+func selfAlign(t *seq.Seq, threads int, mem *uintptr) (dp.DPHits, error) {
+	m, err := morass.New(filter.FilterHit{}, "", "", 2<<20, false)
+	if err != nil {
+		return nil, err
+	}
+	p := New(t, t, true, m, threads, 0, mem, nil)
+	defer p.CleanUp()
+	if err = p.Optimise(DefaultLength, DefaultMinIdentity); err != nil {
+		return nil, err
+	}
+	if err = p.BuildIndex(); err != nil {
+		return nil, err
+	}
+	return p.Align(false)
+}
+
 // Checkers
 type floatApproxChecker struct {
 	*check.CheckerInfo
@@ -134,6 +177,60 @@ func (s *S) TestOptimise(c *check.C) {
 	}
 }
 
+func (s *S) TestAlignConcurrent(c *check.C) {
+	defer func(n int) { FilterChunk = n }(FilterChunk)
+	t := chromosome(100000, 1000, 4, 1)
+
+	mem := uintptr(32 << 20)
+	single, err := selfAlign(t, 1, &mem)
+	c.Assert(err, check.Equals, nil)
+	// Each pair of the four repeat copies is found.
+	c.Check(len(single) >= 6, check.Equals, true)
+
+	// Align may be repeated on an indexed PALS.
+	m, err := morass.New(filter.FilterHit{}, "", "", 2<<20, false)
+	c.Assert(err, check.Equals, nil)
+	p := New(t, t, true, m, 2, 0, &mem, nil)
+	defer p.CleanUp()
+	c.Assert(p.Optimise(DefaultLength, DefaultMinIdentity), check.Equals, nil)
+	c.Assert(p.BuildIndex(), check.Equals, nil)
+	for i := 0; i < 2; i++ {
+		hits, err := p.Align(false)
+		c.Assert(err, check.Equals, nil)
+		c.Check(hits, check.DeepEquals, single)
+	}
+
+	// Chunked and unchunked filtering give the same alignments for any number of threads.
+	for _, chunk := range []int{1 << 20, 10000} {
+		FilterChunk = chunk
+		for _, threads := range []int{1, 2, 4} {
+			hits, err := selfAlign(t, threads, &mem)
+			c.Assert(err, check.Equals, nil)
+			c.Check(hits, check.DeepEquals, single, check.Commentf("chunk %d threads %d", chunk, threads))
+		}
+	}
+}
+
+func (s *S) TestWorkers(c *check.C) {
+	mem := uintptr(1000)
+	for _, t := range []struct {
+		threads   int
+		mem       *uintptr
+		base, per uintptr
+		workers   int
+	}{
+		{threads: 4, base: 100, per: 100, workers: 4},
+		{threads: 0, base: 100, per: 100, workers: 1},
+		{threads: 8, mem: &mem, base: 200, per: 100, workers: 8},
+		{threads: 16, mem: &mem, base: 200, per: 100, workers: 8},
+		{threads: 16, mem: &mem, base: 950, per: 100, workers: 1},
+		{threads: 16, mem: &mem, base: 2000, per: 100, workers: 1},
+	} {
+		p := &PALS{threads: t.threads, maxMem: t.mem}
+		c.Check(p.workers(t.base, t.per), check.Equals, t.workers)
+	}
+}
+
 func (s *S) TestPack(c *check.C) {
 	p := NewPacker("")
 	for k := byte(1); k <= maxk; k++ {
@@ -184,3 +281,34 @@ deBruijn5	pals	hit	1	904	0.0000	.	.	Target deBruijn5 1 904; maxe 0
 deBruijn8	pals	hit	1025	4095	0.0000	.	.	Target deBruijn8 1025 4095; maxe 0
 `)
 }
+
+// benchmarkAlign times only Align; construction, optimisation and indexing are serial and
+// are performed once outside the timer.
+func benchmarkAlign(b *testing.B, threads int) {
+	b.StopTimer()
+	t := chromosome(2000000, 2000, 20, 1)
+	mem := uintptr(256 << 20)
+	m, err := morass.New(filter.FilterHit{}, "", "", 2<<20, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := New(t, t, true, m, threads, 0, &mem, nil)
+	defer p.CleanUp()
+	if err = p.Optimise(DefaultLength, DefaultMinIdentity); err != nil {
+		b.Fatal(err)
+	}
+	if err = p.BuildIndex(); err != nil {
+		b.Fatal(err)
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Align(false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAlign1(b *testing.B) { benchmarkAlign(b, 1) }
+func BenchmarkAlign2(b *testing.B) { benchmarkAlign(b, 2) }
+func BenchmarkAlign4(b *testing.B) { benchmarkAlign(b, 4) }
+func BenchmarkAlign8(b *testing.B) { benchmarkAlign(b, 8) }
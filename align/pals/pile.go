@@ -16,8 +16,8 @@
 package pals
 
 import (
-	"code.google.com/p/biogo.interval"
 	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/interval"
 	"fmt"
 	"unsafe"
 )
@@ -55,7 +55,7 @@ func (i *PileInterval) Overlap(b interval.IntRange) bool {
 	return i.End-i.overlap >= b.Start && i.Start <= b.End-i.overlap
 }
 func (i *PileInterval) ID() uintptr              { return uintptr(unsafe.Pointer(i)) }
-func (i *PileInterval) Range() interval.IntRange { return interval.IntRange{i.Start, i.End} }
+func (i *PileInterval) Range() interval.IntRange { return interval.IntRange{Start: i.Start, End: i.End} }
 
 type ContainQuery struct {
 	Start, End int
@@ -67,7 +67,7 @@ func (q *ContainQuery) Overlap(b interval.IntRange) bool {
 	return b.Start <= q.Start+q.Slop && b.End >= q.End-q.Slop
 }
 func (q *ContainQuery) ID() uintptr              { return 0 }
-func (q *ContainQuery) Range() interval.IntRange { return interval.IntRange{q.Start, q.End} }
+func (q *ContainQuery) Range() interval.IntRange { return interval.IntRange{Start: q.Start, End: q.End} }
 
 // NewPiler creates a Piler object ready for piling feature pairs.
 func NewPiler(overlap int) *Piler {
@@ -140,9 +140,9 @@ func (p *Piler) merge(pi *PileInterval) {
 		qi,
 	)
 	for _, d := range r {
-		t.Delete(d, false)
+		t.Delete(d)
 	}
-	t.Insert(pi, false)
+	t.Insert(pi)
 }
 
 // A Pile is a collection of features covering a maximal (potentially contiguous, depending on
@@ -244,7 +244,7 @@ func (p *Piler) Pile(q *ContainQuery) (*PileInterval, error) {
 	// Sanity check: no pile should overlap any other pile within overlap constraints
 	// TODO: Should this be a panic?
 	if c > 1 {
-		return nil, fmt.Errorf("pals: internal inconsistency - too many results:", c)
+		return nil, fmt.Errorf("pals: internal inconsistency - too many results: %d", c)
 	}
 
 	return pt.(*PileInterval), nil
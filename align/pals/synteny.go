@@ -0,0 +1,496 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A Chainer chains feature pairs into colinear, strand-consistent chains and merges chains
+// into synteny blocks.
+type Chainer struct {
+	MaxGap     int     // Maximum gap between chained pairs on either sequence.
+	GapOpen    int     // Cost of a gap between chained pairs.
+	GapExtend  int     // Cost per base of difference between target and query gap lengths.
+	MinScore   int     // Minimum score of a chain.
+	BlockGap   int     // Maximum gap between chains merged into a synteny block.
+	DupOverlap float64 // Minimum fraction of the smaller of two blocks overlapped by the other to indicate duplication.
+}
+
+// DefaultChainer provides parameters suitable for comparing assemblies.
+var DefaultChainer = Chainer{
+	MaxGap:     10000,
+	GapOpen:    10,
+	GapExtend:  1,
+	MinScore:   100,
+	BlockGap:   100000,
+	DupOverlap: 0.5,
+}
+
+// A Chain is a colinear set of feature pairs between a target and a query sequence.
+type Chain struct {
+	Target, Query string
+	Strand        int8
+	TStart, TEnd  int
+	QStart, QEnd  int
+	Score         int
+	Pairs         []*FeaturePair // Ordered by target position.
+}
+
+// A Block is a synteny block of colinear chains.
+type Block struct {
+	Target, Query string
+	Strand        int8
+	TStart, TEnd  int
+	QStart, QEnd  int
+	Score         int
+	Chains        []*Chain // Ordered by target position.
+}
+
+// Return the number of target and query bases covered by chains in the block.
+func (b *Block) aligned() (t, q int) {
+	for _, c := range b.Chains {
+		t += c.TEnd - c.TStart
+		q += c.QEnd - c.QStart
+	}
+	return
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+type pairsByGroup []*FeaturePair
+
+func (p pairsByGroup) Len() int { return len(p) }
+func (p pairsByGroup) Less(i, j int) bool {
+	a, b := p[i], p[j]
+	switch {
+	case name(a.A) != name(b.A):
+		return name(a.A) < name(b.A)
+	case name(a.B) != name(b.B):
+		return name(a.B) < name(b.B)
+	case a.Strand != b.Strand:
+		return a.Strand > b.Strand
+	case a.A.Start != b.A.Start:
+		return a.A.Start < b.A.Start
+	case a.B.Start != b.B.Start:
+		return a.B.Start < b.B.Start
+	case a.A.End != b.A.End:
+		return a.A.End < b.A.End
+	}
+	return a.B.End < b.B.End
+}
+func (p pairsByGroup) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// Chains returns the chains of pairs with a score of at least MinScore, ordered by target
+// and target position. Pairs are chained when they are on the same strand, advance on both
+// sequences and are separated by no more than MaxGap. Chain scores are the sum of the pair
+// scores less gap costs, and each pair is included in at most one chain.
+func (c Chainer) Chains(pairs []*FeaturePair) []*Chain {
+	pairs = append([]*FeaturePair(nil), pairs...)
+	sort.Sort(pairsByGroup(pairs))
+
+	var chains []*Chain
+	for i := 0; i < len(pairs); {
+		j := i + 1
+		for ; j < len(pairs); j++ {
+			if name(pairs[j].A) != name(pairs[i].A) || name(pairs[j].B) != name(pairs[i].B) || pairs[j].Strand != pairs[i].Strand {
+				break
+			}
+		}
+		chains = append(chains, c.chain(pairs[i:j])...)
+		i = j
+	}
+
+	sort.Sort(chainsByPos(chains))
+	return chains
+}
+
+// chain returns the chains of a group of pairs sharing target, query and strand, and
+// sorted by target start.
+func (c Chainer) chain(g []*FeaturePair) []*Chain {
+	var maxLen int
+	for _, p := range g {
+		if l := p.A.Len(); l > maxLen {
+			maxLen = l
+		}
+	}
+
+	strand := g[0].Strand
+	score := make([]int, len(g))
+	pred := make([]int, len(g))
+	for i, p := range g {
+		score[i], pred[i] = p.Score, -1
+		for j := i - 1; j >= 0; j-- {
+			q := g[j]
+			if p.A.Start-q.A.Start > c.MaxGap+maxLen {
+				break
+			}
+			if q.A.Start >= p.A.Start || q.A.End >= p.A.End {
+				continue
+			}
+			ga := p.A.Start - q.A.End
+			var gb int
+			if strand >= 0 {
+				if q.B.Start >= p.B.Start || q.B.End >= p.B.End {
+					continue
+				}
+				gb = p.B.Start - q.B.End
+			} else {
+				if q.B.Start <= p.B.Start || q.B.End <= p.B.End {
+					continue
+				}
+				gb = q.B.Start - p.B.End
+			}
+			if ga > c.MaxGap || gb > c.MaxGap {
+				continue
+			}
+			var cost int
+			if ga > 0 || gb > 0 {
+				cost = c.GapOpen
+			}
+			cost += c.GapExtend * abs(ga-gb)
+			// Penalise bases counted in both overlapping pairs.
+			if o := -min(min(ga, gb), 0); o > 0 {
+				cost += o
+			}
+			if s := score[j] + p.Score - cost; s > score[i] {
+				score[i], pred[i] = s, j
+			}
+		}
+	}
+
+	// Extract chains from their highest scoring ends, truncating
+	// chains that reach pairs already used by a better chain.
+	order := make([]int, len(g))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byScoreDesc{order, score})
+	used := make([]bool, len(g))
+	var chains []*Chain
+	for _, i := range order {
+		if used[i] {
+			continue
+		}
+		var members []int
+		k := i
+		for ; k >= 0 && !used[k]; k = pred[k] {
+			used[k] = true
+			members = append(members, k)
+		}
+		s := score[i]
+		if k >= 0 {
+			s -= score[k]
+		}
+		if s < c.MinScore {
+			continue
+		}
+		ch := &Chain{
+			Target: name(g[i].A),
+			Query:  name(g[i].B),
+			Strand: strand,
+			TStart: g[i].A.Start, TEnd: g[i].A.End,
+			QStart: g[i].B.Start, QEnd: g[i].B.End,
+			Score: s,
+		}
+		for m := len(members) - 1; m >= 0; m-- {
+			p := g[members[m]]
+			ch.Pairs = append(ch.Pairs, p)
+			ch.TStart, ch.TEnd = min(ch.TStart, p.A.Start), max(ch.TEnd, p.A.End)
+			ch.QStart, ch.QEnd = min(ch.QStart, p.B.Start), max(ch.QEnd, p.B.End)
+		}
+		chains = append(chains, ch)
+	}
+	return chains
+}
+
+type byScoreDesc struct {
+	order []int
+	score []int
+}
+
+func (s byScoreDesc) Len() int           { return len(s.order) }
+func (s byScoreDesc) Less(i, j int) bool { return s.score[s.order[i]] > s.score[s.order[j]] }
+func (s byScoreDesc) Swap(i, j int)      { s.order[i], s.order[j] = s.order[j], s.order[i] }
+
+type chainsByPos []*Chain
+
+func (c chainsByPos) Len() int { return len(c) }
+func (c chainsByPos) Less(i, j int) bool {
+	a, b := c[i], c[j]
+	switch {
+	case a.Target != b.Target:
+		return a.Target < b.Target
+	case a.TStart != b.TStart:
+		return a.TStart < b.TStart
+	case a.TEnd != b.TEnd:
+		return a.TEnd < b.TEnd
+	case a.Query != b.Query:
+		return a.Query < b.Query
+	case a.QStart != b.QStart:
+		return a.QStart < b.QStart
+	}
+	return a.Strand > b.Strand
+}
+func (c chainsByPos) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+// Blocks merges chains into synteny blocks, ordered by target and target position. Chains
+// sharing target, query and strand are merged when they are colinear and separated by no
+// more than BlockGap on either sequence, with gap lengths differing by no more than MaxGap.
+// Chains on other strands or queries may lie within a block.
+func (c Chainer) Blocks(chains []*Chain) []*Block {
+	groups := make(map[[2]string]map[int8][]*Chain)
+	var keys [][2]string
+	for _, ch := range chains {
+		k := [2]string{ch.Target, ch.Query}
+		if _, ok := groups[k]; !ok {
+			groups[k] = make(map[int8][]*Chain)
+			keys = append(keys, k)
+		}
+		groups[k][ch.Strand] = append(groups[k][ch.Strand], ch)
+	}
+
+	var blocks []*Block
+	for _, k := range keys {
+		for _, strand := range []int8{1, -1} {
+			g := groups[k][strand]
+			sort.Sort(chainsByPos(g))
+			var b *Block
+			for _, ch := range g {
+				if b != nil {
+					ga := ch.TStart - b.TEnd
+					gb := ch.QStart - b.QEnd
+					if strand < 0 {
+						gb = b.QStart - ch.QEnd
+					}
+					if ga <= c.BlockGap && gb <= c.BlockGap && ga >= -c.MaxGap && gb >= -c.MaxGap && abs(ga-gb) <= c.MaxGap {
+						b.Chains = append(b.Chains, ch)
+						b.TStart, b.TEnd = min(b.TStart, ch.TStart), max(b.TEnd, ch.TEnd)
+						b.QStart, b.QEnd = min(b.QStart, ch.QStart), max(b.QEnd, ch.QEnd)
+						b.Score += ch.Score
+						continue
+					}
+				}
+				b = &Block{
+					Target: ch.Target, Query: ch.Query, Strand: ch.Strand,
+					TStart: ch.TStart, TEnd: ch.TEnd,
+					QStart: ch.QStart, QEnd: ch.QEnd,
+					Score:  ch.Score,
+					Chains: []*Chain{ch},
+				}
+				blocks = append(blocks, b)
+			}
+		}
+	}
+
+	sort.Sort(blocksByPos(blocks))
+	return blocks
+}
+
+type blocksByPos []*Block
+
+func (b blocksByPos) Len() int { return len(b) }
+func (b blocksByPos) Less(i, j int) bool {
+	return chainsByPos{
+		{Target: b[i].Target, Query: b[i].Query, Strand: b[i].Strand, TStart: b[i].TStart, TEnd: b[i].TEnd, QStart: b[i].QStart},
+		{Target: b[j].Target, Query: b[j].Query, Strand: b[j].Strand, TStart: b[j].TStart, TEnd: b[j].TEnd, QStart: b[j].QStart},
+	}.Less(0, 1)
+}
+func (b blocksByPos) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+
+// An Event is a class of rearrangement between target and query.
+type Event int
+
+const (
+	Inversion     Event = iota // A block on the opposite strand to most of its target-query alignment.
+	Translocation              // A block aligning to a query other than the predominant query of its target, or out of order.
+	Duplication                // A block overlapping another block on the target or the query.
+)
+
+func (e Event) String() string {
+	switch e {
+	case Inversion:
+		return "inversion"
+	case Translocation:
+		return "translocation"
+	case Duplication:
+		return "duplication"
+	}
+	return fmt.Sprintf("Event(%d)", int(e))
+}
+
+// A Rearrangement describes a synteny block involved in a rearrangement. Other holds the
+// overlapping block for duplications.
+type Rearrangement struct {
+	Type  Event
+	Block *Block
+	Other *Block
+}
+
+// Rearrangements reports the inversions, translocations and duplications indicated by blocks,
+// which must be ordered as returned by Blocks. For each target, the query and strand covering
+// most of the target are taken as the reference arrangement, and blocks of the predominant
+// query not in the heaviest consistently ordered set of blocks are reported as translocations.
+func (c Chainer) Rearrangements(blocks []*Block) []Rearrangement {
+	var r []Rearrangement
+	for i := 0; i < len(blocks); {
+		j := i + 1
+		for ; j < len(blocks) && blocks[j].Target == blocks[i].Target; j++ {
+		}
+		r = append(r, arrangement(blocks[i:j])...)
+		i = j
+	}
+
+	// Find blocks overlapping on either sequence.
+	for i, a := range blocks {
+		for _, b := range blocks[:i] {
+			if c.duplicated(a, b) {
+				r = append(r, Rearrangement{Type: Duplication, Block: a, Other: b})
+			}
+		}
+	}
+
+	sort.Stable(byBlock(r))
+	return r
+}
+
+// arrangement returns the inversions and translocations of the blocks of a single target.
+func arrangement(blocks []*Block) []Rearrangement {
+	var (
+		r       []Rearrangement
+		byQuery = make(map[string]int)
+		byDir   = make(map[int8]int)
+		query   string
+	)
+	for _, b := range blocks {
+		t, _ := b.aligned()
+		byQuery[b.Query] += t
+		if n := byQuery[b.Query]; n > byQuery[query] || (n == byQuery[query] && b.Query < query) {
+			query = b.Query
+		}
+	}
+	var order []*Block
+	for _, b := range blocks {
+		if b.Query != query {
+			r = append(r, Rearrangement{Type: Translocation, Block: b})
+			continue
+		}
+		t, _ := b.aligned()
+		byDir[b.Strand] += t
+		order = append(order, b)
+	}
+	var strand int8 = 1
+	if byDir[-1] > byDir[1] {
+		strand = -1
+	}
+
+	// Find the heaviest set of blocks ordered consistently on target and query.
+	weight := make([]int, len(order))
+	pred := make([]int, len(order))
+	best := -1
+	for i, b := range order {
+		weight[i], _ = b.aligned()
+		w := weight[i]
+		pred[i] = -1
+		for j, p := range order[:i] {
+			if (strand > 0 && p.QStart < b.QStart) || (strand < 0 && p.QStart > b.QStart) {
+				if weight[j]+w > weight[i] {
+					weight[i], pred[i] = weight[j]+w, j
+				}
+			}
+		}
+		if best < 0 || weight[i] > weight[best] {
+			best = i
+		}
+	}
+	inOrder := make([]bool, len(order))
+	for k := best; k >= 0; k = pred[k] {
+		inOrder[k] = true
+	}
+	for i, b := range order {
+		if b.Strand != strand {
+			r = append(r, Rearrangement{Type: Inversion, Block: b})
+		}
+		if !inOrder[i] {
+			r = append(r, Rearrangement{Type: Translocation, Block: b})
+		}
+	}
+	return r
+}
+
+// duplicated returns whether the chains of a and b overlap by at least DupOverlap of the
+// smaller block on either the target or the query.
+func (c Chainer) duplicated(a, b *Block) bool {
+	at, aq := a.aligned()
+	bt, bq := b.aligned()
+	var ot, oq int
+	for _, ca := range a.Chains {
+		for _, cb := range b.Chains {
+			if a.Target == b.Target {
+				ot += max(0, min(ca.TEnd, cb.TEnd)-max(ca.TStart, cb.TStart))
+			}
+			if a.Query == b.Query {
+				oq += max(0, min(ca.QEnd, cb.QEnd)-max(ca.QStart, cb.QStart))
+			}
+		}
+	}
+	return (ot > 0 && float64(ot) >= c.DupOverlap*float64(min(at, bt))) ||
+		(oq > 0 && float64(oq) >= c.DupOverlap*float64(min(aq, bq)))
+}
+
+type byBlock []Rearrangement
+
+func (r byBlock) Len() int { return len(r) }
+func (r byBlock) Less(i, j int) bool {
+	if r[i].Block != r[j].Block {
+		return blocksByPos{r[i].Block, r[j].Block}.Less(0, 1)
+	}
+	return r[i].Type < r[j].Type
+}
+func (r byBlock) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+// WriteReport writes a tab separated report of rearrangements to w. Coordinates are zero-based
+// and half open.
+func WriteReport(w io.Writer, r []Rearrangement) error {
+	_, err := fmt.Fprintln(w, "#type\ttarget\ttstart\ttend\tquery\tqstart\tqend\tstrand\tother")
+	if err != nil {
+		return err
+	}
+	for _, e := range r {
+		strand := '+'
+		if e.Block.Strand < 0 {
+			strand = '-'
+		}
+		other := "."
+		if o := e.Other; o != nil {
+			other = fmt.Sprintf("%s:%d-%d/%s:%d-%d", o.Target, o.TStart, o.TEnd, o.Query, o.QStart, o.QEnd)
+		}
+		b := e.Block
+		_, err = fmt.Fprintf(w, "%v\t%s\t%d\t%d\t%s\t%d\t%d\t%c\t%s\n",
+			e.Type, b.Target, b.TStart, b.TEnd, b.Query, b.QStart, b.QEnd, strand, other)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
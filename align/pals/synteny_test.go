@@ -0,0 +1,136 @@
+// Copyright ©2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pals
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/align/pals/dp"
+	"code.google.com/p/biogo/feat"
+	check "launchpad.net/gocheck"
+	"strings"
+)
+
+// Helpers
+func synPair(ts, te int, query string, qs, qe int, strand int8, score int) *FeaturePair {
+	return &FeaturePair{
+		A:      &feat.Feature{ID: "t", Start: ts, End: te},
+		B:      &feat.Feature{ID: query, Start: qs, End: qe},
+		Score:  score,
+		Strand: strand,
+	}
+}
+
+var synPairs = []*FeaturePair{
+	synPair(16000, 17000, "q", 11500, 12500, 1, 800),
+	synPair(0, 1000, "q", 0, 1000, 1, 800),
+	synPair(3500, 4000, "q", 3000, 3500, -1, 400),
+	synPair(1100, 2000, "q", 1120, 2020, 1, 700),
+	synPair(3000, 3500, "q", 3500, 4000, -1, 400),
+	synPair(5000, 6000, "q", 5000, 6000, 1, 800),
+	synPair(7000, 8000, "q2", 0, 1000, 1, 800),
+	synPair(9000, 10000, "q", 15000, 16000, 1, 800),
+	synPair(11000, 13000, "q", 11000, 13000, 1, 1600),
+	synPair(20000, 20100, "q", 20000, 20100, 1, 50),
+}
+
+func synChainer() Chainer {
+	c := DefaultChainer
+	c.MaxGap = 2000
+	c.BlockGap = 10000
+	return c
+}
+
+// Tests
+func (s *S) TestChains(c *check.C) {
+	chains := synChainer().Chains(synPairs)
+	type ch struct {
+		query        string
+		strand       int8
+		tstart, tend int
+		qstart, qend int
+		score, pairs int
+	}
+	var got []ch
+	for _, x := range chains {
+		got = append(got, ch{x.Query, x.Strand, x.TStart, x.TEnd, x.QStart, x.QEnd, x.Score, len(x.Pairs)})
+	}
+	c.Check(got, check.DeepEquals, []ch{
+		{"q", 1, 0, 2000, 0, 2020, 1470, 2},
+		{"q", -1, 3000, 4000, 3000, 4000, 800, 2},
+		{"q", 1, 5000, 6000, 5000, 6000, 800, 1},
+		{"q2", 1, 7000, 8000, 0, 1000, 800, 1},
+		{"q", 1, 9000, 10000, 15000, 16000, 800, 1},
+		{"q", 1, 11000, 13000, 11000, 13000, 1600, 1},
+		{"q", 1, 16000, 17000, 11500, 12500, 800, 1},
+	})
+	c.Check(chains[1].Pairs[0].A.Start, check.Equals, 3000)
+}
+
+func (s *S) TestSynteny(c *check.C) {
+	cl := synChainer()
+	blocks := cl.Blocks(cl.Chains(synPairs))
+	c.Assert(len(blocks), check.Equals, 6)
+	c.Check(len(blocks[0].Chains), check.Equals, 2)
+	c.Check([]int{blocks[0].TStart, blocks[0].TEnd, blocks[0].QStart, blocks[0].QEnd, blocks[0].Score}, check.DeepEquals, []int{0, 6000, 0, 6000, 2270})
+
+	r := cl.Rearrangements(blocks)
+	type ev struct {
+		typ   Event
+		block int
+		other int
+	}
+	index := func(b *Block) int {
+		for i, x := range blocks {
+			if x == b {
+				return i
+			}
+		}
+		return -1
+	}
+	var got []ev
+	for _, e := range r {
+		got = append(got, ev{e.Type, index(e.Block), index(e.Other)})
+	}
+	c.Check(got, check.DeepEquals, []ev{
+		{Inversion, 1, -1},
+		{Translocation, 2, -1},
+		{Translocation, 3, -1},
+		{Duplication, 5, 4},
+	})
+
+	var b bytes.Buffer
+	c.Check(WriteReport(&b, r), check.Equals, nil)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	c.Assert(len(lines), check.Equals, 5)
+	c.Check(lines[1], check.Equals, "inversion\tt\t3000\t4000\tq\t3000\t4000\t-\t.")
+	c.Check(lines[4], check.Equals, "duplication\tt\t16000\t17000\tq\t11500\t12500\t+\tt:11000-13000/q:11000-13000")
+}
+
+func (s *S) TestNewFeaturePairs(c *check.C) {
+	hits := dp.DPHits{
+		{Abpos: 0, Aepos: 4, Bbpos: 4*binSize + 10, Bepos: 4*binSize + 60},
+		{Abpos: 29*binSize + 10, Aepos: 29*binSize + 110, Bbpos: 29*binSize + 200, Bepos: 29*binSize + 300},
+	}
+	fps, err := NewFeaturePairs(ps, ps, hits, false)
+	c.Assert(err, check.Equals, nil)
+	c.Assert(len(fps), check.Equals, 2)
+	c.Check(fps[0].A.ID, check.Equals, "deBruijn1")
+	c.Check(fps[0].B.ID, check.Equals, "deBruijn5")
+	c.Check(fps[1].B.Start, check.Equals, 1224)
+
+	_, err = NewFeaturePairs(ps, ps, dp.DPHits{{Abpos: 10, Aepos: 5}}, false)
+	c.Check(err, check.NotNil)
+}
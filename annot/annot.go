@@ -0,0 +1,275 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package annot provides an in-memory annotation store indexing features by identifier,
+// feature type, source, parent and genomic range.
+//
+// Identifiers and parent relationships are taken from GFF3 (ID=...;Parent=...) and GTF
+// (gene_id "..."; transcript_id "...";) attributes. Features without an identifying
+// attribute, such as BED records, are identified by their ID field.
+package annot
+
+import (
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/interval"
+	"code.google.com/p/biogo/io/featio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A Store holds a set of indexed features.
+type Store struct {
+	features []*feat.Feature
+	byID     map[string][]*feat.Feature
+	byType   map[string][]*feat.Feature
+	bySource map[string][]*feat.Feature
+	children map[string][]*feat.Feature
+	ids      map[*feat.Feature]string
+	ranges   interval.Tree
+}
+
+// Return a new empty Store.
+func New() *Store {
+	return &Store{
+		byID:     make(map[string][]*feat.Feature),
+		byType:   make(map[string][]*feat.Feature),
+		bySource: make(map[string][]*feat.Feature),
+		children: make(map[string][]*feat.Feature),
+		ids:      make(map[*feat.Feature]string),
+		ranges:   interval.NewTree(),
+	}
+}
+
+// Add a feature to the Store.
+func (self *Store) Add(f *feat.Feature) error {
+	iv, err := interval.New(f.Location, f.Start, f.End, len(self.features), f)
+	if err != nil {
+		return err
+	}
+	self.ranges.Insert(iv)
+	self.features = append(self.features, f)
+
+	attr := Attributes(f)
+	id := identify(f, attr)
+	self.ids[f] = id
+	self.byID[id] = append(self.byID[id], f)
+	self.byType[f.Feature] = append(self.byType[f.Feature], f)
+	self.bySource[f.Source] = append(self.bySource[f.Source], f)
+	for _, p := range parents(id, attr) {
+		self.children[p] = append(self.children[p], f)
+	}
+
+	return nil
+}
+
+// Read features from r into the Store until EOF, returning the number of features added.
+// Features without a Location, such as GFF metadata, are skipped.
+func (self *Store) ReadFrom(r featio.Reader) (n int, err error) {
+	for {
+		var f *feat.Feature
+		f, err = r.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if f.Location == "" {
+			continue
+		}
+		if err = self.Add(f); err != nil {
+			return
+		}
+		n++
+	}
+}
+
+// Return the number of features in the Store.
+func (self *Store) Len() int { return len(self.features) }
+
+// Return all features in the Store in the order they were added.
+func (self *Store) Features() []*feat.Feature { return self.features }
+
+// Return the identifier used to index f, and whether f is held by the Store.
+func (self *Store) IDOf(f *feat.Feature) (id string, ok bool) {
+	id, ok = self.ids[f]
+	return
+}
+
+// Return the features with the given identifier. More than one feature may share an identifier,
+// for example the lines of a discontinuous GFF3 CDS.
+func (self *Store) ID(id string) []*feat.Feature { return self.byID[id] }
+
+// Return the features of the given feature type.
+func (self *Store) Type(t string) []*feat.Feature { return self.byType[t] }
+
+// Return the features from the given source.
+func (self *Store) Source(s string) []*feat.Feature { return self.bySource[s] }
+
+// Return the features that name id as a parent.
+func (self *Store) Children(id string) []*feat.Feature { return self.children[id] }
+
+// Return all features descended from the features with identifier id that have the given
+// feature type. If t is empty, all descendants are returned. Each descendant is returned once,
+// in breadth first order.
+func (self *Store) Descendants(id, t string) (d []*feat.Feature) {
+	seen := map[*feat.Feature]bool{}
+	visited := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, c := range self.children[p] {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			if t == "" || c.Feature == t {
+				d = append(d, c)
+			}
+			if cid := self.ids[c]; !visited[cid] {
+				visited[cid] = true
+				queue = append(queue, cid)
+			}
+		}
+	}
+
+	return
+}
+
+// A Query specifies a set of features. Empty string fields and a zero Strand match any feature.
+// If Location is not empty, only features on Location that overlap [Start, End) by at least
+// one base are matched.
+type Query struct {
+	Location   string
+	Start, End int
+	Strand     int8
+	Type       string
+	Source     string
+}
+
+func (self Query) match(f *feat.Feature) bool {
+	return (self.Strand == 0 || f.Strand == self.Strand) &&
+		(self.Type == "" || f.Feature == self.Type) &&
+		(self.Source == "" || f.Source == self.Source)
+}
+
+// Return the features matching q. Range queries return features in order of start position,
+// other queries return features in the order they were added.
+func (self *Store) Query(q Query) (r []*feat.Feature, err error) {
+	if q.Location == "" {
+		var candidates []*feat.Feature
+		switch {
+		case q.Type != "":
+			candidates = self.byType[q.Type]
+		case q.Source != "":
+			candidates = self.bySource[q.Source]
+		default:
+			candidates = self.features
+		}
+		for _, f := range candidates {
+			if q.match(f) {
+				r = append(r, f)
+			}
+		}
+		return
+	}
+
+	iv, err := interval.New(q.Location, q.Start, q.End, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	var hits intervals
+	for h := range self.ranges.Intersect(iv, 1) {
+		if q.match(h.Meta.(*feat.Feature)) {
+			hits = append(hits, h)
+		}
+	}
+	sort.Sort(hits)
+	r = make([]*feat.Feature, len(hits))
+	for i, h := range hits {
+		r[i] = h.Meta.(*feat.Feature)
+	}
+
+	return
+}
+
+type intervals []*interval.Interval
+
+func (self intervals) Len() int { return len(self) }
+func (self intervals) Less(i, j int) bool {
+	if self[i].Start() != self[j].Start() {
+		return self[i].Start() < self[j].Start()
+	}
+	return self[i].Line() < self[j].Line()
+}
+func (self intervals) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+// identify returns the identifier of f.
+func identify(f *feat.Feature, attr map[string][]string) string {
+	if id, ok := attr["ID"]; ok && len(id) > 0 {
+		return id[0]
+	}
+	switch f.Feature {
+	case "gene":
+		if id, ok := attr["gene_id"]; ok && len(id) > 0 {
+			return id[0]
+		}
+	case "transcript", "mRNA":
+		if id, ok := attr["transcript_id"]; ok && len(id) > 0 {
+			return id[0]
+		}
+	}
+	return f.ID
+}
+
+// parents returns the identifiers of the parents of a feature with the given identifier.
+func parents(id string, attr map[string][]string) (p []string) {
+	if par, ok := attr["Parent"]; ok {
+		return par
+	}
+	for _, k := range []string{"transcript_id", "gene_id"} {
+		if v, ok := attr[k]; ok && len(v) > 0 && v[0] != id {
+			p = append(p, v[0])
+		}
+	}
+	return
+}
+
+// Return the attributes of f parsed as either GFF3 key=value pairs or GTF key "value" pairs.
+// GFF3 values are split on commas.
+func Attributes(f *feat.Feature) map[string][]string {
+	attr := make(map[string][]string)
+	for _, field := range strings.Split(f.Attributes, ";") {
+		field = strings.TrimSpace(field)
+		if len(field) == 0 {
+			continue
+		}
+		if i := strings.Index(field, "="); i >= 0 && (strings.IndexAny(field, " \t") < 0 || strings.IndexAny(field, " \t") > i) {
+			key := strings.TrimSpace(field[:i])
+			attr[key] = append(attr[key], strings.Split(field[i+1:], ",")...)
+			continue
+		}
+		if i := strings.IndexAny(field, " \t"); i >= 0 {
+			key := field[:i]
+			attr[key] = append(attr[key], strings.Trim(strings.TrimSpace(field[i+1:]), `"`))
+		} else {
+			attr[field] = append(attr[field], "")
+		}
+	}
+
+	return attr
+}
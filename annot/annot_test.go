@@ -0,0 +1,115 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package annot
+
+import (
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/bed"
+	"code.google.com/p/biogo/io/featio/gff"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func starts(f []*feat.Feature) (s []int) {
+	for _, fe := range f {
+		s = append(s, fe.Start)
+	}
+	return
+}
+
+func newStore(c *check.C, data string) *Store {
+	s := New()
+	n, err := s.ReadFrom(gff.NewReader(ioutil.NopCloser(strings.NewReader(data))))
+	c.Assert(err, check.Equals, nil)
+	c.Assert(n, check.Equals, s.Len())
+	return s
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+const gff3 = `##gff-version 3
+chr2	ens	gene	1001	9000	.	-	.	ID=geneX;Name=X
+chr2	ens	mRNA	1001	9000	.	-	.	ID=tx1;Parent=geneX
+chr2	ens	exon	1001	2000	.	-	.	ID=e1;Parent=tx1
+chr2	ens	exon	4001	5000	.	-	.	ID=e2;Parent=tx1
+chr2	ens	exon	8001	9000	.	-	.	ID=e3;Parent=tx1
+chr2	ens	CDS	1501	2000	.	-	0	ID=cds1;Parent=tx1
+chr2	ens	CDS	4001	5000	.	-	1	ID=cds1;Parent=tx1
+chr2	hav	gene	3001	6000	.	+	.	ID=geneY
+chr2	hav	CDS	3001	3500	.	+	0	ID=cdsY;Parent=geneY
+chr3	ens	CDS	1	100	.	-	0	ID=cdsZ
+`
+
+func (s *S) TestGFF3(c *check.C) {
+	st := newStore(c, gff3)
+	c.Check(st.Len(), check.Equals, 10)
+	c.Check(starts(st.ID("cds1")), check.DeepEquals, []int{1500, 4000})
+	c.Check(len(st.Type("CDS")), check.Equals, 4)
+	c.Check(len(st.Source("hav")), check.Equals, 2)
+	c.Check(len(st.Children("tx1")), check.Equals, 5)
+	c.Check(starts(st.Descendants("geneX", "exon")), check.DeepEquals, []int{1000, 4000, 8000})
+	c.Check(len(st.Descendants("geneX", "")), check.Equals, 6)
+	id, ok := st.IDOf(st.Type("mRNA")[0])
+	c.Check(ok, check.Equals, true)
+	c.Check(id, check.Equals, "tx1")
+
+	r, err := st.Query(Query{Location: "chr2", Start: 0, End: 5000, Strand: -1, Type: "CDS"})
+	c.Check(err, check.Equals, nil)
+	c.Check(starts(r), check.DeepEquals, []int{1500, 4000})
+	r, err = st.Query(Query{Location: "chr2", Start: 2000, End: 3001})
+	c.Check(err, check.Equals, nil)
+	c.Check(starts(r), check.DeepEquals, []int{1000, 1000, 3000, 3000})
+	r, err = st.Query(Query{Type: "CDS", Strand: -1})
+	c.Check(err, check.Equals, nil)
+	c.Check(starts(r), check.DeepEquals, []int{1500, 4000, 0})
+	r, err = st.Query(Query{Location: "chr4", Start: 0, End: 10})
+	c.Check(err, check.Equals, nil)
+	c.Check(len(r), check.Equals, 0)
+}
+
+const gtf = `chr1	src	gene	11	100	.	+	.	gene_id "G1";
+chr1	src	transcript	11	100	.	+	.	gene_id "G1"; transcript_id "T1";
+chr1	src	exon	11	30	.	+	.	gene_id "G1"; transcript_id "T1"; exon_number "1";
+chr1	src	exon	61	100	.	+	.	gene_id "G1"; transcript_id "T1"; exon_number "2";
+`
+
+func (s *S) TestGTF(c *check.C) {
+	st := newStore(c, gtf)
+	c.Check(len(st.ID("G1")), check.Equals, 1)
+	c.Check(len(st.ID("T1")), check.Equals, 1)
+	c.Check(starts(st.Descendants("G1", "exon")), check.DeepEquals, []int{10, 60})
+	c.Check(starts(st.Descendants("T1", "")), check.DeepEquals, []int{10, 60})
+	c.Check(Attributes(st.Type("exon")[1])["exon_number"], check.DeepEquals, []string{"2"})
+}
+
+func (s *S) TestBed(c *check.C) {
+	st := New()
+	n, err := st.ReadFrom(bed.NewReader(ioutil.NopCloser(strings.NewReader("chr1\t10\t20\tpeak1\nchr1\t15\t30\tpeak2\n")), 4))
+	c.Assert(err, check.Equals, nil)
+	c.Check(n, check.Equals, 2)
+	c.Check(starts(st.ID("peak2")), check.DeepEquals, []int{15})
+	r, err := st.Query(Query{Location: "chr1", Start: 19, End: 20})
+	c.Check(err, check.Equals, nil)
+	c.Check(starts(r), check.DeepEquals, []int{10, 15})
+}
@@ -0,0 +1,211 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package for calculating per-base depth of coverage from features and aligned records.
+package coverage
+
+import (
+	"code.google.com/p/biogo/feat"
+	"sort"
+)
+
+// Aligned is the interface satisfied by alignment records that can contribute to coverage.
+type Aligned interface {
+	Reference() string // Name of the reference sequence the record is aligned to.
+	Orientation() int8 // Strand of the alignment: 1 forward, -1 reverse and 0 unknown.
+	MapQ() int         // Mapping quality.
+	Blocks() []Block   // Reference blocks covered by aligned bases.
+}
+
+// A Block is a half-open region of a reference sequence.
+type Block struct {
+	Start, End int
+}
+
+// A Run is a maximal region of constant, non-zero depth.
+type Run struct {
+	Location   string
+	Start, End int
+	Depth      int
+}
+
+// Return the length of a Run.
+func (self Run) Len() int { return self.End - self.Start }
+
+// Return a feat.Feature describing the Run, with the depth held in Score.
+func (self Run) Feature() *feat.Feature {
+	d := float64(self.Depth)
+	return &feat.Feature{
+		Location: self.Location,
+		Start:    self.Start,
+		End:      self.End,
+		Score:    &d,
+	}
+}
+
+type event struct {
+	pos, delta int
+}
+
+type events []event
+
+func (self events) Len() int           { return len(self) }
+func (self events) Less(i, j int) bool { return self[i].pos < self[j].pos }
+func (self events) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// An Accumulator collects features and aligned records and calculates run-length encoded depth
+// of coverage for each location.
+type Accumulator struct {
+	Strand     int8    // If non-zero, only records on the given strand are counted.
+	MinQuality float64 // Records with a quality below MinQuality are not counted.
+
+	depth map[string]events
+	order []string
+}
+
+// Return a new Accumulator. If strand is non-zero only records on that strand are counted.
+// Records with a quality less than minQual are ignored.
+func New(strand int8, minQual float64) *Accumulator {
+	return &Accumulator{
+		Strand:     strand,
+		MinQuality: minQual,
+		depth:      make(map[string]events),
+	}
+}
+
+func (self *Accumulator) add(loc string, start, end int) {
+	if end <= start {
+		return
+	}
+	e, ok := self.depth[loc]
+	if !ok {
+		self.order = append(self.order, loc)
+	}
+	self.depth[loc] = append(e, event{start, 1}, event{end, -1})
+}
+
+// AddFeature adds the span of a feature to the coverage, returning whether it passed the filters.
+// The feature Score is used as its quality; when MinQuality is greater than zero, features
+// without a Score are not counted.
+func (self *Accumulator) AddFeature(f *feat.Feature) bool {
+	if self.Strand != 0 && f.Strand != self.Strand {
+		return false
+	}
+	if self.MinQuality > 0 && (f.Score == nil || *f.Score < self.MinQuality) {
+		return false
+	}
+	self.add(f.Location, f.Start, f.End)
+
+	return true
+}
+
+// AddAligned adds the aligned blocks of an alignment record to the coverage, returning whether it
+// passed the filters.
+func (self *Accumulator) AddAligned(r Aligned) bool {
+	if self.Strand != 0 && r.Orientation() != self.Strand {
+		return false
+	}
+	if float64(r.MapQ()) < self.MinQuality {
+		return false
+	}
+	loc := r.Reference()
+	for _, b := range r.Blocks() {
+		self.add(loc, b.Start, b.End)
+	}
+
+	return true
+}
+
+// Return the locations with coverage in the order they were first seen.
+func (self *Accumulator) Locations() []string {
+	return append([]string(nil), self.order...)
+}
+
+// Runs returns the run-length encoded depth of coverage for loc in position order. Regions with
+// zero depth are not included and adjacent regions of equal depth are merged.
+func (self *Accumulator) Runs(loc string) (runs []Run) {
+	e := self.depth[loc]
+	sort.Stable(e)
+
+	var (
+		depth int
+		open  bool
+	)
+	for i := 0; i < len(e); {
+		pos := e[i].pos
+		for ; i < len(e) && e[i].pos == pos; i++ {
+			depth += e[i].delta
+		}
+		if open {
+			last := &runs[len(runs)-1]
+			if last.Depth == depth {
+				continue
+			}
+			last.End, open = pos, false
+		}
+		if depth > 0 {
+			runs = append(runs, Run{Location: loc, Start: pos, Depth: depth})
+			open = true
+		}
+	}
+
+	return
+}
+
+// Do calls fn for each run of each location, with locations in the order they were first seen.
+// Iteration stops if fn returns a non-nil error, which is returned.
+func (self *Accumulator) Do(fn func(Run) error) error {
+	for _, loc := range self.order {
+		for _, r := range self.Runs(loc) {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Depth returns the depth of coverage for each position of loc in [start, end). If end is less
+// than start, Depth returns nil.
+func (self *Accumulator) Depth(loc string, start, end int) []int {
+	if end < start {
+		return nil
+	}
+	d := make([]int, end-start)
+	for _, r := range self.Runs(loc) {
+		if r.End <= start || r.Start >= end {
+			continue
+		}
+		s, e := r.Start, r.End
+		if s < start {
+			s = start
+		}
+		if e > end {
+			e = end
+		}
+		for i := s; i < e; i++ {
+			d[i-start] = r.Depth
+		}
+	}
+
+	return d
+}
+
+// Reset removes all accumulated coverage.
+func (self *Accumulator) Reset() {
+	self.depth = make(map[string]events)
+	self.order = nil
+}
@@ -0,0 +1,102 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package coverage
+
+import (
+	"code.google.com/p/biogo/feat"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"testing"
+)
+
+// Helpers
+func floatPtr(f float64) *float64 { return &f }
+
+type read struct {
+	ref    string
+	strand int8
+	mapq   int
+	blocks []Block
+}
+
+func (r read) Reference() string { return r.ref }
+func (r read) Orientation() int8 { return r.strand }
+func (r read) MapQ() int         { return r.mapq }
+func (r read) Blocks() []Block   { return r.blocks }
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestRuns(c *check.C) {
+	a := New(0, 0)
+	for _, f := range []*feat.Feature{
+		{Location: "chr1", Start: 0, End: 10},
+		{Location: "chr1", Start: 5, End: 15},
+		{Location: "chr1", Start: 15, End: 20},
+		{Location: "chr1", Start: 25, End: 30},
+		{Location: "chr2", Start: 0, End: 1},
+	} {
+		c.Check(a.AddFeature(f), check.Equals, true)
+	}
+	c.Check(a.Locations(), check.DeepEquals, []string{"chr1", "chr2"})
+	c.Check(a.Runs("chr1"), check.DeepEquals, []Run{
+		{Location: "chr1", Start: 0, End: 5, Depth: 1},
+		{Location: "chr1", Start: 5, End: 10, Depth: 2},
+		{Location: "chr1", Start: 10, End: 20, Depth: 1},
+		{Location: "chr1", Start: 25, End: 30, Depth: 1},
+	})
+	c.Check(a.Runs("chr3"), check.HasLen, 0)
+}
+
+func (s *S) TestFilters(c *check.C) {
+	a := New(-1, 20)
+	c.Check(a.AddFeature(&feat.Feature{Location: "chr1", Start: 0, End: 10, Strand: 1, Score: floatPtr(30)}), check.Equals, false)
+	c.Check(a.AddFeature(&feat.Feature{Location: "chr1", Start: 0, End: 10, Strand: -1}), check.Equals, false)
+	c.Check(a.AddFeature(&feat.Feature{Location: "chr1", Start: 0, End: 10, Strand: -1, Score: floatPtr(10)}), check.Equals, false)
+	c.Check(a.AddFeature(&feat.Feature{Location: "chr1", Start: 0, End: 10, Strand: -1, Score: floatPtr(20)}), check.Equals, true)
+	c.Check(a.AddAligned(read{"chr1", -1, 5, []Block{{0, 10}}}), check.Equals, false)
+	c.Check(a.AddAligned(read{"chr1", -1, 60, []Block{{0, 4}, {8, 12}}}), check.Equals, true)
+	c.Check(a.Depth("chr1", 0, 14), check.DeepEquals, []int{2, 2, 2, 2, 1, 1, 1, 1, 2, 2, 1, 1, 0, 0})
+}
+
+func (s *S) TestDepth(c *check.C) {
+	const n = 1000
+	a := New(0, 0)
+	want := make([]int, n)
+	for i := 0; i < 200; i++ {
+		st := rand.Intn(n)
+		en := st + rand.Intn(n-st)
+		for j := st; j < en; j++ {
+			want[j]++
+		}
+		a.AddFeature(&feat.Feature{Location: "chr", Start: st, End: en})
+	}
+	c.Check(a.Depth("chr", 0, n), check.DeepEquals, want)
+	c.Check(a.Depth("chr", 10, 10), check.DeepEquals, []int{})
+	c.Check(a.Depth("chr", 10, 5), check.IsNil)
+
+	runs := a.Runs("chr")
+	for i := 1; i < len(runs); i++ {
+		c.Check(runs[i].Start >= runs[i-1].End, check.Equals, true)
+		if runs[i].Start == runs[i-1].End {
+			c.Check(runs[i].Depth, check.Not(check.Equals), runs[i-1].Depth)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package enrich
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/interval"
+	"math"
+)
+
+// Return an interval.Tree holding the features in f. Each Interval's Meta field holds the
+// corresponding feature.
+func NewTree(f []*feat.Feature) (t interval.Tree, err error) {
+	t = interval.NewTree()
+	for i, fe := range f {
+		var iv *interval.Interval
+		if iv, err = interval.New(fe.Location, fe.Start, fe.End, i, fe); err != nil {
+			return nil, err
+		}
+		t.Insert(iv)
+	}
+
+	return
+}
+
+// Return the number of features in f that overlap at least one interval in t by at least one base.
+func Overlaps(f []*feat.Feature, t interval.Tree) (n int, err error) {
+	for _, fe := range f {
+		q, err := interval.New(fe.Location, fe.Start, fe.End, 0, nil)
+		if err != nil {
+			return 0, err
+		}
+		hit := false
+		for _ = range t.Intersect(q, 1) {
+			hit = true
+		}
+		if hit {
+			n++
+		}
+	}
+
+	return
+}
+
+// A Result holds the outcome of a permutation enrichment test.
+type Result struct {
+	Observed int     // Number of query features overlapping the annotation.
+	Null     []int   // Overlap counts for each shuffle of the query.
+	Expected float64 // Mean of Null.
+	PHigh    float64 // Empirical probability of an overlap count at least as large as Observed.
+	PLow     float64 // Empirical probability of an overlap count at least as small as Observed.
+}
+
+// Return the ratio of observed to expected overlap count.
+func (self Result) FoldChange() float64 {
+	if self.Expected == 0 {
+		return math.Inf(1)
+	}
+	return float64(self.Observed) / self.Expected
+}
+
+// Perform a permutation test for enrichment of overlap between query and the features in annot,
+// shuffling query n times with s. Empirical p-values are calculated as (k+1)/(n+1) where k is the
+// number of shuffles at least as extreme as the observed overlap.
+func Enrichment(query []*feat.Feature, annot interval.Tree, s *Shuffler, n int) (r Result, err error) {
+	if n < 1 {
+		return r, bio.NewError("enrich: number of permutations must be positive", 0, n)
+	}
+	if r.Observed, err = Overlaps(query, annot); err != nil {
+		return
+	}
+	r.Null = make([]int, n)
+	var high, low, sum int
+	for i := range r.Null {
+		var sh []*feat.Feature
+		if sh, err = s.Shuffle(query); err != nil {
+			return
+		}
+		if r.Null[i], err = Overlaps(sh, annot); err != nil {
+			return
+		}
+		sum += r.Null[i]
+		if r.Null[i] >= r.Observed {
+			high++
+		}
+		if r.Null[i] <= r.Observed {
+			low++
+		}
+	}
+	r.Expected = float64(sum) / float64(n)
+	r.PHigh = float64(high+1) / float64(n+1)
+	r.PLow = float64(low+1) / float64(n+1)
+
+	return
+}
@@ -0,0 +1,138 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package enrich
+
+import (
+	"code.google.com/p/biogo/feat"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"testing"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+var genome = []*feat.Feature{
+	{Location: "chr1", Start: 0, End: 1000},
+	{Location: "chr2", Start: 0, End: 250},
+}
+
+func (s *S) TestWindows(c *check.C) {
+	w, err := Windows(genome, 300)
+	c.Assert(err, check.Equals, nil)
+	var obtain [][3]interface{}
+	for _, f := range w {
+		obtain = append(obtain, [3]interface{}{f.Location, f.Start, f.End})
+	}
+	c.Check(obtain, check.DeepEquals, [][3]interface{}{
+		{"chr1", 0, 300}, {"chr1", 300, 600}, {"chr1", 600, 900}, {"chr1", 900, 1000},
+		{"chr2", 0, 250},
+	})
+	c.Check(w[0].ID, check.Equals, "chr1:0..300")
+
+	w, err = Sliding(genome[1:], 100, 50)
+	c.Assert(err, check.Equals, nil)
+	obtain = obtain[:0]
+	for _, f := range w {
+		obtain = append(obtain, [3]interface{}{f.Location, f.Start, f.End})
+	}
+	c.Check(obtain, check.DeepEquals, [][3]interface{}{
+		{"chr2", 0, 100}, {"chr2", 50, 150}, {"chr2", 100, 200}, {"chr2", 150, 250},
+	})
+
+	_, err = Sliding(genome, 0, 1)
+	c.Check(err, check.Not(check.Equals), nil)
+}
+
+func (s *S) TestShuffle(c *check.C) {
+	exclude := []*feat.Feature{
+		{Location: "chr1", Start: 100, End: 900},
+		{Location: "chr2", Start: 0, End: 250},
+	}
+	sh, err := NewShuffler(genome, exclude, rand.NewSource(1))
+	c.Assert(err, check.Equals, nil)
+	c.Check(sh.Len(), check.Equals, 200)
+
+	f := []*feat.Feature{{ID: "a", Location: "chr2", Start: 10, End: 60}}
+	seen := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		r, err := sh.Shuffle(f)
+		c.Assert(err, check.Equals, nil)
+		c.Check(r[0].ID, check.Equals, "a")
+		c.Check(r[0].Location, check.Equals, "chr1")
+		c.Check(r[0].End-r[0].Start, check.Equals, 50)
+		c.Check(r[0].Start < 100 && r[0].End <= 100 || r[0].Start >= 900 && r[0].End <= 1000, check.Equals, true,
+			check.Commentf("%d-%d", r[0].Start, r[0].End))
+		seen[r[0].Start/100] = true
+	}
+	c.Check(seen, check.DeepEquals, map[int]bool{0: true, 9: true})
+	c.Check(f[0].Location, check.Equals, "chr2")
+
+	sh.SameLocation = true
+	_, err = sh.Shuffle(f)
+	c.Check(err, check.Not(check.Equals), nil)
+
+	_, err = sh.Shuffle([]*feat.Feature{{Location: "chr1", Start: 0, End: 150}})
+	c.Check(err, check.Not(check.Equals), nil)
+}
+
+func (s *S) TestShuffleReproducible(c *check.C) {
+	f := []*feat.Feature{{Location: "chr1", Start: 0, End: 10}, {Location: "chr2", Start: 5, End: 25}}
+	var obtain [2][]int
+	for k := range obtain {
+		sh, err := NewShuffler(genome, nil, rand.NewSource(42))
+		c.Assert(err, check.Equals, nil)
+		for i := 0; i < 10; i++ {
+			r, err := sh.Shuffle(f)
+			c.Assert(err, check.Equals, nil)
+			for _, fe := range r {
+				obtain[k] = append(obtain[k], fe.Start)
+			}
+		}
+	}
+	c.Check(obtain[0], check.DeepEquals, obtain[1])
+}
+
+func (s *S) TestEnrichment(c *check.C) {
+	annot := []*feat.Feature{
+		{Location: "chr1", Start: 0, End: 10},
+		{Location: "chr1", Start: 500, End: 510},
+	}
+	t, err := NewTree(annot)
+	c.Assert(err, check.Equals, nil)
+	query := []*feat.Feature{
+		{Location: "chr1", Start: 5, End: 15},
+		{Location: "chr1", Start: 505, End: 515},
+		{Location: "chr1", Start: 10, End: 20},
+	}
+	n, err := Overlaps(query, t)
+	c.Check(err, check.Equals, nil)
+	c.Check(n, check.Equals, 2)
+
+	sh, err := NewShuffler(genome, nil, rand.NewSource(1))
+	c.Assert(err, check.Equals, nil)
+	r, err := Enrichment(query, t, sh, 99)
+	c.Assert(err, check.Equals, nil)
+	c.Check(r.Observed, check.Equals, 2)
+	c.Check(len(r.Null), check.Equals, 99)
+	c.Check(r.PHigh < 0.05, check.Equals, true)
+	c.Check(r.PLow > 0.95, check.Equals, true)
+	c.Check(r.FoldChange() > 1, check.Equals, true)
+}
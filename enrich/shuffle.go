@@ -0,0 +1,167 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package enrich
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/util"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Default number of placement attempts made for each feature before a shuffle fails.
+var DefaultMaxTries = 1000
+
+// A Shuffler randomly places features within a genome, avoiding excluded regions.
+type Shuffler struct {
+	// MaxTries is the number of placement attempts made for each feature.
+	MaxTries int
+	// SameLocation restricts placement of each feature to its original reference sequence.
+	SameLocation bool
+
+	rand     *rand.Rand
+	segments []segment
+	cum      []int             // cum[i] is the total length of segments[:i].
+	byLoc    map[string][2]int // Index range of segments for each location.
+}
+
+type segment struct {
+	location   string
+	start, end int
+}
+
+// Return a new Shuffler placing features within genome but not overlapping any feature in
+// exclude. Random numbers are drawn from src, so a Shuffler created with a source with the
+// same seed will produce the same sequence of shuffles.
+func NewShuffler(genome, exclude []*feat.Feature, src rand.Source) (*Shuffler, error) {
+	s := &Shuffler{
+		MaxTries: DefaultMaxTries,
+		rand:     rand.New(src),
+		byLoc:    make(map[string][2]int),
+	}
+
+	excl := make(map[string][]segment)
+	for _, f := range exclude {
+		excl[f.Location] = append(excl[f.Location], segment{f.Location, f.Start, f.End})
+	}
+	for _, x := range excl {
+		sort.Sort(segments(x))
+	}
+
+	g := make([]segment, len(genome))
+	for i, f := range genome {
+		g[i] = segment{f.Location, f.Start, f.End}
+	}
+	sort.Sort(segments(g))
+
+	for _, r := range g {
+		if r.end <= r.start {
+			continue
+		}
+		start := r.start
+		for _, x := range excl[r.location] {
+			if x.end <= start || x.start >= r.end {
+				continue
+			}
+			if x.start > start {
+				s.segments = append(s.segments, segment{r.location, start, x.start})
+			}
+			start = util.Max(start, x.end)
+		}
+		if start < r.end {
+			s.segments = append(s.segments, segment{r.location, start, r.end})
+		}
+	}
+	if len(s.segments) == 0 {
+		return nil, bio.NewError("enrich: no unexcluded regions in genome", 0)
+	}
+
+	s.cum = make([]int, len(s.segments)+1)
+	for i, seg := range s.segments {
+		s.cum[i+1] = s.cum[i] + seg.end - seg.start
+		r, ok := s.byLoc[seg.location]
+		if !ok {
+			r[0] = i
+		}
+		r[1] = i + 1
+		s.byLoc[seg.location] = r
+	}
+	for i := 1; i < len(s.segments); i++ {
+		if a, b := s.segments[i-1], s.segments[i]; a.location == b.location && a.end > b.start {
+			return nil, bio.NewError(fmt.Sprintf("enrich: overlapping genome regions on %s", a.location), 0)
+		}
+	}
+
+	return s, nil
+}
+
+// Return the total length of the genome available for placement.
+func (self *Shuffler) Len() int { return self.cum[len(self.cum)-1] }
+
+// Return copies of the features in f with their Location, Start and End randomly reassigned so
+// that each lies entirely within the genome, outside the excluded regions, and has its
+// original length. Every valid placement of a feature is equally likely. Shuffled features
+// may overlap each other.
+func (self *Shuffler) Shuffle(f []*feat.Feature) (s []*feat.Feature, err error) {
+	s = make([]*feat.Feature, len(f))
+	for i, o := range f {
+		lo, hi := 0, len(self.segments)
+		if self.SameLocation {
+			r, ok := self.byLoc[o.Location]
+			if !ok {
+				return nil, bio.NewError(fmt.Sprintf("enrich: no unexcluded region on %s", o.Location), 0, o)
+			}
+			lo, hi = r[0], r[1]
+		}
+		if s[i], err = self.place(o, lo, hi); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// place attempts to place a copy of f in segments[lo:hi].
+func (self *Shuffler) place(f *feat.Feature, lo, hi int) (*feat.Feature, error) {
+	length := f.End - f.Start
+	base, n := self.cum[lo], self.cum[hi]-self.cum[lo]
+	for try := 0; try < self.MaxTries; try++ {
+		off := base + self.rand.Intn(n)
+		i := sort.Search(hi-lo, func(i int) bool { return self.cum[lo+i+1] > off }) + lo
+		seg := self.segments[i]
+		start := seg.start + off - self.cum[i]
+		if start+length <= seg.end {
+			c := *f
+			c.Location, c.Start, c.End = seg.location, start, start+length
+			return &c, nil
+		}
+	}
+
+	return nil, bio.NewError(fmt.Sprintf("enrich: failed to place feature after %d attempts", self.MaxTries), 0, f)
+}
+
+type segments []segment
+
+func (self segments) Len() int { return len(self) }
+func (self segments) Less(i, j int) bool {
+	if self[i].location != self[j].location {
+		return self[i].location < self[j].location
+	}
+	return self[i].start < self[j].start
+}
+func (self segments) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
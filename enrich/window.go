@@ -0,0 +1,64 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package enrich provides genome windowing, feature shuffling and permutation tests
+// of feature overlap enrichment.
+//
+// A genome is described by a slice of features, each giving a region of a reference
+// sequence. Usually these span whole chromosomes, but any set of non-overlapping regions
+// may be used.
+package enrich
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"fmt"
+	"strconv"
+)
+
+// Return fixed, non-overlapping windows of the given size tiling each region of genome.
+// The final window of a region is truncated at the end of the region.
+func Windows(genome []*feat.Feature, size int) ([]*feat.Feature, error) {
+	return Sliding(genome, size, size)
+}
+
+// Return windows of the given size starting every step bases across each region of genome.
+// Windows are truncated at the end of a region and no window is started beyond the start of
+// the first window that reaches the end of the region.
+func Sliding(genome []*feat.Feature, size, step int) (w []*feat.Feature, err error) {
+	if size < 1 || step < 1 {
+		return nil, bio.NewError(fmt.Sprintf("enrich: illegal window size %d or step %d", size, step), 0)
+	}
+	for _, g := range genome {
+		for s := g.Start; s < g.End; s += step {
+			e := s + size
+			if e > g.End {
+				e = g.End
+			}
+			w = append(w, &feat.Feature{
+				ID:       g.Location + ":" + strconv.Itoa(s) + ".." + strconv.Itoa(e),
+				Location: g.Location,
+				Start:    s,
+				End:      e,
+				Moltype:  g.Moltype,
+			})
+			if e == g.End {
+				break
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,219 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codon
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/protein"
+	"code.google.com/p/biogo/exp/seq/translate"
+	"code.google.com/p/biogo/io/featio/gff"
+	"code.google.com/p/biogo/io/seqio/fasta"
+	"code.google.com/p/biogo/search"
+	check "launchpad.net/gocheck"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+type B struct{ *bytes.Buffer }
+
+func (b B) Close() error { return nil }
+
+func approx(c *check.C, obtained, expected float64) {
+	c.Check(math.Abs(obtained-expected) < 1e-9, check.Equals, true, check.Commentf("%v != %v", obtained, expected))
+}
+
+func (s *S) TestIndex(c *check.C) {
+	c.Check(Index([]byte("TTT")), check.Equals, 0)
+	c.Check(Index([]byte("ggg")), check.Equals, 63)
+	c.Check(Index([]byte("AUG")), check.Equals, 35)
+	c.Check(Index([]byte("ANG")), check.Equals, -1)
+	c.Check(Index([]byte("AT")), check.Equals, -1)
+	for i := 0; i < 64; i++ {
+		c.Check(Index([]byte(Codon(i))), check.Equals, i)
+	}
+}
+
+func (s *S) TestUsage(c *check.C) {
+	u := NewUsage(translate.Standard)
+	c.Check(u.Add([]byte("ATGGCTGCTGCCNNNTAA")), check.Equals, 5)
+	gct, gcc, gca := Index([]byte("GCT")), Index([]byte("GCC")), Index([]byte("GCA"))
+	c.Check(u.Counts[gct], check.Equals, 2.)
+	c.Check(u.AminoAcid(gct), check.Equals, alphabet.Letter('A'))
+	c.Check(u.Synonymous('W'), check.DeepEquals, []int{Index([]byte("TGG"))})
+
+	f, r, w := u.Fractions(), u.RSCU(), u.Weights()
+	approx(c, f[gct], 2./3)
+	approx(c, r[gct], 8./3)
+	approx(c, r[gcc], 4./3)
+	approx(c, r[gca], 0)
+	approx(c, w[gct], 1)
+	approx(c, w[gcc], 0.5)
+	approx(c, w[gca], 0.25)
+	approx(c, w[Index([]byte("TTT"))], 0)
+
+	approx(c, u.CAI([]byte("ATGGCTGCCTAA")), math.Sqrt(0.5))
+	approx(c, u.CAI([]byte("GCAGCANNN")), 0.25)
+	c.Check(math.IsNaN(u.CAI([]byte("ATGTTTTAA"))), check.Equals, true)
+	c.Check(strings.HasPrefix(u.String(), "TTT\tF\t0\t0.000\t0.000\n"), check.Equals, true)
+}
+
+func (s *S) TestTAI(c *check.C) {
+	t, err := NewTAI(translate.Standard, map[string]int{"AGC": 2, "GGC": 1, "CAT": 1}, false)
+	c.Assert(err, check.Equals, nil)
+	gct, gcc, gca, ata := Index([]byte("GCT")), Index([]byte("GCC")), Index([]byte("GCA")), Index([]byte("ATA"))
+	max := 2 + (1-WobbleGU)*1
+	approx(c, t.Weights[gct], 1)
+	approx(c, t.Weights[gcc], (1+(1-WobbleIC)*2)/max)
+	approx(c, t.Weights[gca], (1-WobbleIA)*2/max)
+	mean := math.Pow(t.Weights[gcc]*t.Weights[gca], 1./3)
+	approx(c, t.Weights[ata], mean)
+	approx(c, t.Weights[Index([]byte("ATG"))], 0)
+	approx(c, t.Weights[Index([]byte("TAA"))], 0)
+	approx(c, t.Index([]byte("ATGGCTGCCTAA")), math.Sqrt(t.Weights[gcc]))
+
+	p, err := NewTAI(translate.Standard, map[string]int{"AGC": 2, "GGC": 1, "CAT": 1}, true)
+	c.Assert(err, check.Equals, nil)
+	approx(c, p.Weights[ata], (1-LysidineLA)/max)
+
+	_, err = NewTAI(translate.Standard, map[string]int{"AG": 1}, false)
+	c.Check(err, check.NotNil)
+	_, err = NewTAI(translate.Standard, map[string]int{}, false)
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestGenes(c *check.C) {
+	chr := "CC" + "ATGAAATAA" + strings.Repeat("N", 9) + "TTACCC" + "NNNN" + "GGGCAT" + "NN" + "CATGAAATAA"
+	ref := B{bytes.NewBufferString(">chr1\n" + chr + "\n")}
+	feats := B{bytes.NewBufferString(strings.Join([]string{
+		"chr1\ttest\tgene\t3\t11\t.\t+\t.\tID=g1",
+		"chr1\ttest\tCDS\t3\t11\t.\t+\t0\tParent=g1",
+		"chr1\ttest\tCDS\t31\t36\t.\t-\t0\tParent=g2",
+		"chr1\ttest\tCDS\t21\t26\t.\t-\t0\tParent=g2",
+		"chr1\ttest\tCDS\t39\t48\t.\t+\t1\tgene_id \"g3\"; transcript_id \"t3\"",
+	}, "\n") + "\n")}
+
+	genes, err := Genes(gff.NewReader(feats), fasta.NewReader(ref), nil)
+	c.Assert(err, check.Equals, nil)
+	c.Check(genes, check.DeepEquals, []Gene{
+		{"g1", []byte("ATGAAATAA")},
+		{"g2", []byte("ATGCCCGGGTAA")},
+		{"t3", []byte("ATGAAATAA")},
+	})
+
+	u := NewUsage(translate.Standard)
+	for _, g := range genes {
+		u.Add(g.CDS)
+	}
+	sc := Scores(genes, u, nil)
+	c.Check(sc[1].ID, check.Equals, "g2")
+	c.Check(sc[1].Codons, check.Equals, 4)
+	approx(c, sc[1].CAI, 1)
+	c.Check(math.IsNaN(sc[1].TAI), check.Equals, true)
+
+	feats = B{bytes.NewBufferString("chr2\ttest\tCDS\t1\t3\t.\t+\t0\tParent=g1\n")}
+	_, err = Genes(gff.NewReader(feats), fasta.NewReader(B{bytes.NewBufferString(">chr1\nACGT\n")}), nil)
+	c.Check(err, check.NotNil)
+}
+
+func optUsage() *Usage {
+	u := NewUsage(translate.Standard)
+	for cod, n := range map[string]float64{
+		"GCT": 10, "GCC": 5, "GCA": 2, "GCG": 0.5,
+		"AAA": 10, "AAG": 4,
+		"ATG": 10, "TAA": 3, "TGA": 1,
+		"TTT": 10, "TTC": 8,
+	} {
+		u.Counts[Index([]byte(cod))] = n
+	}
+	return u
+}
+
+// checkOptimised checks that d encodes p and satisfies the constraints of o.
+func checkOptimised(c *check.C, o *Optimiser, p string, d *nucleic.Seq) {
+	t, err := translate.Standard.Translate(d, 1)
+	c.Assert(err, check.Equals, nil)
+	c.Check(t.String(), check.Equals, p)
+	dna := []byte(d.String())
+	for _, site := range o.Avoid {
+		pat, err := search.Compile(site)
+		c.Assert(err, check.Equals, nil)
+		c.Check(pat.Hamming(dna, 0), check.HasLen, 0)
+		c.Check(pat.RevComp().Hamming(dna, 0), check.HasLen, 0)
+	}
+	w := o.Window
+	if w <= 0 || w > len(dna) {
+		w = len(dna)
+	}
+	for i := 0; i+w <= len(dna); i++ {
+		g := float64(strings.Count(string(dna[i:i+w]), "G")+strings.Count(string(dna[i:i+w]), "C")) / float64(w)
+		c.Check(g >= o.MinGC && g <= o.MaxGC, check.Equals, true, check.Commentf("window %d GC %v", i, g))
+	}
+}
+
+func (s *S) TestOptimise(c *check.C) {
+	o := NewOptimiser(optUsage())
+	p := protein.NewSeq("prot", []alphabet.Letter("MAKAF*"), alphabet.Protein)
+	d, err := o.Optimise(p)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "ATGGCTAAAGCTTTTTAA")
+	c.Check(d.ID, check.Equals, "prot")
+
+	// The most recent choice is changed first.
+	o.Avoid = []string{"GCTAAA", "TTTTAA"}
+	d, err = o.Optimise(p)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "ATGGCTAAGGCTTTTTGA")
+	checkOptimised(c, o, "MAKAF*", d)
+
+	// Sites are avoided on the opposite strand.
+	o.Avoid = []string{"TTTAGC"}
+	d, err = o.Optimise(p)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "ATGGCTAAGGCTTTTTAA")
+	checkOptimised(c, o, "MAKAF*", d)
+
+	o.Avoid = nil
+	o.MinGC, o.Window = 0.3, 6
+	long := "MKAKAFKAKFAKKAF*"
+	d, err = o.Optimise(protein.NewSeq("", []alphabet.Letter(long), alphabet.Protein))
+	c.Assert(err, check.Equals, nil)
+	checkOptimised(c, o, long, d)
+
+	o.MinGC, o.MaxGC, o.Window = 0.45, 0.5, 0
+	d, err = o.Optimise(protein.NewSeq("", []alphabet.Letter(long), alphabet.Protein))
+	c.Assert(err, check.Equals, nil)
+	checkOptimised(c, o, long, d)
+
+	// Unsatisfiable constraints.
+	o.MinGC, o.MaxGC = 0.5, 1
+	_, err = o.Optimise(protein.NewSeq("", []alphabet.Letter("KKKK"), alphabet.Protein))
+	c.Check(err, check.NotNil)
+	o.MinGC, o.MaxGC, o.Window, o.MaxSteps = 0.9, 1, 6, 10
+	_, err = o.Optimise(protein.NewSeq("", []alphabet.Letter(long), alphabet.Protein))
+	c.Check(err, check.NotNil)
+	_, err = NewOptimiser(optUsage()).Optimise(protein.NewSeq("", []alphabet.Letter("MO"), alphabet.Protein))
+	c.Check(err, check.NotNil)
+}
@@ -0,0 +1,177 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codon
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio"
+	"code.google.com/p/biogo/io/seqio"
+	"code.google.com/p/biogo/seq"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// A Gene is a coding sequence in its coding orientation.
+type Gene struct {
+	ID  string
+	CDS []byte
+}
+
+// Parent returns the name of the transcript or gene that a CDS feature belongs to, taken from the
+// first of the Parent, transcript_id, gene_id or ID attributes found in GFF3 or GFF2 form, or the
+// feature ID if none is present.
+func Parent(f *feat.Feature) string {
+	attrs := map[string]string{}
+	for _, a := range strings.Split(f.Attributes, ";") {
+		a = strings.TrimSpace(a)
+		var k, v string
+		if i := strings.IndexAny(a, "= "); i >= 0 {
+			k, v = a[:i], strings.Trim(strings.TrimSpace(a[i+1:]), `"`)
+		}
+		if _, ok := attrs[k]; k != "" && !ok {
+			attrs[k] = v
+		}
+	}
+	for _, k := range []string{"Parent", "transcript_id", "gene_id", "ID"} {
+		if v, ok := attrs[k]; ok && v != "" {
+			return v
+		}
+	}
+	return f.ID
+}
+
+// Genes returns the coding sequences described by the CDS features read from features, using the
+// reference sequences read from refs. CDS features are grouped into genes by the name returned by
+// group, or by Parent if group is nil. The CDS segments of each gene are joined in order, reverse
+// complemented if on the minus strand, and trimmed by the phase of the first segment. Genes are
+// returned in the order of their first CDS feature.
+func Genes(features featio.Reader, refs seqio.Reader, group func(*feat.Feature) string) ([]Gene, error) {
+	if group == nil {
+		group = Parent
+	}
+
+	ref := map[string]*seq.Seq{}
+	for {
+		s, err := refs.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		ref[s.ID] = s
+	}
+
+	var (
+		names []string
+		parts = map[string][]*feat.Feature{}
+	)
+	for {
+		f, err := features.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if f == nil || f.Feature != "CDS" {
+			continue
+		}
+		name := group(f)
+		if _, ok := parts[name]; !ok {
+			names = append(names, name)
+		}
+		parts[name] = append(parts[name], f)
+	}
+
+	genes := make([]Gene, 0, len(names))
+	for _, name := range names {
+		cds, err := join(parts[name], ref)
+		if err != nil {
+			return nil, err
+		}
+		genes = append(genes, Gene{ID: name, CDS: cds})
+	}
+
+	return genes, nil
+}
+
+type byStart []*feat.Feature
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Less(i, j int) bool { return s[i].Start < s[j].Start }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// join returns the coding sequence of the CDS segments fs.
+func join(fs []*feat.Feature, ref map[string]*seq.Seq) ([]byte, error) {
+	sort.Sort(byStart(fs))
+	strand := fs[0].Strand
+	var cds []byte
+	for _, f := range fs {
+		s, ok := ref[f.Location]
+		switch {
+		case !ok:
+			return nil, bio.NewError("codon: no reference sequence", 0, f.Location)
+		case f.Strand != strand:
+			return nil, bio.NewError("codon: CDS segments on different strands", 0, f.ID)
+		case f.Start < s.Offset || f.End > s.Offset+s.Len() || f.Start > f.End:
+			return nil, bio.NewError("codon: CDS outside reference sequence", 0, f.ID)
+		}
+		cds = append(cds, s.Seq[f.Start-s.Offset:f.End-s.Offset]...)
+	}
+
+	first := fs[0]
+	if strand < 0 {
+		first = fs[len(fs)-1]
+		for i, j := 0, len(cds)-1; i <= j; i, j = i+1, j-1 {
+			cds[i], cds[j] = complement(cds[j]), complement(cds[i])
+		}
+	}
+	if phase := int(first.Frame); phase > 0 && phase < 3 && phase <= len(cds) {
+		cds = cds[phase:]
+	}
+
+	return cds, nil
+}
+
+func complement(b byte) byte {
+	c := comp(b &^ 0x20)
+	if b&0x20 != 0 {
+		c |= 0x20
+	}
+	return c
+}
+
+// A Score holds the codon usage indices of a gene.
+type Score struct {
+	ID       string
+	Codons   int
+	CAI, TAI float64
+}
+
+// Scores returns the CAI of each gene with respect to the reference usage u, and the tAI with
+// respect to t. If t is nil, the tAI is NaN.
+func Scores(genes []Gene, u *Usage, t *TAI) []Score {
+	s := make([]Score, len(genes))
+	for i, g := range genes {
+		s[i] = Score{ID: g.ID, Codons: len(g.CDS) / 3, CAI: u.CAI(g.CDS), TAI: math.NaN()}
+		if t != nil {
+			s[i].TAI = t.Index(g.CDS)
+		}
+	}
+	return s
+}
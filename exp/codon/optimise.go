@@ -0,0 +1,217 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codon
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/protein"
+	"code.google.com/p/biogo/search"
+	"sort"
+)
+
+// Default optimisation parameters.
+var (
+	DefaultThreshold = 0.1
+	DefaultMaxSteps  = 1000000
+)
+
+// An Optimiser back-translates protein sequences using the codons favoured by a codon usage
+// table, subject to constraints on the sequence produced.
+type Optimiser struct {
+	Usage     *Usage
+	Threshold float64  // Codons with a relative adaptiveness below Threshold are used only when no other codon is available.
+	Avoid     []string // Sites, as IUPAC patterns, that must not occur on either strand.
+	MinGC     float64  // Minimum GC fraction.
+	MaxGC     float64  // Maximum GC fraction.
+	Window    int      // Length of the windows in which the GC fraction is constrained. Zero constrains the whole sequence.
+	MaxSteps  int      // Maximum number of codon choices made before giving up.
+}
+
+// NewOptimiser returns an Optimiser using the codon usage u without site or GC constraints.
+func NewOptimiser(u *Usage) *Optimiser {
+	return &Optimiser{
+		Usage:     u,
+		Threshold: DefaultThreshold,
+		MaxGC:     1,
+		MaxSteps:  DefaultMaxSteps,
+	}
+}
+
+// choices returns the codons that may encode each amino acid of aas in order of preference.
+func (o *Optimiser) choices(aas []alphabet.Letter) ([][]int, error) {
+	w := o.Usage.Weights()
+	cache := map[alphabet.Letter][]int{}
+	ch := make([][]int, len(aas))
+	for i, aa := range aas {
+		if c, ok := cache[aa]; ok {
+			ch[i] = c
+			continue
+		}
+		syn := o.Usage.Synonymous(aa)
+		if len(syn) == 0 {
+			return nil, bio.NewError("codon: no codon for amino acid", 0, string(aa), i)
+		}
+		sort.Stable(byWeight{syn, w})
+		var c []int
+		for _, s := range syn {
+			if w[s] >= o.Threshold {
+				c = append(c, s)
+			}
+		}
+		if len(c) == 0 {
+			c = syn
+		}
+		cache[aa], ch[i] = c, c
+	}
+	return ch, nil
+}
+
+type byWeight struct {
+	c []int
+	w [64]float64
+}
+
+func (b byWeight) Len() int           { return len(b.c) }
+func (b byWeight) Less(i, j int) bool { return b.w[b.c[i]] > b.w[b.c[j]] }
+func (b byWeight) Swap(i, j int)      { b.c[i], b.c[j] = b.c[j], b.c[i] }
+
+func gc(c int) (n int) {
+	for _, b := range Codon(c) {
+		if b == 'C' || b == 'G' {
+			n++
+		}
+	}
+	return
+}
+
+// Optimise returns a DNA sequence encoding p. Codons are chosen in order of their relative
+// adaptiveness in the usage table, backtracking where a choice would create an avoided site or
+// a window with a GC fraction outside the specified bounds. An error is returned if no sequence
+// satisfying the constraints is found within MaxSteps codon choices.
+func (o *Optimiser) Optimise(p protein.Sequence) (*nucleic.Seq, error) {
+	aas := make([]alphabet.Letter, p.Len())
+	for i := range aas {
+		aas[i] = p.At(seq.Position{Pos: p.Start() + i}).L
+		if aas[i] >= 'a' && aas[i] <= 'z' {
+			aas[i] -= 'a' - 'A'
+		}
+	}
+	ch, err := o.choices(aas)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []*search.Pattern
+	for _, s := range o.Avoid {
+		pat, err := search.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, pat)
+		if rc := pat.RevComp(); rc.String() != pat.String() {
+			sites = append(sites, rc)
+		}
+	}
+
+	n := len(aas)
+	length := 3 * n
+	window := o.Window
+	if window <= 0 || window > length {
+		window = length
+	}
+
+	// Bounds on the GC content achievable by the codons following each position.
+	minRest, maxRest := make([]int, n+1), make([]int, n+1)
+	for i := n - 1; i >= 0; i-- {
+		lo, hi := 3, 0
+		for _, c := range ch[i] {
+			g := gc(c)
+			if g < lo {
+				lo = g
+			}
+			if g > hi {
+				hi = g
+			}
+		}
+		minRest[i], maxRest[i] = minRest[i+1]+lo, maxRest[i+1]+hi
+	}
+	minGC, maxGC := o.MinGC*float64(window), o.MaxGC*float64(window)
+
+	d := make([]byte, 0, length)
+	gcPrefix := make([]int, 1, length+1)
+	ok := func(k int) bool {
+		for _, s := range sites {
+			from := len(d) - 3 - s.Len() + 1
+			if from < 0 {
+				from = 0
+			}
+			if len(s.Hamming(d[from:], 0)) > 0 {
+				return false
+			}
+		}
+		for e := len(d) - 2; e <= len(d); e++ {
+			if e < window {
+				continue
+			}
+			g := float64(gcPrefix[e] - gcPrefix[e-window])
+			if g < minGC || g > maxGC {
+				return false
+			}
+		}
+		if window == length {
+			g := gcPrefix[len(d)]
+			if float64(g+maxRest[k+1]) < minGC || float64(g+minRest[k+1]) > maxGC {
+				return false
+			}
+		}
+		return true
+	}
+
+	choice := make([]int, n+1)
+	for k, steps := 0, 0; k < n; {
+		if choice[k] == len(ch[k]) {
+			choice[k] = 0
+			if k--; k < 0 {
+				return nil, bio.NewError("codon: no sequence satisfies the constraints", 0, *p.Name())
+			}
+			d, gcPrefix = d[:3*k], gcPrefix[:3*k+1]
+			choice[k]++
+			continue
+		}
+		if steps++; steps > o.MaxSteps {
+			return nil, bio.NewError("codon: optimisation step limit reached", 0, *p.Name())
+		}
+		for _, b := range []byte(Codon(ch[k][choice[k]])) {
+			d = append(d, b)
+			g := gcPrefix[len(gcPrefix)-1]
+			if b == 'C' || b == 'G' {
+				g++
+			}
+			gcPrefix = append(gcPrefix, g)
+		}
+		if ok(k) {
+			k++
+		} else {
+			d, gcPrefix = d[:3*k], gcPrefix[:3*k+1]
+			choice[k]++
+		}
+	}
+
+	return nucleic.NewSeq(*p.Name(), alphabet.BytesToLetters(d), alphabet.DNA), nil
+}
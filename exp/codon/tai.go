@@ -0,0 +1,134 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package codon
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/translate"
+	"math"
+	"strings"
+)
+
+// Selective constraints on codon-anticodon pairing from dos Reis et al.
+var (
+	WobbleGU   = 0.41   // G:U wobble pairing.
+	WobbleIC   = 0.28   // I:C wobble pairing.
+	WobbleIA   = 0.9999 // I:A wobble pairing.
+	WobbleUG   = 0.68   // U:G wobble pairing.
+	LysidineLA = 0.89   // L:A pairing of the lysidine modified anticodon of prokaryotic tRNA-Ile.
+)
+
+// A TAI holds the tRNA adaptation weights of codons.
+type TAI struct {
+	Table   *translate.Table
+	Weights [64]float64
+}
+
+// NewTAI returns the tRNA adaptation weights of the codons of the genetic code t given the tRNA
+// gene copy numbers keyed by anticodon, written 5' to 3'. Anticodons with an A in the first
+// position are taken to be modified to inosine. If prokaryote is true ATA is taken to be read
+// by the lysidine modified CAT anticodon.
+func NewTAI(t *translate.Table, trna map[string]int, prokaryote bool) (*TAI, error) {
+	var copies [64]float64 // Copy number of the Watson-Crick anticodon of each codon.
+	for ac, n := range trna {
+		if len(ac) != 3 {
+			return nil, bio.NewError("codon: invalid anticodon", 0, ac)
+		}
+		ac = strings.ToUpper(ac)
+		c := Index([]byte{comp(ac[2]), comp(ac[1]), comp(ac[0])})
+		if c < 0 {
+			return nil, bio.NewError("codon: invalid anticodon", 0, ac)
+		}
+		copies[c] += float64(n)
+	}
+
+	aa, _ := aminoAcids(t)
+	ti := &TAI{Table: t}
+	var w [64]float64
+	for i := 0; i < 64; i += 4 {
+		// Codons ending T, C, A and G.
+		w[i] = copies[i] + (1-WobbleGU)*copies[i+1]
+		w[i+1] = copies[i+1] + (1-WobbleIC)*copies[i]
+		w[i+2] = copies[i+2] + (1-WobbleIA)*copies[i]
+		w[i+3] = copies[i+3] + (1-WobbleUG)*copies[i+2]
+	}
+	if prokaryote {
+		ata, atg := Index([]byte("ATA")), Index([]byte("ATG"))
+		w[ata] += (1 - LysidineLA) * copies[atg]
+	}
+
+	var (
+		max     float64
+		logSum  float64
+		nonZero int
+	)
+	for i, v := range w {
+		if !counted(aa, i) {
+			continue
+		}
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return nil, bio.NewError("codon: no tRNA genes for sense codons", 0)
+	}
+	for i, v := range w {
+		if !counted(aa, i) {
+			continue
+		}
+		if ti.Weights[i] = v / max; v > 0 {
+			logSum += math.Log(ti.Weights[i])
+			nonZero++
+		}
+	}
+
+	// Codons without a decoding tRNA are given the geometric mean weight.
+	mean := math.Exp(logSum / float64(nonZero))
+	for i, v := range ti.Weights {
+		if counted(aa, i) && v == 0 {
+			ti.Weights[i] = mean
+		}
+	}
+
+	return ti, nil
+}
+
+// counted returns whether the codon with index i contributes to the tAI. Stop codons and ATG
+// are excluded.
+func counted(aa [64]alphabet.Letter, i int) bool {
+	return aa[i] != '*' && Codon(i) != "ATG"
+}
+
+// Index returns the tRNA Adaptation Index of the coding sequence cds, the geometric mean of the
+// weights of its codons, excluding stop codons, ATG and ambiguous codons. Index returns NaN if
+// no codons remain.
+func (ti *TAI) Index(cds []byte) float64 {
+	return geomean(cds, func(c int) (float64, bool) { return ti.Weights[c], ti.Weights[c] > 0 })
+}
+
+func comp(b byte) byte {
+	switch b {
+	case 'A':
+		return 'T'
+	case 'C':
+		return 'G'
+	case 'G':
+		return 'C'
+	case 'T', 'U':
+		return 'A'
+	}
+	return 'N'
+}
@@ -0,0 +1,212 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package codon provides codon usage tables, codon usage indices and codon optimisation.
+//
+// The Codon Adaptation Index is described in:
+//  The codon adaptation index - a measure of directional synonymous codon usage bias, and its
+//  potential applications.
+//   Paul M. Sharp and Wen-Hsiung Li. Nucleic Acids Research 15:1281-1295 (1987).
+//
+// The tRNA Adaptation Index is described in:
+//  Solving the riddle of codon usage preferences: a test for translational selection.
+//   Mario dos Reis, Renos Savva and Lorenz Wernisch. Nucleic Acids Research 32:5036-5044 (2004).
+package codon
+
+import (
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/translate"
+	"fmt"
+	"math"
+)
+
+// Codons are indexed 0-63 with bases ordered TCAG, the first base varying slowest, as in
+// the NCBI genetic code tables.
+const bases = "TCAG"
+
+var baseIndex = func() (t [256]int8) {
+	for i := range t {
+		t[i] = -1
+	}
+	for i, b := range []byte("TCAG") {
+		t[b], t[b|0x20] = int8(i), int8(i)
+	}
+	t['U'], t['u'] = 0, 0
+	return
+}()
+
+// Index returns the index of the unambiguous codon c, or -1 if c contains a letter other than
+// A, C, G, T or U.
+func Index(c []byte) int {
+	if len(c) < 3 {
+		return -1
+	}
+	x, y, z := baseIndex[c[0]], baseIndex[c[1]], baseIndex[c[2]]
+	if x < 0 || y < 0 || z < 0 {
+		return -1
+	}
+	return int(x)<<4 | int(y)<<2 | int(z)
+}
+
+// Codon returns the codon with index i.
+func Codon(i int) string { return string([]byte{bases[i>>4], bases[i>>2&3], bases[i&3]}) }
+
+func aminoAcids(t *translate.Table) (aa [64]alphabet.Letter, syn [64]int) {
+	var n [256]int
+	for i := range aa {
+		c := Codon(i)
+		aa[i] = t.TranslateCodon(translate.Codon{alphabet.Letter(c[0]), alphabet.Letter(c[1]), alphabet.Letter(c[2])})
+		n[aa[i]]++
+	}
+	for i := range syn {
+		syn[i] = n[aa[i]]
+	}
+	return
+}
+
+// A Usage is a codon usage table.
+type Usage struct {
+	Table  *translate.Table
+	Counts [64]float64
+
+	aa  [64]alphabet.Letter
+	syn [64]int // Number of codons encoding the amino acid of each codon.
+}
+
+// NewUsage returns an empty codon usage table for the genetic code t.
+func NewUsage(t *translate.Table) *Usage {
+	u := &Usage{Table: t}
+	u.aa, u.syn = aminoAcids(t)
+	return u
+}
+
+// Add counts the codons of the coding sequence cds, read in its first frame, and returns the
+// number of codons counted. Codons containing ambiguous letters are not counted.
+func (u *Usage) Add(cds []byte) int {
+	var n int
+	for i := 0; i+3 <= len(cds); i += 3 {
+		if c := Index(cds[i : i+3]); c >= 0 {
+			u.Counts[c]++
+			n++
+		}
+	}
+	return n
+}
+
+// AminoAcid returns the amino acid encoded by the codon with index i.
+func (u *Usage) AminoAcid(i int) alphabet.Letter { return u.aa[i] }
+
+// Synonymous returns the indices of the codons encoding the amino acid aa.
+func (u *Usage) Synonymous(aa alphabet.Letter) []int {
+	var s []int
+	for i, l := range u.aa {
+		if l == aa {
+			s = append(s, i)
+		}
+	}
+	return s
+}
+
+// Fractions returns the fraction of each amino acid's codons that are each codon.
+func (u *Usage) Fractions() (f [64]float64) {
+	sum := u.sums()
+	for i, c := range u.Counts {
+		if s := sum[u.aa[i]]; s > 0 {
+			f[i] = c / s
+		}
+	}
+	return
+}
+
+// RSCU returns the relative synonymous codon usage of each codon, the ratio of the codon's count
+// to the count expected if all synonymous codons were used equally. Codons of amino acids that
+// have not been counted have an RSCU of zero.
+func (u *Usage) RSCU() (r [64]float64) {
+	f := u.Fractions()
+	for i := range r {
+		r[i] = f[i] * float64(u.syn[i])
+	}
+	return
+}
+
+// Weights returns the relative adaptiveness of each codon, the ratio of the codon's count to the
+// count of the most used synonymous codon. Codons that have not been counted are given a count
+// of 0.5 as described by Sharp and Li. Codons of amino acids that have not been counted have a
+// weight of zero.
+func (u *Usage) Weights() (w [64]float64) {
+	var max [256]float64
+	for i, c := range u.Counts {
+		if c > max[u.aa[i]] {
+			max[u.aa[i]] = c
+		}
+	}
+	for i, c := range u.Counts {
+		if m := max[u.aa[i]]; m > 0 {
+			w[i] = math.Max(c, 0.5) / m
+		}
+	}
+	return
+}
+
+func (u *Usage) sums() (s [256]float64) {
+	for i, c := range u.Counts {
+		s[u.aa[i]] += c
+	}
+	return
+}
+
+// CAI returns the Codon Adaptation Index of the coding sequence cds with respect to the reference
+// usage u: the geometric mean of the relative adaptiveness of its codons. Stop codons, codons of
+// amino acids encoded by a single codon, ambiguous codons and codons of amino acids not counted in
+// u are excluded. CAI returns NaN if no codons remain.
+func (u *Usage) CAI(cds []byte) float64 {
+	w := u.Weights()
+	return geomean(cds, func(c int) (float64, bool) {
+		return w[c], u.aa[c] != '*' && u.syn[c] > 1 && w[c] > 0
+	})
+}
+
+// geomean returns the geometric mean of the weights of the codons of cds for which w returns true.
+func geomean(cds []byte, w func(c int) (float64, bool)) float64 {
+	var (
+		sum float64
+		n   int
+	)
+	for i := 0; i+3 <= len(cds); i += 3 {
+		c := Index(cds[i : i+3])
+		if c < 0 {
+			continue
+		}
+		if v, ok := w(c); ok {
+			sum += math.Log(v)
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return math.Exp(sum / float64(n))
+}
+
+// String returns a tabular representation of the usage table with the count, fraction of
+// synonymous codons and RSCU of each codon.
+func (u *Usage) String() string {
+	f, r := u.Fractions(), u.RSCU()
+	var s []byte
+	for i, c := range u.Counts {
+		s = append(s, fmt.Sprintf("%s\t%c\t%g\t%.3f\t%.3f\n", Codon(i), u.aa[i], c, f[i], r[i])...)
+	}
+	return string(s)
+}
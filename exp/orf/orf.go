@@ -0,0 +1,229 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package orf provides six-frame open reading frame finding for nucleic acid sequences.
+package orf
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/translate"
+	"code.google.com/p/biogo/feat"
+	oseq "code.google.com/p/biogo/seq"
+	"fmt"
+	"sort"
+)
+
+// A StartPolicy specifies which codons may begin an ORF.
+type StartPolicy int
+
+const (
+	ATG      StartPolicy = iota // ORFs begin with ATG.
+	AnyStart                    // ORFs begin with any initiation codon of the genetic code.
+	NoStart                     // ORFs begin immediately after the preceding in-frame stop codon.
+)
+
+var complement = [256]alphabet.Letter{}
+
+func init() {
+	for i := range complement {
+		complement[i] = 'N'
+	}
+	for _, p := range []string{"AT", "UA", "CG", "GC", "TA", "RY", "YR", "KM", "MK", "SS", "WW", "BV", "VB", "DH", "HD", "NN", "--"} {
+		complement[p[0]] = alphabet.Letter(p[1])
+		complement[p[0]|0x20] = alphabet.Letter(p[1] | 0x20)
+	}
+	complement['-'] = '-'
+}
+
+// A Finder finds open reading frames in nucleic acid sequences.
+type Finder struct {
+	Table     *translate.Table // Genetic code used to identify start and stop codons.
+	MinLength int              // Minimum length of an ORF in bases, including the stop codon.
+	Starts    StartPolicy
+	Nested    bool   // Report ORFs beginning at each in-frame start, not only the first.
+	Partial   bool   // Report ORFs without a stop codon at the ends of linear sequences.
+	Source    string // Source of the features returned.
+}
+
+// NewFinder returns a Finder using the standard genetic code and reporting ORFs of at least
+// minLength bases that begin with ATG.
+func NewFinder(minLength int) *Finder {
+	return &Finder{
+		Table:     translate.Standard,
+		MinLength: minLength,
+		Starts:    ATG,
+		Source:    "orf",
+	}
+}
+
+// Find returns the ORFs on both strands of s.
+func (f *Finder) Find(s *oseq.Seq) ([]*feat.Feature, error) {
+	return f.find(s.ID, s.Offset, alphabet.BytesToLetters(s.Seq), s.Circular)
+}
+
+// FindNucleic returns the ORFs on both strands of s.
+func (f *Finder) FindNucleic(s nucleic.Sequence) ([]*feat.Feature, error) {
+	l := make([]alphabet.Letter, s.Len())
+	for i := range l {
+		l[i] = s.At(seq.Position{Pos: s.Start() + i}).L
+	}
+	return f.find(*s.Name(), s.Start(), l, s.IsCircular())
+}
+
+// find returns features for the ORFs found in the letters l of the sequence named id, starting
+// at offset. The features have Start and End set in the coordinates of the sequence, Strand set
+// to the strand of the ORF and Frame, the GFF phase, set to 0 since every ORF begins with a whole
+// codon. The reading frame of the ORF, counted from the start of its strand, is given by the frame
+// attribute as +1 to +3 or -1 to -3. ORFs crossing the origin of a circular sequence have an End
+// greater than the end of the sequence.
+func (f *Finder) find(id string, offset int, l []alphabet.Letter, circular bool) ([]*feat.Feature, error) {
+	if f.Table == nil {
+		return nil, bio.NewError("orf: no genetic code", 0)
+	}
+	if f.MinLength < 3 {
+		return nil, bio.NewError("orf: minimum length less than one codon", 0, f.MinLength)
+	}
+
+	rc := make([]alphabet.Letter, len(l))
+	for i, b := range l {
+		rc[len(l)-1-i] = complement[b]
+	}
+
+	var orfs []*feat.Feature
+	for _, strand := range []int8{1, -1} {
+		s := l
+		if strand < 0 {
+			s = rc
+		}
+		for _, o := range f.scan(s, circular) {
+			start, end := o.start, o.end
+			if strand < 0 {
+				start, end = len(l)-end, len(l)-start
+				if start < 0 {
+					start, end = start+len(l), end+len(l)
+				}
+			}
+			frame := o.start % 3
+			orfs = append(orfs, &feat.Feature{
+				Location:   id,
+				Source:     f.Source,
+				Feature:    "ORF",
+				Start:      start + offset,
+				End:        end + offset,
+				Strand:     strand,
+				Frame:      0,
+				Moltype:    bio.DNA,
+				Attributes: fmt.Sprintf("frame %+d", int(strand)*(frame+1)),
+			})
+		}
+	}
+
+	sort.Sort(byPosition(orfs))
+	for i, o := range orfs {
+		o.ID = fmt.Sprintf("%s_orf%d", id, i+1)
+		o.Attributes = fmt.Sprintf("ID %s; %s", o.ID, o.Attributes)
+	}
+
+	return orfs, nil
+}
+
+type orf struct{ start, end int }
+
+// scan returns the ORFs found in the three frames of a single strand. If circular is true, the
+// strand is scanned as three tandem copies so that ORFs beginning in the middle copy have their
+// full upstream and downstream context, and only ORFs beginning in the middle copy and no longer
+// than the strand are returned, in the coordinates of the middle copy.
+func (f *Finder) scan(s []alphabet.Letter, circular bool) []orf {
+	n := len(s)
+	lo, hi := 0, n
+	if circular {
+		t := make([]alphabet.Letter, 0, 3*n)
+		for i := 0; i < 3; i++ {
+			t = append(t, s...)
+		}
+		s, lo, hi = t, n, 2*n
+	}
+
+	var orfs []orf
+	keep := func(start, end int) {
+		if start < lo || start >= hi || end-start < f.MinLength || (circular && end-start > n) {
+			return
+		}
+		orfs = append(orfs, orf{start - lo, end - lo})
+	}
+	for frame := 0; frame < 3; frame++ {
+		var open []int
+		afterStop := true // The beginning of the strand is treated as following a stop.
+		for i := frame; i+3 <= len(s); i += 3 {
+			c := translate.Codon{s[i], s[i+1], s[i+2]}
+			if f.Table.IsStop(c) {
+				for _, st := range open {
+					keep(st, i+3)
+				}
+				open = open[:0]
+				afterStop = true
+				continue
+			}
+			wasAfterStop := afterStop
+			afterStop = false
+			if len(open) > 0 && !f.Nested {
+				continue
+			}
+			switch f.Starts {
+			case ATG:
+				if isATG(c) {
+					open = append(open, i)
+				}
+			case AnyStart:
+				if f.Table.IsStart(c) {
+					open = append(open, i)
+				}
+			case NoStart:
+				if wasAfterStop {
+					open = append(open, i)
+				}
+			}
+		}
+		if f.Partial && !circular {
+			end := frame + (len(s)-frame)/3*3
+			for _, st := range open {
+				keep(st, end)
+			}
+		}
+	}
+
+	return orfs
+}
+
+func isATG(c translate.Codon) bool {
+	return c[0]|0x20 == 'a' && (c[1]|0x20 == 't' || c[1]|0x20 == 'u') && c[2]|0x20 == 'g'
+}
+
+type byPosition []*feat.Feature
+
+func (p byPosition) Len() int { return len(p) }
+func (p byPosition) Less(i, j int) bool {
+	if p[i].Start != p[j].Start {
+		return p[i].Start < p[j].Start
+	}
+	if p[i].End != p[j].End {
+		return p[i].End < p[j].End
+	}
+	return p[i].Strand > p[j].Strand
+}
+func (p byPosition) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,175 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package orf
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/translate"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/gff"
+	oseq "code.google.com/p/biogo/seq"
+	"fmt"
+	check "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+type B struct{ *bytes.Buffer }
+
+func (b B) Close() error { return nil }
+
+func revComp(s string) string {
+	b := make([]byte, len(s))
+	for i := range s {
+		b[len(s)-1-i] = byte(complement[s[i]])
+	}
+	return string(b)
+}
+
+type orfs []struct {
+	start, end    int
+	strand, frame int8
+}
+
+func found(c *check.C, f *Finder, s string, circular bool) orfs {
+	fs, err := f.Find(&oseq.Seq{ID: "test", Seq: []byte(s), Circular: circular})
+	c.Assert(err, check.Equals, nil)
+
+	// The exp sequence types give the same result.
+	n := nucleic.NewSeq("test", []alphabet.Letter(s), alphabet.DNA)
+	n.Circular(circular)
+	nfs, err := f.FindNucleic(n)
+	c.Assert(err, check.Equals, nil)
+	c.Check(nfs, check.DeepEquals, fs)
+
+	var o orfs
+	for _, f := range fs {
+		// ORFs begin with a whole codon, so the GFF phase is always zero.
+		c.Check(f.Frame, check.Equals, int8(0))
+		var frame int
+		_, err := fmt.Sscanf(f.Attributes[strings.Index(f.Attributes, "frame "):], "frame %d", &frame)
+		c.Assert(err, check.Equals, nil)
+		if frame < 0 {
+			frame = -frame
+		}
+		o = append(o, struct {
+			start, end    int
+			strand, frame int8
+		}{f.Start, f.End, f.Strand, int8(frame - 1)})
+	}
+	return o
+}
+
+func (s *S) TestFind(c *check.C) {
+	sq := "CC" + "ATGAAATTTGGGTAG" + "GGG" + revComp("ATGCCCAAATAA") + "CC"
+	f := NewFinder(12)
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{2, 17, 1, 2}, {20, 32, -1, 2}})
+
+	f.MinLength = 13
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{2, 17, 1, 2}})
+
+	_, err := (&Finder{Table: translate.Standard}).Find(&oseq.Seq{Seq: []byte(sq)})
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestNested(c *check.C) {
+	sq := "ATGAAAATGTTTTAG"
+	f := NewFinder(9)
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{0, 15, 1, 0}})
+	f.Nested = true
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{0, 15, 1, 0}, {6, 15, 1, 0}})
+}
+
+func (s *S) TestStarts(c *check.C) {
+	sq := "GTGAAATTTTAA"
+	f := NewFinder(12)
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs(nil))
+	f.Starts, f.Table = AnyStart, translate.Tables[11]
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{0, 12, 1, 0}})
+
+	f = NewFinder(9)
+	f.Starts = NoStart
+	var plus orfs
+	for _, o := range found(c, f, "AAACCCTAAGGGTTTCCCTGA", false) {
+		if o.strand == 1 && o.frame == 0 {
+			plus = append(plus, o)
+		}
+	}
+	c.Check(plus, check.DeepEquals, orfs{{0, 9, 1, 0}, {9, 21, 1, 0}})
+}
+
+func (s *S) TestPartial(c *check.C) {
+	sq := "CCATGAAATTTGGGCCC"
+	f := NewFinder(12)
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs(nil))
+	f.Partial = true
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs{{2, 17, 1, 2}})
+}
+
+func (s *S) TestCircular(c *check.C) {
+	sq := "AAATAG" + strings.Repeat("C", 20) + "ATGCCC"
+	l := len(sq)
+	f := NewFinder(12)
+	c.Check(found(c, f, sq, false), check.DeepEquals, orfs(nil))
+	c.Check(found(c, f, sq, true), check.DeepEquals, orfs{{l - 6, l + 6, 1, int8((l - 6) % 3)}})
+	c.Check(found(c, f, revComp(sq), true), check.DeepEquals, orfs{{l - 6, l + 6, -1, int8((l - 6) % 3)}})
+}
+
+func (s *S) TestGFF(c *check.C) {
+	fs, err := NewFinder(12).Find(&oseq.Seq{ID: "chr", Seq: []byte("CC" + revComp("ATGCCCAAATAA"))})
+	c.Assert(err, check.Equals, nil)
+	b := B{&bytes.Buffer{}}
+	w := gff.NewWriter(b, 2, 60, false)
+	for _, f := range fs {
+		_, err = w.Write(f)
+		c.Assert(err, check.Equals, nil)
+	}
+	c.Assert(w.Close(), check.Equals, nil)
+	c.Check(b.String(), check.Equals, "chr\torf\tORF\t3\t14\t.\t-\t0\tID chr_orf1; frame -1\n")
+	c.Check(fs, check.DeepEquals, []*feat.Feature{{
+		ID: "chr_orf1", Location: "chr", Source: "orf", Feature: "ORF",
+		Start: 2, End: 14, Strand: -1, Frame: 0, Moltype: bio.DNA,
+		Attributes: "ID chr_orf1; frame -1",
+	}})
+
+	// An ORF in the third frame is written with phase 0 and reads back in frame.
+	sq := "CC" + "ATGAAATTTGGGTAG" + "G"
+	fs, err = NewFinder(12).Find(&oseq.Seq{ID: "chr", Seq: []byte(sq)})
+	c.Assert(err, check.Equals, nil)
+	c.Assert(len(fs), check.Equals, 1)
+	b.Reset()
+	w = gff.NewWriter(b, 2, 60, false)
+	_, err = w.Write(fs[0])
+	c.Assert(err, check.Equals, nil)
+	c.Assert(w.Close(), check.Equals, nil)
+	c.Check(b.String(), check.Equals, "chr\torf\tORF\t3\t17\t.\t+\t0\tID chr_orf1; frame +3\n")
+
+	r := gff.NewReader(B{bytes.NewBufferString(b.String())})
+	g, err := r.Read()
+	c.Assert(err, check.Equals, nil)
+	c.Check(g.Frame, check.Equals, int8(0))
+	c.Check(sq[g.Start+int(g.Frame):g.Start+int(g.Frame)+3], check.Equals, "ATG")
+}
@@ -0,0 +1,63 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package translate
+
+import (
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/protein"
+	"fmt"
+)
+
+func ExampleTable_Frames() {
+	s := nucleic.NewSeq("example DNA", []alphabet.Letter("ATGGCCATTGTAATGGGCCGCTGAAAGGGTGCCCGATAG"), alphabet.DNA)
+	f, err := Standard.Frames(s)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, p := range f {
+		fmt.Println(p.Desc, p)
+	}
+	// Output:
+	// frame=+1 MAIVMGR*KGAR*
+	// frame=+2 WPL*WAAERVPD
+	// frame=+3 GHCNGPLKGCPI
+	// frame=-1 LSGTLSAAHYNGH
+	// frame=-2 YRAPFQRPITMA
+	// frame=-3 IGHPFSGPLQWP
+}
+
+func ExampleTable_TranslateCDS() {
+	s := nucleic.NewSeq("example CDS", []alphabet.Letter("GTGAARTTYCTGTAG"), alphabet.DNA)
+	for _, id := range []int{1, 11} {
+		p, err := Tables[id].TranslateCDS(s)
+		fmt.Println(Tables[id], p, err == nil)
+	}
+	// Output:
+	// 1: Standard <nil> false
+	// 11: Bacterial, Archaeal and Plant Plastid MKFL true
+}
+
+func ExampleTable_BackTranslate() {
+	p := protein.NewSeq("example protein", []alphabet.Letter("MKWL*"), alphabet.Protein)
+	d, err := Standard.BackTranslate(p)
+	if err == nil {
+		fmt.Println(d)
+	}
+	// Output:
+	// ATGAARTGGYTNTRR
+}
@@ -0,0 +1,331 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package translate provides genetic code tables and translation of nucleic acid sequences
+// to protein sequences and back.
+//
+// All of the NCBI genetic codes are provided. Ambiguous IUPAC nucleotide codes are translated
+// to a single amino acid if all the codons they represent encode the same amino acid, to one
+// of the ambiguous amino acid codes B, Z or J if they encode only the amino acids those codes
+// represent, and otherwise to X.
+package translate
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/protein"
+	"fmt"
+)
+
+// Nucleotide bit masks, with bits ordered T, C, A, G as in the NCBI tables.
+const (
+	t = 1 << iota
+	c
+	a
+	g
+	gap
+
+	n = t | c | a | g
+)
+
+var (
+	masks [256]byte
+	codes = [16]alphabet.Letter{'-', 'T', 'C', 'Y', 'A', 'W', 'M', 'H', 'G', 'K', 'S', 'B', 'R', 'D', 'V', 'N'}
+)
+
+func init() {
+	for l, m := range map[byte]byte{
+		'T': t, 'U': t, 'C': c, 'A': a, 'G': g,
+		'Y': c | t, 'R': a | g, 'W': a | t, 'S': c | g, 'K': g | t, 'M': a | c,
+		'B': c | g | t, 'D': a | g | t, 'H': a | c | t, 'V': a | c | g, 'N': n, 'X': n,
+	} {
+		masks[l], masks[l|0x20] = m, m
+	}
+	masks['-'], masks['.'] = gap, gap
+
+	for _, d := range ncbi {
+		tab, err := NewTable(d.id, d.name, d.aas, d.starts)
+		if err != nil {
+			panic(err)
+		}
+		Tables[d.id] = tab
+	}
+	Standard = Tables[1]
+}
+
+// complement returns the bit mask complementary to m.
+func complement(m byte) byte {
+	return m&gap | (m&t)<<2 | (m&a)>>2 | (m&c)<<2 | (m&g)>>2
+}
+
+// A Codon is a nucleotide triplet.
+type Codon [3]alphabet.Letter
+
+func (self Codon) String() string { return string([]byte{byte(self[0]), byte(self[1]), byte(self[2])}) }
+
+func (self Codon) masks() [3]byte {
+	return [3]byte{masks[self[0]], masks[self[1]], masks[self[2]]}
+}
+
+// A Table is a genetic code.
+type Table struct {
+	ID   int
+	Name string
+
+	aa    [64]alphabet.Letter
+	start [64]bool
+	stop  [64]bool     // Codons that may terminate translation.
+	back  [256][3]byte // Nucleotide masks of the codons encoding each amino acid.
+}
+
+var (
+	// Tables holds the NCBI genetic codes keyed on their NCBI identifier.
+	Tables = map[int]*Table{}
+
+	// Standard is the standard genetic code, NCBI table 1.
+	Standard *Table
+)
+
+// NewTable returns a genetic code with the given identifier and name. The translations of the
+// 64 codons are given by aas and the initiation codons by starts, both in NCBI order with the
+// bases of each codon position ordered TCAG and the first position varying slowest. Initiation
+// codons are marked by M in starts. Sense codons that may terminate translation depending on
+// context are marked by * in starts.
+func NewTable(id int, name, aas, starts string) (*Table, error) {
+	if len(aas) != 64 || len(starts) != 64 {
+		return nil, bio.NewError("translate: table must specify 64 codons", 0, id)
+	}
+	tab := &Table{ID: id, Name: name}
+	for i := range tab.aa {
+		l := alphabet.Letter(aas[i])
+		if l != '*' && (l < 'A' || l > 'Z') {
+			return nil, bio.NewError("translate: invalid amino acid", 0, id, aas[i])
+		}
+		tab.aa[i] = l
+		tab.start[i] = starts[i] == 'M'
+		tab.stop[i] = l == '*' || starts[i] == '*'
+
+		m := [3]byte{1 << uint(i>>4), 1 << uint(i>>2&3), 1 << uint(i&3)}
+		for _, b := range []alphabet.Letter{l, l | 0x20} {
+			for j := range m {
+				tab.back[b][j] |= m[j]
+			}
+		}
+	}
+	for _, amb := range []struct {
+		l  alphabet.Letter
+		of string
+	}{{'B', "DN"}, {'Z', "EQ"}, {'J', "IL"}} {
+		for _, b := range []alphabet.Letter{amb.l, amb.l | 0x20} {
+			for j := range tab.back[b] {
+				tab.back[b][j] = tab.back[amb.of[0]][j] | tab.back[amb.of[1]][j]
+			}
+		}
+	}
+	for _, b := range []alphabet.Letter{'X', 'x'} {
+		tab.back[b] = [3]byte{n, n, n}
+	}
+	tab.back['-'] = [3]byte{gap, gap, gap}
+
+	return tab, nil
+}
+
+func (self *Table) String() string { return fmt.Sprintf("%d: %s", self.ID, self.Name) }
+
+// each calls f with the index of each unambiguous codon represented by the nucleotide masks
+// in m, returning false if f returns false or m represents no codon.
+func each(m [3]byte, f func(i int) bool) bool {
+	if m[0]&n == 0 || m[1]&n == 0 || m[2]&n == 0 {
+		return false
+	}
+	for x := 0; x < 4; x++ {
+		if m[0]&(1<<uint(x)) == 0 {
+			continue
+		}
+		for y := 0; y < 4; y++ {
+			if m[1]&(1<<uint(y)) == 0 {
+				continue
+			}
+			for z := 0; z < 4; z++ {
+				if m[2]&(1<<uint(z)) != 0 && !f(x<<4|y<<2|z) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func bit(l alphabet.Letter) uint32 {
+	if l == '*' {
+		return 1 << 26
+	}
+	return 1 << (l - 'A')
+}
+
+func (self *Table) translate(m [3]byte) alphabet.Letter {
+	if m == [3]byte{gap, gap, gap} {
+		return '-'
+	}
+	var set uint32
+	if !each(m, func(i int) bool { set |= bit(self.aa[i]); return true }) {
+		return 'X'
+	}
+	switch {
+	case set&(set-1) == 0:
+		for l := alphabet.Letter('A'); l <= 'Z'; l++ {
+			if set == bit(l) {
+				return l
+			}
+		}
+		return '*'
+	case set&^(bit('D')|bit('N')) == 0:
+		return 'B'
+	case set&^(bit('E')|bit('Q')) == 0:
+		return 'Z'
+	case set&^(bit('I')|bit('L')) == 0:
+		return 'J'
+	}
+	return 'X'
+}
+
+// TranslateCodon returns the amino acid encoded by the codon. Gap codons translate to the
+// gap letter, '-'.
+func (self *Table) TranslateCodon(cod Codon) alphabet.Letter { return self.translate(cod.masks()) }
+
+// IsStart returns whether every codon represented by cod is an initiation codon.
+func (self *Table) IsStart(cod Codon) bool {
+	return each(cod.masks(), func(i int) bool { return self.start[i] })
+}
+
+// IsStop returns whether every codon represented by cod is a stop codon.
+func (self *Table) IsStop(cod Codon) bool {
+	return each(cod.masks(), func(i int) bool { return self.aa[i] == '*' })
+}
+
+// MayStop returns whether every codon represented by cod may terminate translation. This
+// differs from IsStop only for codes where stop codons are also assigned to amino acids.
+func (self *Table) MayStop(cod Codon) bool {
+	return each(cod.masks(), func(i int) bool { return self.stop[i] })
+}
+
+// masksOf returns the nucleotide masks of the letters of s read in the given frame. Frames 1,
+// 2 and 3 read the sequence from its first, second and third letter, and frames -1, -2 and -3
+// read the reverse complement of the sequence from its first, second and third letter.
+func masksOf(s nucleic.Sequence, frame int) ([]byte, error) {
+	if frame == 0 || frame < -3 || frame > 3 {
+		return nil, bio.NewError("translate: invalid frame", 0, frame)
+	}
+	ms := make([]byte, s.Len())
+	for i := range ms {
+		ms[i] = masks[s.At(seq.Position{Pos: s.Start() + i}).L]
+	}
+	if frame < 0 {
+		for i, j := 0, len(ms)-1; i <= j; i, j = i+1, j-1 {
+			ms[i], ms[j] = complement(ms[j]), complement(ms[i])
+		}
+		frame = -frame
+	}
+	if frame-1 > len(ms) {
+		return nil, nil
+	}
+	return ms[frame-1:], nil
+}
+
+func (self *Table) translateMasks(ms []byte) []alphabet.Letter {
+	p := make([]alphabet.Letter, len(ms)/3)
+	for i := range p {
+		p[i] = self.translate([3]byte{ms[3*i], ms[3*i+1], ms[3*i+2]})
+	}
+	return p
+}
+
+// Translate returns the translation of s in the given frame, one of 1, 2, 3 for the strand of s
+// and -1, -2, -3 for the opposite strand. Incomplete trailing codons are ignored.
+func (self *Table) Translate(s nucleic.Sequence, frame int) (*protein.Seq, error) {
+	ms, err := masksOf(s, frame)
+	if err != nil {
+		return nil, err
+	}
+	p := protein.NewSeq(*s.Name(), self.translateMasks(ms), alphabet.Protein)
+	p.Desc = fmt.Sprintf("frame=%+d", frame)
+	return p, nil
+}
+
+// Frames returns the translations of s in frames 1, 2, 3, -1, -2 and -3.
+func (self *Table) Frames(s nucleic.Sequence) ([6]*protein.Seq, error) {
+	var f [6]*protein.Seq
+	for i, frame := range [...]int{1, 2, 3, -1, -2, -3} {
+		var err error
+		if f[i], err = self.Translate(s, frame); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// TranslateCDS returns the translation of the complete coding sequence s. The sequence must
+// be a whole number of codons beginning with an initiation codon, which is translated as
+// methionine, and ending with its only stop codon, which is not included in the translation.
+func (self *Table) TranslateCDS(s nucleic.Sequence) (*protein.Seq, error) {
+	ms, err := masksOf(s, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(ms) < 6 || len(ms)%3 != 0:
+		return nil, bio.NewError("translate: CDS length not a multiple of three", 0, *s.Name(), len(ms))
+	case !each([3]byte{ms[0], ms[1], ms[2]}, func(i int) bool { return self.start[i] }):
+		return nil, bio.NewError("translate: CDS does not begin with a start codon", 0, *s.Name())
+	}
+	l := self.translateMasks(ms)
+	if l[len(l)-1] != '*' {
+		return nil, bio.NewError("translate: CDS does not end with a stop codon", 0, *s.Name())
+	}
+	l = l[:len(l)-1]
+	for i, aa := range l {
+		if aa == '*' {
+			return nil, bio.NewError("translate: internal stop codon in CDS", 0, *s.Name(), i)
+		}
+	}
+	l[0] = 'M'
+
+	return protein.NewSeq(*s.Name(), l, alphabet.Protein), nil
+}
+
+// BackTranslate returns a DNA sequence with the codon for each amino acid of p written as the
+// IUPAC codes covering, at each codon position, the bases of all codons encoding the amino acid.
+// Gaps are back-translated to three gaps and X to NNN. An error is returned if a letter of p is
+// not encoded by the table.
+func (self *Table) BackTranslate(p protein.Sequence) (*nucleic.Seq, error) {
+	d := make([]alphabet.Letter, 0, 3*p.Len())
+	for i := p.Start(); i < p.End(); i++ {
+		l := p.At(seq.Position{Pos: i}).L
+		m := self.back[l]
+		if m[0] == 0 {
+			return nil, bio.NewError("translate: no codon for amino acid", 0, *p.Name(), i, string(l))
+		}
+		for _, b := range m {
+			if b == gap {
+				d = append(d, '-')
+			} else {
+				d = append(d, codes[b])
+			}
+		}
+	}
+	return nucleic.NewSeq(*p.Name(), d, alphabet.DNA), nil
+}
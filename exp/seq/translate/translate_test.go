@@ -0,0 +1,184 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package translate
+
+import (
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/exp/seq/nucleic/packed"
+	"code.google.com/p/biogo/exp/seq/protein"
+	check "launchpad.net/gocheck"
+	"testing"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func codon(s string) Codon {
+	return Codon{alphabet.Letter(s[0]), alphabet.Letter(s[1]), alphabet.Letter(s[2])}
+}
+
+func (s *S) TestTables(c *check.C) {
+	c.Check(len(Tables), check.Equals, len(ncbi))
+	c.Check(Standard.ID, check.Equals, 1)
+	const bases = "TCAG"
+	for _, d := range ncbi {
+		tab := Tables[d.id]
+		c.Assert(tab, check.NotNil)
+		for i := 0; i < 64; i++ {
+			cod := codon(string([]byte{bases[i>>4], bases[i>>2&3], bases[i&3]}))
+			c.Check(tab.TranslateCodon(cod), check.Equals, alphabet.Letter(d.aas[i]), check.Commentf("table %d codon %v", d.id, cod))
+			c.Check(tab.IsStart(cod), check.Equals, d.starts[i] == 'M')
+			c.Check(tab.IsStop(cod), check.Equals, d.aas[i] == '*')
+		}
+	}
+	_, err := NewTable(0, "short", "FF", "--")
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestCodes(c *check.C) {
+	for _, t := range []struct {
+		table   int
+		codon   string
+		aa      alphabet.Letter
+		start   bool
+		stop    bool
+		mayStop bool
+	}{
+		{1, "ATG", 'M', true, false, false},
+		{1, "aug", 'M', true, false, false},
+		{1, "TGA", '*', false, true, true},
+		{2, "TGA", 'W', false, false, false},
+		{2, "AGA", '*', false, true, true},
+		{11, "GTG", 'V', true, false, false},
+		{28, "TAA", 'Q', false, false, true},
+		{1, "GCN", 'A', false, false, false},
+		{1, "TTY", 'F', false, false, false},
+		{1, "YTR", 'L', false, false, false},
+		{1, "RAY", 'B', false, false, false},
+		{1, "SAR", 'Z', false, false, false},
+		{1, "MTH", 'J', false, false, false},
+		{1, "TRA", '*', false, true, true},
+		{1, "TNA", 'X', false, false, false},
+		{1, "NNN", 'X', false, false, false},
+		{1, "AT-", 'X', false, false, false},
+		{1, "---", '-', false, false, false},
+		{1, "A?G", 'X', false, false, false},
+		{11, "NTG", 'X', true, false, false},
+		{11, "ATH", 'I', true, false, false},
+	} {
+		tab := Tables[t.table]
+		cod := codon(t.codon)
+		c.Check(tab.TranslateCodon(cod), check.Equals, t.aa, check.Commentf("table %d codon %s", t.table, t.codon))
+		c.Check(tab.IsStart(cod), check.Equals, t.start, check.Commentf("table %d codon %s", t.table, t.codon))
+		c.Check(tab.IsStop(cod), check.Equals, t.stop, check.Commentf("table %d codon %s", t.table, t.codon))
+		c.Check(tab.MayStop(cod), check.Equals, t.mayStop, check.Commentf("table %d codon %s", t.table, t.codon))
+	}
+}
+
+const frameSeq = "ATGGCCATTGTAATGGGCCGCTGAAAGGGTGCCCGATAG"
+
+var frames = [6]string{
+	"MAIVMGR*KGAR*",
+	"WPL*WAAERVPD",
+	"GHCNGPLKGCPI",
+	"LSGTLSAAHYNGH",
+	"YRAPFQRPITMA",
+	"IGHPFSGPLQWP",
+}
+
+func (s *S) TestTranslate(c *check.C) {
+	l := []alphabet.Letter(frameSeq)
+	ql := make([]alphabet.QLetter, len(l))
+	for i := range l {
+		ql[i] = alphabet.QLetter{L: l[i], Q: 30}
+	}
+	p, err := packed.NewSeq("packed", l, alphabet.DNA)
+	c.Assert(err, check.Equals, nil)
+	for _, ns := range []nucleic.Sequence{
+		nucleic.NewSeq("seq", l, alphabet.DNA),
+		nucleic.NewQSeq("qseq", ql, alphabet.DNA, alphabet.Sanger),
+		p,
+	} {
+		f, err := Standard.Frames(ns)
+		c.Assert(err, check.Equals, nil)
+		for i := range f {
+			c.Check(f[i].String(), check.Equals, frames[i])
+			c.Check(f[i].ID, check.Equals, *ns.Name())
+		}
+		c.Check(f[3].Desc, check.Equals, "frame=-1")
+	}
+
+	_, err = Standard.Translate(nucleic.NewSeq("", l, alphabet.DNA), 4)
+	c.Check(err, check.NotNil)
+	pr, err := Standard.Translate(nucleic.NewSeq("", l[:2], alphabet.DNA), 3)
+	c.Check(err, check.Equals, nil)
+	c.Check(pr.Len(), check.Equals, 0)
+}
+
+func (s *S) TestTranslateCDS(c *check.C) {
+	for _, t := range []struct {
+		table int
+		cds   string
+		prot  string
+		ok    bool
+	}{
+		{11, "GTGAAATAA", "MK", true},
+		{1, "ATGTTYTGA", "MF", true},
+		{1, "GTGAAATAA", "", false},
+		{1, "ATGTAAAAATAA", "", false},
+		{1, "ATGAAAAAA", "", false},
+		{1, "ATGAAATA", "", false},
+		{2, "ATAAAAAGG", "MK", true},
+	} {
+		p, err := Tables[t.table].TranslateCDS(nucleic.NewSeq("cds", []alphabet.Letter(t.cds), alphabet.DNA))
+		if !t.ok {
+			c.Check(err, check.NotNil, check.Commentf("%s", t.cds))
+			continue
+		}
+		c.Assert(err, check.Equals, nil)
+		c.Check(p.String(), check.Equals, t.prot)
+	}
+}
+
+func (s *S) TestBackTranslate(c *check.C) {
+	p := protein.NewSeq("prot", []alphabet.Letter("MFlW*BZJX-"), alphabet.Protein)
+	d, err := Standard.BackTranslate(p)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "ATGTTYYTNTGGTRRRAYSARHTNNNN---")
+	c.Check(d.ID, check.Equals, "prot")
+
+	vm, err := Tables[2].BackTranslate(protein.NewSeq("", []alphabet.Letter("W*"), alphabet.Protein))
+	c.Assert(err, check.Equals, nil)
+	c.Check(vm.String(), check.Equals, "TGRWRR")
+
+	_, err = Standard.BackTranslate(protein.NewSeq("", []alphabet.Letter("MO"), alphabet.Protein))
+	c.Check(err, check.NotNil)
+
+	// Every codon represented by a back-translation encodes the amino acid.
+	for _, aa := range "ACDEFGHIKMNPQRSTVWY" {
+		d, err := Standard.BackTranslate(protein.NewSeq("", []alphabet.Letter{alphabet.Letter(aa)}, alphabet.Protein))
+		c.Assert(err, check.Equals, nil)
+		got := Standard.TranslateCodon(Codon{d.S[0], d.S[1], d.S[2]})
+		if aa != 'L' && aa != 'R' && aa != 'S' {
+			c.Check(got, check.Equals, alphabet.Letter(aa))
+		}
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package fmindex provides suffix array construction and an FM-index for exact, maximal and
+// inexact matching of patterns against a sequence of alphabet.Letter, as described in:
+//  Opportunistic data structures with applications.
+//   P. Ferragina and G. Manzini. Proc. 41st Symp. Foundations of Computer Science 390-398 (2000).
+package fmindex
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic/packed"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	occInterval = 64 // Interval between occurrence table checkpoints.
+	sentinel    = 0  // Code of the end of text marker.
+)
+
+// DefaultSampleRate is the default suffix array sampling interval.
+var DefaultSampleRate = 32
+
+// An Index is an FM-index over a letter sequence.
+type Index struct {
+	alpha alphabet.Alphabet
+	sigma int // Number of symbol codes including the sentinel.
+	n     int // Length of the text including the sentinel.
+	rate  int
+
+	c      []int32 // c[x] is the number of text symbols less than x.
+	bwt    []byte
+	dollar int     // Position of the sentinel in the BWT.
+	occ    []int32 // Occurrence counts of each code before each checkpoint.
+
+	marks   []uint64 // Bit vector of BWT positions with sampled suffix array values.
+	ranks   []int32  // Cumulative count of marks before each word of marks.
+	samples []int32  // Sampled suffix array values in BWT order.
+}
+
+// Return a new Index of s interpreted with alphabet a, sampling every rate-th text position
+// of the suffix array. An error is returned if s contains letters not valid in a.
+func New(s []alphabet.Letter, a alphabet.Alphabet, rate int) (*Index, error) {
+	if a.Len() > math.MaxUint8 {
+		return nil, bio.NewError("fmindex: alphabet too large", 0, a)
+	}
+	t := make([]int32, len(s)+1)
+	for i, l := range s {
+		c := a.IndexOf(l)
+		if c < 0 {
+			return nil, bio.NewError(fmt.Sprintf("fmindex: invalid letter %q at position %d", l, i), 0, s)
+		}
+		t[i] = int32(c + 1)
+	}
+	return newIndex(t, a, rate)
+}
+
+// Return a new Index of the packed sequence s, sampling every rate-th text position of the
+// suffix array.
+func NewPacked(s *packed.Seq, rate int) (*Index, error) {
+	t := make([]int32, s.Len()+1)
+	for i := range t[:s.Len()] {
+		p := i + int(s.S.LeftPad)
+		t[i] = int32(s.S.Letters[p/4]>>(2*(3-uint(p%4)))&0x3) + 1
+	}
+	return newIndex(t, s.Alphabet(), rate)
+}
+
+func newIndex(t []int32, a alphabet.Alphabet, rate int) (*Index, error) {
+	switch {
+	case rate < 1:
+		return nil, bio.NewError(fmt.Sprintf("fmindex: illegal sample rate: %d", rate), 0, rate)
+	case int64(len(t)) > math.MaxInt32:
+		return nil, bio.NewError("fmindex: sequence too long", 0, len(t))
+	}
+	self := &Index{
+		alpha: a,
+		sigma: a.Len() + 1,
+		n:     len(t),
+		rate:  rate,
+	}
+	sa := SuffixArray(t, self.sigma)
+
+	self.c = make([]int32, self.sigma+1)
+	for _, x := range t {
+		self.c[x+1]++
+	}
+	for i := 1; i < len(self.c); i++ {
+		self.c[i] += self.c[i-1]
+	}
+
+	self.bwt = make([]byte, self.n)
+	self.marks = make([]uint64, (self.n+63)/64)
+	for i, p := range sa {
+		if p == 0 {
+			self.dollar = i
+			self.bwt[i] = sentinel
+		} else {
+			self.bwt[i] = byte(t[p-1])
+		}
+		if int(p)%rate == 0 {
+			self.marks[i/64] |= 1 << uint(i%64)
+			self.samples = append(self.samples, p)
+		}
+	}
+	self.index()
+
+	return self, nil
+}
+
+// index builds the occurrence checkpoints and mark ranks.
+func (self *Index) index() {
+	self.occ = make([]int32, ((self.n+occInterval-1)/occInterval+1)*self.sigma)
+	counts := make([]int32, self.sigma)
+	for i, x := range self.bwt {
+		if i%occInterval == 0 {
+			copy(self.occ[i/occInterval*self.sigma:], counts)
+		}
+		counts[x]++
+	}
+	if self.n%occInterval == 0 {
+		copy(self.occ[self.n/occInterval*self.sigma:], counts)
+	}
+
+	self.ranks = make([]int32, len(self.marks)+1)
+	for i, w := range self.marks {
+		self.ranks[i+1] = self.ranks[i] + int32(popcount(w))
+	}
+}
+
+func popcount(x uint64) int {
+	x -= (x >> 1) & 0x5555555555555555
+	x = (x>>2)&0x3333333333333333 + x&0x3333333333333333
+	x += x >> 4
+	x &= 0x0f0f0f0f0f0f0f0f
+	return int((x * 0x0101010101010101) >> 56)
+}
+
+// Return the length of the indexed sequence.
+func (self *Index) Len() int { return self.n - 1 }
+
+// Return the alphabet of the Index.
+func (self *Index) Alphabet() alphabet.Alphabet { return self.alpha }
+
+// Return the Burrows-Wheeler transform of the indexed sequence. The end of text marker is
+// represented by the alphabet's gap letter.
+func (self *Index) BWT() []alphabet.Letter {
+	b := make([]alphabet.Letter, self.n)
+	for i, x := range self.bwt {
+		if x == sentinel {
+			b[i] = self.alpha.Gap()
+		} else {
+			b[i] = self.alpha.Letter(int(x) - 1)
+		}
+	}
+	return b
+}
+
+// rank returns the number of occurrences of code x in bwt[0:i].
+func (self *Index) rank(x byte, i int) int {
+	cp := i / occInterval
+	r := int(self.occ[cp*self.sigma+int(x)])
+	for _, b := range self.bwt[cp*occInterval : i] {
+		if b == x {
+			r++
+		}
+	}
+	return r
+}
+
+// lf returns the BWT position of the suffix preceding the suffix at BWT position i.
+func (self *Index) lf(i int) int {
+	x := self.bwt[i]
+	return int(self.c[x]) + self.rank(x, i)
+}
+
+// extend returns the suffix array interval of xP given the interval [lo, hi) of P.
+func (self *Index) extend(x byte, lo, hi int) (int, int) {
+	return int(self.c[x]) + self.rank(x, lo), int(self.c[x]) + self.rank(x, hi)
+}
+
+// code returns the symbol code of l or 0 if l is not in the alphabet.
+func (self *Index) code(l alphabet.Letter) byte {
+	c := self.alpha.IndexOf(l)
+	if c < 0 {
+		return sentinel
+	}
+	return byte(c + 1)
+}
+
+// Return the suffix array interval [lo, hi) of suffixes prefixed by p.
+func (self *Index) Range(p []alphabet.Letter) (lo, hi int) {
+	lo, hi = 0, self.n
+	for i := len(p) - 1; i >= 0 && lo < hi; i-- {
+		x := self.code(p[i])
+		if x == sentinel {
+			return 0, 0
+		}
+		lo, hi = self.extend(x, lo, hi)
+	}
+	return
+}
+
+// Return the number of occurrences of p in the indexed sequence.
+func (self *Index) Count(p []alphabet.Letter) int {
+	lo, hi := self.Range(p)
+	return hi - lo
+}
+
+// Return the sequence position of the suffix at suffix array index i.
+func (self *Index) SA(i int) int {
+	var steps int
+	for {
+		if self.marks[i/64]&(1<<uint(i%64)) != 0 {
+			r := int(self.ranks[i/64]) + popcount(self.marks[i/64]&(1<<uint(i%64)-1))
+			return int(self.samples[r]) + steps
+		}
+		if i == self.dollar {
+			return steps
+		}
+		i = self.lf(i)
+		steps++
+	}
+}
+
+// Return the sorted sequence positions of the suffixes in the suffix array interval [lo, hi).
+func (self *Index) Positions(lo, hi int) []int {
+	pos := make([]int, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		pos = append(pos, self.SA(i))
+	}
+	sort.Ints(pos)
+	return pos
+}
+
+// Return the sorted positions of occurrences of p in the indexed sequence.
+func (self *Index) Locate(p []alphabet.Letter) []int {
+	return self.Positions(self.Range(p))
+}
+
+// A MEM is a maximal exact match between a query and the indexed sequence.
+type MEM struct {
+	QStart, QEnd int // Query interval of the match.
+	Lo, Hi       int // Suffix array interval of the match.
+}
+
+// Return the super-maximal exact matches of q of at least minLen letters. A super-maximal exact
+// match is a maximal exact match whose query interval is not contained in that of any other, so
+// every occurrence of each reported match can be extended in neither direction. Matches are
+// returned in order of query position.
+func (self *Index) SMEMs(q []alphabet.Letter, minLen int) (mems []MEM) {
+	next := len(q) + 1 // Query start of the longest match ending one position further right.
+	for end := len(q); end > 0; end-- {
+		lo, hi := 0, self.n
+		start := end
+		for start > 0 {
+			x := self.code(q[start-1])
+			if x == sentinel {
+				break
+			}
+			nlo, nhi := self.extend(x, lo, hi)
+			if nlo >= nhi {
+				break
+			}
+			lo, hi = nlo, nhi
+			start--
+		}
+		if start < next && end > start && end-start >= minLen {
+			mems = append(mems, MEM{QStart: start, QEnd: end, Lo: lo, Hi: hi})
+		}
+		next = start
+	}
+	for i, j := 0, len(mems)-1; i < j; i, j = i+1, j-1 {
+		mems[i], mems[j] = mems[j], mems[i]
+	}
+	return
+}
+
+// A Match is an inexact occurrence of a pattern.
+type Match struct {
+	Pos        int // Position of the occurrence in the indexed sequence.
+	Mismatches int // Number of substitutions.
+}
+
+// Return the occurrences of p with at most k substitutions, found by backtracking backward
+// search. Each position is reported once with its smallest number of mismatches and matches
+// are returned in order of position.
+func (self *Index) Approximate(p []alphabet.Letter, k int) []Match {
+	best := make(map[int]int)
+	var search func(i, lo, hi, mm int)
+	search = func(i, lo, hi, mm int) {
+		if i < 0 {
+			for j := lo; j < hi; j++ {
+				pos := self.SA(j)
+				if m, ok := best[pos]; !ok || mm < m {
+					best[pos] = mm
+				}
+			}
+			return
+		}
+		want := self.code(p[i])
+		for x := byte(1); int(x) < self.sigma; x++ {
+			cost := mm
+			if x != want {
+				cost++
+			}
+			if cost > k {
+				continue
+			}
+			if nlo, nhi := self.extend(x, lo, hi); nlo < nhi {
+				search(i-1, nlo, nhi, cost)
+			}
+		}
+	}
+	if len(p) > 0 {
+		search(len(p)-1, 0, self.n, 0)
+	}
+
+	var m []Match
+	for pos, mm := range best {
+		m = append(m, Match{Pos: pos, Mismatches: mm})
+	}
+	sort.Sort(byPos(m))
+	return m
+}
+
+type byPos []Match
+
+func (self byPos) Len() int           { return len(self) }
+func (self byPos) Less(i, j int) bool { return self[i].Pos < self[j].Pos }
+func (self byPos) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
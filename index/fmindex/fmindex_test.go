@@ -0,0 +1,238 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fmindex
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic/packed"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func random(n int, letters string, rnd *rand.Rand) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rnd.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func lett(s string) []alphabet.Letter { return alphabet.BytesToLetters([]byte(s)) }
+
+func naiveSA(t []int32) []int32 {
+	sa := make([]int32, len(t))
+	for i := range sa {
+		sa[i] = int32(i)
+	}
+	sort.Sort(suffixes{t, sa})
+	return sa
+}
+
+type suffixes struct{ t, sa []int32 }
+
+func (self suffixes) Len() int { return len(self.sa) }
+func (self suffixes) Less(i, j int) bool {
+	a, b := self.t[self.sa[i]:], self.t[self.sa[j]:]
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+func (self suffixes) Swap(i, j int) { self.sa[i], self.sa[j] = self.sa[j], self.sa[i] }
+
+func naiveLocate(s, p string) (pos []int) {
+	for i := 0; i+len(p) <= len(s); i++ {
+		if s[i:i+len(p)] == p {
+			pos = append(pos, i)
+		}
+	}
+	return
+}
+
+func naiveApprox(s, p string, k int) (m []Match) {
+	for i := 0; i+len(p) <= len(s); i++ {
+		d := 0
+		for j := range p {
+			if s[i+j] != p[j] {
+				d++
+			}
+		}
+		if d <= k {
+			m = append(m, Match{Pos: i, Mismatches: d})
+		}
+	}
+	return
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestSuffixArray(c *check.C) {
+	c.Check(SuffixArray(nil, 1), check.DeepEquals, []int32{})
+	c.Check(SuffixArray([]int32{0}, 1), check.DeepEquals, []int32{0})
+	rnd := rand.New(rand.NewSource(1))
+	for _, k := range []int{2, 3, 5, 21} {
+		for _, n := range []int{1, 2, 10, 100, 1000} {
+			t := make([]int32, n+1)
+			for i := range t[:n] {
+				t[i] = int32(rnd.Intn(k-1) + 1)
+			}
+			c.Check(SuffixArray(t, k), check.DeepEquals, naiveSA(t), check.Commentf("k=%d n=%d", k, n))
+		}
+	}
+	// Highly repetitive text exercises deep recursion.
+	t := make([]int32, 1001)
+	for i := range t[:1000] {
+		t[i] = int32(i%3%2 + 1)
+	}
+	c.Check(SuffixArray(t, 3), check.DeepEquals, naiveSA(t))
+}
+
+func (s *S) TestSearch(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(5000, "acgt", rnd)
+	text += text[1000:1200] // Include a repeat.
+	for _, rate := range []int{1, 7, 32} {
+		idx, err := New(lett(text), alphabet.DNA, rate)
+		c.Assert(err, check.Equals, nil)
+		c.Check(idx.Len(), check.Equals, len(text))
+		for i := 0; i < 50; i++ {
+			l := rnd.Intn(12) + 1
+			st := rnd.Intn(len(text) - l)
+			p := text[st : st+l]
+			expect := naiveLocate(text, p)
+			c.Check(idx.Count(lett(p)), check.Equals, len(expect))
+			c.Check(idx.Locate(lett(p)), check.DeepEquals, expect)
+			// Case insensitivity follows the alphabet.
+			c.Check(idx.Count(lett(strings.ToUpper(p))), check.Equals, len(expect))
+		}
+		c.Check(idx.Locate(lett(text[1000:1200])), check.DeepEquals, []int{1000, 5000})
+		c.Check(idx.Count(lett("acgtnacgt")), check.Equals, 0)
+		c.Check(idx.Count(nil), check.Equals, len(text)+1)
+	}
+
+	_, err := New(lett("acgtn"), alphabet.DNA, 4)
+	c.Check(err, check.NotNil)
+	_, err = New(lett("acgt"), alphabet.DNA, 0)
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestBWT(c *check.C) {
+	idx, err := New(lett("acaacg"), alphabet.DNA, 2)
+	c.Assert(err, check.Equals, nil)
+	// Suffixes: $, aacg$, acaacg$, acg$, caacg$, cg$, g$
+	c.Check(alphabet.LettersToBytes(idx.BWT()), check.DeepEquals, []byte("gc-aaac"))
+	for i, p := range []int{6, 2, 0, 3, 1, 4, 5} {
+		c.Check(idx.SA(i), check.Equals, p)
+	}
+}
+
+func (s *S) TestPacked(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(1001, "acgt", rnd)
+	p, err := packed.NewSeq("", lett(text), alphabet.DNA)
+	c.Assert(err, check.Equals, nil)
+	c.Assert(p.Truncate(3, 1001), check.Equals, nil)
+	pi, err := NewPacked(p, 16)
+	c.Assert(err, check.Equals, nil)
+	li, err := New(lett(text[3:]), alphabet.DNA, 16)
+	c.Assert(err, check.Equals, nil)
+	c.Check(pi.BWT(), check.DeepEquals, li.BWT())
+	c.Check(pi.Locate(lett(text[500:510])), check.DeepEquals, li.Locate(lett(text[500:510])))
+}
+
+func (s *S) TestSMEMs(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(3000, "acgt", rnd)
+	q := text[100:300] + "tttttttttt" + text[2000:2150] + random(100, "acgt", rnd)
+	idx, err := New(lett(text), alphabet.DNA, 8)
+	c.Assert(err, check.Equals, nil)
+	mems := idx.SMEMs(lett(q), 20)
+	c.Assert(len(mems) >= 2, check.Equals, true)
+	c.Check(mems[0].QStart, check.Equals, 0)
+	c.Check(mems[0].QEnd >= 200, check.Equals, true)
+	found := false
+	for i, m := range mems {
+		c.Check(m.QEnd-m.QStart >= 20, check.Equals, true)
+		sub := q[m.QStart:m.QEnd]
+		c.Check(idx.Positions(m.Lo, m.Hi), check.DeepEquals, naiveLocate(text, sub))
+		if m.QStart > 0 {
+			c.Check(idx.Count(lett(q[m.QStart-1:m.QEnd])), check.Equals, 0)
+		}
+		if m.QEnd < len(q) {
+			c.Check(idx.Count(lett(q[m.QStart:m.QEnd+1])), check.Equals, 0)
+		}
+		if i > 0 {
+			c.Check(m.QStart > mems[i-1].QStart && m.QEnd > mems[i-1].QEnd, check.Equals, true)
+		}
+		found = found || (idx.Positions(m.Lo, m.Hi)[0] == 2000 && m.QEnd-m.QStart >= 150)
+	}
+	c.Check(found, check.Equals, true)
+}
+
+func (s *S) TestApproximate(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(2000, "acgt", rnd)
+	idx, err := New(lett(text), alphabet.DNA, 16)
+	c.Assert(err, check.Equals, nil)
+	for i := 0; i < 20; i++ {
+		st := rnd.Intn(len(text) - 12)
+		p := []byte(text[st : st+12])
+		p[rnd.Intn(12)] = "acgt"[rnd.Intn(4)]
+		for k := 0; k <= 2; k++ {
+			c.Check(idx.Approximate(lett(string(p)), k), check.DeepEquals, naiveApprox(text, string(p), k))
+		}
+	}
+
+	prot := "mkvlaagivgllpsrhtglaqevcaa"
+	pi, err := New(lett(prot), alphabet.Protein, 4)
+	c.Assert(err, check.Equals, nil)
+	c.Check(pi.Approximate(lett("glaqxv"), 1), check.DeepEquals, []Match{{Pos: 17, Mismatches: 1}})
+}
+
+func (s *S) TestFormat(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(3000, "acgt", rnd)
+	idx, err := New(lett(text), alphabet.DNA, 10)
+	c.Assert(err, check.Equals, nil)
+	var b bytes.Buffer
+	n, err := idx.WriteTo(&b)
+	c.Assert(err, check.Equals, nil)
+	c.Check(n, check.Equals, int64(b.Len()))
+
+	r, err := ReadIndex(bytes.NewReader(b.Bytes()), alphabet.DNA)
+	c.Assert(err, check.Equals, nil)
+	c.Check(r, check.DeepEquals, idx)
+	c.Check(r.Locate(lett(text[10:30])), check.DeepEquals, []int{10})
+
+	_, err = ReadIndex(bytes.NewReader(b.Bytes()), alphabet.Protein)
+	c.Check(err, check.NotNil)
+	_, err = ReadIndex(bytes.NewReader(b.Bytes()[:b.Len()-5]), alphabet.DNA)
+	c.Check(err, check.NotNil)
+	_, err = ReadIndex(strings.NewReader("not an index at all"), alphabet.DNA)
+	c.Check(err, check.NotNil)
+}
@@ -0,0 +1,155 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fmindex
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/alphabet"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Serialised indexes begin with the magic bytes "bgfmidx", a version byte and a header of
+// little-endian int32 values: alphabet length, text length, sample rate and sentinel BWT
+// position, followed by the alphabet letters. The BWT, the marked positions and the
+// suffix array samples follow. Occurrence tables are rebuilt on reading.
+var magic = [7]byte{'b', 'g', 'f', 'm', 'i', 'd', 'x'}
+
+const formatVersion = 1
+
+type counter struct {
+	w io.Writer
+	n int64
+}
+
+func (self *counter) Write(b []byte) (int, error) {
+	n, err := self.w.Write(b)
+	self.n += int64(n)
+	return n, err
+}
+
+// Write the Index to w.
+func (self *Index) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	cw := &counter{w: bw}
+	for _, v := range []interface{}{
+		magic,
+		byte(formatVersion),
+		[]int32{int32(self.alpha.Len()), int32(self.n), int32(self.rate), int32(self.dollar)},
+		letters(self.alpha),
+		self.bwt,
+		self.marks,
+		int32(len(self.samples)),
+		self.samples,
+	} {
+		if err = binary.Write(cw, binary.LittleEndian, v); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, bw.Flush()
+}
+
+// Read an Index written by WriteTo from r. The alphabet a must match the alphabet used to
+// construct the Index.
+func ReadIndex(r io.Reader, a alphabet.Alphabet) (*Index, error) {
+	br := bufio.NewReader(r)
+	var (
+		m   [7]byte
+		ver byte
+		hdr [4]int32
+	)
+	for _, v := range []interface{}{&m, &ver, &hdr} {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return nil, readError(err)
+		}
+	}
+	switch {
+	case m != magic:
+		return nil, bio.NewError("fmindex: not an index", 0, m)
+	case ver != formatVersion:
+		return nil, bio.NewError(fmt.Sprintf("fmindex: unknown index version: %d", ver), 0, ver)
+	case int(hdr[0]) != a.Len():
+		return nil, bio.NewError("fmindex: alphabet mismatch", 0, a)
+	case hdr[1] < 1 || hdr[2] < 1 || hdr[3] < 0 || hdr[3] >= hdr[1]:
+		return nil, bio.NewError("fmindex: corrupt index header", 0, hdr)
+	}
+	l := make([]byte, hdr[0])
+	if _, err := io.ReadFull(br, l); err != nil {
+		return nil, readError(err)
+	}
+	if !bytes.Equal(l, letters(a)) {
+		return nil, bio.NewError("fmindex: alphabet mismatch", 0, a)
+	}
+
+	self := &Index{
+		alpha:  a,
+		sigma:  a.Len() + 1,
+		n:      int(hdr[1]),
+		rate:   int(hdr[2]),
+		dollar: int(hdr[3]),
+		bwt:    make([]byte, hdr[1]),
+		marks:  make([]uint64, (hdr[1]+63)/64),
+	}
+	var ns int32
+	for _, v := range []interface{}{self.bwt, self.marks, &ns} {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return nil, readError(err)
+		}
+	}
+	if ns < 0 || ns > hdr[1] {
+		return nil, bio.NewError("fmindex: corrupt index", 0, ns)
+	}
+	self.samples = make([]int32, ns)
+	if err := binary.Read(br, binary.LittleEndian, self.samples); err != nil {
+		return nil, readError(err)
+	}
+
+	self.c = make([]int32, self.sigma+1)
+	for _, x := range self.bwt {
+		if int(x) >= self.sigma {
+			return nil, bio.NewError("fmindex: corrupt index", 0, x)
+		}
+		self.c[x+1]++
+	}
+	for i := 1; i < len(self.c); i++ {
+		self.c[i] += self.c[i-1]
+	}
+	self.index()
+	if int(self.ranks[len(self.ranks)-1]) != len(self.samples) {
+		return nil, bio.NewError("fmindex: corrupt index", 0, ns)
+	}
+
+	return self, nil
+}
+
+// letters returns the letters of a in index order.
+func letters(a alphabet.Alphabet) []byte {
+	l := make([]byte, a.Len())
+	for i := range l {
+		l[i] = byte(a.Letter(i))
+	}
+	return l
+}
+
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return bio.NewError("fmindex: truncated index", 0)
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fmindex
+
+// Return the suffix array of t, which must end with a unique sentinel 0 and otherwise hold
+// symbols in the range [1, k). The suffix array is constructed by induced sorting as described in:
+//  Two efficient algorithms for linear time suffix array construction.
+//   G. Nong, S. Zhang and W. H. Chan. IEEE Trans. Computers 60:1471-1484 (2011).
+func SuffixArray(t []int32, k int) []int32 {
+	sa := make([]int32, len(t))
+	if len(t) > 0 {
+		sais(t, sa, k)
+	}
+	return sa
+}
+
+func sais(t, sa []int32, k int) {
+	n := len(t)
+	if n == 1 {
+		sa[0] = 0
+		return
+	}
+
+	// Classify suffixes as S-type (true) or L-type.
+	stype := make([]bool, n)
+	stype[n-1] = true
+	for i := n - 2; i >= 0; i-- {
+		stype[i] = t[i] < t[i+1] || (t[i] == t[i+1] && stype[i+1])
+	}
+	isLMS := func(i int) bool { return i > 0 && stype[i] && !stype[i-1] }
+
+	bkt := make([]int32, k)
+	buckets := func(end bool) {
+		for i := range bkt {
+			bkt[i] = 0
+		}
+		for _, c := range t {
+			bkt[c]++
+		}
+		var sum int32
+		for i, c := range bkt {
+			sum += c
+			if end {
+				bkt[i] = sum
+			} else {
+				bkt[i] = sum - c
+			}
+		}
+	}
+	induce := func() {
+		buckets(false)
+		for i := 0; i < n; i++ {
+			if j := sa[i] - 1; sa[i] > 0 && !stype[j] {
+				sa[bkt[t[j]]] = j
+				bkt[t[j]]++
+			}
+		}
+		buckets(true)
+		for i := n - 1; i >= 0; i-- {
+			if j := sa[i] - 1; sa[i] > 0 && stype[j] {
+				bkt[t[j]]--
+				sa[bkt[t[j]]] = j
+			}
+		}
+	}
+
+	// Sort LMS substrings.
+	buckets(true)
+	for i := range sa {
+		sa[i] = -1
+	}
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			bkt[t[i]]--
+			sa[bkt[t[i]]] = int32(i)
+		}
+	}
+	induce()
+
+	// Name LMS substrings.
+	n1 := 0
+	for i := 0; i < n; i++ {
+		if isLMS(int(sa[i])) {
+			sa[n1] = sa[i]
+			n1++
+		}
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+	name, prev := 0, -1
+	for i := 0; i < n1; i++ {
+		pos, diff := int(sa[i]), false
+		for d := 0; d < n; d++ {
+			if prev < 0 || t[pos+d] != t[prev+d] || stype[pos+d] != stype[prev+d] {
+				diff = true
+				break
+			} else if d > 0 && (isLMS(pos+d) || isLMS(prev+d)) {
+				break
+			}
+		}
+		if diff {
+			name++
+			prev = pos
+		}
+		sa[n1+pos/2] = int32(name - 1)
+	}
+	for i, j := n-1, n-1; i >= n1; i-- {
+		if sa[i] >= 0 {
+			sa[j] = sa[i]
+			j--
+		}
+	}
+
+	// Sort the reduced problem, recursively if names are not unique.
+	s1, sa1 := sa[n-n1:], sa[:n1]
+	if name < n1 {
+		sais(s1, sa1, name)
+	} else {
+		for i, c := range s1 {
+			sa1[c] = int32(i)
+		}
+	}
+
+	// Induce the suffix array from the sorted LMS suffixes.
+	buckets(true)
+	for i, j := 1, 0; i < n; i++ {
+		if isLMS(i) {
+			s1[j] = int32(i)
+			j++
+		}
+	}
+	for i := range sa1 {
+		sa1[i] = s1[sa1[i]]
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+	for i := n1 - 1; i >= 0; i-- {
+		j := sa[i]
+		sa[i] = -1
+		bkt[t[j]]--
+		sa[bkt[t[j]]] = j
+	}
+	induce()
+}
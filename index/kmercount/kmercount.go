@@ -0,0 +1,482 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package kmercount provides a concurrent streaming k-mer counter for large read sets.
+//
+// Counts are held in sharded hash tables. When the number of distinct k-mers held in memory
+// exceeds a limit, the tables are spilled to disk through a morass and merged when counts are
+// read back.
+package kmercount
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/index/kmerindex"
+	"code.google.com/p/biogo/io/seqio"
+	"code.google.com/p/biogo/morass"
+	"code.google.com/p/biogo/seq"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Default parameters for a Counter.
+var (
+	DefaultShards   = 64
+	DefaultMaxKmers = 1 << 26 // Distinct k-mers held in memory before spilling.
+)
+
+const maxChunk = 1 << 20 // Maximum number of spilled k-mers sorted in memory by the morass.
+
+// A KmerCount is a k-mer and the number of times it was seen.
+type KmerCount struct {
+	Kmer  kmerindex.Kmer64
+	Count int
+}
+
+// Less is used to sort spilled KmerCounts.
+func (self KmerCount) Less(i interface{}) bool { return self.Kmer < i.(KmerCount).Kmer }
+
+type shard struct {
+	sync.Mutex
+	counts map[kmerindex.Kmer64]uint32
+}
+
+// A Counter counts k-mers of up to 32 bases. Only k-mers containing exclusively A, C, G and T
+// are counted. A Counter is safe for concurrent use by multiple goroutines.
+type Counter struct {
+	k         int
+	canonical bool
+	maxKmers  int64
+
+	lock     sync.RWMutex // Held for writing during spill.
+	shards   []shard
+	distinct int64
+	total    int64
+
+	// TempDir and TempPrefix specify the location of spill files.
+	TempDir, TempPrefix string
+	spill               *morass.Morass
+	merged              *os.File
+}
+
+// Return a new Counter for k-mers of length k. If canonical is true, each k-mer is counted as the
+// lesser of itself and its reverse complement. shards specifies the number of hash tables used
+// and maxKmers the number of distinct k-mers held in memory before spilling to disk. Values
+// less than 1 select the package defaults.
+func New(k int, canonical bool, shards, maxKmers int) (*Counter, error) {
+	if k < 1 || k > kmerindex.MaxKmerLen64 {
+		return nil, bio.NewError(fmt.Sprintf("kmercount: illegal k: %d", k), 0, k)
+	}
+	if shards < 1 {
+		shards = DefaultShards
+	}
+	if maxKmers < 1 {
+		maxKmers = DefaultMaxKmers
+	}
+	c := &Counter{
+		k:         k,
+		canonical: canonical,
+		maxKmers:  int64(maxKmers),
+		shards:    make([]shard, shards),
+	}
+	for i := range c.shards {
+		c.shards[i].counts = make(map[kmerindex.Kmer64]uint32)
+	}
+
+	return c, nil
+}
+
+// Return the k-mer length of the Counter.
+func (self *Counter) K() int { return self.k }
+
+// Return the total number of k-mers counted.
+func (self *Counter) Total() int64 { return atomic.LoadInt64(&self.total) }
+
+// Return whether the Counter has spilled counts to disk.
+func (self *Counter) Spilled() bool { return self.spill != nil || self.merged != nil }
+
+func (self *Counter) shardOf(kmer kmerindex.Kmer64) int {
+	return int((uint64(kmer) * 0x9e3779b97f4a7c15 >> 32) % uint64(len(self.shards)))
+}
+
+// Add the k-mers of s to the Counter.
+func (self *Counter) Add(s *seq.Seq) error {
+	batches := make([][]kmerindex.Kmer64, len(self.shards))
+	kmerindex.ForEachKmer64(self.k, s.Seq, func(_ int, kmer, rc kmerindex.Kmer64) {
+		if self.canonical {
+			kmer, _ = kmerindex.CanonicalOf64(kmer, rc)
+		}
+		i := self.shardOf(kmer)
+		batches[i] = append(batches[i], kmer)
+	})
+
+	self.lock.RLock()
+	var n int64
+	for i, b := range batches {
+		if len(b) == 0 {
+			continue
+		}
+		sh := &self.shards[i]
+		sh.Lock()
+		for _, kmer := range b {
+			c, ok := sh.counts[kmer]
+			if !ok {
+				atomic.AddInt64(&self.distinct, 1)
+			}
+			if c < math.MaxUint32 {
+				sh.counts[kmer] = c + 1
+			}
+		}
+		sh.Unlock()
+		n += int64(len(b))
+	}
+	atomic.AddInt64(&self.total, n)
+	full := atomic.LoadInt64(&self.distinct) > self.maxKmers
+	self.lock.RUnlock()
+
+	if full {
+		return self.spillShards(false)
+	}
+	return nil
+}
+
+// spillShards writes the in-memory counts to the spill morass. If force is false, counts are only
+// spilled if the in-memory limit is still exceeded.
+func (self *Counter) spillShards(force bool) (err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if !force && self.distinct <= self.maxKmers {
+		return nil
+	}
+	if self.spill == nil {
+		chunk := self.maxKmers
+		if chunk > maxChunk {
+			chunk = maxChunk
+		}
+		if self.spill, err = morass.New(KmerCount{}, self.TempPrefix, self.TempDir, int(chunk), false); err != nil {
+			return
+		}
+		self.spill.AutoClear = true
+		self.spill.AutoClean = true
+	}
+	for i := range self.shards {
+		for kmer, c := range self.shards[i].counts {
+			if err = self.spill.Push(KmerCount{Kmer: kmer, Count: int(c)}); err != nil {
+				return
+			}
+		}
+		self.shards[i].counts = make(map[kmerindex.Kmer64]uint32)
+	}
+	self.distinct = 0
+
+	return
+}
+
+// Count the k-mers of all sequences read from r using the given number of concurrent workers.
+// If threads is less than 1, runtime.GOMAXPROCS(0) workers are used. Count returns the number of
+// sequences read and any error other than io.EOF.
+func (self *Counter) Count(r seqio.Reader, threads int) (n int, err error) {
+	if threads < 1 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		seqs = make(chan *seq.Seq, threads*4)
+		errs = make(chan error, threads)
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var failed bool
+			for s := range seqs {
+				if failed {
+					continue
+				}
+				if e := self.Add(s); e != nil {
+					errs <- e
+					failed = true
+				}
+			}
+		}()
+	}
+
+	for {
+		var s *seq.Seq
+		if s, err = r.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		seqs <- s
+		n++
+	}
+	close(seqs)
+	wg.Wait()
+	close(errs)
+	if err == nil {
+		err = <-errs
+	}
+
+	return
+}
+
+// Call fn for each distinct k-mer and its count in order of increasing k-mer value. If fn
+// returns an error, iteration stops and the error is returned. Do must not be called
+// concurrently with Add or Count.
+func (self *Counter) Do(fn func(KmerCount) error) (err error) {
+	if self.spill == nil && self.merged == nil {
+		var kc []KmerCount
+		for i := range self.shards {
+			for kmer, c := range self.shards[i].counts {
+				kc = append(kc, KmerCount{Kmer: kmer, Count: int(c)})
+			}
+		}
+		sort.Sort(kmerCounts(kc))
+		for _, c := range kc {
+			if err = fn(c); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	if err = self.merge(); err != nil {
+		return
+	}
+	if _, err = self.merged.Seek(0, 0); err != nil {
+		return
+	}
+	r := bufio.NewReader(self.merged)
+	var rec [12]byte
+	for {
+		if _, err = io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		kc := KmerCount{
+			Kmer:  kmerindex.Kmer64(binary.LittleEndian.Uint64(rec[:8])),
+			Count: int(binary.LittleEndian.Uint32(rec[8:])),
+		}
+		if err = fn(kc); err != nil {
+			return
+		}
+	}
+}
+
+// merge combines spilled and in-memory counts into a single sorted merge file.
+func (self *Counter) merge() (err error) {
+	if self.spill == nil && self.distinct == 0 {
+		return
+	}
+	if err = self.spillShards(true); err != nil {
+		return
+	}
+	if self.merged != nil {
+		// Fold the previous merge back into the spill so that counts added since are included.
+		if _, err = self.merged.Seek(0, 0); err != nil {
+			return
+		}
+		r := bufio.NewReader(self.merged)
+		var rec [12]byte
+		for {
+			if _, err = io.ReadFull(r, rec[:]); err != nil {
+				break
+			}
+			if err = self.spill.Push(KmerCount{
+				Kmer:  kmerindex.Kmer64(binary.LittleEndian.Uint64(rec[:8])),
+				Count: int(binary.LittleEndian.Uint32(rec[8:])),
+			}); err != nil {
+				return
+			}
+		}
+		if err != io.EOF {
+			return
+		}
+		self.closeMerged()
+	}
+	if err = self.spill.Finalise(); err != nil {
+		return
+	}
+
+	if self.merged, err = ioutil.TempFile(self.TempDir, self.TempPrefix); err != nil {
+		return
+	}
+	w := bufio.NewWriter(self.merged)
+	var (
+		rec  [12]byte
+		curr KmerCount
+		kc   KmerCount
+		have bool
+	)
+	flush := func() error {
+		c := curr.Count
+		if c > math.MaxUint32 {
+			c = math.MaxUint32
+		}
+		binary.LittleEndian.PutUint64(rec[:8], uint64(curr.Kmer))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(c))
+		_, err := w.Write(rec[:])
+		return err
+	}
+	for {
+		if err = self.spill.Pull(&kc); err != nil {
+			break
+		}
+		switch {
+		case !have:
+			curr, have = kc, true
+		case kc.Kmer == curr.Kmer:
+			curr.Count += kc.Count
+		default:
+			if err = flush(); err != nil {
+				return
+			}
+			curr = kc
+		}
+	}
+	if err != io.EOF {
+		return
+	}
+	if have {
+		if err = flush(); err != nil {
+			return
+		}
+	}
+	self.spill.CleanUp()
+	self.spill = nil
+
+	return w.Flush()
+}
+
+func (self *Counter) closeMerged() {
+	self.merged.Close()
+	os.Remove(self.merged.Name())
+	self.merged = nil
+}
+
+// Release any disk resources held by the Counter. The Counter's counts are lost.
+func (self *Counter) Close() (err error) {
+	if self.spill != nil {
+		err = self.spill.CleanUp()
+		self.spill = nil
+	}
+	if self.merged != nil {
+		self.closeMerged()
+	}
+	for i := range self.shards {
+		self.shards[i].counts = make(map[kmerindex.Kmer64]uint32)
+	}
+	self.distinct, self.total = 0, 0
+
+	return
+}
+
+// Write a dump of k-mers and counts to w, one "kmer count" pair per line in order of increasing
+// k-mer value. Only k-mers seen at least min times are written.
+func (self *Counter) WriteDump(w io.Writer, min int) error {
+	bw := bufio.NewWriter(w)
+	err := self.Do(func(kc KmerCount) error {
+		if kc.Count < min {
+			return nil
+		}
+		_, err := fmt.Fprintf(bw, "%s %d\n", kmerindex.Stringify64(self.k, kc.Kmer), kc.Count)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// A Histogram is a k-mer spectrum. Element i holds the number of distinct k-mers seen i times.
+// The final element also includes all k-mers seen more often.
+type Histogram []int64
+
+// Return the k-mer spectrum of the counted k-mers with counts up to max.
+func (self *Counter) Histogram(max int) (h Histogram, err error) {
+	if max < 1 {
+		return nil, bio.NewError("kmercount: histogram maximum must be positive", 0, max)
+	}
+	h = make(Histogram, max+1)
+	err = self.Do(func(kc KmerCount) error {
+		if kc.Count > max {
+			h[max]++
+		} else {
+			h[kc.Count]++
+		}
+		return nil
+	})
+
+	return
+}
+
+// Write the non-zero elements of the Histogram to w as "count frequency" lines.
+func (self Histogram) WriteTo(w io.Writer) (n int64, err error) {
+	bw := bufio.NewWriter(w)
+	for i, f := range self {
+		if f == 0 {
+			continue
+		}
+		var c int
+		if c, err = fmt.Fprintf(bw, "%d %d\n", i, f); err != nil {
+			return
+		}
+		n += int64(c)
+	}
+	err = bw.Flush()
+
+	return
+}
+
+// Read a Histogram in the format written by WriteTo.
+func ReadHistogram(r io.Reader) (h Histogram, err error) {
+	br := bufio.NewReader(r)
+	for {
+		var c, f int64
+		if _, err = fmt.Fscan(br, &c, &f); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if c < 0 {
+			return nil, bio.NewError(fmt.Sprintf("kmercount: negative count in histogram: %d", c), 0, c)
+		}
+		for int64(len(h)) <= c {
+			h = append(h, 0)
+		}
+		h[c] += f
+	}
+}
+
+type kmerCounts []KmerCount
+
+func (self kmerCounts) Len() int           { return len(self) }
+func (self kmerCounts) Less(i, j int) bool { return self[i].Kmer < self[j].Kmer }
+func (self kmerCounts) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
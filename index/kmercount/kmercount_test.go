@@ -0,0 +1,156 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kmercount
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/index/kmerindex"
+	"code.google.com/p/biogo/io/seqio/fastq"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func reads(n, l int, rnd *rand.Rand) string {
+	genome := make([]byte, 500)
+	for i := range genome {
+		genome[i] = "ACGT"[rnd.Intn(4)]
+	}
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		s := rnd.Intn(len(genome) - l)
+		r := append([]byte(nil), genome[s:s+l]...)
+		if i%10 == 0 {
+			r[rnd.Intn(l)] = 'N'
+		}
+		b.WriteString("@r\n")
+		b.Write(r)
+		b.WriteString("\n+\n")
+		b.WriteString(strings.Repeat("I", l))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func naive(data string, k int, canonical bool) map[string]int {
+	m := make(map[string]int)
+	lines := strings.Split(data, "\n")
+	for i := 1; i < len(lines); i += 4 {
+		s := lines[i]
+		for j := 0; j+k <= len(s); j++ {
+			w := s[j : j+k]
+			if strings.Contains(w, "N") {
+				continue
+			}
+			if canonical {
+				km, _ := kmerindex.KmerOf64(k, w)
+				if rc := kmerindex.Stringify64(k, kmerindex.ComplementOf64(k, km)); rc < w {
+					w = rc
+				}
+			}
+			m[w]++
+		}
+	}
+	return m
+}
+
+func obtain(c *check.C, kc *Counter) map[string]int {
+	m := make(map[string]int)
+	last := kmerindex.Kmer64(0)
+	first := true
+	err := kc.Do(func(k KmerCount) error {
+		c.Check(first || k.Kmer > last, check.Equals, true)
+		first, last = false, k.Kmer
+		m[kmerindex.Stringify64(kc.K(), k.Kmer)] = k.Count
+		return nil
+	})
+	c.Check(err, check.Equals, nil)
+	return m
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestCount(c *check.C) {
+	data := reads(200, 50, rand.New(rand.NewSource(1)))
+	for _, t := range []struct {
+		k         int
+		canonical bool
+		maxKmers  int
+		spill     bool
+	}{
+		{5, false, 0, false},
+		{11, true, 0, false},
+		{11, false, 100, true},
+		{21, true, 50, true},
+	} {
+		kc, err := New(t.k, t.canonical, 4, t.maxKmers)
+		c.Assert(err, check.Equals, nil)
+		n, err := kc.Count(fastq.NewReader(ioutil.NopCloser(strings.NewReader(data))), 3)
+		c.Check(err, check.Equals, nil)
+		c.Check(n, check.Equals, 200)
+		c.Check(kc.Spilled(), check.Equals, t.spill)
+		expect := naive(data, t.k, t.canonical)
+		var total int64
+		for _, v := range expect {
+			total += int64(v)
+		}
+		c.Check(kc.Total(), check.Equals, total)
+		c.Check(obtain(c, kc), check.DeepEquals, expect)
+		// Counting is resumable after reading counts.
+		_, err = kc.Count(fastq.NewReader(ioutil.NopCloser(strings.NewReader(data))), 2)
+		c.Check(err, check.Equals, nil)
+		for k := range expect {
+			expect[k] *= 2
+		}
+		c.Check(obtain(c, kc), check.DeepEquals, expect)
+		c.Check(kc.Close(), check.Equals, nil)
+	}
+}
+
+func (s *S) TestOutput(c *check.C) {
+	data := "@a\nACGTACGTA\n+\nIIIIIIIII\n@b\nACGTN\n+\nIIIII\n"
+	kc, err := New(4, false, 2, 2)
+	c.Assert(err, check.Equals, nil)
+	_, err = kc.Count(fastq.NewReader(ioutil.NopCloser(strings.NewReader(data))), 1)
+	c.Assert(err, check.Equals, nil)
+
+	var b bytes.Buffer
+	c.Check(kc.WriteDump(&b, 1), check.Equals, nil)
+	c.Check(b.String(), check.Equals, "ACGT 3\nCGTA 2\nGTAC 1\nTACG 1\n")
+	b.Reset()
+	c.Check(kc.WriteDump(&b, 2), check.Equals, nil)
+	c.Check(b.String(), check.Equals, "ACGT 3\nCGTA 2\n")
+
+	h, err := kc.Histogram(2)
+	c.Check(err, check.Equals, nil)
+	c.Check(h, check.DeepEquals, Histogram{0, 2, 2})
+	b.Reset()
+	_, err = h.WriteTo(&b)
+	c.Check(err, check.Equals, nil)
+	c.Check(b.String(), check.Equals, "1 2\n2 2\n")
+	rh, err := ReadHistogram(&b)
+	c.Check(err, check.Equals, nil)
+	c.Check(rh, check.DeepEquals, h)
+	c.Check(kc.Close(), check.Equals, nil)
+}
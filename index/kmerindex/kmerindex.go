@@ -15,7 +15,9 @@
 
 // Kmer indexing package based on Bob Edgar and Gene Meyers' approach used in PALS.
 //
-// Currently limited to Kmers of 15 nucleotides due to int constraints in Go.
+// Index is limited to Kmers of 15 nucleotides due to int constraints in Go. Longer Kmers are
+// handled by the sparse Index64 and Index128 types, which allow words of up to 32 and 64
+// nucleotides respectively.
 package kmerindex
 
 import (
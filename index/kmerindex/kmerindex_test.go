@@ -23,6 +23,15 @@ import (
 	"testing"
 )
 
+// Helpers
+func revComp(s string) string {
+	b := make([]byte, len(s))
+	for i := range s {
+		b[len(s)-1-i] = map[byte]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A'}[s[i]]
+	}
+	return string(b)
+}
+
 // Tests
 func Test(t *testing.T) { check.TestingT(t) }
 
@@ -158,3 +167,130 @@ func (s *S) TestKmerKmerUtilities(c *check.C) {
 		}
 	}
 }
+
+func (s *S) TestLongKmerPositions(c *check.C) {
+	for _, k := range []int{MinKmerLen, 15, 21, 31, 32} {
+		i, err := New64(k, s.Seq)
+		c.Assert(err, check.Equals, nil)
+		hashPos := make(map[string][]int)
+		for p := 0; p+k <= s.Seq.Len(); p++ {
+			hashPos[string(s.Seq.Seq[p:p+k])] = append(hashPos[string(s.Seq.Seq[p:p+k])], p)
+		}
+		freqs, ok := i.KmerFrequencies()
+		c.Check(ok, check.Equals, true)
+		c.Check(len(freqs), check.Equals, len(hashPos))
+		i.Build()
+		for key, p := range hashPos {
+			kmer, err := i.KmerOf(key)
+			c.Check(err, check.Equals, nil)
+			c.Check(freqs[kmer], check.Equals, len(p))
+			pos, err := i.GetPositionsString(key)
+			c.Check(err, check.Equals, nil)
+			c.Check(pos, check.DeepEquals, p)
+		}
+		pos, ok := i.KmerIndex()
+		c.Check(ok, check.Equals, true)
+		c.Check(len(pos), check.Equals, len(hashPos))
+	}
+	for _, k := range []int{MinKmerLen, 31, 33, 50, 64} {
+		i, err := New128(k, s.Seq)
+		c.Assert(err, check.Equals, nil)
+		i.Build()
+		hashPos := make(map[string][]int)
+		for p := 0; p+k <= s.Seq.Len(); p++ {
+			hashPos[string(s.Seq.Seq[p:p+k])] = append(hashPos[string(s.Seq.Seq[p:p+k])], p)
+		}
+		freqs, _ := i.KmerFrequencies()
+		c.Check(len(freqs), check.Equals, len(hashPos))
+		for key, p := range hashPos {
+			pos, err := i.GetPositionsString(key)
+			c.Check(err, check.Equals, nil)
+			c.Check(pos, check.DeepEquals, p)
+		}
+	}
+	_, err := New64(33, s.Seq)
+	c.Check(err, check.Not(check.Equals), nil)
+}
+
+func (s *S) TestLongKmerUtilities(c *check.C) {
+	for _, k := range []int{4, 17, 32} {
+		for n := 0; n < 100; n++ {
+			b := make([]byte, k)
+			for j := range b {
+				b[j] = "ACGT"[rand.Intn(4)]
+			}
+			kmer, err := KmerOf64(k, string(b))
+			c.Assert(err, check.Equals, nil)
+			c.Check(Stringify64(k, kmer), check.Equals, string(b))
+			rc := Stringify64(k, ComplementOf64(k, kmer))
+			c.Check(rc, check.Equals, revComp(string(b)))
+			if k <= 8 {
+				c.Check(uint64(ComplementOf64(k, kmer)), check.Equals, uint64(ComplementOf(k, Kmer(kmer))))
+			}
+		}
+	}
+	for _, k := range []int{4, 32, 33, 47, 64} {
+		for n := 0; n < 100; n++ {
+			b := make([]byte, k)
+			for j := range b {
+				b[j] = "ACGT"[rand.Intn(4)]
+			}
+			kmer, err := KmerOf128(k, string(b))
+			c.Assert(err, check.Equals, nil)
+			c.Check(Stringify128(k, kmer), check.Equals, string(b))
+			c.Check(Stringify128(k, ComplementOf128(k, kmer)), check.Equals, revComp(string(b)))
+			gc := 0
+			for _, v := range b {
+				if v == 'G' || v == 'C' {
+					gc++
+				}
+			}
+			c.Check(GCof128(k, kmer), check.Equals, float64(gc)/float64(k))
+		}
+	}
+}
+
+func (s *S) TestMultiIndex(c *check.C) {
+	a := &seq.Seq{ID: "a", Seq: []byte("ACGTTGCANNACGTTG")}
+	b := &seq.Seq{ID: "b", Seq: []byte("ccaacgttgg")}
+
+	m, err := NewMulti(4, false, a, b)
+	c.Assert(err, check.Equals, nil)
+	m.Build()
+	hits, err := m.GetHitsString("ACGT")
+	c.Check(err, check.Equals, nil)
+	c.Check(hits, check.DeepEquals, []Hit{
+		{ID: "a", Index: 0, Pos: 0, Strand: 1},
+		{ID: "a", Index: 0, Pos: 10, Strand: 1},
+		{ID: "b", Index: 1, Pos: 3, Strand: 1},
+	})
+	hits, err = m.GetHitsString("CAAC")
+	c.Check(err, check.Equals, nil)
+	c.Check(hits, check.DeepEquals, []Hit{{ID: "b", Index: 1, Pos: 1, Strand: 1}})
+	freqs, _ := m.KmerFrequencies()
+	n := 0
+	for _, f := range freqs {
+		n += f
+	}
+	c.Check(n, check.Equals, 5+3+7) // No k-mers overlapping the Ns.
+
+	m, err = NewMulti(4, true, a, b)
+	c.Assert(err, check.Equals, nil)
+	m.Build()
+	hits, err = m.GetHitsString("GTTG")
+	c.Check(err, check.Equals, nil)
+	c.Check(hits, check.DeepEquals, []Hit{
+		{ID: "a", Index: 0, Pos: 2, Strand: 1},
+		{ID: "a", Index: 0, Pos: 12, Strand: 1},
+		{ID: "b", Index: 1, Pos: 1, Strand: -1},
+		{ID: "b", Index: 1, Pos: 5, Strand: 1},
+	})
+	hits, err = m.GetHitsString("CAAC")
+	c.Check(err, check.Equals, nil)
+	c.Check(len(hits), check.Equals, 4)
+	for _, h := range hits {
+		c.Check(h.Strand, check.Equals, int8(map[int]int{2: -1, 12: -1, 1: 1, 5: -1}[h.Pos]))
+	}
+	hits, err = m.GetHitsString("ACGN")
+	c.Check(err, check.Not(check.Equals), nil)
+}
@@ -0,0 +1,533 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kmerindex
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"sort"
+)
+
+// Long Kmer indexes do not use a dense finger table. Instead the (kmer, position) pairs of the
+// sequence are sorted by kmer and positions are found by binary search, so index size depends
+// only on sequence length.
+
+var MaxKmerLen64 = 32 // Maximum word size of an Index64.
+
+// 2-bit per base packed word of up to 32 bases.
+type Kmer64 uint64
+
+// errors should be handled through a panic which will be recovered by ForEachKmerOf
+type Eval64 func(index *Index64, j int, kmer Kmer64)
+
+// Sparse long Kmer index type.
+type Index64 struct {
+	kmers   []Kmer64
+	pos     []int
+	Seq     *seq.Seq
+	k       int
+	kMask   Kmer64
+	indexed bool
+}
+
+// Create a new Index64 with a word size k based on sequence.
+func New64(k int, sequence *seq.Seq) (i *Index64, err error) {
+	switch {
+	case k > MaxKmerLen64:
+		return nil, bio.NewError("k greater than MaxKmerLen64", 0, k, MaxKmerLen64)
+	case k < MinKmerLen:
+		return nil, bio.NewError("k less than MinKmerLen", 0, k, MinKmerLen)
+	case k+1 > sequence.Len():
+		return nil, bio.NewError("sequence shorter than k+1-mer length", 0, k+1, sequence.Len())
+	}
+
+	return &Index64{
+		k:     k,
+		kMask: ^Kmer64(0) >> uint(64-2*k),
+		Seq:   sequence,
+	}, nil
+}
+
+// Build the sorted Kmer position table.
+func (self *Index64) Build() {
+	self.kmers, self.pos = self.kmers[:0], self.pos[:0]
+	self.ForEachKmerOf(self.Seq, 0, self.Seq.Len(), func(index *Index64, position int, kmer Kmer64) {
+		index.kmers = append(index.kmers, kmer)
+		index.pos = append(index.pos, position)
+	})
+	sort.Sort(kmerPos64{self})
+	self.indexed = true
+}
+
+type kmerPos64 struct{ *Index64 }
+
+func (self kmerPos64) Len() int { return len(self.kmers) }
+func (self kmerPos64) Less(i, j int) bool {
+	if self.kmers[i] != self.kmers[j] {
+		return self.kmers[i] < self.kmers[j]
+	}
+	return self.pos[i] < self.pos[j]
+}
+func (self kmerPos64) Swap(i, j int) {
+	self.kmers[i], self.kmers[j] = self.kmers[j], self.kmers[i]
+	self.pos[i], self.pos[j] = self.pos[j], self.pos[i]
+}
+
+// Return an array of positions for the Kmer string kmertext
+func (self *Index64) GetPositionsString(kmertext string) (positions []int, err error) {
+	switch {
+	case len(kmertext) != self.k:
+		return nil, bio.NewError("Sequence length does not match Kmer length", 0, self.k, kmertext)
+	case !self.indexed:
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+
+	var kmer Kmer64
+	if kmer, err = self.KmerOf(kmertext); err != nil {
+		return nil, err
+	}
+
+	return self.GetPositionsKmer(kmer)
+}
+
+// Return an array of positions for the Kmer kmer
+func (self *Index64) GetPositionsKmer(kmer Kmer64) (positions []int, err error) {
+	switch {
+	case kmer > self.kMask:
+		return nil, bio.NewError("Kmer out of range", 0, kmer, self.kMask)
+	case !self.indexed:
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+
+	i := sort.Search(len(self.kmers), func(i int) bool { return self.kmers[i] >= kmer })
+	j := i
+	for ; j < len(self.kmers) && self.kmers[j] == kmer; j++ {
+	}
+	if i == j {
+		return
+	}
+
+	positions = make([]int, j-i)
+	copy(positions, self.pos[i:j])
+
+	return
+}
+
+// Return a map containing absolute Kmer frequencies. Unlike Index, an Index64 can return
+// frequencies both before and after Build, so the returned bool is always true.
+func (self *Index64) KmerFrequencies() (map[Kmer64]int, bool) {
+	m := map[Kmer64]int{}
+	if self.indexed {
+		for _, kmer := range self.kmers {
+			m[kmer]++
+		}
+	} else {
+		self.ForEachKmerOf(self.Seq, 0, self.Seq.Len(), func(_ *Index64, _ int, kmer Kmer64) {
+			m[kmer]++
+		})
+	}
+
+	return m, true
+}
+
+// Return a map containing relative Kmer frequencies. The returned bool is always true.
+func (self *Index64) NormalisedKmerFrequencies() (map[Kmer64]float64, bool) {
+	f, _ := self.KmerFrequencies()
+	m := make(map[Kmer64]float64, len(f))
+	l := float64(self.Seq.Len())
+	for kmer, n := range f {
+		m[kmer] = float64(n) / l
+	}
+
+	return m, true
+}
+
+// Returns a Kmer-keyed map containing slices of kmer positions and true if called after Build,
+// otherwise nil and false.
+func (self *Index64) KmerIndex() (map[Kmer64][]int, bool) {
+	if !self.indexed {
+		return nil, false
+	}
+
+	m := make(map[Kmer64][]int)
+	for i := 0; i < len(self.kmers); {
+		j := i + 1
+		for ; j < len(self.kmers) && self.kmers[j] == self.kmers[i]; j++ {
+		}
+		m[self.kmers[i]] = append([]int(nil), self.pos[i:j]...)
+		i = j
+	}
+
+	return m, true
+}
+
+// Applies the f Eval64 func to all kmers in s from start to end. Returns any panic raised by f as an error.
+func (self *Index64) ForEachKmerOf(s *seq.Seq, start, end int, f Eval64) (err error) {
+	defer func() {
+		if !Debug {
+			if r := recover(); r != nil {
+				var ok bool
+				err, ok = r.(error)
+				if !ok {
+					err = bio.NewError(fmt.Sprintf("pkg: %v", r), 1, r)
+				}
+			}
+		}
+	}()
+
+	var kmer Kmer64
+	high := start
+	for position, basePosition := start-self.k+1, start; basePosition < end; position, basePosition = position+1, basePosition+1 {
+		currentBase := lookUp.ValueToCode[s.Seq[basePosition]]
+		if currentBase >= 0 {
+			kmer = ((kmer << 2) | Kmer64(currentBase)) & self.kMask
+		} else {
+			kmer = 0
+			high = basePosition + 1
+		}
+		if position >= high {
+			f(self, position, kmer)
+		}
+	}
+
+	return
+}
+
+// Return the Kmer length of the Index64.
+func (self *Index64) GetK() int { return self.k }
+
+// Returns a pointer to the indexed seq.Seq.
+func (self *Index64) GetSeq() *seq.Seq { return self.Seq }
+
+// Convert a Kmer64 into a string of bases
+func (self *Index64) Stringify(kmer Kmer64) string { return Stringify64(self.k, kmer) }
+
+// Convert a string of bases into a Kmer64, returns an error if string length does not match word length
+func (self *Index64) KmerOf(kmertext string) (Kmer64, error) { return KmerOf64(self.k, kmertext) }
+
+// Reverse complement a Kmer64
+func (self *Index64) ComplementOf(kmer Kmer64) Kmer64 { return ComplementOf64(self.k, kmer) }
+
+// Return the GC fraction of a Kmer64
+func (self *Index64) GCof(kmer Kmer64) float64 { return GCof64(self.k, kmer) }
+
+// Convert a string of bases into a len k Kmer64, returns an error if string length does not match k
+func KmerOf64(k int, kmertext string) (kmer Kmer64, err error) {
+	if len(kmertext) != k || k > MaxKmerLen64 {
+		return 0, bio.NewError("Sequence length does not match Kmer length", 0, k, kmertext)
+	}
+
+	for _, v := range kmertext {
+		x := lookUp.ValueToCode[v]
+		if x < 0 {
+			return 0, bio.NewError("Kmer contains illegal character", 0, kmertext)
+		}
+		kmer = (kmer << 2) | Kmer64(x)
+	}
+
+	return
+}
+
+// Convert a Kmer64 of len k into a string of bases
+func Stringify64(k int, kmer Kmer64) string {
+	kmertext := make([]byte, k)
+	for i := k - 1; i >= 0; i, kmer = i-1, kmer>>2 {
+		kmertext[i] = bio.N[kmer&3]
+	}
+
+	return string(kmertext)
+}
+
+// Reverse complement a Kmer64 of len k
+func ComplementOf64(k int, kmer Kmer64) (c Kmer64) {
+	for i := 0; i < k; i, kmer = i+1, kmer>>2 {
+		c = c<<2 | (3 - kmer&3)
+	}
+
+	return
+}
+
+// Return the GC fraction of a Kmer64 of len k
+func GCof64(k int, kmer Kmer64) float64 {
+	gc := 0
+	for i := k - 1; i >= 0; i, kmer = i-1, kmer>>2 {
+		gc += int((kmer & 1) ^ ((kmer & 2) >> 1))
+	}
+
+	return float64(gc) / float64(k)
+}
+
+var MaxKmerLen128 = 64 // Maximum word size of an Index128.
+
+// 2-bit per base packed word of up to 64 bases. Hi holds the most significant bits.
+type Kmer128 struct {
+	Hi, Lo uint64
+}
+
+// Less returns whether self sorts before k.
+func (self Kmer128) Less(k Kmer128) bool {
+	return self.Hi < k.Hi || (self.Hi == k.Hi && self.Lo < k.Lo)
+}
+
+func (self Kmer128) push(b uint64) Kmer128 {
+	return Kmer128{Hi: self.Hi<<2 | self.Lo>>62, Lo: self.Lo<<2 | b}
+}
+
+func (self Kmer128) and(m Kmer128) Kmer128 {
+	return Kmer128{Hi: self.Hi & m.Hi, Lo: self.Lo & m.Lo}
+}
+
+func (self Kmer128) last() uint64 { return self.Lo & 3 }
+
+func (self Kmer128) shiftRight() Kmer128 {
+	return Kmer128{Hi: self.Hi >> 2, Lo: self.Lo>>2 | self.Hi<<62}
+}
+
+func mask128(k int) Kmer128 {
+	if k <= 32 {
+		return Kmer128{Lo: ^uint64(0) >> uint(64-2*k)}
+	}
+	return Kmer128{Hi: ^uint64(0) >> uint(128-2*k), Lo: ^uint64(0)}
+}
+
+// errors should be handled through a panic which will be recovered by ForEachKmerOf
+type Eval128 func(index *Index128, j int, kmer Kmer128)
+
+// Sparse long Kmer index type for words of up to 64 bases.
+type Index128 struct {
+	kmers   []Kmer128
+	pos     []int
+	Seq     *seq.Seq
+	k       int
+	kMask   Kmer128
+	indexed bool
+}
+
+// Create a new Index128 with a word size k based on sequence.
+func New128(k int, sequence *seq.Seq) (i *Index128, err error) {
+	switch {
+	case k > MaxKmerLen128:
+		return nil, bio.NewError("k greater than MaxKmerLen128", 0, k, MaxKmerLen128)
+	case k < MinKmerLen:
+		return nil, bio.NewError("k less than MinKmerLen", 0, k, MinKmerLen)
+	case k+1 > sequence.Len():
+		return nil, bio.NewError("sequence shorter than k+1-mer length", 0, k+1, sequence.Len())
+	}
+
+	return &Index128{
+		k:     k,
+		kMask: mask128(k),
+		Seq:   sequence,
+	}, nil
+}
+
+// Build the sorted Kmer position table.
+func (self *Index128) Build() {
+	self.kmers, self.pos = self.kmers[:0], self.pos[:0]
+	self.ForEachKmerOf(self.Seq, 0, self.Seq.Len(), func(index *Index128, position int, kmer Kmer128) {
+		index.kmers = append(index.kmers, kmer)
+		index.pos = append(index.pos, position)
+	})
+	sort.Sort(kmerPos128{self})
+	self.indexed = true
+}
+
+type kmerPos128 struct{ *Index128 }
+
+func (self kmerPos128) Len() int { return len(self.kmers) }
+func (self kmerPos128) Less(i, j int) bool {
+	if self.kmers[i] != self.kmers[j] {
+		return self.kmers[i].Less(self.kmers[j])
+	}
+	return self.pos[i] < self.pos[j]
+}
+func (self kmerPos128) Swap(i, j int) {
+	self.kmers[i], self.kmers[j] = self.kmers[j], self.kmers[i]
+	self.pos[i], self.pos[j] = self.pos[j], self.pos[i]
+}
+
+// Return an array of positions for the Kmer string kmertext
+func (self *Index128) GetPositionsString(kmertext string) (positions []int, err error) {
+	switch {
+	case len(kmertext) != self.k:
+		return nil, bio.NewError("Sequence length does not match Kmer length", 0, self.k, kmertext)
+	case !self.indexed:
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+
+	var kmer Kmer128
+	if kmer, err = self.KmerOf(kmertext); err != nil {
+		return nil, err
+	}
+
+	return self.GetPositionsKmer(kmer)
+}
+
+// Return an array of positions for the Kmer kmer
+func (self *Index128) GetPositionsKmer(kmer Kmer128) (positions []int, err error) {
+	switch {
+	case kmer.and(self.kMask) != kmer:
+		return nil, bio.NewError("Kmer out of range", 0, kmer, self.kMask)
+	case !self.indexed:
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+
+	i := sort.Search(len(self.kmers), func(i int) bool { return !self.kmers[i].Less(kmer) })
+	j := i
+	for ; j < len(self.kmers) && self.kmers[j] == kmer; j++ {
+	}
+	if i == j {
+		return
+	}
+
+	positions = make([]int, j-i)
+	copy(positions, self.pos[i:j])
+
+	return
+}
+
+// Return a map containing absolute Kmer frequencies. The returned bool is always true.
+func (self *Index128) KmerFrequencies() (map[Kmer128]int, bool) {
+	m := map[Kmer128]int{}
+	if self.indexed {
+		for _, kmer := range self.kmers {
+			m[kmer]++
+		}
+	} else {
+		self.ForEachKmerOf(self.Seq, 0, self.Seq.Len(), func(_ *Index128, _ int, kmer Kmer128) {
+			m[kmer]++
+		})
+	}
+
+	return m, true
+}
+
+// Returns a Kmer-keyed map containing slices of kmer positions and true if called after Build,
+// otherwise nil and false.
+func (self *Index128) KmerIndex() (map[Kmer128][]int, bool) {
+	if !self.indexed {
+		return nil, false
+	}
+
+	m := make(map[Kmer128][]int)
+	for i := 0; i < len(self.kmers); {
+		j := i + 1
+		for ; j < len(self.kmers) && self.kmers[j] == self.kmers[i]; j++ {
+		}
+		m[self.kmers[i]] = append([]int(nil), self.pos[i:j]...)
+		i = j
+	}
+
+	return m, true
+}
+
+// Applies the f Eval128 func to all kmers in s from start to end. Returns any panic raised by f as an error.
+func (self *Index128) ForEachKmerOf(s *seq.Seq, start, end int, f Eval128) (err error) {
+	defer func() {
+		if !Debug {
+			if r := recover(); r != nil {
+				var ok bool
+				err, ok = r.(error)
+				if !ok {
+					err = bio.NewError(fmt.Sprintf("pkg: %v", r), 1, r)
+				}
+			}
+		}
+	}()
+
+	var kmer Kmer128
+	high := start
+	for position, basePosition := start-self.k+1, start; basePosition < end; position, basePosition = position+1, basePosition+1 {
+		currentBase := lookUp.ValueToCode[s.Seq[basePosition]]
+		if currentBase >= 0 {
+			kmer = kmer.push(uint64(currentBase)).and(self.kMask)
+		} else {
+			kmer = Kmer128{}
+			high = basePosition + 1
+		}
+		if position >= high {
+			f(self, position, kmer)
+		}
+	}
+
+	return
+}
+
+// Return the Kmer length of the Index128.
+func (self *Index128) GetK() int { return self.k }
+
+// Returns a pointer to the indexed seq.Seq.
+func (self *Index128) GetSeq() *seq.Seq { return self.Seq }
+
+// Convert a Kmer128 into a string of bases
+func (self *Index128) Stringify(kmer Kmer128) string { return Stringify128(self.k, kmer) }
+
+// Convert a string of bases into a Kmer128, returns an error if string length does not match word length
+func (self *Index128) KmerOf(kmertext string) (Kmer128, error) { return KmerOf128(self.k, kmertext) }
+
+// Reverse complement a Kmer128
+func (self *Index128) ComplementOf(kmer Kmer128) Kmer128 { return ComplementOf128(self.k, kmer) }
+
+// Return the GC fraction of a Kmer128
+func (self *Index128) GCof(kmer Kmer128) float64 { return GCof128(self.k, kmer) }
+
+// Convert a string of bases into a len k Kmer128, returns an error if string length does not match k
+func KmerOf128(k int, kmertext string) (kmer Kmer128, err error) {
+	if len(kmertext) != k || k > MaxKmerLen128 {
+		return Kmer128{}, bio.NewError("Sequence length does not match Kmer length", 0, k, kmertext)
+	}
+
+	for _, v := range kmertext {
+		x := lookUp.ValueToCode[v]
+		if x < 0 {
+			return Kmer128{}, bio.NewError("Kmer contains illegal character", 0, kmertext)
+		}
+		kmer = kmer.push(uint64(x))
+	}
+
+	return
+}
+
+// Convert a Kmer128 of len k into a string of bases
+func Stringify128(k int, kmer Kmer128) string {
+	kmertext := make([]byte, k)
+	for i := k - 1; i >= 0; i, kmer = i-1, kmer.shiftRight() {
+		kmertext[i] = bio.N[kmer.last()]
+	}
+
+	return string(kmertext)
+}
+
+// Reverse complement a Kmer128 of len k
+func ComplementOf128(k int, kmer Kmer128) (c Kmer128) {
+	for i := 0; i < k; i, kmer = i+1, kmer.shiftRight() {
+		c = c.push(3 - kmer.last())
+	}
+
+	return
+}
+
+// Return the GC fraction of a Kmer128 of len k
+func GCof128(k int, kmer Kmer128) float64 {
+	gc := 0
+	for i := k - 1; i >= 0; i, kmer = i-1, kmer.shiftRight() {
+		b := kmer.last()
+		gc += int((b & 1) ^ ((b & 2) >> 1))
+	}
+
+	return float64(gc) / float64(k)
+}
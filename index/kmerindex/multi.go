@@ -0,0 +1,209 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package kmerindex
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/seq"
+	"sort"
+)
+
+// A Hit is the location of a Kmer in a MultiIndex.
+type Hit struct {
+	ID     string // ID of the sequence containing the Kmer.
+	Index  int    // Index of the sequence in the MultiIndex's Seqs.
+	Pos    int    // Position of the Kmer on the forward strand of the sequence.
+	Strand int8   // Strand of the sequence on which the Kmer occurs.
+}
+
+// A MultiIndex is a sparse Kmer index over a set of sequences. Kmers containing bases other
+// than A, C, G and T are not indexed.
+type MultiIndex struct {
+	Seqs      []*seq.Seq
+	k         int
+	kMask     Kmer64
+	canonical bool
+	kmers     []Kmer64
+	hits      []hitPos
+	indexed   bool
+}
+
+type hitPos struct {
+	seq    int32
+	strand int8
+	pos    int
+}
+
+// Create a new MultiIndex with word size k over the provided sequences. If canonical is true,
+// each Kmer is indexed as the lesser of itself and its reverse complement so that queries find
+// occurrences on both strands.
+func NewMulti(k int, canonical bool, seqs ...*seq.Seq) (*MultiIndex, error) {
+	switch {
+	case k > MaxKmerLen64:
+		return nil, bio.NewError("k greater than MaxKmerLen64", 0, k, MaxKmerLen64)
+	case k < MinKmerLen:
+		return nil, bio.NewError("k less than MinKmerLen", 0, k, MinKmerLen)
+	case len(seqs) == 0:
+		return nil, bio.NewError("no sequences to index", 0)
+	}
+
+	return &MultiIndex{
+		Seqs:      seqs,
+		k:         k,
+		kMask:     ^Kmer64(0) >> uint(64-2*k),
+		canonical: canonical,
+	}, nil
+}
+
+// Return the Kmer length of the MultiIndex.
+func (self *MultiIndex) GetK() int { return self.k }
+
+// Return whether the MultiIndex holds canonical Kmers.
+func (self *MultiIndex) Canonical() bool { return self.canonical }
+
+// Call f with each Kmer of length k in s that contains only A, C, G and T, along with its
+// reverse complement. position is the position of the start of the Kmer in s.
+func ForEachKmer64(k int, s []byte, f func(position int, kmer, rc Kmer64)) {
+	var (
+		kmer, rc Kmer64
+		kMask    = ^Kmer64(0) >> uint(64-2*k)
+		shift    = uint(2 * (k - 1))
+		high     = 0
+	)
+	for position, basePosition := -k+1, 0; basePosition < len(s); position, basePosition = position+1, basePosition+1 {
+		currentBase := lookUp.ValueToCode[s[basePosition]]
+		if currentBase >= 0 {
+			kmer = ((kmer << 2) | Kmer64(currentBase)) & kMask
+			rc = (rc >> 2) | Kmer64(3-currentBase)<<shift
+		} else {
+			kmer, rc = 0, 0
+			high = basePosition + 1
+		}
+		if position >= high {
+			f(position, kmer, rc)
+		}
+	}
+}
+
+// Return the canonical form of kmer given its reverse complement rc, and the strand of
+// kmer relative to the canonical form.
+func CanonicalOf64(kmer, rc Kmer64) (Kmer64, int8) {
+	if rc < kmer {
+		return rc, -1
+	}
+	return kmer, 1
+}
+
+// Build the sorted Kmer hit table.
+func (self *MultiIndex) Build() {
+	self.kmers, self.hits = self.kmers[:0], self.hits[:0]
+	for i, s := range self.Seqs {
+		ForEachKmer64(self.k, s.Seq, func(position int, kmer, rc Kmer64) {
+			strand := int8(1)
+			if self.canonical {
+				kmer, strand = CanonicalOf64(kmer, rc)
+			}
+			self.kmers = append(self.kmers, kmer)
+			self.hits = append(self.hits, hitPos{seq: int32(i), strand: strand, pos: position})
+		})
+	}
+	sort.Sort(multiHits{self})
+	self.indexed = true
+}
+
+type multiHits struct{ *MultiIndex }
+
+func (self multiHits) Len() int { return len(self.kmers) }
+func (self multiHits) Less(i, j int) bool {
+	switch {
+	case self.kmers[i] != self.kmers[j]:
+		return self.kmers[i] < self.kmers[j]
+	case self.hits[i].seq != self.hits[j].seq:
+		return self.hits[i].seq < self.hits[j].seq
+	}
+	return self.hits[i].pos < self.hits[j].pos
+}
+func (self multiHits) Swap(i, j int) {
+	self.kmers[i], self.kmers[j] = self.kmers[j], self.kmers[i]
+	self.hits[i], self.hits[j] = self.hits[j], self.hits[i]
+}
+
+// Return the hits for the Kmer string kmertext.
+func (self *MultiIndex) GetHitsString(kmertext string) (hits []Hit, err error) {
+	kmer, err := KmerOf64(self.k, kmertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.GetHitsKmer(kmer)
+}
+
+// Return the hits for the Kmer kmer, ordered by sequence index and position. For a canonical
+// index, hits on both strands are returned and Strand gives the strand on which kmer itself
+// occurs.
+func (self *MultiIndex) GetHitsKmer(kmer Kmer64) (hits []Hit, err error) {
+	switch {
+	case kmer > self.kMask:
+		return nil, bio.NewError("Kmer out of range", 0, kmer, self.kMask)
+	case !self.indexed:
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+
+	flip := int8(1)
+	if self.canonical {
+		kmer, flip = CanonicalOf64(kmer, ComplementOf64(self.k, kmer))
+	}
+	i := sort.Search(len(self.kmers), func(i int) bool { return self.kmers[i] >= kmer })
+	for ; i < len(self.kmers) && self.kmers[i] == kmer; i++ {
+		h := self.hits[i]
+		hits = append(hits, Hit{
+			ID:     self.Seqs[h.seq].ID,
+			Index:  int(h.seq),
+			Pos:    h.pos,
+			Strand: h.strand * flip,
+		})
+	}
+
+	return
+}
+
+// Return a map containing absolute Kmer frequencies over all indexed sequences. For a canonical
+// index the keys are canonical Kmers. The returned bool is always true.
+func (self *MultiIndex) KmerFrequencies() (map[Kmer64]int, bool) {
+	m := map[Kmer64]int{}
+	if self.indexed {
+		for _, kmer := range self.kmers {
+			m[kmer]++
+		}
+		return m, true
+	}
+	for _, s := range self.Seqs {
+		ForEachKmer64(self.k, s.Seq, func(_ int, kmer, rc Kmer64) {
+			if self.canonical {
+				kmer, _ = CanonicalOf64(kmer, rc)
+			}
+			m[kmer]++
+		})
+	}
+
+	return m, true
+}
+
+// Convert a Kmer64 into a string of bases
+func (self *MultiIndex) Stringify(kmer Kmer64) string { return Stringify64(self.k, kmer) }
+
+// Reverse complement a Kmer64
+func (self *MultiIndex) ComplementOf(kmer Kmer64) Kmer64 { return ComplementOf64(self.k, kmer) }
@@ -0,0 +1,165 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package minhash
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// On-disk sketch format. Each sketch is written as:
+//  magic    [8]byte "bgsketch"
+//  version  uvarint
+//  kind     uvarint
+//  k        uvarint
+//  seed     uvarint
+//  size     uvarint
+//  scaled   uvarint
+//  length   uvarint
+//  name     uvarint length, at most MaxNameLen, followed by bytes
+//  n        uvarint number of hashes
+//  hashes   n uvarint deltas between successive ascending hashes
+// Any number of sketches may be concatenated in a file.
+var magic = [8]byte{'b', 'g', 's', 'k', 'e', 't', 'c', 'h'}
+
+const formatVersion = 1
+
+// MaxNameLen is the maximum length of a sketch name in the minhash binary format.
+const MaxNameLen = 1 << 16
+
+// Write the Sketch to w in the minhash binary format.
+func (self *Sketch) WriteTo(w io.Writer) (n int64, err error) {
+	if len(self.Name) > MaxNameLen {
+		return 0, bio.NewError(fmt.Sprintf("minhash: sketch name longer than %d", MaxNameLen), 0, len(self.Name))
+	}
+	bw := bufio.NewWriter(w)
+	var buf [binary.MaxVarintLen64]byte
+	put := func(v uint64) error {
+		c, err := bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+		n += int64(c)
+		return err
+	}
+
+	c, err := bw.Write(magic[:])
+	n += int64(c)
+	if err != nil {
+		return
+	}
+	for _, v := range []uint64{formatVersion, uint64(self.Kind), uint64(self.K), self.Seed, uint64(self.Size), self.Scaled, uint64(self.Length), uint64(len(self.Name))} {
+		if err = put(v); err != nil {
+			return
+		}
+	}
+	c, err = bw.WriteString(self.Name)
+	n += int64(c)
+	if err != nil {
+		return
+	}
+	h := self.Hashes()
+	if err = put(uint64(len(h))); err != nil {
+		return
+	}
+	var last uint64
+	for _, v := range h {
+		if err = put(v - last); err != nil {
+			return
+		}
+		last = v
+	}
+
+	return n, bw.Flush()
+}
+
+// A Reader reads sketches written by Sketch.WriteTo.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// Return a new Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read the next sketch. At the end of the stream Read returns io.EOF.
+func (self *Reader) Read() (s *Sketch, err error) {
+	var m [8]byte
+	if _, err = io.ReadFull(self.r, m[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = bio.NewError("minhash: truncated sketch", 0)
+		}
+		return
+	}
+	if m != magic {
+		return nil, bio.NewError("minhash: not a sketch", 0, m)
+	}
+
+	var v [8]uint64
+	for i := range v {
+		if v[i], err = binary.ReadUvarint(self.r); err != nil {
+			return nil, truncated(err)
+		}
+	}
+	if v[0] != formatVersion {
+		return nil, bio.NewError(fmt.Sprintf("minhash: unknown sketch version: %d", v[0]), 0, v[0])
+	}
+	switch int(v[1]) {
+	case Bottom:
+		s, err = NewBottom(int(v[2]), int(v[4]), v[3])
+	case Scaled:
+		s, err = NewScaled(int(v[2]), v[5], v[3])
+	default:
+		err = bio.NewError(fmt.Sprintf("minhash: unknown sketch type: %d", v[1]), 0, v[1])
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Length = int64(v[6])
+
+	if v[7] > MaxNameLen {
+		return nil, bio.NewError(fmt.Sprintf("minhash: sketch name length %d exceeds %d", v[7], MaxNameLen), 0, v[7])
+	}
+	name := make([]byte, v[7])
+	if _, err = io.ReadFull(self.r, name); err != nil {
+		return nil, truncated(err)
+	}
+	s.Name = string(name)
+
+	count, err := binary.ReadUvarint(self.r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	var h uint64
+	for i := uint64(0); i < count; i++ {
+		var d uint64
+		if d, err = binary.ReadUvarint(self.r); err != nil {
+			return nil, truncated(err)
+		}
+		h += d
+		s.AddHash(h)
+	}
+
+	return s, nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return bio.NewError("minhash: truncated sketch", 0)
+	}
+	return err
+}
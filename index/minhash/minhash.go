@@ -0,0 +1,360 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package minhash provides bottom-k MinHash and FracMinHash (scaled) sketches of nucleic acid
+// sequences and Mash distance estimation as described in:
+//  Mash: fast genome and metagenome distance estimation using MinHash.
+//   B. D. Ondov, T. J. Treangen, P. Melsted, et al. Genome Biology 17:132 (2016).
+//
+// K-mers are hashed in canonical form using MurmurHash3 so that sketches are strand independent.
+// K-mers containing bases other than A, C, G and T are ignored.
+package minhash
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/io/seqio"
+	"code.google.com/p/biogo/seq"
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Default hash seed, matching Mash and sourmash.
+var DefaultSeed uint64 = 42
+
+// Sketch types.
+const (
+	Bottom = iota // Bottom-k MinHash holding the Size smallest hashes.
+	Scaled        // FracMinHash holding all hashes below 2^64/Scaled.
+)
+
+// A Sketch is a MinHash sketch of a set of k-mers.
+type Sketch struct {
+	Name   string
+	Kind   int
+	K      int
+	Seed   uint64
+	Size   int    // Maximum number of hashes held by a Bottom sketch.
+	Scaled uint64 // Scaling factor of a Scaled sketch.
+	Length int64  // Number of k-mers added to the sketch.
+
+	set    map[uint64]struct{}
+	heap   maxHeap
+	sorted []uint64
+	buf    []byte
+}
+
+// Return a new bottom-k MinHash Sketch of k-mers of length k holding up to size hashes.
+func NewBottom(k, size int, seed uint64) (*Sketch, error) {
+	if size < 1 {
+		return nil, bio.NewError(fmt.Sprintf("minhash: illegal sketch size: %d", size), 0, size)
+	}
+	return newSketch(Bottom, k, size, 0, seed)
+}
+
+// Return a new FracMinHash Sketch of k-mers of length k retaining a fraction 1/scaled of all hashes.
+func NewScaled(k int, scaled, seed uint64) (*Sketch, error) {
+	if scaled < 1 {
+		return nil, bio.NewError(fmt.Sprintf("minhash: illegal scaling factor: %d", scaled), 0, scaled)
+	}
+	return newSketch(Scaled, k, 0, scaled, seed)
+}
+
+func newSketch(kind, k, size int, scaled, seed uint64) (*Sketch, error) {
+	if k < 1 || k > 32 {
+		return nil, bio.NewError(fmt.Sprintf("minhash: illegal k: %d", k), 0, k)
+	}
+	return &Sketch{
+		Kind:   kind,
+		K:      k,
+		Seed:   seed,
+		Size:   size,
+		Scaled: scaled,
+		set:    make(map[uint64]struct{}),
+	}, nil
+}
+
+// Return the largest hash value a Scaled sketch retains.
+func (self *Sketch) MaxHash() uint64 {
+	if self.Kind != Scaled {
+		return math.MaxUint64
+	}
+	return math.MaxUint64 / self.Scaled
+}
+
+var complement = [256]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A', 'a': 'T', 'c': 'G', 'g': 'C', 't': 'A'}
+
+// Add the k-mers of s to the Sketch.
+func (self *Sketch) Add(s *seq.Seq) {
+	k := self.K
+	if cap(self.buf) < 2*k {
+		self.buf = make([]byte, 2*k)
+	}
+	fwd, rev := self.buf[:k], self.buf[k:2*k]
+	valid := 0
+	for i, b := range s.Seq {
+		if complement[b] == 0 {
+			valid = 0
+			continue
+		}
+		valid++
+		if valid < k {
+			continue
+		}
+		w := s.Seq[i-k+1 : i+1]
+		for j, c := range w {
+			fwd[j] = complement[complement[c]]
+			rev[k-1-j] = complement[c]
+		}
+		canon := fwd
+		for j := range fwd {
+			if fwd[j] != rev[j] {
+				if rev[j] < fwd[j] {
+					canon = rev
+				}
+				break
+			}
+		}
+		self.Length++
+		self.AddHash(murmur3(canon, self.Seed))
+	}
+}
+
+// Add a hash value to the Sketch.
+func (self *Sketch) AddHash(h uint64) {
+	if _, ok := self.set[h]; ok {
+		return
+	}
+	switch self.Kind {
+	case Scaled:
+		if h > self.MaxHash() {
+			return
+		}
+	case Bottom:
+		if len(self.heap) == self.Size {
+			if h >= self.heap[0] {
+				return
+			}
+			delete(self.set, heap.Pop(&self.heap).(uint64))
+		}
+		heap.Push(&self.heap, h)
+	}
+	self.set[h] = struct{}{}
+	self.sorted = nil
+}
+
+// Add the k-mers of all sequences read from r to the Sketch, returning the number of sequences
+// read and any error other than io.EOF.
+func (self *Sketch) AddReader(r seqio.Reader) (n int, err error) {
+	for {
+		var s *seq.Seq
+		if s, err = r.Read(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		self.Add(s)
+		n++
+	}
+}
+
+// Return the hashes held by the Sketch in ascending order.
+func (self *Sketch) Hashes() []uint64 {
+	if self.sorted == nil {
+		self.sorted = make([]uint64, 0, len(self.set))
+		for h := range self.set {
+			self.sorted = append(self.sorted, h)
+		}
+		sort.Sort(uint64s(self.sorted))
+	}
+	h := make([]uint64, len(self.sorted))
+	copy(h, self.sorted)
+	return h
+}
+
+// Return the number of hashes held by the Sketch.
+func (self *Sketch) Len() int { return len(self.set) }
+
+// compatible returns an error if a and b cannot be compared.
+func compatible(a, b *Sketch) error {
+	switch {
+	case a.K != b.K:
+		return bio.NewError(fmt.Sprintf("minhash: k mismatch: %d != %d", a.K, b.K), 0, a, b)
+	case a.Seed != b.Seed:
+		return bio.NewError("minhash: seed mismatch", 0, a, b)
+	case a.Kind != b.Kind:
+		return bio.NewError("minhash: sketch type mismatch", 0, a, b)
+	}
+	return nil
+}
+
+// A Comparison holds the result of comparing two sketches.
+type Comparison struct {
+	Shared      int     // Number of shared hashes among those considered.
+	Considered  int     // Number of hashes in the sketch union considered.
+	Jaccard     float64 // Estimated Jaccard index.
+	Containment float64 // Estimated fraction of the first sketch's k-mers in the second.
+	Distance    float64 // Mash distance.
+	PValue      float64 // Probability of Shared or more shared hashes by chance.
+}
+
+// Compare two sketches of the same type, k and seed. For bottom-k sketches the Jaccard index is
+// estimated from the smallest Size hashes of the union of the two sketches, as in Mash. For
+// scaled sketches all retained hashes are used after downsampling both sketches to the larger
+// of their scaling factors, as in sourmash.
+func Compare(a, b *Sketch) (c Comparison, err error) {
+	if err = compatible(a, b); err != nil {
+		return
+	}
+	ha, hb := a.Hashes(), b.Hashes()
+	if a.Kind == Scaled {
+		max := a.MaxHash()
+		if m := b.MaxHash(); m < max {
+			max = m
+		}
+		ha, hb = below(ha, max), below(hb, max)
+	}
+
+	limit := math.MaxInt32
+	if a.Kind == Bottom {
+		limit = a.Size
+		if b.Size < limit {
+			limit = b.Size
+		}
+	}
+	var i, j int
+	for c.Considered < limit && (i < len(ha) || j < len(hb)) {
+		switch {
+		case j == len(hb) || (i < len(ha) && ha[i] < hb[j]):
+			i++
+		case i == len(ha) || hb[j] < ha[i]:
+			j++
+		default:
+			c.Shared++
+			i++
+			j++
+		}
+		c.Considered++
+	}
+	if c.Considered > 0 {
+		c.Jaccard = float64(c.Shared) / float64(c.Considered)
+	}
+
+	// Containment is estimated over the hashes of a below the largest hash both sketches resolve.
+	max := uint64(math.MaxUint64)
+	if a.Kind == Bottom {
+		// A sketch that is not full holds all its hashes and so resolves all values.
+		if len(ha) == a.Size {
+			max = ha[len(ha)-1]
+		}
+		if len(hb) == b.Size && hb[len(hb)-1] < max {
+			max = hb[len(hb)-1]
+		}
+	}
+	var inA, both int
+	for i, j = 0, 0; i < len(ha) && ha[i] <= max; i++ {
+		inA++
+		for j < len(hb) && hb[j] < ha[i] {
+			j++
+		}
+		if j < len(hb) && hb[j] == ha[i] {
+			both++
+		}
+	}
+	if inA > 0 {
+		c.Containment = float64(both) / float64(inA)
+	}
+
+	c.Distance = MashDistance(c.Jaccard, a.K)
+	c.PValue = PValue(c.Shared, c.Considered, a.K, a.Length, b.Length)
+
+	return
+}
+
+// below returns the prefix of the ascending hashes h that are no greater than max.
+func below(h []uint64, max uint64) []uint64 {
+	return h[:sort.Search(len(h), func(i int) bool { return h[i] > max })]
+}
+
+// Return the Mash distance corresponding to Jaccard index j for k-mers of length k.
+func MashDistance(j float64, k int) float64 {
+	if j <= 0 {
+		return 1
+	}
+	if j >= 1 {
+		return 0
+	}
+	d := -1 / float64(k) * math.Log(2*j/(1+j))
+	if d > 1 {
+		return 1
+	}
+	return d
+}
+
+// Return the Mash p-value of observing at least x shared hashes among n considered for random
+// sequences of lengths la and lb with k-mers of length k.
+func PValue(x, n, k int, la, lb int64) float64 {
+	if x <= 0 || n == 0 {
+		return 1
+	}
+	pk := math.Pow(4, -float64(k))
+	pa := -math.Expm1(float64(la) * math.Log1p(-pk))
+	pb := -math.Expm1(float64(lb) * math.Log1p(-pk))
+	r := pa * pb / (pa + pb - pa*pb)
+	if r <= 0 {
+		return 0
+	}
+	if r >= 1 {
+		return 1
+	}
+
+	// Upper tail of the binomial distribution, summed in log space.
+	lr, lq := math.Log(r), math.Log1p(-r)
+	lgn, _ := math.Lgamma(float64(n + 1))
+	var p float64
+	for i := x; i <= n; i++ {
+		lgi, _ := math.Lgamma(float64(i + 1))
+		lgni, _ := math.Lgamma(float64(n - i + 1))
+		t := math.Exp(lgn - lgi - lgni + float64(i)*lr + float64(n-i)*lq)
+		p += t
+		if t < p*1e-17 && float64(i) > float64(n)*r {
+			break
+		}
+	}
+	if p > 1 {
+		p = 1
+	}
+	return p
+}
+
+type maxHeap []uint64
+
+func (self maxHeap) Len() int            { return len(self) }
+func (self maxHeap) Less(i, j int) bool  { return self[i] > self[j] }
+func (self maxHeap) Swap(i, j int)       { self[i], self[j] = self[j], self[i] }
+func (self *maxHeap) Push(x interface{}) { *self = append(*self, x.(uint64)) }
+func (self *maxHeap) Pop() (x interface{}) {
+	x, *self = (*self)[len(*self)-1], (*self)[:len(*self)-1]
+	return
+}
+
+type uint64s []uint64
+
+func (self uint64s) Len() int           { return len(self) }
+func (self uint64s) Less(i, j int) bool { return self[i] < self[j] }
+func (self uint64s) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
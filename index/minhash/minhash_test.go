@@ -0,0 +1,253 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package minhash
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/io/seqio/fasta"
+	"code.google.com/p/biogo/seq"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func random(n int, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rnd.Intn(4)]
+	}
+	return s
+}
+
+func revComp(s []byte) []byte {
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = complement[b]
+	}
+	return r
+}
+
+func sketch(c *check.C, kind, k int, p uint64, s ...[]byte) *Sketch {
+	var (
+		sk  *Sketch
+		err error
+	)
+	if kind == Bottom {
+		sk, err = NewBottom(k, int(p), DefaultSeed)
+	} else {
+		sk, err = NewScaled(k, p, DefaultSeed)
+	}
+	c.Assert(err, check.Equals, nil)
+	for _, b := range s {
+		sk.Add(seq.New("", b, nil))
+	}
+	return sk
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestMurmur3(c *check.C) {
+	for _, t := range []struct {
+		data string
+		seed uint64
+		hash uint64
+	}{
+		{"", 0, 0},
+		{"hello", 0, 0xcbd8a7b341bd9b02},
+		{"ACGTACGTACGTACGTACGTA", 42, 0xb4e9c495b633d387},
+	} {
+		c.Check(murmur3([]byte(t.data), t.seed), check.Equals, t.hash)
+	}
+}
+
+func (s *S) TestAdd(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	b := random(2000, rnd)
+	fwd := sketch(c, Bottom, 21, 100, b)
+	rev := sketch(c, Bottom, 21, 100, revComp(b))
+	c.Check(fwd.Len(), check.Equals, 100)
+	c.Check(fwd.Length, check.Equals, int64(2000-21+1))
+	c.Check(fwd.Hashes(), check.DeepEquals, rev.Hashes())
+	lower := sketch(c, Bottom, 21, 100, bytes.ToLower(b))
+	c.Check(lower.Hashes(), check.DeepEquals, fwd.Hashes())
+
+	// K-mers spanning ambiguous bases are ignored.
+	n := sketch(c, Bottom, 4, 100, []byte("ACGTNACGTA"))
+	c.Check(n.Length, check.Equals, int64(3))
+	c.Check(n.Len(), check.Equals, 2)
+
+	// A bottom sketch holds the smallest hashes of all k-mers.
+	all := sketch(c, Bottom, 21, 1<<20, b)
+	c.Check(all.Hashes()[:100], check.DeepEquals, fwd.Hashes())
+
+	// A scaled sketch holds all hashes below MaxHash.
+	sc := sketch(c, Scaled, 21, 10, b)
+	var expect []uint64
+	for _, h := range all.Hashes() {
+		if h <= sc.MaxHash() {
+			expect = append(expect, h)
+		}
+	}
+	c.Check(sc.Hashes(), check.DeepEquals, expect)
+}
+
+func (s *S) TestCompare(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	shared := random(50000, rnd)
+	a, b := random(50000, rnd), random(50000, rnd)
+
+	// Jaccard of (shared+a) and (shared+b) is approximately 1/3.
+	for _, kind := range []int{Bottom, Scaled} {
+		p := uint64(1000)
+		if kind == Scaled {
+			p = 100
+		}
+		sa := sketch(c, kind, 21, p, shared, a)
+		sb := sketch(c, kind, 21, p, shared, b)
+		cmp, err := Compare(sa, sb)
+		c.Check(err, check.Equals, nil)
+		c.Check(math.Abs(cmp.Jaccard-1./3) < 0.05, check.Equals, true, check.Commentf("kind %d: %+v", kind, cmp))
+		c.Check(math.Abs(cmp.Containment-0.5) < 0.05, check.Equals, true, check.Commentf("kind %d: %+v", kind, cmp))
+		c.Check(cmp.Distance, check.Equals, MashDistance(cmp.Jaccard, 21))
+		c.Check(cmp.PValue < 1e-10, check.Equals, true)
+
+		self, err := Compare(sa, sa)
+		c.Check(err, check.Equals, nil)
+		c.Check(self.Jaccard, check.Equals, 1.)
+		c.Check(self.Containment, check.Equals, 1.)
+		c.Check(self.Distance, check.Equals, 0.)
+	}
+
+	// A scaled sketch of a subsequence is contained in the sketch of its parent.
+	sub := sketch(c, Scaled, 21, 100, shared[:20000])
+	parent := sketch(c, Scaled, 21, 100, shared, a)
+	cmp, err := Compare(sub, parent)
+	c.Check(err, check.Equals, nil)
+	c.Check(cmp.Containment, check.Equals, 1.)
+	c.Check(cmp.Jaccard < 0.3, check.Equals, true)
+
+	// Scaled sketches of a sequence at different scales are downsampled to the coarser scale.
+	whole := random(200000, rnd)
+	fine, coarse := sketch(c, Scaled, 21, 10, whole), sketch(c, Scaled, 21, 1000, whole)
+	for _, t := range [][2]*Sketch{{fine, coarse}, {coarse, fine}} {
+		cmp, err = Compare(t[0], t[1])
+		c.Check(err, check.Equals, nil)
+		c.Check(cmp.Considered, check.Equals, coarse.Len())
+		c.Check(cmp.Jaccard, check.Equals, 1.)
+		c.Check(cmp.Containment, check.Equals, 1.)
+		c.Check(cmp.Distance, check.Equals, 0.)
+	}
+
+	// Unrelated sequences share nothing.
+	cmp, err = Compare(sketch(c, Bottom, 21, 1000, a), sketch(c, Bottom, 21, 1000, b))
+	c.Check(err, check.Equals, nil)
+	c.Check(cmp.Shared, check.Equals, 0)
+	c.Check(cmp.Distance, check.Equals, 1.)
+	c.Check(cmp.PValue, check.Equals, 1.)
+
+	// Incompatible sketches.
+	for _, t := range [][2]*Sketch{
+		{sketch(c, Bottom, 21, 10), sketch(c, Bottom, 15, 10)},
+		{sketch(c, Bottom, 21, 10), sketch(c, Scaled, 21, 10)},
+	} {
+		_, err = Compare(t[0], t[1])
+		c.Check(err, check.NotNil)
+	}
+}
+
+func (s *S) TestMashDistance(c *check.C) {
+	c.Check(MashDistance(0, 21), check.Equals, 1.)
+	c.Check(MashDistance(1, 21), check.Equals, 0.)
+	c.Check(math.Abs(MashDistance(0.5, 21)-0.019308) < 1e-6, check.Equals, true)
+	c.Check(PValue(0, 1000, 21, 1e6, 1e6), check.Equals, 1.)
+	c.Check(PValue(1, 1000, 21, 1e6, 1e6) > PValue(10, 1000, 21, 1e6, 1e6), check.Equals, true)
+	c.Check(PValue(10, 1000, 21, 1e6, 1e6) > PValue(10, 1000, 21, 1e5, 1e5), check.Equals, true)
+}
+
+func (s *S) TestAddReader(c *check.C) {
+	r := fasta.NewReader(ioutil.NopCloser(strings.NewReader(">a\nACGTACGTTT\nGCA\n>b\nTTTTGGGGCCCC\n")))
+	sk := sketch(c, Bottom, 5, 100)
+	n, err := sk.AddReader(r)
+	c.Check(err, check.Equals, nil)
+	c.Check(n, check.Equals, 2)
+	c.Check(sk.Length, check.Equals, int64(9+8))
+	c.Check(sk.Hashes(), check.DeepEquals, sketch(c, Bottom, 5, 100, []byte("ACGTACGTTTGCA"), []byte("TTTTGGGGCCCC")).Hashes())
+}
+
+func (s *S) TestFormat(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	in := []*Sketch{
+		sketch(c, Bottom, 21, 500, random(10000, rnd)),
+		sketch(c, Scaled, 15, 20, random(10000, rnd)),
+		sketch(c, Bottom, 5, 10),
+	}
+	in[0].Name = "first"
+	in[1].Name = "second"
+	var b bytes.Buffer
+	for _, sk := range in {
+		_, err := sk.WriteTo(&b)
+		c.Assert(err, check.Equals, nil)
+	}
+	// Delta encoding makes the format compact.
+	c.Check(b.Len() < 9*(500+in[1].Len()), check.Equals, true)
+
+	r := NewReader(bytes.NewReader(b.Bytes()))
+	for _, sk := range in {
+		got, err := r.Read()
+		c.Assert(err, check.Equals, nil)
+		c.Check(got.Name, check.Equals, sk.Name)
+		c.Check(got.Kind, check.Equals, sk.Kind)
+		c.Check(got.K, check.Equals, sk.K)
+		c.Check(got.Seed, check.Equals, sk.Seed)
+		c.Check(got.Size, check.Equals, sk.Size)
+		c.Check(got.Scaled, check.Equals, sk.Scaled)
+		c.Check(got.Length, check.Equals, sk.Length)
+		c.Check(got.Hashes(), check.DeepEquals, sk.Hashes())
+	}
+	_, err := r.Read()
+	c.Check(err, check.Equals, io.EOF)
+
+	_, err = NewReader(bytes.NewReader(b.Bytes()[:b.Len()/2])).Read()
+	c.Check(err, check.NotNil)
+	c.Check(err, check.Not(check.Equals), io.EOF)
+	_, err = NewReader(strings.NewReader("notasketch")).Read()
+	c.Check(err, check.NotNil)
+
+	// Overlong names are neither written nor read.
+	long := sketch(c, Bottom, 5, 10)
+	long.Name = strings.Repeat("n", MaxNameLen+1)
+	_, err = long.WriteTo(&b)
+	c.Check(err, check.NotNil)
+	hdr := append([]byte(nil), magic[:]...)
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range []uint64{formatVersion, uint64(Bottom), 5, 0, 10, 0, 0, math.MaxUint64} {
+		hdr = append(hdr, buf[:binary.PutUvarint(buf[:], v)]...)
+	}
+	_, err = NewReader(bytes.NewReader(hdr)).Read()
+	c.Check(err, check.NotNil)
+	c.Check(err, check.Not(check.Equals), io.EOF)
+}
@@ -0,0 +1,185 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package minimizer
+
+import (
+	"math"
+	"sort"
+)
+
+// A Chainer groups anchors into collinear chains using the dynamic programming scheme of
+// minimap2.
+type Chainer struct {
+	MaxGap     int // Maximum gap between consecutive anchors on either sequence.
+	Bandwidth  int // Maximum difference between the query and reference gaps of consecutive anchors.
+	Lookback   int // Number of preceding anchors considered as predecessors of each anchor.
+	MinScore   int // Minimum chain score.
+	MinAnchors int // Minimum number of anchors in a chain.
+}
+
+// Default chaining parameters.
+var DefaultChainer = Chainer{
+	MaxGap:     5000,
+	Bandwidth:  500,
+	Lookback:   50,
+	MinScore:   40,
+	MinAnchors: 3,
+}
+
+// A Chain is a collinear set of anchors. Coordinates are half-open on the forward strands of
+// the query and reference.
+type Chain struct {
+	Target       int
+	Strand       int8
+	Score        int
+	QStart, QEnd int
+	TStart, TEnd int
+	Anchors      []Anchor // Anchors in order of reference position.
+}
+
+// Return the chains of anchors of k-mer length k for a query of length qlen, ordered by
+// descending score. Each anchor is used in at most one chain.
+func (self Chainer) Chain(anchors []Anchor, k, qlen int) []Chain {
+	a := make([]Anchor, len(anchors))
+	copy(a, anchors)
+	sort.Sort(anchorOrder(a))
+
+	var chains []Chain
+	for lo := 0; lo < len(a); {
+		hi := lo + 1
+		for hi < len(a) && a[hi].Target == a[lo].Target && a[hi].Strand == a[lo].Strand {
+			hi++
+		}
+		chains = append(chains, self.chain(a[lo:hi], k, qlen)...)
+		lo = hi
+	}
+	sort.Stable(byScore(chains))
+
+	return chains
+}
+
+// qpos returns the position of the anchor on the query strand aligned to the reference.
+func qpos(a Anchor, k, qlen int) int {
+	if a.Strand < 0 {
+		return qlen - (a.QPos + k)
+	}
+	return a.QPos
+}
+
+// chain performs chaining on anchors sharing a target and strand, sorted by target position.
+func (self Chainer) chain(a []Anchor, k, qlen int) (chains []Chain) {
+	f := make([]int, len(a))
+	p := make([]int, len(a))
+	for i := range a {
+		f[i], p[i] = k, -1
+		qi := qpos(a[i], k, qlen)
+		for j := i - 1; j >= 0 && (self.Lookback <= 0 || i-j <= self.Lookback); j-- {
+			dt := a[i].TPos - a[j].TPos
+			if dt > self.MaxGap {
+				break
+			}
+			dq := qi - qpos(a[j], k, qlen)
+			if dt <= 0 || dq <= 0 || dq > self.MaxGap {
+				continue
+			}
+			l := dq - dt
+			if l < 0 {
+				l = -l
+			}
+			if l > self.Bandwidth {
+				continue
+			}
+			match := k
+			if dq < match {
+				match = dq
+			}
+			if dt < match {
+				match = dt
+			}
+			s := f[j] + match
+			if l > 0 {
+				s -= int(0.01*float64(k*l) + 0.5*math.Log2(float64(l)))
+			}
+			if s > f[i] {
+				f[i], p[i] = s, j
+			}
+		}
+	}
+
+	order := make([]int, len(a))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byValue{order, f})
+	used := make([]bool, len(a))
+	for _, end := range order {
+		if used[end] {
+			continue
+		}
+		var (
+			idx   []int
+			score = f[end]
+		)
+		i := end
+		for ; i >= 0 && !used[i]; i = p[i] {
+			idx = append(idx, i)
+			used[i] = true
+		}
+		if i >= 0 {
+			score -= f[i]
+		}
+		if score < self.MinScore || len(idx) < self.MinAnchors {
+			continue
+		}
+		c := Chain{
+			Target:  a[end].Target,
+			Strand:  a[end].Strand,
+			Score:   score,
+			Anchors: make([]Anchor, len(idx)),
+			QStart:  math.MaxInt32,
+			TStart:  a[idx[len(idx)-1]].TPos,
+			TEnd:    a[end].TPos + k,
+		}
+		for j, ai := range idx {
+			an := a[ai]
+			c.Anchors[len(idx)-1-j] = an
+			if an.QPos < c.QStart {
+				c.QStart = an.QPos
+			}
+			if an.QPos+k > c.QEnd {
+				c.QEnd = an.QPos + k
+			}
+		}
+		chains = append(chains, c)
+	}
+
+	return
+}
+
+type byScore []Chain
+
+func (self byScore) Len() int           { return len(self) }
+func (self byScore) Less(i, j int) bool { return self[i].Score > self[j].Score }
+func (self byScore) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+type byValue struct {
+	idx []int
+	v   []int
+}
+
+func (self byValue) Len() int           { return len(self.idx) }
+func (self byValue) Less(i, j int) bool { return self.v[self.idx[i]] > self.v[self.idx[j]] }
+func (self byValue) Swap(i, j int)      { self.idx[i], self.idx[j] = self.idx[j], self.idx[i] }
@@ -0,0 +1,161 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package minimizer
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/seq"
+	"sort"
+)
+
+// A Hit is the location of a seed in an Index.
+type Hit struct {
+	Index  int  // Index of the sequence in the Index's Seqs.
+	Pos    int  // Position of the seed on the forward strand of the sequence.
+	Strand int8 // Strand of the seed relative to its canonical form.
+}
+
+// An Index maps sampled seed hashes to their positions in a set of reference sequences.
+type Index struct {
+	Seqs    []*seq.Seq
+	Sampler Sampler
+
+	// MaxOcc is the maximum number of occurrences of a seed for it to be used as an anchor.
+	// Zero indicates no limit.
+	MaxOcc int
+
+	hashes  []uint64
+	hits    []hitPos
+	indexed bool
+}
+
+type hitPos struct {
+	seq    int32
+	strand int8
+	pos    int
+}
+
+// Create a new Index sampling seeds from the provided sequences with sampler.
+func New(sampler Sampler, seqs ...*seq.Seq) (*Index, error) {
+	switch {
+	case sampler == nil:
+		return nil, bio.NewError("minimizer: no sampler", 0)
+	case len(seqs) == 0:
+		return nil, bio.NewError("minimizer: no sequences to index", 0)
+	}
+	return &Index{Seqs: seqs, Sampler: sampler}, nil
+}
+
+// Build the sorted seed table.
+func (self *Index) Build() {
+	self.hashes, self.hits = self.hashes[:0], self.hits[:0]
+	for i, s := range self.Seqs {
+		for _, sd := range self.Sampler.Sample(s.Seq) {
+			self.hashes = append(self.hashes, sd.Hash)
+			self.hits = append(self.hits, hitPos{seq: int32(i), strand: sd.Strand, pos: sd.Pos})
+		}
+	}
+	sort.Sort(seedHits{self})
+	self.indexed = true
+}
+
+type seedHits struct{ *Index }
+
+func (self seedHits) Len() int { return len(self.hashes) }
+func (self seedHits) Less(i, j int) bool {
+	switch {
+	case self.hashes[i] != self.hashes[j]:
+		return self.hashes[i] < self.hashes[j]
+	case self.hits[i].seq != self.hits[j].seq:
+		return self.hits[i].seq < self.hits[j].seq
+	}
+	return self.hits[i].pos < self.hits[j].pos
+}
+func (self seedHits) Swap(i, j int) {
+	self.hashes[i], self.hashes[j] = self.hashes[j], self.hashes[i]
+	self.hits[i], self.hits[j] = self.hits[j], self.hits[i]
+}
+
+// Return the number of seeds held by the Index.
+func (self *Index) Len() int { return len(self.hashes) }
+
+// Return the hits for the seed hash h ordered by sequence index and position.
+func (self *Index) Hits(h uint64) (hits []Hit, err error) {
+	if !self.indexed {
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+	lo, hi := self.span(h)
+	for _, hp := range self.hits[lo:hi] {
+		hits = append(hits, Hit{Index: int(hp.seq), Pos: hp.pos, Strand: hp.strand})
+	}
+	return
+}
+
+func (self *Index) span(h uint64) (lo, hi int) {
+	lo = sort.Search(len(self.hashes), func(i int) bool { return self.hashes[i] >= h })
+	for hi = lo; hi < len(self.hashes) && self.hashes[hi] == h; hi++ {
+	}
+	return
+}
+
+// An Anchor is a seed match between a query and a reference sequence.
+type Anchor struct {
+	Target int  // Index of the reference sequence.
+	TPos   int  // Position of the seed on the forward strand of the reference.
+	QPos   int  // Position of the seed on the forward strand of the query.
+	Strand int8 // Strand of the query relative to the reference.
+}
+
+// Return the anchors of query q against the Index, ordered by target, strand and target
+// position. Seeds occurring more than MaxOcc times in the Index are ignored.
+func (self *Index) Anchors(q []byte) (anchors []Anchor, err error) {
+	if !self.indexed {
+		return nil, bio.NewError("Index not built: call Build()", 0, self)
+	}
+	for _, sd := range self.Sampler.Sample(q) {
+		lo, hi := self.span(sd.Hash)
+		if self.MaxOcc > 0 && hi-lo > self.MaxOcc {
+			continue
+		}
+		for _, hp := range self.hits[lo:hi] {
+			anchors = append(anchors, Anchor{
+				Target: int(hp.seq),
+				TPos:   hp.pos,
+				QPos:   sd.Pos,
+				Strand: sd.Strand * hp.strand,
+			})
+		}
+	}
+	sort.Sort(anchorOrder(anchors))
+	return
+}
+
+type anchorOrder []Anchor
+
+func (self anchorOrder) Len() int { return len(self) }
+func (self anchorOrder) Less(i, j int) bool {
+	a, b := self[i], self[j]
+	switch {
+	case a.Target != b.Target:
+		return a.Target < b.Target
+	case a.Strand != b.Strand:
+		return a.Strand > b.Strand
+	case a.TPos != b.TPos:
+		return a.TPos < b.TPos
+	}
+	return a.QPos < b.QPos
+}
+func (self anchorOrder) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
@@ -0,0 +1,240 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package minimizer provides minimizer and syncmer sampling of nucleic acid k-mers, a seed
+// index over many reference sequences and collinear chaining of seed anchors, as described in:
+//  Reducing storage requirements for biological sequence comparison.
+//   M. Roberts, W. Hayes, B. R. Hunt, et al. Bioinformatics 20:3363-3369 (2004).
+//  Syncmers are more sensitive than minimizers for selecting conserved k-mers in biological sequences.
+//   R. Edgar. PeerJ 9:e10805 (2021).
+//  Minimap2: pairwise alignment for nucleotide sequences.
+//   H. Li. Bioinformatics 34:3094-3100 (2018).
+//
+// K-mers are sampled in canonical form so that seeds match on either strand. K-mers containing
+// bases other than A, C, G and T, and k-mers equal to their own reverse complement, are not sampled.
+package minimizer
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/index/kmerindex"
+	"fmt"
+)
+
+// A Seed is a sampled k-mer.
+type Seed struct {
+	Hash   uint64 // Hash of the canonical k-mer.
+	Pos    int    // Position of the k-mer on the forward strand.
+	Strand int8   // Strand of the k-mer relative to its canonical form.
+}
+
+// A Sampler selects seeds from a sequence.
+type Sampler interface {
+	KmerLen() int
+	Sample(s []byte) []Seed
+}
+
+// hash is an invertible integer hash of a k-mer of length k.
+func hash(kmer kmerindex.Kmer64, k int) uint64 {
+	mask := ^uint64(0) >> uint(64-2*k)
+	h := uint64(kmer)
+	h = (^h + (h << 21)) & mask
+	h ^= h >> 24
+	h = (h + (h << 3) + (h << 8)) & mask
+	h ^= h >> 14
+	h = (h + (h << 2) + (h << 4)) & mask
+	h ^= h >> 28
+	h = (h + (h << 31)) & mask
+	return h
+}
+
+// kmers calls f with the hash and strand of each canonical k-mer of s, and whether the k-mer
+// is contiguous with the previously reported k-mer.
+func kmers(s []byte, k int, f func(pos int, h uint64, strand int8, contiguous bool)) {
+	last := -2
+	kmerindex.ForEachKmer64(k, s, func(pos int, kmer, rc kmerindex.Kmer64) {
+		if kmer == rc {
+			return
+		}
+		c, strand := kmerindex.CanonicalOf64(kmer, rc)
+		f(pos, hash(c, k), strand, pos == last+1)
+		last = pos
+	})
+}
+
+// window is a sliding window minimum over seeds.
+type window struct {
+	q          []Seed
+	head, seen int
+}
+
+func (self *window) reset() { self.q, self.head, self.seen = self.q[:0], 0, 0 }
+
+// push adds a seed to the window, expiring seeds at or before expire.
+func (self *window) push(s Seed, expire int) {
+	for len(self.q) > self.head && self.q[len(self.q)-1].Hash > s.Hash {
+		self.q = self.q[:len(self.q)-1]
+	}
+	self.q = append(self.q, s)
+	for self.q[self.head].Pos <= expire {
+		self.head++
+	}
+	self.seen++
+	if self.head > len(self.q)/2 && self.head > 64 {
+		self.q = append(self.q[:0], self.q[self.head:]...)
+		self.head = 0
+	}
+}
+
+func (self *window) min() Seed { return self.q[self.head] }
+
+// Window is a (w,k)-minimizer Sampler selecting the k-mer with the smallest hash in each
+// window of W consecutive k-mers. Ties are broken in favour of the leftmost k-mer.
+type Window struct {
+	W, K int
+}
+
+// Return a new Window sampler.
+func NewWindow(w, k int) (Window, error) {
+	switch {
+	case w < 1:
+		return Window{}, bio.NewError(fmt.Sprintf("minimizer: illegal window: %d", w), 0, w)
+	case k < kmerindex.MinKmerLen || k > kmerindex.MaxKmerLen64:
+		return Window{}, bio.NewError(fmt.Sprintf("minimizer: illegal k: %d", k), 0, k)
+	}
+	return Window{W: w, K: k}, nil
+}
+
+// Return the k-mer length of the sampler.
+func (self Window) KmerLen() int { return self.K }
+
+// Return the minimizers of s in order of position. A run of fewer than W consecutive k-mers
+// contributes its single smallest k-mer.
+func (self Window) Sample(s []byte) (seeds []Seed) {
+	var win window
+	last := -1
+	emit := func() {
+		if m := win.min(); m.Pos != last {
+			seeds = append(seeds, m)
+			last = m.Pos
+		}
+	}
+	kmers(s, self.K, func(pos int, h uint64, strand int8, contiguous bool) {
+		if !contiguous {
+			if win.seen > 0 && win.seen < self.W {
+				emit()
+			}
+			win.reset()
+		}
+		win.push(Seed{Hash: h, Pos: pos, Strand: strand}, pos-self.W)
+		if win.seen >= self.W {
+			emit()
+		}
+	})
+	if win.seen > 0 && win.seen < self.W {
+		emit()
+	}
+	return
+}
+
+// Syncmer is a Sampler selecting k-mers whose smallest s-mer, of length S, starts at one
+// of the given Offsets within the k-mer. Closed syncmers have offsets 0 and K-S; open
+// syncmers have a single offset. Selection is strand independent only when the offsets are
+// symmetric within the k-mer, as they are for closed syncmers.
+type Syncmer struct {
+	K, S    int
+	Offsets []int
+}
+
+// Return a new closed syncmer sampler.
+func NewClosedSyncmer(k, s int) (Syncmer, error) {
+	return NewSyncmer(k, s, 0, k-s)
+}
+
+// Return a new syncmer sampler with the specified s-mer offsets.
+func NewSyncmer(k, s int, offsets ...int) (Syncmer, error) {
+	switch {
+	case k < kmerindex.MinKmerLen || k > kmerindex.MaxKmerLen64:
+		return Syncmer{}, bio.NewError(fmt.Sprintf("minimizer: illegal k: %d", k), 0, k)
+	case s < 1 || s > k:
+		return Syncmer{}, bio.NewError(fmt.Sprintf("minimizer: illegal s: %d", s), 0, s)
+	case len(offsets) == 0:
+		return Syncmer{}, bio.NewError("minimizer: no syncmer offsets", 0)
+	}
+	for _, o := range offsets {
+		if o < 0 || o > k-s {
+			return Syncmer{}, bio.NewError(fmt.Sprintf("minimizer: illegal syncmer offset: %d", o), 0, o)
+		}
+	}
+	return Syncmer{K: k, S: s, Offsets: offsets}, nil
+}
+
+// Return the k-mer length of the sampler.
+func (self Syncmer) KmerLen() int { return self.K }
+
+// Return the syncmers of s in order of position.
+func (self Syncmer) Sample(s []byte) (seeds []Seed) {
+	// s-mers are hashed in canonical form, including palindromes, so that selection is
+	// strand independent.
+	var (
+		smers []uint64
+		start int
+		win   window
+		n     = self.K - self.S + 1
+	)
+	flush := func() {
+		win.reset()
+		for i, h := range smers {
+			win.push(Seed{Hash: h, Pos: i}, i-n)
+			if i < n-1 {
+				continue
+			}
+			pos := i - n + 1
+			// Any s-mer equal to the minimum at an offset selects the k-mer so that
+			// selection is strand independent when the minimum is not unique.
+			min := win.min().Hash
+			sel := false
+			for _, o := range self.Offsets {
+				if smers[pos+o] == min {
+					sel = true
+					break
+				}
+			}
+			if !sel {
+				continue
+			}
+			w := s[start+pos : start+pos+self.K]
+			kmerindex.ForEachKmer64(self.K, w, func(_ int, kmer, rc kmerindex.Kmer64) {
+				if kmer == rc {
+					return
+				}
+				c, strand := kmerindex.CanonicalOf64(kmer, rc)
+				seeds = append(seeds, Seed{Hash: hash(c, self.K), Pos: start + pos, Strand: strand})
+			})
+		}
+		smers = smers[:0]
+	}
+	last := -2
+	kmerindex.ForEachKmer64(self.S, s, func(pos int, kmer, rc kmerindex.Kmer64) {
+		if pos != last+1 {
+			flush()
+			start = pos
+		}
+		c, _ := kmerindex.CanonicalOf64(kmer, rc)
+		smers = append(smers, hash(c, self.S))
+		last = pos
+	})
+	flush()
+	return
+}
@@ -0,0 +1,253 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package minimizer
+
+import (
+	"code.google.com/p/biogo/index/kmerindex"
+	"code.google.com/p/biogo/seq"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Helpers
+func random(n int, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rnd.Intn(4)]
+	}
+	return s
+}
+
+var comp = [256]byte{'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A', 'N': 'N'}
+
+func revComp(s []byte) []byte {
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = comp[b]
+	}
+	return r
+}
+
+// mutate introduces substitutions and single base indels at rate r.
+func mutate(s []byte, r float64, rnd *rand.Rand) []byte {
+	var m []byte
+	for _, b := range s {
+		switch x := rnd.Float64(); {
+		case x < r/3:
+			m = append(m, "ACGT"[rnd.Intn(4)])
+		case x < 2*r/3:
+		case x < r:
+			m = append(m, b, "ACGT"[rnd.Intn(4)])
+		default:
+			m = append(m, b)
+		}
+	}
+	return m
+}
+
+func hashes(seeds []Seed) []uint64 {
+	h := make([]uint64, len(seeds))
+	for i, s := range seeds {
+		h[i] = s.Hash
+	}
+	sort.Sort(uint64s(h))
+	return h
+}
+
+type uint64s []uint64
+
+func (self uint64s) Len() int           { return len(self) }
+func (self uint64s) Less(i, j int) bool { return self[i] < self[j] }
+func (self uint64s) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+type kmer struct {
+	pos    int
+	h      uint64
+	strand int8
+}
+
+func allKmers(s []byte, k int) (km []kmer) {
+	kmerindex.ForEachKmer64(k, s, func(pos int, f, rc kmerindex.Kmer64) {
+		c, strand := kmerindex.CanonicalOf64(f, rc)
+		km = append(km, kmer{pos, hash(c, k), strand})
+	})
+	return
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestHash(c *check.C) {
+	// The hash is invertible, so distinct k-mers have distinct hashes.
+	seen := make(map[uint64]bool)
+	for km := kmerindex.Kmer64(0); km < 1<<12; km++ {
+		h := hash(km, 6)
+		c.Check(h < 1<<12, check.Equals, true)
+		c.Check(seen[h], check.Equals, false)
+		seen[h] = true
+	}
+}
+
+func (s *S) TestWindow(c *check.C) {
+	_, err := NewWindow(0, 15)
+	c.Check(err, check.NotNil)
+	_, err = NewWindow(10, 33)
+	c.Check(err, check.NotNil)
+
+	rnd := rand.New(rand.NewSource(1))
+	b := random(5000, rnd)
+	for _, w := range []int{1, 5, 10} {
+		win, err := NewWindow(w, 15)
+		c.Assert(err, check.Equals, nil)
+		seeds := win.Sample(b)
+		km := allKmers(b, 15)
+
+		// Every seed is the leftmost minimum of some window and every window contains a seed.
+		expect := make(map[int]bool)
+		for i := 0; i+w <= len(km); i++ {
+			m := i
+			for j := i; j < i+w; j++ {
+				if km[j].h < km[m].h {
+					m = j
+				}
+			}
+			expect[km[m].pos] = true
+		}
+		c.Check(len(seeds), check.Equals, len(expect))
+		for i, sd := range seeds {
+			c.Check(expect[sd.Pos], check.Equals, true)
+			c.Check(sd.Hash, check.Equals, km[sd.Pos].h)
+			c.Check(sd.Strand, check.Equals, km[sd.Pos].strand)
+			if i > 0 {
+				c.Check(sd.Pos > seeds[i-1].Pos, check.Equals, true)
+			}
+		}
+		if w > 1 {
+			// Expected density is 2/(w+1).
+			d := float64(len(seeds)) / float64(len(km))
+			c.Check(d < 1.2*2/float64(w+1), check.Equals, true, check.Commentf("density %f", d))
+		}
+
+		c.Check(hashes(win.Sample(revComp(b))), check.DeepEquals, hashes(seeds))
+	}
+
+	// Ambiguous bases split the sequence into separately sampled runs.
+	win, _ := NewWindow(10, 5)
+	seeds := win.Sample([]byte("ACGTTGCANACGGT"))
+	c.Check(len(seeds), check.Equals, 2)
+	c.Check(seeds[0].Pos < 4, check.Equals, true)
+	c.Check(seeds[1].Pos > 8, check.Equals, true)
+}
+
+func (s *S) TestSyncmer(c *check.C) {
+	for _, t := range [][3]int{{15, 0, 0}, {15, 16, 0}, {15, 5, 11}} {
+		_, err := NewSyncmer(t[0], t[1], t[2])
+		c.Check(err, check.NotNil)
+	}
+	_, err := NewSyncmer(15, 5)
+	c.Check(err, check.NotNil)
+
+	rnd := rand.New(rand.NewSource(1))
+	b := random(5000, rnd)
+	const k, sl = 15, 5
+	sync, err := NewClosedSyncmer(k, sl)
+	c.Assert(err, check.Equals, nil)
+	seeds := sync.Sample(b)
+	km := allKmers(b, k)
+	sm := allKmers(b, sl)
+	var n int
+	for i := range km {
+		min := sm[i].h
+		for j := i; j <= i+k-sl; j++ {
+			if sm[j].h < min {
+				min = sm[j].h
+			}
+		}
+		if sm[i].h != min && sm[i+k-sl].h != min {
+			continue
+		}
+		c.Assert(n < len(seeds), check.Equals, true)
+		c.Check(seeds[n].Pos, check.Equals, i)
+		c.Check(seeds[n].Hash, check.Equals, km[i].h)
+		n++
+	}
+	c.Check(n, check.Equals, len(seeds))
+	// Expected density is 2/(k-s+1).
+	d := float64(len(seeds)) / float64(len(km))
+	c.Check(d < 1.2*2/float64(k-sl+1), check.Equals, true, check.Commentf("density %f", d))
+	c.Check(hashes(sync.Sample(revComp(b))), check.DeepEquals, hashes(seeds))
+}
+
+func (s *S) TestIndex(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	var refs []*seq.Seq
+	for _, id := range []string{"a", "b", "c"} {
+		refs = append(refs, seq.New(id, random(20000, rnd), nil))
+	}
+	win, _ := NewWindow(10, 15)
+	sync, _ := NewClosedSyncmer(15, 9)
+	for _, sampler := range []Sampler{win, sync} {
+		idx, err := New(sampler, refs...)
+		c.Assert(err, check.Equals, nil)
+		_, err = idx.Anchors(refs[0].Seq[:100])
+		c.Check(err, check.NotNil)
+		idx.Build()
+		c.Check(idx.Len() < 3*20000/3, check.Equals, true)
+
+		for _, sd := range sampler.Sample(refs[2].Seq[:1000]) {
+			hits, err := idx.Hits(sd.Hash)
+			c.Check(err, check.Equals, nil)
+			found := false
+			for _, h := range hits {
+				found = found || (h.Index == 2 && h.Pos == sd.Pos && h.Strand == sd.Strand)
+			}
+			c.Check(found, check.Equals, true)
+		}
+
+		for _, strand := range []int8{1, -1} {
+			q := mutate(refs[1].Seq[5000:10000], 0.05, rnd)
+			if strand < 0 {
+				q = revComp(q)
+			}
+			anchors, err := idx.Anchors(q)
+			c.Assert(err, check.Equals, nil)
+			chains := DefaultChainer.Chain(anchors, sampler.KmerLen(), len(q))
+			c.Assert(len(chains) > 0, check.Equals, true)
+			best := chains[0]
+			c.Check(best.Target, check.Equals, 1)
+			c.Check(best.Strand, check.Equals, strand)
+			c.Check(best.TStart-5000 < 200 && best.TStart >= 5000-20, check.Equals, true, check.Commentf("%d", best.TStart))
+			c.Check(10000-best.TEnd < 200 && best.TEnd <= 10000+20, check.Equals, true, check.Commentf("%d", best.TEnd))
+			c.Check(best.QEnd-best.QStart > 4500, check.Equals, true)
+			for i, a := range best.Anchors {
+				c.Check(a.Target, check.Equals, 1)
+				if i > 0 {
+					c.Check(a.TPos > best.Anchors[i-1].TPos, check.Equals, true)
+					c.Check((a.QPos > best.Anchors[i-1].QPos) == (strand > 0), check.Equals, true)
+				}
+			}
+			for _, ch := range chains[1:] {
+				c.Check(ch.Score < best.Score/4, check.Equals, true)
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package interval
+
+import (
+	"code.google.com/p/biogo/util"
+	"math/rand"
+)
+
+// An IntRange is a range of positions.
+type IntRange struct {
+	Start, End int
+}
+
+// An IntOverlapper can determine whether it overlaps an IntRange. Overlap must return true for
+// any range that encloses a range for which Overlap would return true, since it is used to
+// prune subtrees during DoMatching.
+type IntOverlapper interface {
+	Overlap(IntRange) bool
+}
+
+// An IntRanger returns an IntRange.
+type IntRanger interface {
+	Range() IntRange
+}
+
+// An IntInterface is a type that can be inserted into an IntTree. ID must be unique for
+// intervals sharing a start position.
+type IntInterface interface {
+	IntOverlapper
+	IntRanger
+	ID() uintptr
+}
+
+// An IntOperation is a function that operates on an IntInterface. If done is returned true,
+// the IntOperation is indicating that no further work needs to be done and so the Do or
+// DoMatching method should traverse no further.
+type IntOperation func(IntInterface) (done bool)
+
+// An IntTree is a copy-on-write interval tree. Mutating operations never alter existing
+// nodes; changed paths are copied, so a Snapshot of an IntTree is cheap and remains valid
+// and unchanged regardless of later Insert or Delete calls on the tree it was taken from.
+//
+// An IntTree and its snapshots may be read concurrently by any number of goroutines.
+// Concurrent writes to the same IntTree value must be serialised by the caller.
+type IntTree struct {
+	root  *intNode
+	count int
+}
+
+type intNode struct {
+	elem        IntInterface
+	span        IntRange // Range spanned by the node's subtree.
+	priority    int
+	left, right *intNode
+}
+
+// Return a new empty IntTree.
+func NewIntTree() *IntTree {
+	return &IntTree{}
+}
+
+// Snapshot returns an immutable view of the tree as it is at the time of the call.
+// The returned tree may itself be mutated without affecting the receiver.
+func (self *IntTree) Snapshot() *IntTree {
+	return &IntTree{root: self.root, count: self.count}
+}
+
+// Len returns the number of intervals stored in the tree.
+func (self *IntTree) Len() int { return self.count }
+
+// Range returns the range spanned by all intervals in the tree.
+func (self *IntTree) Range() (r IntRange) {
+	if self.root != nil {
+		r = self.root.span
+	}
+
+	return
+}
+
+// Insert an interval into the tree. An interval with the same start and ID as e is replaced.
+func (self *IntTree) Insert(e IntInterface) {
+	var added bool
+	self.root, added = self.root.insert(e, rand.Int())
+	if added {
+		self.count++
+	}
+}
+
+// Delete the interval with the same start and ID as e from the tree.
+func (self *IntTree) Delete(e IntInterface) {
+	var deleted bool
+	self.root, deleted = self.root.delete(e)
+	if deleted {
+		self.count--
+	}
+}
+
+// Get returns all intervals in the tree that overlap q.
+func (self *IntTree) Get(q IntOverlapper) (o []IntInterface) {
+	self.DoMatching(func(e IntInterface) (done bool) {
+		o = append(o, e)
+		return
+	}, q)
+
+	return
+}
+
+// Do performs fn on all intervals stored in the tree in start order. A boolean is returned
+// indicating whether the traversal was interrupted by fn returning true.
+func (self *IntTree) Do(fn IntOperation) bool {
+	if self.root == nil {
+		return false
+	}
+	return self.root.do(fn)
+}
+
+// DoMatching performs fn on all intervals stored in the tree that overlap q, in start order.
+// A boolean is returned indicating whether the traversal was interrupted by fn returning true.
+func (self *IntTree) DoMatching(fn IntOperation, q IntOverlapper) bool {
+	if self.root == nil || !q.Overlap(self.root.span) {
+		return false
+	}
+	return self.root.doMatch(fn, q)
+}
+
+func compareInt(a, b IntInterface) int {
+	ra, rb := a.Range(), b.Range()
+	switch {
+	case ra.Start < rb.Start:
+		return -1
+	case ra.Start > rb.Start:
+		return 1
+	case a.ID() < b.ID():
+		return -1
+	case a.ID() > b.ID():
+		return 1
+	}
+	return 0
+}
+
+func (self *intNode) clone() *intNode {
+	c := *self
+	return &c
+}
+
+func (self *intNode) adjustSpan() {
+	self.span = self.elem.Range()
+	if self.left != nil {
+		self.span.Start = util.Min(self.span.Start, self.left.span.Start)
+		self.span.End = util.Max(self.span.End, self.left.span.End)
+	}
+	if self.right != nil {
+		self.span.Start = util.Min(self.span.Start, self.right.span.Start)
+		self.span.End = util.Max(self.span.End, self.right.span.End)
+	}
+}
+
+// Insert e into a copy of the subtree rooted at the receiver, returning the new root.
+// Only nodes on the insertion path are copied.
+func (self *intNode) insert(e IntInterface, priority int) (root *intNode, added bool) {
+	if self == nil {
+		return &intNode{elem: e, span: e.Range(), priority: priority}, true
+	}
+
+	root = self.clone()
+	switch c := compareInt(e, self.elem); {
+	case c < 0:
+		root.left, added = self.left.insert(e, priority)
+		if root.left.priority > root.priority {
+			root = root.rotateRight()
+		}
+	case c > 0:
+		root.right, added = self.right.insert(e, priority)
+		if root.right.priority > root.priority {
+			root = root.rotateLeft()
+		}
+	default:
+		root.elem = e
+	}
+	root.adjustSpan()
+
+	return
+}
+
+// Rotations are only ever applied to freshly copied nodes.
+func (self *intNode) rotateRight() (root *intNode) {
+	root = self.left
+	self.left, root.right = root.right, self
+	self.adjustSpan()
+
+	return
+}
+
+func (self *intNode) rotateLeft() (root *intNode) {
+	root = self.right
+	self.right, root.left = root.left, self
+	self.adjustSpan()
+
+	return
+}
+
+// Delete e from a copy of the subtree rooted at the receiver, returning the new root.
+func (self *intNode) delete(e IntInterface) (root *intNode, deleted bool) {
+	if self == nil {
+		return nil, false
+	}
+
+	switch c := compareInt(e, self.elem); {
+	case c < 0:
+		var left *intNode
+		if left, deleted = self.left.delete(e); !deleted {
+			return self, false
+		}
+		root = self.clone()
+		root.left = left
+	case c > 0:
+		var right *intNode
+		if right, deleted = self.right.delete(e); !deleted {
+			return self, false
+		}
+		root = self.clone()
+		root.right = right
+	default:
+		return joinInt(self.left, self.right), true
+	}
+	root.adjustSpan()
+
+	return
+}
+
+// Join two subtrees where all elements of a sort before all elements of b.
+func joinInt(a, b *intNode) (root *intNode) {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.priority > b.priority:
+		root = a.clone()
+		root.right = joinInt(a.right, b)
+	default:
+		root = b.clone()
+		root.left = joinInt(a, b.left)
+	}
+	root.adjustSpan()
+
+	return
+}
+
+func (self *intNode) do(fn IntOperation) (done bool) {
+	if self.left != nil {
+		if done = self.left.do(fn); done {
+			return
+		}
+	}
+	if done = fn(self.elem); done {
+		return
+	}
+	if self.right != nil {
+		done = self.right.do(fn)
+	}
+
+	return
+}
+
+func (self *intNode) doMatch(fn IntOperation, q IntOverlapper) (done bool) {
+	if self.left != nil && q.Overlap(self.left.span) {
+		if done = self.left.doMatch(fn, q); done {
+			return
+		}
+	}
+	if q.Overlap(self.elem.Range()) {
+		if done = fn(self.elem); done {
+			return
+		}
+	}
+	if self.right != nil && q.Overlap(self.right.span) {
+		done = self.right.doMatch(fn, q)
+	}
+
+	return
+}
@@ -0,0 +1,115 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package interval
+
+import (
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"sync"
+)
+
+type intIv struct {
+	start, end int
+	id         uintptr
+}
+
+func (i *intIv) Overlap(b IntRange) bool { return i.end >= b.Start && i.start <= b.End }
+func (i *intIv) ID() uintptr              { return i.id }
+func (i *intIv) Range() IntRange          { return IntRange{Start: i.start, End: i.end} }
+
+func randomIntIvs(n, iLength, locRange int) (ivs []*intIv) {
+	ivs = make([]*intIv, n)
+	for j := range ivs {
+		start := rand.Intn(locRange)
+		ivs[j] = &intIv{start: start, end: start + rand.Intn(iLength), id: uintptr(j)}
+	}
+
+	return
+}
+
+func checkIntTree(c *check.C, t *IntTree, ivs []*intIv) {
+	var (
+		count int
+		last  = -1
+	)
+	t.Do(func(e IntInterface) (done bool) {
+		c.Check(e.Range().Start >= last, check.Equals, true)
+		last = e.Range().Start
+		count++
+		return
+	})
+	c.Check(count, check.Equals, len(ivs))
+	c.Check(t.Len(), check.Equals, len(ivs))
+
+	for i := 0; i < 100; i++ {
+		q := randomIntIvs(1, 1e3, 1e4)[0]
+		exhaustive := 0
+		for _, iv := range ivs {
+			if q.Overlap(iv.Range()) {
+				exhaustive++
+			}
+		}
+		got := t.Get(q)
+		for _, e := range got {
+			c.Check(q.Overlap(e.Range()), check.Equals, true)
+		}
+		c.Check(len(got), check.Equals, exhaustive)
+	}
+}
+
+func (s *S) TestIntTreeInsertDelete(c *check.C) {
+	ivs := randomIntIvs(1e3, 1e2, 1e4)
+	t := NewIntTree()
+	for _, iv := range ivs {
+		t.Insert(iv)
+	}
+	checkIntTree(c, t, ivs)
+
+	for _, iv := range ivs[:500] {
+		t.Delete(iv)
+	}
+	checkIntTree(c, t, ivs[500:])
+	t.Delete(ivs[0])
+	c.Check(t.Len(), check.Equals, 500)
+}
+
+func (s *S) TestIntTreeSnapshot(c *check.C) {
+	ivs := randomIntIvs(1e3, 1e2, 1e4)
+	t := NewIntTree()
+	for _, iv := range ivs[:500] {
+		t.Insert(iv)
+	}
+	snap := t.Snapshot()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkIntTree(c, snap, ivs[:500])
+		}()
+	}
+	for _, iv := range ivs[500:] {
+		t.Insert(iv)
+	}
+	for _, iv := range ivs[:250] {
+		t.Delete(iv)
+	}
+	wg.Wait()
+
+	checkIntTree(c, snap, ivs[:500])
+	checkIntTree(c, t, ivs[250:])
+}
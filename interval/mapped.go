@@ -0,0 +1,396 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package interval
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+)
+
+// The on-disk index is a header followed by fixed width little-endian records. The header is:
+//
+//  magic    [8]byte
+//  segments uint64
+//  for each segment:
+//   length  uint64 - length of name
+//   name    []byte - padded with zeros to a multiple of 8 bytes
+//   count   uint64 - number of records
+//   level   uint64 - height of the implicit tree
+//
+// Records for each segment follow in segment order, sorted by start. Each record holds start,
+// end, line and the maximum end of its implicit subtree as int64, so that the records form an
+// augmented implicit interval tree (Li, H. cgranges) that can be searched in place.
+var mappedMagic = [8]byte{'b', 'g', 'i', 'v', 'l', 0, 0, 1}
+
+const (
+	recordFields = 4
+	recordSize   = recordFields * 8
+	scanLevel    = 3 // Subtrees of this height or less are scanned linearly.
+)
+
+type mappedRecord struct {
+	start, end, line, maxEnd int64
+}
+
+type mappedSegment struct {
+	offset int // Byte offset of the first record.
+	count  int
+	level  int
+}
+
+// WriteTo writes the contents of the Tree to w in a form that can be opened by OpenMapped.
+// Interval Meta data is not retained; the line value of each interval is stored and may be
+// used to refer back to the source of the interval.
+func (self Tree) WriteTo(w io.Writer) (n int64, err error) {
+	segs := make([]string, 0, len(self))
+	for seg := range self {
+		segs = append(segs, seg)
+	}
+	sort.Strings(segs)
+
+	recs := make([][]mappedRecord, len(segs))
+	levels := make([]int, len(segs))
+	for i, seg := range segs {
+		for iv := range self.Traverse(seg) {
+			recs[i] = append(recs[i], mappedRecord{start: int64(iv.start), end: int64(iv.end), line: int64(iv.line)})
+		}
+		levels[i] = indexRecords(recs[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	put := func(v uint64) {
+		if err == nil {
+			err = binary.Write(cw, binary.LittleEndian, v)
+		}
+	}
+	if _, err = cw.Write(mappedMagic[:]); err != nil {
+		return cw.n, err
+	}
+	put(uint64(len(segs)))
+	for i, seg := range segs {
+		put(uint64(len(seg)))
+		if err == nil {
+			_, err = cw.Write(append([]byte(seg), make([]byte, pad8(len(seg))-len(seg))...))
+		}
+		put(uint64(len(recs[i])))
+		put(uint64(levels[i]))
+	}
+	for _, rs := range recs {
+		for _, r := range rs {
+			put(uint64(r.start))
+			put(uint64(r.end))
+			put(uint64(r.line))
+			put(uint64(r.maxEnd))
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	return cw.n, err
+}
+
+// WriteFile writes the contents of the Tree to the named file, truncating any existing file.
+func (self Tree) WriteFile(name string) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	if _, err = self.WriteTo(f); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (self *countWriter) Write(b []byte) (n int, err error) {
+	n, err = self.w.Write(b)
+	self.n += int64(n)
+	return
+}
+
+func pad8(n int) int { return (n + 7) &^ 7 }
+
+// Calculate the maxEnd fields of a start sorted slice of records, returning the height of the
+// implicit tree.
+func indexRecords(a []mappedRecord) (level int) {
+	n := len(a)
+	if n == 0 {
+		return -1
+	}
+
+	var lastI int
+	var last int64
+	for i := 0; i < n; i += 2 {
+		lastI, a[i].maxEnd, last = i, a[i].end, a[i].end
+	}
+	for level = 1; 1<<uint(level) <= n; level++ {
+		x := 1 << uint(level-1)
+		for i := (x << 1) - 1; i < n; i += x << 2 {
+			e := a[i].end
+			if a[i-x].maxEnd > e {
+				e = a[i-x].maxEnd
+			}
+			if i+x < n {
+				if a[i+x].maxEnd > e {
+					e = a[i+x].maxEnd
+				}
+			} else if last > e {
+				e = last
+			}
+			a[i].maxEnd = e
+		}
+		if (lastI>>uint(level))&1 != 0 {
+			lastI -= x
+		} else {
+			lastI += x
+		}
+		if lastI < n && a[lastI].maxEnd > last {
+			last = a[lastI].maxEnd
+		}
+	}
+
+	return level - 1
+}
+
+// A MappedTree is an immutable interval index backed by a file written by Tree.WriteTo. Where
+// supported by the operating system the file is memory-mapped, so opening an index does not
+// require it to be rebuilt or read into memory. A MappedTree is safe for concurrent use.
+type MappedTree struct {
+	data     []byte
+	segments map[string]mappedSegment
+	unmap    func() error
+}
+
+// Open a file written by Tree.WriteTo or Tree.WriteFile as a MappedTree.
+func OpenMapped(name string) (*MappedTree, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedTree{data: data, unmap: unmap}
+	if err = m.readHeader(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (self *MappedTree) readHeader() error {
+	var off int
+	next := func() (v int, ok bool) {
+		if off+8 > len(self.data) {
+			return 0, false
+		}
+		v = int(binary.LittleEndian.Uint64(self.data[off:]))
+		off += 8
+		return v, true
+	}
+
+	if len(self.data) < len(mappedMagic) || string(self.data[:len(mappedMagic)]) != string(mappedMagic[:]) {
+		return bio.NewError("interval: not a mapped interval index", 0)
+	}
+	off = len(mappedMagic)
+	n, ok := next()
+	if !ok {
+		return bio.NewError("interval: truncated index header", 0)
+	}
+
+	type entry struct {
+		name         string
+		count, level int
+	}
+	entries := make([]entry, 0, n)
+	for i := 0; i < n; i++ {
+		l, ok := next()
+		if !ok || off+pad8(l) > len(self.data) {
+			return bio.NewError("interval: truncated index header", 0, i)
+		}
+		e := entry{name: string(self.data[off : off+l])}
+		off += pad8(l)
+		if e.count, ok = next(); !ok {
+			return bio.NewError("interval: truncated index header", 0, i)
+		}
+		if e.level, ok = next(); !ok {
+			return bio.NewError("interval: truncated index header", 0, i)
+		}
+		entries = append(entries, e)
+	}
+
+	self.segments = make(map[string]mappedSegment, n)
+	for _, e := range entries {
+		self.segments[e.name] = mappedSegment{offset: off, count: e.count, level: e.level}
+		off += e.count * recordSize
+	}
+	if off > len(self.data) {
+		return bio.NewError("interval: truncated index records", 0, off, len(self.data))
+	}
+
+	return nil
+}
+
+// Close releases the resources held by the MappedTree. The MappedTree must not be used after
+// Close has been called.
+func (self *MappedTree) Close() (err error) {
+	if self.unmap != nil {
+		err = self.unmap()
+	}
+	self.data, self.segments, self.unmap = nil, nil, nil
+
+	return
+}
+
+// Return the names of the segments held by the index in sorted order.
+func (self *MappedTree) Segments() []string {
+	segs := make([]string, 0, len(self.segments))
+	for seg := range self.segments {
+		segs = append(segs, seg)
+	}
+	sort.Strings(segs)
+
+	return segs
+}
+
+// Return the number of intervals held for a segment.
+func (self *MappedTree) Len(seg string) int {
+	return self.segments[seg].count
+}
+
+func (self *MappedTree) field(s mappedSegment, i, f int) int {
+	return int(int64(binary.LittleEndian.Uint64(self.data[s.offset+i*recordSize+f*8:])))
+}
+
+func (self *MappedTree) interval(seg string, s mappedSegment, i int) *Interval {
+	iv, _ := New(seg, self.field(s, i, 0), self.field(s, i, 1), self.field(s, i, 2), nil)
+	return iv
+}
+
+// Find all intervals in the index that overlap query. Return a channel that will convey results.
+// Intervals are returned in start order and hold the line value stored in the index.
+//
+// The overlap parameter determines how much overlap is required:
+//     overlap < 0 intervals can be up to overlap away
+//     overlap = 0 intervals abut
+//     overlap > 0 intervals must overlap by overlap
+func (self *MappedTree) Intersect(i *Interval, overlap int) (result chan *Interval) {
+	result = make(chan *Interval)
+	go func() {
+		self.DoIntersect(i, overlap, func(iv *Interval) (done bool) {
+			result <- iv
+			return
+		})
+		close(result)
+	}()
+
+	return
+}
+
+// DoIntersect calls fn on each interval in the index that overlaps query, in start order,
+// stopping early if fn returns true. The overlap parameter is interpreted as for Intersect.
+func (self *MappedTree) DoIntersect(i *Interval, overlap int, fn func(*Interval) (done bool)) {
+	s, ok := self.segments[i.seg]
+	if !ok || s.count == 0 {
+		return
+	}
+	var (
+		lo = i.start + overlap // Matching intervals must end at or after lo.
+		hi = i.end - overlap   // Matching intervals must start at or before hi.
+
+		hits  []int
+		stack = []struct{ x, level, visited int }{{(1 << uint(s.level)) - 1, s.level, 0}}
+	)
+	for len(stack) > 0 {
+		z := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch {
+		case z.level <= scanLevel:
+			i0 := z.x >> uint(z.level) << uint(z.level)
+			i1 := i0 + (1 << uint(z.level+1)) - 1
+			if i1 > s.count {
+				i1 = s.count
+			}
+			for j := i0; j < i1 && self.field(s, j, 0) <= hi; j++ {
+				if self.field(s, j, 1) >= lo {
+					hits = append(hits, j)
+				}
+			}
+		case z.visited == 0:
+			y := z.x - (1 << uint(z.level-1))
+			z.visited = 1
+			stack = append(stack, z)
+			if y >= s.count || self.field(s, y, 3) >= lo {
+				stack = append(stack, struct{ x, level, visited int }{y, z.level - 1, 0})
+			}
+		case z.x < s.count && self.field(s, z.x, 0) <= hi:
+			if self.field(s, z.x, 1) >= lo {
+				hits = append(hits, z.x)
+			}
+			stack = append(stack, struct{ x, level, visited int }{z.x + (1 << uint(z.level-1)), z.level - 1, 0})
+		}
+	}
+
+	sort.Ints(hits)
+	for _, j := range hits {
+		if fn(self.interval(i.seg, s, j)) {
+			return
+		}
+	}
+}
+
+// Traverse all intervals for a segment in the index in start order. Return a channel that will
+// convey results.
+func (self *MappedTree) Traverse(seg string) (result chan *Interval) {
+	result = make(chan *Interval)
+	go func() {
+		if s, ok := self.segments[seg]; ok {
+			for j := 0; j < s.count; j++ {
+				result <- self.interval(seg, s, j)
+			}
+		}
+		close(result)
+	}()
+
+	return
+}
+
+// Load the intervals held by the index into a new Tree.
+func (self *MappedTree) Tree() Tree {
+	t := NewTree()
+	for seg, s := range self.segments {
+		for j := 0; j < s.count; j++ {
+			t.Insert(self.interval(seg, s, j))
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,74 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package interval
+
+import (
+	check "launchpad.net/gocheck"
+	"path/filepath"
+)
+
+func (s *S) TestMappedTree(c *check.C) {
+	for _, n := range []int{1, 2, 7, 100, 1e4} {
+		tree := testTree(n, 1e3, 1e2, 1e5)
+		extra, _ := New("other", 10, 20, 42, nil)
+		tree.Insert(extra)
+
+		name := filepath.Join(c.MkDir(), "index")
+		c.Assert(tree.WriteFile(name), check.IsNil)
+		m, err := OpenMapped(name)
+		c.Assert(err, check.IsNil)
+
+		c.Check(m.Segments(), check.DeepEquals, []string{"", "other"})
+		c.Check(m.Len(""), check.Equals, n)
+		c.Check(len(fillSliceWith(m.Traverse(""), n)), check.Equals, n)
+
+		for i := 0; i < 100; i++ {
+			test := randomInterval(1e4, 1e2, 1e5)
+			for _, overlap := range []int{-10, 0, 10} {
+				var want, got []int
+				for seg := range tree.Intersect(test, overlap) {
+					want = append(want, seg.start, seg.end)
+				}
+				last := -1
+				for seg := range m.Intersect(test, overlap) {
+					c.Check(seg.start >= last, check.Equals, true)
+					last = seg.start
+					got = append(got, seg.start, seg.end)
+				}
+				c.Check(len(got), check.Equals, len(want))
+			}
+		}
+
+		q, _ := New("other", 0, 15, 0, nil)
+		hits := fillSliceWith(m.Intersect(q, 0), 1)
+		c.Assert(len(hits), check.Equals, 1)
+		c.Check(hits[0].Line(), check.Equals, 42)
+
+		c.Check(m.Close(), check.IsNil)
+	}
+}
+
+func (s *S) TestMappedTreeBadFile(c *check.C) {
+	name := filepath.Join(c.MkDir(), "index")
+	c.Assert(NewTree().WriteFile(name), check.IsNil)
+	m, err := OpenMapped(name)
+	c.Assert(err, check.IsNil)
+	c.Check(m.Segments(), check.HasLen, 0)
+	c.Check(m.Close(), check.IsNil)
+
+	_, err = OpenMapped("interval.go")
+	c.Check(err, check.NotNil)
+}
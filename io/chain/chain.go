@@ -0,0 +1,257 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package to read and write UCSC chain format files
+package chain
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	strandToChar = map[int8]string{1: "+", -1: "-"}
+	charToStrand = map[string]int8{"+": 1, "-": -1}
+)
+
+// A Block is an ungapped aligned region of a Chain. Query positions are given in the coordinates
+// of the query strand of the Chain.
+type Block struct {
+	TStart, QStart int
+	Size           int
+}
+
+// A Chain is a chained pairwise alignment between a target and a query sequence. Query
+// coordinates are given on the query strand, so for a Chain with QStrand -1 positions are
+// counted from the end of the forward query sequence.
+type Chain struct {
+	Score   float64
+	TName   string
+	TSize   int
+	TStrand int8
+	TStart  int
+	TEnd    int
+	QName   string
+	QSize   int
+	QStrand int8
+	QStart  int
+	QEnd    int
+	ID      int
+	Blocks  []Block
+}
+
+// Return the number of aligned bases in the Chain.
+func (self *Chain) Matches() (n int) {
+	for _, b := range self.Blocks {
+		n += b.Size
+	}
+	return
+}
+
+// Chain format reader type.
+type Reader struct {
+	f    io.ReadCloser
+	r    *bufio.Reader
+	line int
+}
+
+// Returns a new chain format reader using f.
+func NewReader(f io.ReadCloser) *Reader {
+	return &Reader{
+		f: f,
+		r: bufio.NewReader(f),
+	}
+}
+
+// Returns a new chain reader using a filename.
+func NewReaderName(name string) (r *Reader, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	return NewReader(f), nil
+}
+
+func (self *Reader) readLine() (line string, err error) {
+	for {
+		line, err = self.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			} else {
+				return
+			}
+		}
+		self.line++
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' {
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read a single chain and return it or an error.
+func (self *Reader) Read() (c *Chain, err error) {
+	line, err := self.readLine()
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 12 || fields[0] != "chain" {
+		return nil, bio.NewError(fmt.Sprintf("chain: bad header on line %d", self.line), 0, line)
+	}
+
+	c = &Chain{TName: fields[2], QName: fields[7]}
+	var ok bool
+	if c.TStrand, ok = charToStrand[fields[4]]; !ok {
+		return nil, bio.NewError(fmt.Sprintf("chain: bad target strand on line %d", self.line), 0, line)
+	}
+	if c.QStrand, ok = charToStrand[fields[9]]; !ok {
+		return nil, bio.NewError(fmt.Sprintf("chain: bad query strand on line %d", self.line), 0, line)
+	}
+	if c.Score, err = strconv.ParseFloat(fields[1], 64); err != nil {
+		return nil, bio.NewError(fmt.Sprintf("chain: bad score on line %d", self.line), 0, err)
+	}
+	for i, p := range []*int{&c.TSize, nil, &c.TStart, &c.TEnd, nil, &c.QSize, nil, &c.QStart, &c.QEnd} {
+		if p == nil {
+			continue
+		}
+		if *p, err = strconv.Atoi(fields[i+3]); err != nil {
+			return nil, bio.NewError(fmt.Sprintf("chain: bad header field on line %d", self.line), 0, err)
+		}
+	}
+	if len(fields) > 12 {
+		if c.ID, err = strconv.Atoi(fields[12]); err != nil {
+			return nil, bio.NewError(fmt.Sprintf("chain: bad id on line %d", self.line), 0, err)
+		}
+	}
+
+	t, q := c.TStart, c.QStart
+	for {
+		if line, err = self.readLine(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		fields = strings.Fields(line)
+		if len(fields) != 1 && len(fields) != 3 {
+			return nil, bio.NewError(fmt.Sprintf("chain: bad alignment data on line %d", self.line), 0, line)
+		}
+		var v [3]int
+		for i, f := range fields {
+			if v[i], err = strconv.Atoi(f); err != nil {
+				return nil, bio.NewError(fmt.Sprintf("chain: bad alignment data on line %d", self.line), 0, err)
+			}
+		}
+		c.Blocks = append(c.Blocks, Block{TStart: t, QStart: q, Size: v[0]})
+		if len(fields) == 1 {
+			break
+		}
+		t += v[0] + v[1]
+		q += v[0] + v[2]
+	}
+	if last := c.Blocks[len(c.Blocks)-1]; last.TStart+last.Size != c.TEnd || last.QStart+last.Size != c.QEnd {
+		return nil, bio.NewError(fmt.Sprintf("chain: alignment data inconsistent with header ending line %d", self.line), 0, c)
+	}
+
+	return c, nil
+}
+
+// Return the current line number
+func (self *Reader) Line() int { return self.line }
+
+// Close the reader.
+func (self *Reader) Close() (err error) {
+	return self.f.Close()
+}
+
+// Chain format writer type.
+type Writer struct {
+	f io.WriteCloser
+	w *bufio.Writer
+}
+
+// Returns a new chain format writer using f.
+func NewWriter(f io.WriteCloser) *Writer {
+	return &Writer{
+		f: f,
+		w: bufio.NewWriter(f),
+	}
+}
+
+// Returns a new chain format writer using a filename, truncating any existing file.
+// If appending is required use NewWriter and os.OpenFile.
+func NewWriterName(name string) (w *Writer, err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	return NewWriter(f), nil
+}
+
+// Write a single chain and return the number of bytes written and any error.
+func (self *Writer) Write(c *Chain) (n int, err error) {
+	if len(c.Blocks) == 0 {
+		return 0, bio.NewError("chain: cannot write chain with no blocks", 0, c)
+	}
+	tStrand, ok := strandToChar[c.TStrand]
+	if !ok {
+		return 0, bio.NewError(fmt.Sprintf("chain: bad target strand %d", c.TStrand), 0, c)
+	}
+	qStrand, ok := strandToChar[c.QStrand]
+	if !ok {
+		return 0, bio.NewError(fmt.Sprintf("chain: bad query strand %d", c.QStrand), 0, c)
+	}
+	var b []byte
+	b = append(b, "chain "...)
+	b = strconv.AppendFloat(b, c.Score, 'f', -1, 64)
+	b = append(b, fmt.Sprintf(" %s %d %s %d %d %s %d %s %d %d %d\n",
+		c.TName, c.TSize, tStrand, c.TStart, c.TEnd,
+		c.QName, c.QSize, qStrand, c.QStart, c.QEnd,
+		c.ID)...)
+	for i, bl := range c.Blocks {
+		b = strconv.AppendInt(b, int64(bl.Size), 10)
+		if i < len(c.Blocks)-1 {
+			next := c.Blocks[i+1]
+			dt, dq := next.TStart-bl.TStart-bl.Size, next.QStart-bl.QStart-bl.Size
+			if dt < 0 || dq < 0 {
+				return 0, bio.NewError("chain: blocks out of order", 0, c)
+			}
+			b = append(b, fmt.Sprintf("\t%d\t%d", dt, dq)...)
+		}
+		b = append(b, '\n')
+	}
+	b = append(b, '\n')
+
+	return self.w.Write(b)
+}
+
+// Close the writer, flushing any unwritten data.
+func (self *Writer) Close() (err error) {
+	err = self.w.Flush()
+	if err != nil {
+		return
+	}
+	return self.f.Close()
+}
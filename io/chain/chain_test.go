@@ -0,0 +1,115 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package chain
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+// Helpers
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (self *bufferCloser) Close() error { return nil }
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+const chains = `#comment
+chain 1000 chr1 100 + 10 60 chrA 200 + 20 70 1
+20	5	5
+25
+
+chain 500 chr2 100 + 0 30 chrB 50 - 5 35 2
+30
+
+`
+
+var expect = []*Chain{
+	{
+		Score: 1000,
+		TName: "chr1", TSize: 100, TStrand: 1, TStart: 10, TEnd: 60,
+		QName: "chrA", QSize: 200, QStrand: 1, QStart: 20, QEnd: 70,
+		ID:     1,
+		Blocks: []Block{{TStart: 10, QStart: 20, Size: 20}, {TStart: 35, QStart: 45, Size: 25}},
+	},
+	{
+		Score: 500,
+		TName: "chr2", TSize: 100, TStrand: 1, TStart: 0, TEnd: 30,
+		QName: "chrB", QSize: 50, QStrand: -1, QStart: 5, QEnd: 35,
+		ID:     2,
+		Blocks: []Block{{TStart: 0, QStart: 5, Size: 30}},
+	},
+}
+
+func (s *S) TestRead(c *check.C) {
+	r := NewReader(ioutil.NopCloser(strings.NewReader(chains)))
+	var obtain []*Chain
+	for {
+		ch, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.Equals, nil)
+		obtain = append(obtain, ch)
+	}
+	c.Check(obtain, check.DeepEquals, expect)
+	c.Check(expect[0].Matches(), check.Equals, 45)
+}
+
+func (s *S) TestReadBad(c *check.C) {
+	for _, t := range []string{
+		"chain 1 chr1 100 + 0 10 chrA 100 + 0 10 1\n",
+		"chain 1 chr1 100 + 0 10 chrA 100 + 0 10 1\n5\n",
+		"chain 1 chr1 100 * 0 10 chrA 100 + 0 10 1\n10\n",
+		"chain 1 chr1 100 + 0 10 chrA 100 + 0 10 1\n5 1\n",
+	} {
+		_, err := NewReader(ioutil.NopCloser(strings.NewReader(t))).Read()
+		c.Check(err, check.Not(check.Equals), nil)
+	}
+}
+
+func (s *S) TestWrite(c *check.C) {
+	b := &bufferCloser{}
+	w := NewWriter(b)
+	for _, ch := range expect {
+		_, err := w.Write(ch)
+		c.Check(err, check.Equals, nil)
+	}
+	c.Check(w.Close(), check.Equals, nil)
+	c.Check(b.String(), check.Equals, chains[len("#comment\n"):])
+
+	// Chains must have stranded target and query.
+	for _, strands := range [][2]int8{{0, 1}, {1, 0}, {1, 2}} {
+		ch := *expect[0]
+		ch.TStrand, ch.QStrand = strands[0], strands[1]
+		b.Reset()
+		n, err := w.Write(&ch)
+		c.Check(err, check.NotNil, check.Commentf("strands %v", strands))
+		c.Check(n, check.Equals, 0)
+		c.Check(b.Len(), check.Equals, 0)
+	}
+}
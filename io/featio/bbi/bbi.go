@@ -0,0 +1,142 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package to write bigWig files and to read bigWig and bigBed files, collectively known as
+// BBI files, as described in:
+//  BigWig and BigBed: enabling browsing of large distributed datasets.
+//   W. J. Kent, A. S. Zweig, G. Barber, A. S. Hinrichs and D. Karolchik. Bioinformatics 26:2204-2207 (2010).
+package bbi
+
+import (
+	"math"
+)
+
+// File type magic numbers.
+const (
+	BigWigMagic uint32 = 0x888ffc26
+	BigBedMagic uint32 = 0x8789f2eb
+
+	bptMagic    uint32 = 0x78ca8c91 // Chromosome B+ tree.
+	cirMagic    uint32 = 0x2468ace0 // R-tree index.
+	bbiVersion         = 4
+	headerSize         = 64
+	zoomHdrSize        = 24
+	summarySize        = 40
+	bptHdrSize         = 32
+	cirHdrSize         = 48
+	sectionSize        = 24
+	zoomRecSize        = 32
+	cirLeafSize        = 32
+	cirNodeSize        = 24
+)
+
+// bigWig section types.
+const (
+	bedGraphSection = iota + 1
+	varStepSection
+	fixedStepSection
+)
+
+// Default values for writing BBI files.
+var (
+	DefaultItemsPerSlot = 1024 // Number of data items held in each compressed block.
+	DefaultBlockSize    = 256  // Number of children held by each index node.
+	MaxZoomLevels       = 10   // Maximum number of zoom levels written.
+)
+
+// A Chrom describes a reference sequence of a BBI file.
+type Chrom struct {
+	Name   string
+	Length int
+}
+
+// A Zoom describes a zoom level of a BBI file.
+type Zoom struct {
+	Reduction   int // Number of bases summarised by each zoom record.
+	dataOffset  uint64
+	indexOffset uint64
+}
+
+// A Summary holds summary statistics for a region.
+type Summary struct {
+	Location     string
+	Start, End   int
+	BasesCovered int
+	Min, Max     float64 // Min and Max are NaN when no bases are covered.
+	Sum          float64 // Sum of values over each covered base.
+	SumSquares   float64 // Sum of squared values over each covered base.
+}
+
+// Return the mean value over the covered bases of the region.
+func (self *Summary) Mean() float64 {
+	if self.BasesCovered == 0 {
+		return math.NaN()
+	}
+	return self.Sum / float64(self.BasesCovered)
+}
+
+// Return the standard deviation of values over the covered bases of the region.
+func (self *Summary) StdDev() float64 {
+	n := float64(self.BasesCovered)
+	if n < 2 {
+		return math.NaN()
+	}
+	v := (self.SumSquares - self.Sum*self.Sum/n) / (n - 1)
+	if v < 0 {
+		v = 0
+	}
+	return math.Sqrt(v)
+}
+
+// add includes v over n bases in the summary.
+func (self *Summary) add(n int, v float64) {
+	self.addSummary(n, v, v, v*float64(n), v*v*float64(n))
+}
+
+func (self *Summary) addSummary(n int, min, max, sum, sumSquares float64) {
+	if n <= 0 {
+		return
+	}
+	if self.BasesCovered == 0 || min < self.Min {
+		self.Min = min
+	}
+	if self.BasesCovered == 0 || max > self.Max {
+		self.Max = max
+	}
+	self.BasesCovered += n
+	self.Sum += sum
+	self.SumSquares += sumSquares
+}
+
+func (self *Summary) finalise() {
+	if self.BasesCovered == 0 {
+		self.Min, self.Max = math.NaN(), math.NaN()
+	}
+}
+
+// A zoomRecord is an on-disk summary of a region.
+type zoomRecord struct {
+	chrom, start, end uint32
+	valid             uint32
+	min, max          float32
+	sum, sumSquares   float32
+}
+
+// A cirItem is a leaf entry of an R-tree index.
+type cirItem struct {
+	startChrom, startBase uint32
+	endChrom, endBase     uint32
+	offset, size          uint64
+}
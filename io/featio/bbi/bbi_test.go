@@ -0,0 +1,208 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package bbi
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/feat"
+	"encoding/binary"
+	check "launchpad.net/gocheck"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Helpers
+func floatPtr(f float64) *float64 { return &f }
+
+// writeBigBed writes a minimal uncompressed bigBed file holding fs, which must be sorted.
+func writeBigBed(name string, chroms []Chrom, fs []*feat.Feature) error {
+	w := NewWriter(nil, chroms)
+	var data []byte
+	var items []cirItem
+	for _, f := range fs {
+		id := uint32(w.chromIndex[f.Location])
+		var b bytes.Buffer
+		binary.Write(&b, order, []uint32{id, uint32(f.Start), uint32(f.End)})
+		b.WriteString(f.ID + "\t0\t+\x00")
+		items = append(items, cirItem{id, uint32(f.Start), id, uint32(f.End), uint64(len(data)), uint64(b.Len())})
+		data = append(data, b.Bytes()...)
+	}
+	chromTree := w.chromTree(headerSize + summarySize)
+	dataOffset := uint64(headerSize + summarySize + len(chromTree))
+	indexOffset := dataOffset + 8 + uint64(len(data))
+	index := w.cirTree(relocate(items, dataOffset+8), indexOffset, 1, 0)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, order, BigBedMagic)
+	binary.Write(&buf, order, []uint16{bbiVersion, 0})
+	binary.Write(&buf, order, []uint64{headerSize + summarySize, dataOffset, indexOffset})
+	binary.Write(&buf, order, []uint16{6, 6})
+	binary.Write(&buf, order, []uint64{0, headerSize})
+	binary.Write(&buf, order, uint32(0))
+	binary.Write(&buf, order, uint64(0))
+	buf.Write(make([]byte, summarySize))
+	buf.Write(chromTree)
+	binary.Write(&buf, order, uint64(len(fs)))
+	buf.Write(data)
+	buf.Write(index)
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+var chroms = []Chrom{{"chr2", 1e5}, {"chr1", 2e5}}
+
+func (s *S) TestBigWig(c *check.C) {
+	var fs []*feat.Feature
+	for _, ch := range chroms {
+		for p := 0; p < ch.Length; {
+			l := 1 + rand.Intn(50)
+			if p+l > ch.Length {
+				break
+			}
+			if rand.Intn(4) > 0 {
+				fs = append(fs, &feat.Feature{Location: ch.Name, Start: p, End: p + l, Score: floatPtr(float64(rand.Intn(100)))})
+			}
+			p += l
+		}
+	}
+
+	for _, compress := range []bool{true, false} {
+		name := filepath.Join(c.MkDir(), "test.bw")
+		w, err := NewWriterName(name, chroms)
+		c.Assert(err, check.IsNil)
+		w.Compress = compress
+		for _, i := range rand.Perm(len(fs)) {
+			_, err = w.Write(fs[i])
+			c.Assert(err, check.IsNil)
+		}
+		c.Assert(w.Close(), check.IsNil)
+
+		r, err := NewReaderName(name)
+		c.Assert(err, check.IsNil)
+		c.Check(r.Magic, check.Equals, BigWigMagic)
+		c.Check(r.Chroms(), check.DeepEquals, []Chrom{{"chr1", 2e5}, {"chr2", 1e5}})
+		c.Check(len(r.Zooms) > 0, check.Equals, true)
+
+		var want Summary
+		for _, f := range fs {
+			want.add(f.Len(), *f.Score)
+		}
+		c.Check(r.Total.BasesCovered, check.Equals, want.BasesCovered)
+		c.Check(r.Total.Sum, check.Equals, want.Sum)
+
+		start, end := 12345, 23456
+		var expect []*feat.Feature
+		var exact Summary
+		for _, f := range fs {
+			if f.Location == "chr2" && f.End > start && f.Start < end {
+				expect = append(expect, f)
+				s, e := f.Start, f.End
+				if s < start {
+					s = start
+				}
+				if e > end {
+					e = end
+				}
+				exact.add(e-s, *f.Score)
+			}
+		}
+		got, err := r.Features("chr2", start, end)
+		c.Assert(err, check.IsNil)
+		c.Assert(got, check.HasLen, len(expect))
+		for i := range got {
+			c.Check(got[i].Start, check.Equals, expect[i].Start)
+			c.Check(got[i].End, check.Equals, expect[i].End)
+			c.Check(*got[i].Score, check.Equals, *expect[i].Score)
+		}
+
+		// Bins narrower than twice the finest zoom reduction use the full data.
+		sum, err := r.Summarise("chr2", start, end, (end-start)/r.Zooms[0].Reduction)
+		c.Assert(err, check.IsNil)
+		for _, b := range sum[1:] {
+			sum[0].addSummary(b.BasesCovered, b.Min, b.Max, b.Sum, b.SumSquares)
+		}
+		c.Check(sum[0].BasesCovered, check.Equals, exact.BasesCovered)
+		c.Check(math.Abs(sum[0].Sum-exact.Sum) < 1e-6, check.Equals, true)
+		c.Check(sum[0].Min, check.Equals, exact.Min)
+		c.Check(sum[0].Max, check.Equals, exact.Max)
+
+		// Many bins over a whole chromosome use a zoom level.
+		sum, err = r.Summarise("chr1", 0, 2e5, 10)
+		c.Assert(err, check.IsNil)
+		var covered int
+		var total float64
+		for _, b := range sum {
+			covered += b.BasesCovered
+			total += b.Sum
+		}
+		var chr1 Summary
+		for _, f := range fs {
+			if f.Location == "chr1" {
+				chr1.add(f.Len(), *f.Score)
+			}
+		}
+		c.Check(math.Abs(float64(covered-chr1.BasesCovered)) <= 10, check.Equals, true)
+		c.Check(math.Abs(total-chr1.Sum)/chr1.Sum < 1e-3, check.Equals, true)
+
+		_, err = r.Features("chrX", 0, 10)
+		c.Check(err, check.NotNil)
+		c.Check(r.Close(), check.IsNil)
+	}
+}
+
+func (s *S) TestBigBed(c *check.C) {
+	fs := []*feat.Feature{
+		{ID: "a", Location: "chr1", Start: 10, End: 20},
+		{ID: "b", Location: "chr1", Start: 15, End: 30},
+		{ID: "c", Location: "chr2", Start: 5, End: 8},
+	}
+	name := filepath.Join(c.MkDir(), "test.bb")
+	c.Assert(writeBigBed(name, chroms, fs), check.IsNil)
+
+	r, err := NewReaderName(name)
+	c.Assert(err, check.IsNil)
+	c.Check(r.Magic, check.Equals, BigBedMagic)
+	got, err := r.Features("chr1", 0, 100)
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.HasLen, 2)
+	c.Check(got[1].ID, check.Equals, "b")
+	c.Check(got[1].Strand, check.Equals, int8(1))
+
+	sum, err := r.Summarise("chr1", 0, 40, 2)
+	c.Assert(err, check.IsNil)
+	c.Check(sum[0].BasesCovered, check.Equals, 10)
+	c.Check(sum[0].Max, check.Equals, 2.)
+	c.Check(sum[1].BasesCovered, check.Equals, 10)
+	c.Check(sum[1].Sum, check.Equals, 10.)
+	c.Check(r.Close(), check.IsNil)
+}
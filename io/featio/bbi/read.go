@@ -0,0 +1,524 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package bbi
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/coverage"
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/featio/bed"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BBI format reader type for bigWig and bigBed files.
+type Reader struct {
+	r      io.ReaderAt
+	c      io.Closer
+	order  binary.ByteOrder
+	Magic  uint32 // BigWigMagic or BigBedMagic.
+	Zooms  []Zoom
+	Total  Summary // Summary of all data in the file.
+	chroms []Chrom
+	ids    map[string]uint32
+
+	fieldCount      int
+	dataOffset      uint64
+	indexOffset     uint64
+	uncompressedBuf uint32
+}
+
+// Returns a new BBI format reader using r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	self := &Reader{r: r, ids: make(map[string]uint32)}
+
+	h := make([]byte, headerSize)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return nil, err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(h) == BigWigMagic || binary.LittleEndian.Uint32(h) == BigBedMagic:
+		self.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(h) == BigWigMagic || binary.BigEndian.Uint32(h) == BigBedMagic:
+		self.order = binary.BigEndian
+	default:
+		return nil, bio.NewError("bbi: not a bigWig or bigBed file", 0)
+	}
+	o := self.order
+	self.Magic = o.Uint32(h)
+	zoomLevels := int(o.Uint16(h[6:]))
+	chromTreeOffset := o.Uint64(h[8:])
+	self.dataOffset = o.Uint64(h[16:])
+	self.indexOffset = o.Uint64(h[24:])
+	self.fieldCount = int(o.Uint16(h[32:]))
+	summaryOffset := o.Uint64(h[44:])
+	self.uncompressedBuf = o.Uint32(h[52:])
+
+	z := make([]byte, zoomLevels*zoomHdrSize)
+	if _, err := r.ReadAt(z, headerSize); err != nil {
+		return nil, err
+	}
+	for i := 0; i < zoomLevels; i++ {
+		b := z[i*zoomHdrSize:]
+		self.Zooms = append(self.Zooms, Zoom{
+			Reduction:   int(o.Uint32(b)),
+			dataOffset:  o.Uint64(b[8:]),
+			indexOffset: o.Uint64(b[16:]),
+		})
+	}
+
+	if summaryOffset != 0 {
+		s := make([]byte, summarySize)
+		if _, err := r.ReadAt(s, int64(summaryOffset)); err != nil {
+			return nil, err
+		}
+		self.Total = Summary{
+			BasesCovered: int(o.Uint64(s)),
+			Min:          math.Float64frombits(o.Uint64(s[8:])),
+			Max:          math.Float64frombits(o.Uint64(s[16:])),
+			Sum:          math.Float64frombits(o.Uint64(s[24:])),
+			SumSquares:   math.Float64frombits(o.Uint64(s[32:])),
+		}
+	}
+
+	if err := self.readChromTree(chromTreeOffset); err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// Returns a new BBI reader using a filename.
+func NewReaderName(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.c = f
+
+	return r, nil
+}
+
+// Close the reader.
+func (self *Reader) Close() error {
+	if self.c != nil {
+		return self.c.Close()
+	}
+	return nil
+}
+
+// Return the chromosomes described by the file, ordered by their ID.
+func (self *Reader) Chroms() []Chrom {
+	return append([]Chrom(nil), self.chroms...)
+}
+
+func (self *Reader) readAt(off uint64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := self.r.ReadAt(b, int64(off))
+	return b, err
+}
+
+func (self *Reader) readChromTree(off uint64) error {
+	h, err := self.readAt(off, bptHdrSize)
+	if err != nil {
+		return err
+	}
+	o := self.order
+	if o.Uint32(h) != bptMagic {
+		return bio.NewError("bbi: bad chromosome tree magic", 0)
+	}
+	keySize := int(o.Uint32(h[8:]))
+	n := int(o.Uint64(h[16:]))
+	self.chroms = make([]Chrom, n)
+
+	var walk func(off uint64) error
+	walk = func(off uint64) error {
+		nh, err := self.readAt(off, 4)
+		if err != nil {
+			return err
+		}
+		count := int(o.Uint16(nh[2:]))
+		b, err := self.readAt(off+4, count*(keySize+8))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			it := b[i*(keySize+8):]
+			if nh[0] != 0 {
+				name := strings.TrimRight(string(it[:keySize]), "\x00")
+				id := o.Uint32(it[keySize:])
+				if int(id) >= n {
+					return bio.NewError("bbi: chromosome ID out of range", 0, id)
+				}
+				self.chroms[id] = Chrom{Name: name, Length: int(o.Uint32(it[keySize+4:]))}
+				self.ids[name] = id
+			} else if err = walk(o.Uint64(it[keySize:])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(off + bptHdrSize)
+}
+
+// blocks returns the index entries for blocks overlapping chrom:[start, end) in the R-tree at off.
+func (self *Reader) blocks(off uint64, chrom uint32, start, end int) (items []cirItem, err error) {
+	o := self.order
+	overlaps := func(b []byte) bool {
+		sc, sb, ec, eb := o.Uint32(b), o.Uint32(b[4:]), o.Uint32(b[8:]), o.Uint32(b[12:])
+		return (sc < chrom || (sc == chrom && int(sb) < end)) && (ec > chrom || (ec == chrom && int(eb) > start))
+	}
+
+	h, err := self.readAt(off, cirHdrSize)
+	if err != nil {
+		return nil, err
+	}
+	if o.Uint32(h) != cirMagic {
+		return nil, bio.NewError("bbi: bad index magic", 0)
+	}
+
+	var walk func(off uint64) error
+	walk = func(off uint64) error {
+		nh, err := self.readAt(off, 4)
+		if err != nil {
+			return err
+		}
+		leaf := nh[0] != 0
+		count := int(o.Uint16(nh[2:]))
+		size := cirNodeSize
+		if leaf {
+			size = cirLeafSize
+		}
+		b, err := self.readAt(off+4, count*size)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			it := b[i*size:]
+			if !overlaps(it) {
+				continue
+			}
+			if leaf {
+				items = append(items, cirItem{offset: o.Uint64(it[16:]), size: o.Uint64(it[24:])})
+			} else if err = walk(o.Uint64(it[16:])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = walk(off + cirHdrSize)
+
+	return
+}
+
+func (self *Reader) block(it cirItem) ([]byte, error) {
+	b, err := self.readAt(it.offset, int(it.size))
+	if err != nil {
+		return nil, err
+	}
+	if self.uncompressedBuf == 0 {
+		return b, nil
+	}
+	z, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ioutil.ReadAll(z)
+}
+
+func (self *Reader) chromID(chrom string) (uint32, error) {
+	id, ok := self.ids[chrom]
+	if !ok {
+		return 0, bio.NewError(fmt.Sprintf("bbi: unknown chromosome %q", chrom), 0, chrom)
+	}
+	return id, nil
+}
+
+// Features returns the data records overlapping chrom:[start, end). For bigWig files, each
+// returned feature holds the data value in its Score field. For bigBed files, features are
+// populated from the BED fields of each record.
+func (self *Reader) Features(chrom string, start, end int) (fs []*feat.Feature, err error) {
+	id, err := self.chromID(chrom)
+	if err != nil {
+		return nil, err
+	}
+	items, err := self.blocks(self.indexOffset, id, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range items {
+		b, err := self.block(it)
+		if err != nil {
+			return nil, err
+		}
+		if self.Magic == BigWigMagic {
+			fs, err = self.wigFeatures(fs, b, chrom, id, start, end)
+		} else {
+			fs, err = self.bedFeatures(fs, b, chrom, id, start, end)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func (self *Reader) wigFeatures(fs []*feat.Feature, b []byte, chrom string, id uint32, start, end int) ([]*feat.Feature, error) {
+	o := self.order
+	for len(b) >= sectionSize {
+		var (
+			cid      = o.Uint32(b)
+			secStart = int(o.Uint32(b[4:]))
+			step     = int(o.Uint32(b[12:]))
+			span     = int(o.Uint32(b[16:]))
+			typ      = b[20]
+			n        = int(o.Uint16(b[22:]))
+		)
+		b = b[sectionSize:]
+		var size int
+		switch typ {
+		case bedGraphSection:
+			size = 12
+		case varStepSection:
+			size = 8
+		case fixedStepSection:
+			size = 4
+		default:
+			return nil, bio.NewError("bbi: unknown section type", 0, typ)
+		}
+		if len(b) < n*size {
+			return nil, bio.NewError("bbi: truncated section", 0)
+		}
+		for i := 0; i < n; i++ {
+			it := b[i*size:]
+			var s, e int
+			var v float32
+			switch typ {
+			case bedGraphSection:
+				s, e, v = int(o.Uint32(it)), int(o.Uint32(it[4:])), math.Float32frombits(o.Uint32(it[8:]))
+			case varStepSection:
+				s, v = int(o.Uint32(it)), math.Float32frombits(o.Uint32(it[4:]))
+				e = s + span
+			case fixedStepSection:
+				s, v = secStart+i*step, math.Float32frombits(o.Uint32(it))
+				e = s + span
+			}
+			if cid != id || e <= start || s >= end {
+				continue
+			}
+			val := float64(v)
+			fs = append(fs, &feat.Feature{
+				ID:       chrom + ":" + strconv.Itoa(s) + ".." + strconv.Itoa(e),
+				Location: chrom,
+				Start:    s,
+				End:      e,
+				Score:    &val,
+				Moltype:  bio.DNA,
+			})
+		}
+		b = b[n*size:]
+	}
+
+	return fs, nil
+}
+
+func (self *Reader) bedFeatures(fs []*feat.Feature, b []byte, chrom string, id uint32, start, end int) ([]*feat.Feature, error) {
+	o := self.order
+	for len(b) >= 12 {
+		cid, s, e := o.Uint32(b), int(o.Uint32(b[4:])), int(o.Uint32(b[8:]))
+		b = b[12:]
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return nil, bio.NewError("bbi: unterminated bigBed record", 0)
+		}
+		rest := string(b[:i])
+		b = b[i+1:]
+		if cid != id || s >= end || e < start || (e == start && e > s) {
+			continue
+		}
+
+		f := &feat.Feature{
+			ID:       chrom + ":" + strconv.Itoa(s) + ".." + strconv.Itoa(e),
+			Location: chrom,
+			Start:    s,
+			End:      e,
+			Moltype:  bio.DNA,
+		}
+		fields := strings.Split(rest, "\t")
+		if len(fields) > 0 && fields[0] != "" {
+			f.ID = fields[0]
+		}
+		if len(fields) > 1 {
+			if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				f.Score = &v
+			}
+		}
+		if len(fields) > 2 {
+			f.Strand = bed.CharToStrand[fields[2]]
+		}
+		if len(fields) > 3 {
+			f.Attributes = strings.Join(fields[3:], "\t")
+		}
+		fs = append(fs, f)
+	}
+
+	return fs, nil
+}
+
+// Summarise returns summary statistics for chrom:[start, end) divided into n equal bins. The
+// coarsest zoom level that resolves the requested bins is used if one is available, otherwise
+// the full data are summarised. For bigBed files, values are the depth of coverage by records.
+func (self *Reader) Summarise(chrom string, start, end, n int) ([]Summary, error) {
+	if n < 1 || end <= start {
+		return nil, bio.NewError("bbi: bad summary request", 0, start, end, n)
+	}
+	id, err := self.chromID(chrom)
+	if err != nil {
+		return nil, err
+	}
+
+	bins := make([]Summary, n)
+	width := float64(end-start) / float64(n)
+	for i := range bins {
+		bins[i].Location = chrom
+		bins[i].Start = start + int(float64(i)*width)
+		bins[i].End = start + int(float64(i+1)*width)
+	}
+	bins[n-1].End = end
+
+	var zoom *Zoom
+	for i := range self.Zooms {
+		if z := &self.Zooms[i]; float64(z.Reduction) <= width/2 && (zoom == nil || z.Reduction > zoom.Reduction) {
+			zoom = z
+		}
+	}
+
+	if zoom != nil {
+		err = self.zoomSummary(bins, zoom, id, start, end)
+	} else {
+		err = self.fullSummary(bins, chrom, start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range bins {
+		bins[i].finalise()
+	}
+
+	return bins, nil
+}
+
+// distribute adds a summary of [s, e) to the bins it overlaps, scaling by the overlap fraction.
+func distribute(bins []Summary, s, e, valid int, min, max, sum, sumSquares float64) {
+	for i := range bins {
+		b := &bins[i]
+		os, oe := s, e
+		if b.Start > os {
+			os = b.Start
+		}
+		if b.End < oe {
+			oe = b.End
+		}
+		if oe <= os {
+			continue
+		}
+		f := float64(oe-os) / float64(e-s)
+		b.addSummary(int(float64(valid)*f+0.5), min, max, sum*f, sumSquares*f)
+	}
+}
+
+func (self *Reader) zoomSummary(bins []Summary, z *Zoom, id uint32, start, end int) error {
+	items, err := self.blocks(z.indexOffset, id, start, end)
+	if err != nil {
+		return err
+	}
+	o := self.order
+	for _, it := range items {
+		b, err := self.block(it)
+		if err != nil {
+			return err
+		}
+		for ; len(b) >= zoomRecSize; b = b[zoomRecSize:] {
+			if o.Uint32(b) != id {
+				continue
+			}
+			s, e := int(o.Uint32(b[4:])), int(o.Uint32(b[8:]))
+			if e <= start || s >= end || e <= s {
+				continue
+			}
+			distribute(bins, s, e, int(o.Uint32(b[12:])),
+				float64(math.Float32frombits(o.Uint32(b[16:]))),
+				float64(math.Float32frombits(o.Uint32(b[20:]))),
+				float64(math.Float32frombits(o.Uint32(b[24:]))),
+				float64(math.Float32frombits(o.Uint32(b[28:]))),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (self *Reader) fullSummary(bins []Summary, chrom string, start, end int) error {
+	fs, err := self.Features(chrom, start, end)
+	if err != nil {
+		return err
+	}
+
+	if self.Magic == BigBedMagic {
+		acc := coverage.New(0, 0)
+		for _, f := range fs {
+			acc.AddFeature(f)
+		}
+		fs = fs[:0]
+		for _, r := range acc.Runs(chrom) {
+			fs = append(fs, r.Feature())
+		}
+	}
+
+	for _, f := range fs {
+		s, e := f.Start, f.End
+		if s < start {
+			s = start
+		}
+		if e > end {
+			e = end
+		}
+		if e <= s {
+			continue
+		}
+		v := *f.Score
+		n := float64(e - s)
+		distribute(bins, s, e, e-s, v, v, v*n, v*v*n)
+	}
+
+	return nil
+}
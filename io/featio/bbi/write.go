@@ -0,0 +1,612 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package bbi
+
+import (
+	"bufio"
+	"bytes"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var order = binary.LittleEndian
+
+type wigItem struct {
+	chrom, start, end int
+	value             float32
+}
+
+type wigItems []wigItem
+
+func (self wigItems) Len() int { return len(self) }
+func (self wigItems) Less(i, j int) bool {
+	return self[i].chrom < self[j].chrom || (self[i].chrom == self[j].chrom && self[i].start < self[j].start)
+}
+func (self wigItems) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+// bigWig format writer type. Data are held in memory until the writer is closed, so features
+// may be written in any order, but they must not overlap.
+type Writer struct {
+	f            io.WriteCloser
+	chroms       []Chrom
+	chromIndex   map[string]int
+	items        wigItems
+	ItemsPerSlot int  // Number of items held in each data block.
+	BlockSize    int  // Number of children held by each index node.
+	Compress     bool // Compress data blocks with zlib.
+}
+
+// Returns a new bigWig format writer using f. The chroms parameter describes the reference
+// sequences that features may be located on.
+func NewWriter(f io.WriteCloser, chroms []Chrom) *Writer {
+	cs := append([]Chrom(nil), chroms...)
+	sort.Sort(chromsByName(cs))
+	ci := make(map[string]int, len(cs))
+	for i, c := range cs {
+		ci[c.Name] = i
+	}
+
+	return &Writer{
+		f:            f,
+		chroms:       cs,
+		chromIndex:   ci,
+		ItemsPerSlot: DefaultItemsPerSlot,
+		BlockSize:    DefaultBlockSize,
+		Compress:     true,
+	}
+}
+
+// Returns a new bigWig format writer using a filename, truncating any existing file.
+func NewWriterName(name string, chroms []Chrom) (w *Writer, err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	return NewWriter(f, chroms), nil
+}
+
+type chromsByName []Chrom
+
+func (self chromsByName) Len() int           { return len(self) }
+func (self chromsByName) Less(i, j int) bool { return self[i].Name < self[j].Name }
+func (self chromsByName) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// Write a single feature, taking the data value from the Score field. Features without a Score
+// are written with a value of zero. The returned byte count is always zero since data are
+// written when the Writer is closed.
+func (self *Writer) Write(f *feat.Feature) (n int, err error) {
+	c, ok := self.chromIndex[f.Location]
+	if !ok {
+		return 0, bio.NewError(fmt.Sprintf("bbi: unknown chromosome %q", f.Location), 0, f)
+	}
+	if f.Start < 0 || f.End <= f.Start || f.End > self.chroms[c].Length {
+		return 0, bio.NewError("bbi: feature out of range", 0, f)
+	}
+	var v float64
+	if f.Score != nil {
+		v = *f.Score
+	}
+	self.items = append(self.items, wigItem{chrom: c, start: f.Start, end: f.End, value: float32(v)})
+
+	return 0, nil
+}
+
+// Close the writer, writing all data, zoom levels and indexes.
+func (self *Writer) Close() (err error) {
+	defer func() {
+		if cerr := self.f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	sort.Sort(self.items)
+	for i := 1; i < len(self.items); i++ {
+		if p, c := self.items[i-1], self.items[i]; p.chrom == c.chrom && p.end > c.start {
+			return bio.NewError(fmt.Sprintf("bbi: overlapping data on %s at %d", self.chroms[c.chrom].Name, c.start), 0)
+		}
+	}
+
+	// Build all compressed blocks in memory so that the file layout is known before writing.
+	var (
+		total   Summary
+		spanSum int
+	)
+	for _, it := range self.items {
+		total.add(it.end-it.start, float64(it.value))
+		spanSum += it.end - it.start
+	}
+	data, dataIndex, maxBuf, err := self.dataBlocks()
+	if err != nil {
+		return err
+	}
+
+	type zoomLevel struct {
+		reduction int
+		data      []byte
+		index     []cirItem
+		count     int
+	}
+	var zooms []zoomLevel
+	if len(self.items) > 0 {
+		reduction := 10 * spanSum / len(self.items)
+		if reduction < 1 {
+			reduction = 1
+		}
+		prev := len(self.items)
+		maxLen := 0
+		for _, c := range self.chroms {
+			if c.Length > maxLen {
+				maxLen = c.Length
+			}
+		}
+		for len(zooms) < MaxZoomLevels && reduction <= maxLen {
+			recs := self.zoomRecords(reduction)
+			if len(recs) > prev/2 && len(zooms) > 0 {
+				break
+			}
+			d, idx, m, err := self.zoomBlocks(recs)
+			if err != nil {
+				return err
+			}
+			if m > maxBuf {
+				maxBuf = m
+			}
+			zooms = append(zooms, zoomLevel{reduction: reduction, data: d, index: idx, count: len(recs)})
+			prev = len(recs)
+			reduction *= 4
+		}
+	}
+	if !self.Compress {
+		maxBuf = 0
+	}
+
+	// Lay out the file.
+	var (
+		chromTree = self.chromTree(headerSize + uint64(len(zooms))*zoomHdrSize + summarySize)
+		off       = headerSize + uint64(len(zooms))*zoomHdrSize
+	)
+	summaryOffset := off
+	off += summarySize
+	chromTreeOffset := off
+	off += uint64(len(chromTree))
+	dataOffset := off
+	off += 8
+	dataIndex = relocate(dataIndex, off)
+	off += uint64(len(data))
+	indexOffset := off
+	index := self.cirTree(dataIndex, off, len(self.items), dataOffset+8)
+	off += uint64(len(index))
+
+	type zoomPlace struct {
+		dataOffset, indexOffset uint64
+		index                   []byte
+	}
+	places := make([]zoomPlace, len(zooms))
+	for i, z := range zooms {
+		places[i].dataOffset = off
+		off += 4
+		zi := relocate(z.index, off)
+		off += uint64(len(z.data))
+		places[i].indexOffset = off
+		places[i].index = self.cirTree(zi, off, z.count, places[i].dataOffset+4)
+		off += uint64(len(places[i].index))
+	}
+
+	w := bufio.NewWriter(self.f)
+	put := func(v interface{}) {
+		if err == nil {
+			err = binary.Write(w, order, v)
+		}
+	}
+	write := func(b []byte) {
+		if err == nil {
+			_, err = w.Write(b)
+		}
+	}
+
+	put(BigWigMagic)
+	put(uint16(bbiVersion))
+	put(uint16(len(zooms)))
+	put(chromTreeOffset)
+	put(dataOffset)
+	put(indexOffset)
+	put(uint16(0)) // fieldCount
+	put(uint16(0)) // definedFieldCount
+	put(uint64(0)) // autoSqlOffset
+	put(summaryOffset)
+	put(uint32(maxBuf))
+	put(uint64(0)) // extensionOffset
+	for i, z := range zooms {
+		put(uint32(z.reduction))
+		put(uint32(0))
+		put(places[i].dataOffset)
+		put(places[i].indexOffset)
+	}
+	total.finalise()
+	if total.BasesCovered == 0 {
+		total.Min, total.Max = 0, 0
+	}
+	put(uint64(total.BasesCovered))
+	put(total.Min)
+	put(total.Max)
+	put(total.Sum)
+	put(total.SumSquares)
+	write(chromTree)
+	put(uint64(len(dataIndex)))
+	write(data)
+	write(index)
+	for i, z := range zooms {
+		put(uint32(z.count))
+		write(z.data)
+		write(places[i].index)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+
+	return
+}
+
+// relocate returns a copy of items with offsets shifted by base.
+func relocate(items []cirItem, base uint64) []cirItem {
+	r := make([]cirItem, len(items))
+	for i, it := range items {
+		it.offset += base
+		r[i] = it
+	}
+	return r
+}
+
+func (self *Writer) compress(b []byte) ([]byte, error) {
+	if !self.Compress {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	z := zlib.NewWriter(&buf)
+	if _, err := z.Write(b); err != nil {
+		return nil, err
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dataBlocks returns the bedGraph sections of the file with index items holding offsets
+// relative to the start of the returned data.
+func (self *Writer) dataBlocks() (data []byte, index []cirItem, maxBuf int, err error) {
+	var sec bytes.Buffer
+	for i := 0; i < len(self.items); {
+		j := i + 1
+		for j < len(self.items) && j-i < self.ItemsPerSlot && self.items[j].chrom == self.items[i].chrom {
+			j++
+		}
+		block := self.items[i:j]
+		first, last := block[0], block[len(block)-1]
+
+		sec.Reset()
+		binary.Write(&sec, order, []uint32{uint32(first.chrom), uint32(first.start), uint32(last.end), 0, 0})
+		binary.Write(&sec, order, []uint8{bedGraphSection, 0})
+		binary.Write(&sec, order, uint16(len(block)))
+		for _, it := range block {
+			binary.Write(&sec, order, []uint32{uint32(it.start), uint32(it.end)})
+			binary.Write(&sec, order, it.value)
+		}
+		if sec.Len() > maxBuf {
+			maxBuf = sec.Len()
+		}
+		var b []byte
+		if b, err = self.compress(sec.Bytes()); err != nil {
+			return
+		}
+		index = append(index, cirItem{
+			startChrom: uint32(first.chrom), startBase: uint32(first.start),
+			endChrom: uint32(last.chrom), endBase: uint32(last.end),
+			offset: uint64(len(data)), size: uint64(len(b)),
+		})
+		data = append(data, b...)
+		i = j
+	}
+
+	return
+}
+
+// zoomRecords summarises the data over bins of reduction bases.
+func (self *Writer) zoomRecords(reduction int) (recs []zoomRecord) {
+	var (
+		cur  Summary
+		bin  = -1
+		chr  = -1
+		emit = func() {
+			if cur.BasesCovered == 0 {
+				return
+			}
+			end := (bin + 1) * reduction
+			if l := self.chroms[chr].Length; end > l {
+				end = l
+			}
+			recs = append(recs, zoomRecord{
+				chrom: uint32(chr), start: uint32(bin * reduction), end: uint32(end),
+				valid: uint32(cur.BasesCovered),
+				min:   float32(cur.Min), max: float32(cur.Max),
+				sum: float32(cur.Sum), sumSquares: float32(cur.SumSquares),
+			})
+		}
+	)
+	for _, it := range self.items {
+		for s := it.start; s < it.end; {
+			b := s / reduction
+			if b != bin || it.chrom != chr {
+				emit()
+				cur, bin, chr = Summary{}, b, it.chrom
+			}
+			e := (b + 1) * reduction
+			if e > it.end {
+				e = it.end
+			}
+			cur.add(e-s, float64(it.value))
+			s = e
+		}
+	}
+	emit()
+
+	return
+}
+
+func (self *Writer) zoomBlocks(recs []zoomRecord) (data []byte, index []cirItem, maxBuf int, err error) {
+	var sec bytes.Buffer
+	for i := 0; i < len(recs); {
+		j := i + 1
+		for j < len(recs) && j-i < self.ItemsPerSlot && recs[j].chrom == recs[i].chrom {
+			j++
+		}
+		block := recs[i:j]
+
+		sec.Reset()
+		for _, r := range block {
+			binary.Write(&sec, order, []uint32{r.chrom, r.start, r.end, r.valid})
+			binary.Write(&sec, order, []float32{r.min, r.max, r.sum, r.sumSquares})
+		}
+		if sec.Len() > maxBuf {
+			maxBuf = sec.Len()
+		}
+		var b []byte
+		if b, err = self.compress(sec.Bytes()); err != nil {
+			return
+		}
+		index = append(index, cirItem{
+			startChrom: block[0].chrom, startBase: block[0].start,
+			endChrom: block[len(block)-1].chrom, endBase: block[len(block)-1].end,
+			offset: uint64(len(data)), size: uint64(len(b)),
+		})
+		data = append(data, b...)
+		i = j
+	}
+
+	return
+}
+
+// chromTree returns a B+ tree mapping chromosome names to IDs and lengths, to be placed at off.
+func (self *Writer) chromTree(off uint64) []byte {
+	keySize := 1
+	for _, c := range self.chroms {
+		if len(c.Name) > keySize {
+			keySize = len(c.Name)
+		}
+	}
+	bs := self.BlockSize
+	if len(self.chroms) < bs {
+		bs = len(self.chroms)
+	}
+	if bs < 1 {
+		bs = 1
+	}
+
+	key := func(i int) []byte {
+		k := make([]byte, keySize)
+		copy(k, self.chroms[i].Name)
+		return k
+	}
+
+	// Each level holds the index of the first chromosome of each of its nodes.
+	levels := [][]int{groups(len(self.chroms), bs)}
+	for len(levels[len(levels)-1]) > 1 {
+		levels = append(levels, groups(len(levels[len(levels)-1]), bs))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, order, []uint32{bptMagic, uint32(bs), uint32(keySize), 8})
+	binary.Write(&buf, order, []uint64{uint64(len(self.chroms)), 0})
+
+	// Calculate node offsets, writing from the root down.
+	nodeOff := make([][]uint64, len(levels))
+	pos := off + bptHdrSize
+	for l := len(levels) - 1; l >= 0; l-- {
+		n := len(levels[l])
+		below := len(self.chroms)
+		if l > 0 {
+			below = len(levels[l-1])
+		}
+		nodeOff[l] = make([]uint64, n)
+		for i := range levels[l] {
+			nodeOff[l][i] = pos
+			pos += 4 + uint64(groupLen(levels[l], i, below)*(keySize+8))
+		}
+	}
+	first := func(l, i int) int { // Index of the first chromosome below node i of level l.
+		for ; l > 0; l-- {
+			i = levels[l][i]
+		}
+		return levels[0][i]
+	}
+	for l := len(levels) - 1; l >= 0; l-- {
+		below := len(self.chroms)
+		if l > 0 {
+			below = len(levels[l-1])
+		}
+		for i, s := range levels[l] {
+			n := groupLen(levels[l], i, below)
+			isLeaf := uint8(0)
+			if l == 0 {
+				isLeaf = 1
+			}
+			binary.Write(&buf, order, []uint8{isLeaf, 0})
+			binary.Write(&buf, order, uint16(n))
+			for j := s; j < s+n; j++ {
+				if l == 0 {
+					buf.Write(key(j))
+					binary.Write(&buf, order, []uint32{uint32(j), uint32(self.chroms[j].Length)})
+				} else {
+					buf.Write(key(first(l-1, j)))
+					binary.Write(&buf, order, nodeOff[l-1][j])
+				}
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// groups returns the starting index of each group of size bs over n items.
+func groups(n, bs int) (g []int) {
+	for i := 0; i < n; i += bs {
+		g = append(g, i)
+	}
+	if len(g) == 0 {
+		g = []int{0}
+	}
+	return
+}
+
+func groupLen(g []int, i, n int) int {
+	if i+1 < len(g) {
+		return g[i+1] - g[i]
+	}
+	return n - g[i]
+}
+
+// cirTree returns an R-tree indexing the given blocks, to be placed at off.
+func (self *Writer) cirTree(items []cirItem, off uint64, itemsPerSlot int, end uint64) []byte {
+	bs := self.BlockSize
+	if bs < 2 {
+		bs = 2
+	}
+	if itemsPerSlot > self.ItemsPerSlot {
+		itemsPerSlot = self.ItemsPerSlot
+	}
+
+	var buf bytes.Buffer
+	bounds := cirItem{}
+	if len(items) > 0 {
+		bounds = cirItem{
+			startChrom: items[0].startChrom, startBase: items[0].startBase,
+			endChrom: items[len(items)-1].endChrom, endBase: items[len(items)-1].endBase,
+		}
+		for _, it := range items {
+			if it.endChrom > bounds.endChrom || (it.endChrom == bounds.endChrom && it.endBase > bounds.endBase) {
+				bounds.endChrom, bounds.endBase = it.endChrom, it.endBase
+			}
+		}
+		end = items[len(items)-1].offset + items[len(items)-1].size
+	}
+	binary.Write(&buf, order, []uint32{cirMagic, uint32(bs)})
+	binary.Write(&buf, order, uint64(len(items)))
+	binary.Write(&buf, order, []uint32{bounds.startChrom, bounds.startBase, bounds.endChrom, bounds.endBase})
+	binary.Write(&buf, order, end)
+	binary.Write(&buf, order, []uint32{uint32(itemsPerSlot), 0})
+
+	// Build the levels of the tree from the leaves up; each node is summarised by its bounds.
+	levels := [][]cirItem{items}
+	for {
+		below := levels[len(levels)-1]
+		var up []cirItem
+		for i := 0; i < len(below); i += bs {
+			j := i + bs
+			if j > len(below) {
+				j = len(below)
+			}
+			b := below[i]
+			for _, it := range below[i+1 : j] {
+				if it.endChrom > b.endChrom || (it.endChrom == b.endChrom && it.endBase > b.endBase) {
+					b.endChrom, b.endBase = it.endChrom, it.endBase
+				}
+			}
+			up = append(up, b)
+		}
+		levels = append(levels, up)
+		if len(up) <= 1 {
+			break
+		}
+	}
+	// levels[0] are the data blocks; levels[1] are leaf nodes; the last level is the root.
+
+	nodeOff := make([][]uint64, len(levels))
+	pos := off + cirHdrSize
+	for l := len(levels) - 1; l >= 1; l-- {
+		nodeOff[l] = make([]uint64, len(levels[l]))
+		for i := range levels[l] {
+			n := len(levels[l-1]) - i*bs
+			if n > bs {
+				n = bs
+			}
+			if n < 0 {
+				n = 0
+			}
+			nodeOff[l][i] = pos
+			size := cirNodeSize
+			if l == 1 {
+				size = cirLeafSize
+			}
+			pos += 4 + uint64(n*size)
+		}
+	}
+	if len(items) == 0 {
+		binary.Write(&buf, order, []uint8{1, 0})
+		binary.Write(&buf, order, uint16(0))
+		return buf.Bytes()
+	}
+	for l := len(levels) - 1; l >= 1; l-- {
+		for i := range levels[l] {
+			lo, hi := i*bs, (i+1)*bs
+			if hi > len(levels[l-1]) {
+				hi = len(levels[l-1])
+			}
+			isLeaf := uint8(0)
+			if l == 1 {
+				isLeaf = 1
+			}
+			binary.Write(&buf, order, []uint8{isLeaf, 0})
+			binary.Write(&buf, order, uint16(hi-lo))
+			for j := lo; j < hi; j++ {
+				it := levels[l-1][j]
+				binary.Write(&buf, order, []uint32{it.startChrom, it.startBase, it.endChrom, it.endBase})
+				if l == 1 {
+					binary.Write(&buf, order, []uint64{it.offset, it.size})
+				} else {
+					binary.Write(&buf, order, nodeOff[l-1][j])
+				}
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
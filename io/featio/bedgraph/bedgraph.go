@@ -0,0 +1,186 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package to read and write bedGraph format files
+package bedgraph
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/feat"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	chromField = iota
+	startField
+	endField
+	valueField
+	lastField
+)
+
+// bedGraph format reader type. The data value of each line is returned in the Score field
+// of the feature.
+type Reader struct {
+	f    io.ReadCloser
+	r    *bufio.Reader
+	line int
+}
+
+// Returns a new bedGraph format reader using f.
+func NewReader(f io.ReadCloser) *Reader {
+	return &Reader{
+		f: f,
+		r: bufio.NewReader(f),
+	}
+}
+
+// Returns a new bedGraph reader using a filename.
+func NewReaderName(name string) (r *Reader, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	return NewReader(f), nil
+}
+
+// Read a single feature and return it or an error. Track, browser and comment lines are skipped.
+func (self *Reader) Read() (f *feat.Feature, err error) {
+	var line string
+	for {
+		line, err = self.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		self.line++
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		break
+	}
+
+	elems := strings.Fields(line)
+	if len(elems) != lastField {
+		return nil, bio.NewError(fmt.Sprintf("Bad bedGraph line %d", self.line), 0, line)
+	}
+
+	f = &feat.Feature{Location: elems[chromField], Moltype: bio.DNA}
+	if f.Start, err = strconv.Atoi(elems[startField]); err != nil {
+		return nil, bio.NewError(fmt.Sprintf("Bad start on line %d", self.line), 0, err)
+	}
+	if f.End, err = strconv.Atoi(elems[endField]); err != nil {
+		return nil, bio.NewError(fmt.Sprintf("Bad end on line %d", self.line), 0, err)
+	}
+	v, err := strconv.ParseFloat(elems[valueField], 64)
+	if err != nil {
+		return nil, bio.NewError(fmt.Sprintf("Bad value on line %d", self.line), 0, err)
+	}
+	f.Score = &v
+	f.ID = elems[chromField] + ":" + elems[startField] + ".." + elems[endField]
+
+	return
+}
+
+// Return the current line number
+func (self *Reader) Line() int { return self.line }
+
+// Rewind the reader.
+func (self *Reader) Rewind() (err error) {
+	if s, ok := self.f.(io.Seeker); ok {
+		_, err = s.Seek(0, 0)
+		if err == nil {
+			self.r.Reset(self.f)
+			self.line = 0
+		}
+	} else {
+		err = bio.NewError("Not a Seeker", 0, self)
+	}
+
+	return
+}
+
+// Close the reader.
+func (self *Reader) Close() (err error) {
+	return self.f.Close()
+}
+
+// bedGraph format writer type. The data value written for each feature is taken from its
+// Score field; features without a Score are written with a value of zero.
+type Writer struct {
+	f           io.WriteCloser
+	w           *bufio.Writer
+	FloatFormat byte
+	Precision   int
+}
+
+// Returns a new bedGraph format writer using f. If track is not empty, it is written as
+// the attributes of a track definition line.
+func NewWriter(f io.WriteCloser, track string) (w *Writer, err error) {
+	w = &Writer{
+		f:           f,
+		w:           bufio.NewWriter(f),
+		FloatFormat: bio.FloatFormat,
+		Precision:   bio.Precision,
+	}
+	if track != "" {
+		_, err = w.w.WriteString("track type=bedGraph " + track + "\n")
+	}
+
+	return
+}
+
+// Returns a new bedGraph format writer using a filename, truncating any existing file.
+// If appending is required use NewWriter and os.OpenFile.
+func NewWriterName(name string, track string) (w *Writer, err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	return NewWriter(f, track)
+}
+
+// Write a single feature and return the number of bytes written and any error.
+func (self *Writer) Write(f *feat.Feature) (n int, err error) {
+	return self.w.WriteString(self.Stringify(f) + "\n")
+}
+
+// Convert a feature to a string.
+func (self *Writer) Stringify(f *feat.Feature) string {
+	var v float64
+	if f.Score != nil {
+		v = *f.Score
+	}
+
+	return strings.Join([]string{
+		f.Location,
+		strconv.Itoa(f.Start),
+		strconv.Itoa(f.End),
+		strconv.FormatFloat(v, self.FloatFormat, self.Precision, 64),
+	}, "\t")
+}
+
+// Close the writer, flushing any unwritten data.
+func (self *Writer) Close() (err error) {
+	err = self.w.Flush()
+	if err != nil {
+		return
+	}
+	return self.f.Close()
+}
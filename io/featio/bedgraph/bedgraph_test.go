@@ -0,0 +1,86 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package bedgraph
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/feat"
+	check "launchpad.net/gocheck"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// Helpers
+func floatPtr(f float64) *float64 { return &f }
+
+type B struct {
+	*bytes.Buffer
+}
+
+func (b *B) Close() error { return nil }
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+var (
+	bg = "track type=bedGraph name=test\n" +
+		"chr1\t0\t10\t1.5\n" +
+		"# comment\n" +
+		"chr1\t10\t20\t3\n"
+	expect = []feat.Feature{
+		{ID: "chr1:0..10", Location: "chr1", Start: 0, End: 10, Score: floatPtr(1.5)},
+		{ID: "chr1:10..20", Location: "chr1", Start: 10, End: 20, Score: floatPtr(3)},
+	}
+)
+
+func (s *S) TestReadWrite(c *check.C) {
+	r := NewReader(ioutil.NopCloser(bytes.NewBufferString(bg)))
+	var got []*feat.Feature
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		got = append(got, f)
+	}
+	c.Assert(got, check.HasLen, len(expect))
+	for i := range got {
+		c.Check(got[i].Location, check.Equals, expect[i].Location)
+		c.Check(got[i].Start, check.Equals, expect[i].Start)
+		c.Check(got[i].End, check.Equals, expect[i].End)
+		c.Check(*got[i].Score, check.Equals, *expect[i].Score)
+	}
+
+	b := &B{&bytes.Buffer{}}
+	w, err := NewWriter(b, "name=test")
+	c.Assert(err, check.IsNil)
+	w.Precision = -1
+	for _, f := range got {
+		_, err = w.Write(f)
+		c.Check(err, check.IsNil)
+	}
+	c.Check(w.Close(), check.IsNil)
+	c.Check(b.String(), check.Equals, "track type=bedGraph name=test\nchr1\t0\t10\t1.5\nchr1\t10\t20\t3\n")
+
+	_, err = NewReader(ioutil.NopCloser(bytes.NewBufferString("chr1\t0\tx\t1\n"))).Read()
+	c.Check(err, check.NotNil)
+}
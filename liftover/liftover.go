@@ -0,0 +1,334 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package liftover maps coordinates between genome assemblies using UCSC chain alignments.
+// The target of each chain is the assembly being mapped from and the query is the assembly
+// being mapped to.
+package liftover
+
+import (
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/interval"
+	"code.google.com/p/biogo/io/chain"
+	"code.google.com/p/biogo/io/featio"
+	"code.google.com/p/biogo/util"
+	"fmt"
+	"io"
+	"sort"
+	"unsafe"
+)
+
+// Default minimum ratio of bases that must be mapped for a feature to be lifted.
+var DefaultMinMatch = 0.95
+
+// Reasons for failure to map a feature.
+var (
+	ErrDeleted          = fmt.Errorf("liftover: deleted in new")
+	ErrPartiallyDeleted = fmt.Errorf("liftover: partially deleted in new")
+	ErrSplit            = fmt.Errorf("liftover: split in new")
+	ErrDuplicated       = fmt.Errorf("liftover: duplicated in new")
+)
+
+// A Position is a single mapped base position.
+type Position struct {
+	Location string
+	Pos      int
+	Strand   int8 // Strand of the query relative to the target: -1 for a strand flip.
+}
+
+// A Writer can write features. The writers of the bed and gff packages satisfy Writer.
+type Writer interface {
+	Write(*feat.Feature) (n int, err error)
+}
+
+// A Lifter maps features and positions using a set of indexed chains.
+type Lifter struct {
+	// MinMatch is the minimum fraction of bases of a feature that must be mapped by
+	// the chain alignments for the feature to be lifted.
+	MinMatch float64
+	// Multiple allows a feature to be lifted to more than one chain. When Multiple is
+	// set, MinMatch is applied to the total number of bases mapped by all chains and
+	// the portion of the feature mapped by each chain is returned as a separate feature.
+	Multiple bool
+
+	trees map[string]*interval.IntTree
+}
+
+// Return a new Lifter holding the provided chains.
+func New(chains ...*chain.Chain) *Lifter {
+	l := &Lifter{
+		MinMatch: DefaultMinMatch,
+		trees:    make(map[string]*interval.IntTree),
+	}
+	for _, c := range chains {
+		l.Add(c)
+	}
+
+	return l
+}
+
+// Return a new Lifter holding the chains read from r.
+func NewFromReader(r *chain.Reader) (l *Lifter, err error) {
+	l = New()
+	for {
+		var c *chain.Chain
+		c, err = r.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		l.Add(c)
+	}
+}
+
+// Add a chain to the Lifter.
+func (self *Lifter) Add(c *chain.Chain) {
+	if c.TStrand == -1 {
+		c = flipTarget(c)
+	}
+	t, ok := self.trees[c.TName]
+	if !ok {
+		t = interval.NewIntTree()
+		self.trees[c.TName] = t
+	}
+	t.Insert(chainSpan{c})
+}
+
+// flipTarget returns a copy of c expressed with the target on the forward strand.
+func flipTarget(c *chain.Chain) *chain.Chain {
+	f := *c
+	f.TStrand, f.QStrand = 1, -c.QStrand
+	f.TStart, f.TEnd = c.TSize-c.TEnd, c.TSize-c.TStart
+	f.QStart, f.QEnd = c.QSize-c.QEnd, c.QSize-c.QStart
+	f.Blocks = make([]chain.Block, len(c.Blocks))
+	for i, b := range c.Blocks {
+		f.Blocks[len(c.Blocks)-1-i] = chain.Block{
+			TStart: c.TSize - b.TStart - b.Size,
+			QStart: c.QSize - b.QStart - b.Size,
+			Size:   b.Size,
+		}
+	}
+
+	return &f
+}
+
+// chainSpan wraps a chain for insertion into an IntTree.
+type chainSpan struct {
+	*chain.Chain
+}
+
+func (self chainSpan) Overlap(b interval.IntRange) bool {
+	return self.TEnd > b.Start && self.TStart < b.End
+}
+func (self chainSpan) Range() interval.IntRange {
+	return interval.IntRange{Start: self.TStart, End: self.TEnd}
+}
+func (self chainSpan) ID() uintptr { return uintptr(unsafe.Pointer(self.Chain)) }
+
+// query is a half-open interval query.
+type query struct {
+	start, end int
+}
+
+func (self query) Overlap(b interval.IntRange) bool {
+	return b.End > self.start && b.Start < self.end
+}
+
+// chains returns the chains overlapping [start, end) on location, ordered by descending score.
+func (self *Lifter) chains(location string, start, end int) (c []*chain.Chain) {
+	t, ok := self.trees[location]
+	if !ok {
+		return
+	}
+	t.DoMatching(func(e interval.IntInterface) (done bool) {
+		c = append(c, e.(chainSpan).Chain)
+		return
+	}, query{start, end})
+	sort.Sort(byScore(c))
+
+	return
+}
+
+type byScore []*chain.Chain
+
+func (self byScore) Len() int           { return len(self) }
+func (self byScore) Less(i, j int) bool { return self[i].Score > self[j].Score }
+func (self byScore) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// queryCoords converts a half-open interval on the query strand of c to forward strand coordinates.
+func queryCoords(c *chain.Chain, start, end int) (int, int) {
+	if c.QStrand == -1 {
+		return c.QSize - end, c.QSize - start
+	}
+	return start, end
+}
+
+// Map a single base position, returning all positions it maps to.
+func (self *Lifter) Position(location string, pos int) (p []Position) {
+	for _, c := range self.chains(location, pos, pos+1) {
+		i := sort.Search(len(c.Blocks), func(i int) bool { return c.Blocks[i].TStart+c.Blocks[i].Size > pos })
+		if i == len(c.Blocks) || c.Blocks[i].TStart > pos {
+			continue
+		}
+		q, _ := queryCoords(c, c.Blocks[i].QStart+pos-c.Blocks[i].TStart, c.Blocks[i].QStart+pos-c.Blocks[i].TStart+1)
+		p = append(p, Position{Location: c.QName, Pos: q, Strand: c.QStrand})
+	}
+
+	return
+}
+
+// A mapping is the portion of a region mapped by a single chain.
+type mapping struct {
+	c          *chain.Chain
+	start, end int // Query strand coordinates.
+	bases      int
+}
+
+// mapRange returns the mapping of [start, end) on target by c.
+func mapRange(c *chain.Chain, start, end int) (m mapping) {
+	m.c = c
+	i := sort.Search(len(c.Blocks), func(i int) bool { return c.Blocks[i].TStart+c.Blocks[i].Size > start })
+	for first := true; i < len(c.Blocks) && c.Blocks[i].TStart < end; i++ {
+		b := c.Blocks[i]
+		s, e := util.Max(start, b.TStart), util.Min(end, b.TStart+b.Size)
+		if first {
+			m.start = b.QStart + s - b.TStart
+			first = false
+		}
+		m.end = b.QStart + e - b.TStart
+		m.bases += e - s
+	}
+
+	return
+}
+
+// Lift a feature, returning the mapped features or a reason for failure to map. Features are
+// copied, with Location, Start, End and Strand altered to reflect the new coordinates. If the
+// feature is lifted to more than one chain, the returned features are ordered by descending
+// chain score.
+func (self *Lifter) Feature(f *feat.Feature) (lifted []*feat.Feature, err error) {
+	if f.End <= f.Start {
+		return self.point(f)
+	}
+
+	var (
+		ms      []mapping
+		pass    int
+		total   int
+		length  = float64(f.End - f.Start)
+		minBase = self.MinMatch * length
+	)
+	for _, c := range self.chains(f.Location, f.Start, f.End) {
+		m := mapRange(c, f.Start, f.End)
+		if m.bases == 0 {
+			continue
+		}
+		ms = append(ms, m)
+		total += m.bases
+		if float64(m.bases) >= minBase {
+			pass++
+		}
+	}
+
+	switch {
+	case len(ms) == 0:
+		return nil, ErrDeleted
+	case self.Multiple:
+		if float64(total) < minBase {
+			return nil, ErrPartiallyDeleted
+		}
+	case pass > 1:
+		return nil, ErrDuplicated
+	case pass == 0:
+		if float64(total) >= minBase {
+			return nil, ErrSplit
+		}
+		return nil, ErrPartiallyDeleted
+	}
+
+	for _, m := range ms {
+		if !self.Multiple && float64(m.bases) < minBase {
+			continue
+		}
+		lifted = append(lifted, liftTo(f, m.c, m.start, m.end))
+	}
+
+	return
+}
+
+// point lifts a zero-length feature.
+func (self *Lifter) point(f *feat.Feature) (lifted []*feat.Feature, err error) {
+	p := self.Position(f.Location, f.Start)
+	switch {
+	case len(p) == 0:
+		return nil, ErrDeleted
+	case len(p) > 1 && !self.Multiple:
+		return nil, ErrDuplicated
+	}
+	for _, pos := range p {
+		l := *f
+		l.Location, l.Start, l.End = pos.Location, pos.Pos, pos.Pos
+		l.Strand *= pos.Strand
+		lifted = append(lifted, &l)
+	}
+
+	return
+}
+
+// liftTo returns a copy of f placed on the query of c at [start, end) in query strand coordinates.
+func liftTo(f *feat.Feature, c *chain.Chain, start, end int) *feat.Feature {
+	l := *f
+	l.Location = c.QName
+	l.Start, l.End = queryCoords(c, start, end)
+	l.Strand *= c.QStrand
+
+	return &l
+}
+
+// Lift all features read from r, writing lifted features to w. Features that cannot be lifted
+// are passed to unmapped, if it is not nil, along with the reason for the failure. Features
+// without a Location, such as GFF metadata, are skipped. Lift returns the number of input
+// features that were lifted and that failed to lift, and any read or write error.
+func (self *Lifter) Lift(r featio.Reader, w Writer, unmapped func(*feat.Feature, error)) (mapped, failed int, err error) {
+	for {
+		var f *feat.Feature
+		f, err = r.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if f.Location == "" {
+			continue
+		}
+		lifted, reason := self.Feature(f)
+		if reason != nil {
+			failed++
+			if unmapped != nil {
+				unmapped(f, reason)
+			}
+			continue
+		}
+		mapped++
+		for _, l := range lifted {
+			if _, err = w.Write(l); err != nil {
+				return
+			}
+		}
+	}
+}
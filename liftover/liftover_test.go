@@ -0,0 +1,180 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package liftover
+
+import (
+	"code.google.com/p/biogo/feat"
+	"code.google.com/p/biogo/io/chain"
+	"io"
+	"io/ioutil"
+	check "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+// Helpers
+type featReader []*feat.Feature
+
+func (self *featReader) Read() (f *feat.Feature, err error) {
+	if len(*self) == 0 {
+		return nil, io.EOF
+	}
+	f, *self = (*self)[0], (*self)[1:]
+	return
+}
+
+type featWriter []*feat.Feature
+
+func (self *featWriter) Write(f *feat.Feature) (int, error) {
+	*self = append(*self, f)
+	return 0, nil
+}
+
+func newLifter(c *check.C) *Lifter {
+	l, err := NewFromReader(chain.NewReader(ioutil.NopCloser(strings.NewReader(chains))))
+	c.Assert(err, check.Equals, nil)
+	return l
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+const chains = `chain 1000 chr1 100 + 10 60 chrA 200 + 20 70 1
+20	5	5
+25
+
+chain 300 chr1 100 + 60 80 chrC 100 + 0 20 3
+20
+
+chain 500 chr2 100 + 0 30 chrB 50 - 5 35 2
+30
+
+chain 200 chr4 100 + 0 10 chrE 10 + 0 10 4
+10
+
+chain 100 chr4 100 + 0 10 chrF 10 + 0 10 5
+10
+
+chain 50 chr5 100 - 90 100 chrG 10 + 0 10 6
+10
+`
+
+func (s *S) TestPosition(c *check.C) {
+	l := newLifter(c)
+	for _, t := range []struct {
+		loc    string
+		pos    int
+		expect []Position
+	}{
+		{"chr1", 15, []Position{{"chrA", 25, 1}}},
+		{"chr1", 32, nil},
+		{"chr1", 59, []Position{{"chrA", 69, 1}}},
+		{"chr1", 60, []Position{{"chrC", 0, 1}}},
+		{"chr2", 0, []Position{{"chrB", 44, -1}}},
+		{"chr4", 3, []Position{{"chrE", 3, 1}, {"chrF", 3, 1}}},
+		{"chr5", 3, []Position{{"chrG", 6, -1}}},
+		{"chr3", 3, nil},
+	} {
+		c.Check(l.Position(t.loc, t.pos), check.DeepEquals, t.expect, check.Commentf("%s:%d", t.loc, t.pos))
+	}
+}
+
+func (s *S) TestFeature(c *check.C) {
+	l := newLifter(c)
+	for i, t := range []struct {
+		minMatch float64
+		multiple bool
+		f        feat.Feature
+		expect   []feat.Feature
+		err      error
+	}{
+		{0.95, false,
+			feat.Feature{ID: "a", Location: "chr1", Start: 10, End: 30, Strand: 1},
+			[]feat.Feature{{ID: "a", Location: "chrA", Start: 20, End: 40, Strand: 1}}, nil},
+		{0.95, false,
+			feat.Feature{ID: "b", Location: "chr1", Start: 25, End: 40, Strand: 1}, nil, ErrPartiallyDeleted},
+		{0.5, false,
+			feat.Feature{ID: "b", Location: "chr1", Start: 25, End: 40, Strand: 1},
+			[]feat.Feature{{ID: "b", Location: "chrA", Start: 35, End: 50, Strand: 1}}, nil},
+		{0.95, false,
+			feat.Feature{ID: "c", Location: "chr2", Start: 0, End: 10, Strand: 1},
+			[]feat.Feature{{ID: "c", Location: "chrB", Start: 35, End: 45, Strand: -1}}, nil},
+		{0.95, false,
+			feat.Feature{ID: "d", Location: "chr3", Start: 0, End: 10}, nil, ErrDeleted},
+		{0.95, false,
+			feat.Feature{ID: "e", Location: "chr1", Start: 30, End: 35}, nil, ErrDeleted},
+		{0.95, false,
+			feat.Feature{ID: "f", Location: "chr1", Start: 50, End: 70}, nil, ErrSplit},
+		{0.95, true,
+			feat.Feature{ID: "f", Location: "chr1", Start: 50, End: 70},
+			[]feat.Feature{
+				{ID: "f", Location: "chrA", Start: 60, End: 70},
+				{ID: "f", Location: "chrC", Start: 0, End: 10},
+			}, nil},
+		{0.95, false,
+			feat.Feature{ID: "g", Location: "chr4", Start: 0, End: 10}, nil, ErrDuplicated},
+		{0.95, true,
+			feat.Feature{ID: "g", Location: "chr4", Start: 0, End: 10, Strand: -1},
+			[]feat.Feature{
+				{ID: "g", Location: "chrE", Start: 0, End: 10, Strand: -1},
+				{ID: "g", Location: "chrF", Start: 0, End: 10, Strand: -1},
+			}, nil},
+		{0.95, false,
+			feat.Feature{ID: "h", Location: "chr5", Start: 0, End: 4, Strand: 1},
+			[]feat.Feature{{ID: "h", Location: "chrG", Start: 6, End: 10, Strand: -1}}, nil},
+		{0.95, false,
+			feat.Feature{ID: "i", Location: "chr1", Start: 15, End: 15},
+			[]feat.Feature{{ID: "i", Location: "chrA", Start: 25, End: 25}}, nil},
+	} {
+		l.MinMatch, l.Multiple = t.minMatch, t.multiple
+		f := t.f
+		lifted, err := l.Feature(&f)
+		c.Check(err, check.Equals, t.err, check.Commentf("Test %d", i))
+		var obtain []feat.Feature
+		for _, lf := range lifted {
+			obtain = append(obtain, *lf)
+		}
+		c.Check(obtain, check.DeepEquals, t.expect, check.Commentf("Test %d", i))
+		c.Check(f, check.DeepEquals, t.f)
+	}
+}
+
+func (s *S) TestLift(c *check.C) {
+	l := newLifter(c)
+	r := &featReader{
+		{ID: "a", Location: "chr1", Start: 10, End: 30},
+		{Meta: "gff-version 2"},
+		{ID: "d", Location: "chr3", Start: 0, End: 10},
+		{ID: "c", Location: "chr2", Start: 0, End: 10},
+	}
+	w := &featWriter{}
+	var failed []string
+	m, u, err := l.Lift(r, w, func(f *feat.Feature, reason error) {
+		c.Check(reason, check.Equals, ErrDeleted)
+		failed = append(failed, f.ID)
+	})
+	c.Check(err, check.Equals, nil)
+	c.Check(m, check.Equals, 2)
+	c.Check(u, check.Equals, 1)
+	c.Check(failed, check.DeepEquals, []string{"d"})
+	c.Assert(len(*w), check.Equals, 2)
+	c.Check((*w)[0].Location, check.Equals, "chrA")
+	c.Check((*w)[1].Location, check.Equals, "chrB")
+}
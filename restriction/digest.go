@@ -0,0 +1,323 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package restriction
+
+import (
+	"code.google.com/p/biogo/search"
+	"code.google.com/p/biogo/seq"
+	"fmt"
+	"sort"
+)
+
+// A Methylase is a DNA methyltransferase modifying bases of a recognition sequence.
+type Methylase struct {
+	Name string
+	Site string // Recognition sequence in IUPAC codes.
+	Pos  int    // Position of the modified base from the 5' end of the site, from 0.
+	Type int    // One of N4mC, C5mC or N6mA.
+}
+
+var (
+	Dam = Methylase{Name: "Dam", Site: "GATC", Pos: 1, Type: N6mA}
+	Dcm = Methylase{Name: "Dcm", Site: "CCWGG", Pos: 1, Type: C5mC}
+)
+
+// A Site is an occurrence of an enzyme recognition sequence.
+type Site struct {
+	Enzyme     *Enzyme
+	Start, End int   // Half-open interval of the site; End may exceed the sequence length on circular sequences.
+	Strand     int8  // Strand bearing the site; zero for palindromic sites.
+	Cuts       []Cut // Cleavage positions of the top and bottom strands, in top strand coordinates.
+	Blocked    bool  // Whether cleavage is blocked by methylation.
+}
+
+type methyl struct {
+	pos    int
+	strand int8
+	typ    int
+}
+
+// Sites returns the sites of e in s on both strands, ordered by start position. Cuts falling
+// outside a linear sequence are omitted. Sites that are methylated by any of the given
+// methylases at a position the enzyme is sensitive to are marked as blocked.
+func Sites(s *seq.Seq, e *Enzyme, methylases ...Methylase) []Site {
+	n := s.Len()
+	text := searchText(s, len(e.Site))
+	methylated := methylate(s, methylases)
+
+	var sites []Site
+	add := func(hits []search.Hit, strand int8) {
+		for _, h := range hits {
+			if h.Start >= n {
+				continue
+			}
+			site := Site{Enzyme: e, Start: h.Start, End: h.End, Strand: strand}
+			for _, c := range e.Cuts {
+				var t, b int
+				if strand < 0 {
+					t, b = h.End-c.Complement, h.End-c.Strand
+				} else {
+					t, b = h.Start+c.Strand, h.Start+c.Complement
+				}
+				if s.Circular {
+					t, b = wrap(t, n), wrap(t, n)+b-t
+				} else if t <= 0 || t >= n || b <= 0 || b >= n {
+					continue
+				}
+				site.Cuts = append(site.Cuts, Cut{t, b})
+			}
+			for _, m := range e.Methylation {
+				k := methyl{typ: m.Type}
+				if (m.Strand > 0) == (strand >= 0) {
+					k.pos, k.strand = h.Start+m.Pos, 1
+				} else {
+					k.pos, k.strand = h.End-1-m.Pos, -1
+				}
+				k.pos = wrap(k.pos, n)
+				if methylated[k] {
+					site.Blocked = true
+					break
+				}
+			}
+			sites = append(sites, site)
+		}
+	}
+	if e.Palindromic() {
+		add(e.pattern.Hamming(text, 0), 0)
+	} else {
+		add(e.pattern.Hamming(text, 0), 1)
+		add(e.rc.Hamming(text, 0), -1)
+	}
+	sort.Stable(byStart(sites))
+
+	return sites
+}
+
+// searchText returns the text of s to search for sites of length l, extended across the origin
+// of circular sequences.
+func searchText(s *seq.Seq, l int) []byte {
+	if !s.Circular || l < 2 || s.Len() == 0 {
+		return s.Seq
+	}
+	text := append([]byte(nil), s.Seq...)
+	for len(text) < s.Len()+l-1 {
+		text = append(text, s.Seq...)
+	}
+	return text[:s.Len()+l-1]
+}
+
+// methylate returns the set of bases of s methylated by the given methylases.
+func methylate(s *seq.Seq, methylases []Methylase) map[methyl]bool {
+	if len(methylases) == 0 {
+		return nil
+	}
+	n := s.Len()
+	m := make(map[methyl]bool)
+	for _, ms := range methylases {
+		p, err := search.Compile(ms.Site)
+		if err != nil {
+			continue
+		}
+		text := searchText(s, len(ms.Site))
+		for _, h := range p.Hamming(text, 0) {
+			if h.Start < n {
+				m[methyl{wrap(h.Start+ms.Pos, n), 1, ms.Type}] = true
+			}
+		}
+		for _, h := range p.RevComp().Hamming(text, 0) {
+			if h.Start < n {
+				m[methyl{wrap(h.End-1-ms.Pos, n), -1, ms.Type}] = true
+			}
+		}
+	}
+	return m
+}
+
+func wrap(i, n int) int {
+	if n == 0 {
+		return i
+	}
+	return ((i % n) + n) % n
+}
+
+type byStart []Site
+
+func (self byStart) Len() int           { return len(self) }
+func (self byStart) Less(i, j int) bool { return self[i].Start < self[j].Start }
+func (self byStart) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// An EndType describes the end of a restriction fragment.
+type EndType int
+
+const (
+	Native     EndType = iota // An end of the undigested linear sequence.
+	Blunt                     // A blunt end.
+	FivePrime                 // An end with a 5' overhang.
+	ThreePrime                // An end with a 3' overhang.
+)
+
+func (t EndType) String() string {
+	switch t {
+	case Native:
+		return "native"
+	case Blunt:
+		return "blunt"
+	case FivePrime:
+		return "5'"
+	case ThreePrime:
+		return "3'"
+	}
+	return fmt.Sprintf("EndType(%d)", int(t))
+}
+
+// An End is an end of a restriction fragment.
+type End struct {
+	Type     EndType
+	Overhang string // Top strand sequence of the single stranded region.
+	Enzyme   string // Name of the enzyme producing the end.
+}
+
+// A Fragment is a product of a restriction digest.
+type Fragment struct {
+	Seq         *seq.Seq // Top strand sequence of the fragment, including single stranded overhangs.
+	Start, End  int      // Top strand cleavage positions; End may exceed the sequence length on circular sequences.
+	Left, Right End
+}
+
+type cleavage struct {
+	Cut
+	enzyme string
+}
+
+type byPosition []cleavage
+
+func (self byPosition) Len() int { return len(self) }
+func (self byPosition) Less(i, j int) bool {
+	return self[i].Strand < self[j].Strand || (self[i].Strand == self[j].Strand && self[i].Complement < self[j].Complement)
+}
+func (self byPosition) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+// Digest returns the fragments resulting from complete digestion of s by the given enzymes,
+// ordered by start position. Cleavage by an enzyme is prevented at sites blocked by the given
+// methylases. Digestion of a circular sequence with n cuts results in n fragments, the last of
+// which spans the origin.
+func Digest(s *seq.Seq, enzymes []*Enzyme, methylases ...Methylase) []Fragment {
+	n := s.Len()
+	var cuts []cleavage
+	for _, e := range enzymes {
+		for _, site := range Sites(s, e, methylases...) {
+			if site.Blocked {
+				continue
+			}
+			for _, c := range site.Cuts {
+				cuts = append(cuts, cleavage{c, e.Name})
+			}
+		}
+	}
+	sort.Stable(byPosition(cuts))
+	for i := 0; i < len(cuts)-1; {
+		if cuts[i].Cut == cuts[i+1].Cut {
+			cuts = append(cuts[:i+1], cuts[i+2:]...)
+		} else {
+			i++
+		}
+	}
+
+	if s.Circular {
+		if len(cuts) == 0 {
+			f := fragment(s, cleavage{Cut{0, 0}, ""}, cleavage{Cut{n, n}, ""})
+			f.Seq.Circular = true
+			return []Fragment{f}
+		}
+		frags := make([]Fragment, len(cuts))
+		for i := range cuts {
+			right := cuts[(i+1)%len(cuts)]
+			if i == len(cuts)-1 {
+				right.Strand += n
+				right.Complement += n
+			}
+			frags[i] = fragment(s, cuts[i], right)
+		}
+		return frags
+	}
+
+	ends := make([]cleavage, 0, len(cuts)+2)
+	ends = append(ends, cleavage{Cut{0, 0}, ""})
+	ends = append(ends, cuts...)
+	ends = append(ends, cleavage{Cut{n, n}, ""})
+	frags := make([]Fragment, len(ends)-1)
+	for i := range frags {
+		frags[i] = fragment(s, ends[i], ends[i+1])
+	}
+	return frags
+}
+
+// fragment returns the fragment of s between the cleavages left and right.
+func fragment(s *seq.Seq, left, right cleavage) Fragment {
+	lo, hi := min(left.Strand, left.Complement), max(right.Strand, right.Complement)
+	f := Fragment{
+		Start: left.Strand,
+		End:   right.Strand,
+		Left:  end(s, left),
+		Right: end(s, right),
+	}
+	f.Seq = seq.New(fmt.Sprintf("%s:%d..%d", s.ID, f.Start, f.End), extract(s, lo, hi), nil)
+	f.Seq.Offset = s.Offset + lo
+	f.Seq.Moltype = s.Moltype
+	return f
+}
+
+// end returns the fragment end produced by c.
+func end(s *seq.Seq, c cleavage) End {
+	if c.enzyme == "" {
+		return End{Type: Native}
+	}
+	e := End{Enzyme: c.enzyme}
+	switch {
+	case c.Complement > c.Strand:
+		e.Type = FivePrime
+	case c.Complement < c.Strand:
+		e.Type = ThreePrime
+	default:
+		e.Type = Blunt
+	}
+	e.Overhang = string(extract(s, min(c.Strand, c.Complement), max(c.Strand, c.Complement)))
+	return e
+}
+
+// extract returns a copy of the bases of s in [start, end), wrapping circular sequences.
+func extract(s *seq.Seq, start, end int) []byte {
+	n := s.Len()
+	b := make([]byte, 0, end-start)
+	for i := start; i < end; i++ {
+		b = append(b, s.Seq[wrap(i, n)])
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,214 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package restriction provides restriction enzyme data from REBASE and in-silico restriction
+// digestion of nucleic acid sequences.
+//
+// Cut positions are given as the number of bases from the first base of a recognition site, on
+// the strand bearing the site, to the point of cleavage, so EcoRI, G^AATTC, cuts its site strand
+// at 1 and the complementary strand at 5, both in the coordinates of the site strand.
+package restriction
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/search"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Cut is a pair of cleavage positions on the two strands of a recognition site.
+type Cut struct {
+	Strand, Complement int
+}
+
+// Overhang returns the length of the single-stranded overhang left by the cut. Positive values
+// indicate 5' overhangs, negative values 3' overhangs and zero blunt ends.
+func (c Cut) Overhang() int { return c.Complement - c.Strand }
+
+// Methylation types.
+const (
+	N4mC = 4 // N4-methylcytosine.
+	C5mC = 5 // 5-methylcytosine.
+	N6mA = 6 // N6-methyladenine.
+)
+
+// A Methylation is a methylated base within a recognition site.
+type Methylation struct {
+	Pos    int  // Position of the base from the 5' end of its strand of the site.
+	Strand int8 // 1 for the site strand, -1 for the complementary strand.
+	Type   int  // One of N4mC, C5mC or N6mA.
+}
+
+// An Enzyme is a restriction enzyme.
+type Enzyme struct {
+	Name          string
+	Isoschizomers []string
+	Site          string // Recognition sequence in IUPAC codes.
+	Cuts          []Cut  // Zero, one or two cuts; no cuts indicates unknown cleavage positions.
+	Methylation   []Methylation
+	Suppliers     string // REBASE commercial supplier codes.
+
+	pattern, rc *search.Pattern
+}
+
+// NewEnzyme returns an enzyme with the given name and site in REBASE notation. Cleavage positions
+// are specified either by a caret within the site, in which case the complementary strand is
+// taken to be cut symmetrically, or by (strand/complement) offsets before or after the site, as
+// in "G^AATTC", "GGTGA(8/7)" or "(10/15)ACNNNNGTAYC(12/7)".
+func NewEnzyme(name, site string) (*Enzyme, error) {
+	e := &Enzyme{Name: name}
+	var (
+		before, after string
+		caret         = -1
+	)
+	if strings.HasPrefix(site, "(") {
+		i := strings.Index(site, ")")
+		if i < 0 {
+			return nil, bio.NewError("restriction: malformed site", 0, name, site)
+		}
+		before, site = site[1:i], site[i+1:]
+	}
+	if i := strings.Index(site, "("); i >= 0 {
+		if !strings.HasSuffix(site, ")") {
+			return nil, bio.NewError("restriction: malformed site", 0, name, site)
+		}
+		site, after = site[:i], site[i+1:len(site)-1]
+	}
+	if i := strings.Index(site, "^"); i >= 0 {
+		caret = i
+		site = site[:i] + site[i+1:]
+	}
+	e.Site = strings.ToUpper(site)
+	if err := e.compile(); err != nil {
+		return nil, err
+	}
+
+	n := len(e.Site)
+	switch {
+	case caret >= 0 && (before != "" || after != ""):
+		return nil, bio.NewError("restriction: caret and offsets in site", 0, name)
+	case caret >= 0:
+		e.Cuts = []Cut{{caret, n - caret}}
+	}
+	if before != "" {
+		s, c, err := offsets(before)
+		if err != nil {
+			return nil, err
+		}
+		e.Cuts = append(e.Cuts, Cut{-s, -c})
+	}
+	if after != "" {
+		s, c, err := offsets(after)
+		if err != nil {
+			return nil, err
+		}
+		e.Cuts = append(e.Cuts, Cut{n + s, n + c})
+	}
+
+	return e, nil
+}
+
+func (e *Enzyme) compile() error {
+	var err error
+	if e.pattern, err = search.Compile(e.Site); err != nil {
+		return err
+	}
+	e.rc = e.pattern.RevComp()
+	return nil
+}
+
+func offsets(s string) (int, int, error) {
+	f := strings.Split(s, "/")
+	if len(f) != 2 {
+		return 0, 0, bio.NewError("restriction: malformed cut offsets", 0, s)
+	}
+	a, err := strconv.Atoi(f[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.Atoi(f[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// Palindromic returns whether the recognition site is its own reverse complement.
+func (e *Enzyme) Palindromic() bool { return e.rc.String() == e.pattern.String() }
+
+// Blunt returns whether all of the enzyme's cuts leave blunt ends.
+func (e *Enzyme) Blunt() bool {
+	for _, c := range e.Cuts {
+		if c.Overhang() != 0 {
+			return false
+		}
+	}
+	return len(e.Cuts) > 0
+}
+
+// String returns the site of the enzyme in REBASE notation.
+func (e *Enzyme) String() string {
+	n := len(e.Site)
+	if len(e.Cuts) == 1 {
+		c := e.Cuts[0]
+		if c.Strand >= 0 && c.Strand <= n && c.Complement == n-c.Strand {
+			return e.Site[:c.Strand] + "^" + e.Site[c.Strand:]
+		}
+	}
+	s := e.Site
+	for _, c := range e.Cuts {
+		if c.Strand < 0 || c.Complement < 0 {
+			s = fmt.Sprintf("(%d/%d)%s", -c.Strand, -c.Complement, s)
+		} else {
+			s = fmt.Sprintf("%s(%d/%d)", s, c.Strand-n, c.Complement-n)
+		}
+	}
+	return s
+}
+
+// parseMethylation parses a REBASE methylation field, a comma separated list of base positions,
+// counted from 1 at the 5' end of the site strand, or as negative numbers from the 5' end of
+// the complementary strand, each followed by the methylation type in parentheses, as in "2(6)".
+func parseMethylation(s string) ([]Methylation, error) {
+	var m []Methylation
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		i := strings.Index(f, "(")
+		if i < 0 || !strings.HasSuffix(f, ")") {
+			return nil, bio.NewError("restriction: malformed methylation", 0, s)
+		}
+		p, err := strconv.Atoi(f[:i])
+		if err != nil {
+			return nil, err
+		}
+		t, err := strconv.Atoi(f[i+1 : len(f)-1])
+		if err != nil {
+			return nil, err
+		}
+		var strand int8 = 1
+		if p < 0 {
+			p, strand = -p, -1
+		}
+		if p == 0 {
+			return nil, bio.NewError("restriction: malformed methylation", 0, s)
+		}
+		m = append(m, Methylation{Pos: p - 1, Strand: strand, Type: t})
+	}
+	return m, nil
+}
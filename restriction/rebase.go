@@ -0,0 +1,205 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package restriction
+
+import (
+	"bufio"
+	"code.google.com/p/biogo/bio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A Format is a REBASE enzyme data format.
+type Format int
+
+const (
+	Withrefm Format = iota // REBASE format #31, withrefm, with fields tagged <1> to <8>.
+	Emboss                 // REBASE format #34, emboss_e.
+)
+
+// REBASE format reader type.
+type Reader struct {
+	f      io.ReadCloser
+	r      *bufio.Reader
+	Format Format
+	line   int
+	next   string // First line of the next withrefm record.
+}
+
+// Returns a new REBASE format reader using f.
+func NewReader(f io.ReadCloser, format Format) *Reader {
+	return &Reader{
+		f:      f,
+		r:      bufio.NewReader(f),
+		Format: format,
+	}
+}
+
+// Returns a new REBASE reader using a filename.
+func NewReaderName(name string, format Format) (r *Reader, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	return NewReader(f, format), nil
+}
+
+func (self *Reader) readLine() (string, error) {
+	line, err := self.r.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	self.line++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Read a single enzyme and return it or an error. Enzymes with unknown recognition sequences
+// are skipped.
+func (self *Reader) Read() (*Enzyme, error) {
+	for {
+		var (
+			e   *Enzyme
+			err error
+		)
+		switch self.Format {
+		case Withrefm:
+			e, err = self.readWithrefm()
+		case Emboss:
+			e, err = self.readEmboss()
+		default:
+			return nil, bio.NewError("restriction: unknown format", 0, self.Format)
+		}
+		if err != nil || e != nil {
+			return e, err
+		}
+	}
+}
+
+// readWithrefm reads a withrefm record, returning a nil enzyme for records without a known site.
+func (self *Reader) readWithrefm() (*Enzyme, error) {
+	fields := map[int]string{}
+	line := self.next
+	self.next = ""
+	for {
+		if strings.HasPrefix(line, "<") {
+			i := strings.Index(line, ">")
+			if i < 0 {
+				return nil, bio.NewError(fmt.Sprintf("restriction: malformed field on line %d", self.line), 0, line)
+			}
+			tag, err := strconv.Atoi(line[1:i])
+			if err != nil {
+				return nil, bio.NewError(fmt.Sprintf("restriction: malformed field on line %d", self.line), 0, line)
+			}
+			if tag == 1 && len(fields) > 0 {
+				self.next = line
+				break
+			}
+			fields[tag] = strings.TrimSpace(line[i+1:])
+		}
+
+		var err error
+		line, err = self.readLine()
+		if err == io.EOF && len(fields) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name, site := fields[1], fields[3]
+	if name == "" {
+		return nil, bio.NewError(fmt.Sprintf("restriction: record without name before line %d", self.line), 0)
+	}
+	if site == "" || strings.Contains(site, "?") {
+		return nil, nil
+	}
+	e, err := NewEnzyme(name, site)
+	if err != nil {
+		return nil, err
+	}
+	if iso := fields[2]; iso != "" {
+		e.Isoschizomers = strings.Split(iso, ",")
+	}
+	if e.Methylation, err = parseMethylation(fields[4]); err != nil {
+		return nil, err
+	}
+	e.Suppliers = fields[7]
+
+	return e, nil
+}
+
+// readEmboss reads an emboss_e line, returning a nil enzyme for lines without a known site.
+func (self *Reader) readEmboss() (*Enzyme, error) {
+	var line string
+	for {
+		var err error
+		if line, err = self.readLine(); err != nil {
+			return nil, err
+		}
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			break
+		}
+	}
+
+	f := strings.Fields(line)
+	if len(f) < 9 {
+		return nil, bio.NewError(fmt.Sprintf("restriction: too few fields on line %d", self.line), 0, line)
+	}
+	var v [7]int
+	for i := range v {
+		var err error
+		if v[i], err = strconv.Atoi(f[i+2]); err != nil {
+			return nil, bio.NewError(fmt.Sprintf("restriction: malformed field on line %d", self.line), 0, line)
+		}
+	}
+	if f[1] == "?" {
+		return nil, nil
+	}
+
+	e := &Enzyme{Name: f[0], Site: strings.ToUpper(f[1])}
+	if err := e.compile(); err != nil {
+		return nil, err
+	}
+	// Cut positions follow the numbered base, with no base zero upstream of the site.
+	pos := func(p int) int {
+		if p <= 0 {
+			return p + 1
+		}
+		return p
+	}
+	switch ncuts := v[1]; ncuts {
+	case 0:
+	case 2, 4:
+		e.Cuts = append(e.Cuts, Cut{pos(v[3]), pos(v[4])})
+		if ncuts == 4 {
+			e.Cuts = append(e.Cuts, Cut{pos(v[5]), pos(v[6])})
+		}
+	default:
+		return nil, bio.NewError(fmt.Sprintf("restriction: invalid cut count on line %d", self.line), 0, line)
+	}
+
+	return e, nil
+}
+
+// Close the reader.
+func (self *Reader) Close() error { return self.f.Close() }
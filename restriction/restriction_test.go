@@ -0,0 +1,313 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package restriction
+
+import (
+	"bytes"
+	"code.google.com/p/biogo/seq"
+	"io"
+	check "launchpad.net/gocheck"
+	"testing"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+type B struct{ *bytes.Buffer }
+
+func (b B) Close() error { return nil }
+
+const withrefm = `REBASE version 510                                              withrefm.510
+
+    =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+    REBASE, The Restriction Enzyme Database   http://rebase.neb.com
+    =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+<1>AbaB8342IV
+<2>
+<3>?
+<4>
+<5>Acinetobacter baumannii B8342
+<6>
+<7>
+<8>Sullivan, D.J.
+
+<1>BcgI
+<2>
+<3>(10/12)CGANNNNNNTGC(12/10)
+<4>
+<5>Bacillus coagulans
+<6>ATCC 27811
+<7>N
+<8>Kong, H., Morgan, R.D.
+
+<1>EcoRI
+<2>
+<3>G^AATTC
+<4>3(6)
+<5>Escherichia coli RY13
+<6>R.N. Yoshimori
+<7>ABCFGHIJKMNOQRSVXY
+<8>Greene, P.J., Boyer, H.W.
+
+<1>HphI
+<2>AsuHPI
+<3>GGTGA(8/7)
+<4>
+<5>Haemophilus parahaemolyticus
+<6>ATCC 10014
+<7>N
+<8>Kleid, D.G.
+
+<1>MboI
+<2>AspMDI,BfuCI,Bsp143I
+<3>^GATC
+<4>2(6),-2(6)
+<5>Moraxella bovis
+<6>ATCC 10900
+<7>ABCFKNQRX
+<8>Gelinas, R.E., Myers, P.A., Roberts, R.J.
+`
+
+const emboss = `#
+# REBASE version 510                                              emboss_e.510
+#
+BcgI	CGANNNNNNTGC	12	4	0	-11	-13	24	22
+EcoRI	GAATTC	6	2	0	1	5	0	0
+HphI	GGTGA	5	2	0	13	12	0	0
+Unk	?	0	0	0	0	0	0	0
+XbaI	tctaga	6	2	0	1	5	0	0
+`
+
+func readAll(c *check.C, r *Reader) []*Enzyme {
+	var enzymes []*Enzyme
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.Equals, nil)
+		enzymes = append(enzymes, e)
+	}
+	return enzymes
+}
+
+func (s *S) TestReadWithrefm(c *check.C) {
+	enzymes := readAll(c, NewReader(B{bytes.NewBufferString(withrefm)}, Withrefm))
+	c.Assert(len(enzymes), check.Equals, 4)
+	for i, t := range []struct {
+		name  string
+		iso   []string
+		site  string
+		cuts  []Cut
+		meth  []Methylation
+		suppl string
+	}{
+		{"BcgI", nil, "CGANNNNNNTGC", []Cut{{-10, -12}, {24, 22}}, nil, "N"},
+		{"EcoRI", nil, "GAATTC", []Cut{{1, 5}}, []Methylation{{2, 1, N6mA}}, "ABCFGHIJKMNOQRSVXY"},
+		{"HphI", []string{"AsuHPI"}, "GGTGA", []Cut{{13, 12}}, nil, "N"},
+		{"MboI", []string{"AspMDI", "BfuCI", "Bsp143I"}, "GATC", []Cut{{0, 4}}, []Methylation{{1, 1, N6mA}, {1, -1, N6mA}}, "ABCFKNQRX"},
+	} {
+		e := enzymes[i]
+		c.Check(e.Name, check.Equals, t.name)
+		c.Check(e.Isoschizomers, check.DeepEquals, t.iso)
+		c.Check(e.Site, check.Equals, t.site)
+		c.Check(e.Cuts, check.DeepEquals, t.cuts)
+		c.Check(e.Methylation, check.DeepEquals, t.meth)
+		c.Check(e.Suppliers, check.Equals, t.suppl)
+	}
+}
+
+func (s *S) TestReadEmboss(c *check.C) {
+	enzymes := readAll(c, NewReader(B{bytes.NewBufferString(emboss)}, Emboss))
+	c.Assert(len(enzymes), check.Equals, 4)
+	for i, t := range []struct {
+		name, site, rebase string
+	}{
+		{"BcgI", "CGANNNNNNTGC", "(10/12)CGANNNNNNTGC(12/10)"},
+		{"EcoRI", "GAATTC", "G^AATTC"},
+		{"HphI", "GGTGA", "GGTGA(8/7)"},
+		{"XbaI", "TCTAGA", "T^CTAGA"},
+	} {
+		c.Check(enzymes[i].Name, check.Equals, t.name)
+		c.Check(enzymes[i].Site, check.Equals, t.site)
+		c.Check(enzymes[i].String(), check.Equals, t.rebase)
+	}
+}
+
+func (s *S) TestNewEnzyme(c *check.C) {
+	for _, t := range []struct {
+		site        string
+		cuts        []Cut
+		palindromic bool
+		blunt       bool
+	}{
+		{"G^AATTC", []Cut{{1, 5}}, true, false},
+		{"CTGCA^G", []Cut{{5, 1}}, true, false},
+		{"CCC^GGG", []Cut{{3, 3}}, true, true},
+		{"GACNNN^NNGTC", []Cut{{6, 5}}, true, false},
+		{"GGTGA(8/7)", []Cut{{13, 12}}, false, false},
+		{"(10/12)CGANNNNNNTGC(12/10)", []Cut{{-10, -12}, {24, 22}}, false, false},
+		{"GATGNNNN", nil, false, false},
+	} {
+		e, err := NewEnzyme("test", t.site)
+		c.Assert(err, check.Equals, nil)
+		c.Check(e.Cuts, check.DeepEquals, t.cuts)
+		c.Check(e.Palindromic(), check.Equals, t.palindromic)
+		c.Check(e.Blunt(), check.Equals, t.blunt)
+		c.Check(e.String(), check.Equals, t.site)
+	}
+	for _, site := range []string{"G^AATTC(1/1)", "(1/1GAATTC", "GAATTC(1)", "GAXTTC", ""} {
+		_, err := NewEnzyme("bad", site)
+		c.Check(err, check.NotNil, check.Commentf("site %q", site))
+	}
+}
+
+func mustEnzyme(c *check.C, name, site, meth string) *Enzyme {
+	e, err := NewEnzyme(name, site)
+	c.Assert(err, check.Equals, nil)
+	e.Methylation, err = parseMethylation(meth)
+	c.Assert(err, check.Equals, nil)
+	return e
+}
+
+func (s *S) TestSites(c *check.C) {
+	ecoRI := mustEnzyme(c, "EcoRI", "G^AATTC", "")
+	hphI := mustEnzyme(c, "HphI", "GGTGA(8/7)", "")
+	for _, t := range []struct {
+		seq      string
+		circular bool
+		e        *Enzyme
+		sites    []Site
+	}{
+		{"AAGAATTCAA", false, ecoRI, []Site{{Enzyme: ecoRI, Start: 2, End: 8, Strand: 0, Cuts: []Cut{{3, 7}}}}},
+		{"GAATTCAA", false, ecoRI, []Site{{Enzyme: ecoRI, Start: 0, End: 6, Strand: 0, Cuts: []Cut{{1, 5}}}}},
+		{"ATTCAAAAAAGA", false, ecoRI, nil},
+		{"ATTCAAAAAAGA", true, ecoRI, []Site{{Enzyme: ecoRI, Start: 10, End: 16, Strand: 0, Cuts: []Cut{{11, 15}}}}},
+		{"GGTGAAAAAAAAAAAAAATCACCAAAAAAAAAA", false, hphI, []Site{
+			{Enzyme: hphI, Start: 0, End: 5, Strand: 1, Cuts: []Cut{{13, 12}}},
+			{Enzyme: hphI, Start: 18, End: 23, Strand: -1, Cuts: []Cut{{11, 10}}},
+		}},
+		// The reverse strand cuts fall before the start of the sequence.
+		{"AAATCACCAAAAAAAAAA", false, hphI, []Site{{Enzyme: hphI, Start: 3, End: 8, Strand: -1}}},
+		{"AAATCACCAAAAAAAAAA", true, hphI, []Site{{Enzyme: hphI, Start: 3, End: 8, Strand: -1, Cuts: []Cut{{14, 13}}}}},
+	} {
+		sq := seq.New("test", []byte(t.seq), nil)
+		sq.Circular = t.circular
+		c.Check(Sites(sq, t.e), check.DeepEquals, t.sites, check.Commentf("%s %v", t.seq, t.circular))
+	}
+}
+
+func (s *S) TestMethylation(c *check.C) {
+	sq := seq.New("test", []byte("AAGATCAACCAGGAA"), nil)
+	for _, t := range []struct {
+		e       *Enzyme
+		dam     bool
+		dcm     bool
+		blocked bool
+	}{
+		{mustEnzyme(c, "MboI", "^GATC", "2(6),-2(6)"), true, false, true},
+		{mustEnzyme(c, "MboI", "^GATC", "2(6),-2(6)"), false, true, false},
+		{mustEnzyme(c, "Sau3AI", "^GATC", "4(5)"), true, false, false},
+		{mustEnzyme(c, "EcoRII", "^CCWGG", "2(5)"), false, true, true},
+		{mustEnzyme(c, "BstNI", "CC^WGG", "-4(4)"), false, true, false},
+	} {
+		var ms []Methylase
+		if t.dam {
+			ms = append(ms, Dam)
+		}
+		if t.dcm {
+			ms = append(ms, Dcm)
+		}
+		sites := Sites(sq, t.e, ms...)
+		c.Assert(len(sites), check.Equals, 1)
+		c.Check(sites[0].Blocked, check.Equals, t.blocked, check.Commentf("%s dam:%v dcm:%v", t.e.Name, t.dam, t.dcm))
+	}
+
+	mboI := mustEnzyme(c, "MboI", "^GATC", "2(6),-2(6)")
+	c.Check(len(Digest(sq, []*Enzyme{mboI})), check.Equals, 2)
+	c.Check(len(Digest(sq, []*Enzyme{mboI}, Dam)), check.Equals, 1)
+}
+
+type frag struct {
+	seq         string
+	start, end  int
+	left, right End
+}
+
+func fragments(fs []Fragment) []frag {
+	var r []frag
+	for _, f := range fs {
+		r = append(r, frag{string(f.Seq.Seq), f.Start, f.End, f.Left, f.Right})
+	}
+	return r
+}
+
+func (s *S) TestDigest(c *check.C) {
+	var (
+		ecoRI = mustEnzyme(c, "EcoRI", "G^AATTC", "")
+		bamHI = mustEnzyme(c, "BamHI", "G^GATCC", "")
+		pstI  = mustEnzyme(c, "PstI", "CTGCA^G", "")
+		smaI  = mustEnzyme(c, "SmaI", "CCC^GGG", "")
+	)
+	for _, t := range []struct {
+		seq      string
+		circular bool
+		enzymes  []*Enzyme
+		frags    []frag
+	}{
+		{"AAGAATTCAA", false, []*Enzyme{ecoRI}, []frag{
+			{"AAGAATT", 0, 3, End{Type: Native}, End{FivePrime, "AATT", "EcoRI"}},
+			{"AATTCAA", 3, 10, End{FivePrime, "AATT", "EcoRI"}, End{Type: Native}},
+		}},
+		{"AACTGCAGAA", false, []*Enzyme{pstI}, []frag{
+			{"AACTGCA", 0, 7, End{Type: Native}, End{ThreePrime, "TGCA", "PstI"}},
+			{"TGCAGAA", 7, 10, End{ThreePrime, "TGCA", "PstI"}, End{Type: Native}},
+		}},
+		{"AACCCGGGAA", false, []*Enzyme{smaI, ecoRI}, []frag{
+			{"AACCC", 0, 5, End{Type: Native}, End{Blunt, "", "SmaI"}},
+			{"GGGAA", 5, 10, End{Blunt, "", "SmaI"}, End{Type: Native}},
+		}},
+		{"AAAAAAAAAA", false, []*Enzyme{ecoRI}, []frag{
+			{"AAAAAAAAAA", 0, 10, End{Type: Native}, End{Type: Native}},
+		}},
+		{"GAATTCAAAAGGATCCAAAA", true, []*Enzyme{bamHI, ecoRI}, []frag{
+			{"AATTCAAAAGGATC", 1, 11, End{FivePrime, "AATT", "EcoRI"}, End{FivePrime, "GATC", "BamHI"}},
+			{"GATCCAAAAGAATT", 11, 21, End{FivePrime, "GATC", "BamHI"}, End{FivePrime, "AATT", "EcoRI"}},
+		}},
+		{"GAATTCAAAAGGATCCAAAA", true, []*Enzyme{ecoRI}, []frag{
+			{"AATTCAAAAGGATCCAAAAGAATT", 1, 21, End{FivePrime, "AATT", "EcoRI"}, End{FivePrime, "AATT", "EcoRI"}},
+		}},
+		{"GAATTCAAAAGGATCCAAAA", true, []*Enzyme{pstI}, []frag{
+			{"GAATTCAAAAGGATCCAAAA", 0, 20, End{Type: Native}, End{Type: Native}},
+		}},
+	} {
+		sq := seq.New("test", []byte(t.seq), nil)
+		sq.Circular = t.circular
+		c.Check(fragments(Digest(sq, t.enzymes)), check.DeepEquals, t.frags, check.Commentf("%s %v", t.seq, t.circular))
+	}
+
+	sq := seq.New("p", []byte("GAATTCAAAAGGATCCAAAA"), nil)
+	sq.Circular = true
+	fs := Digest(sq, []*Enzyme{ecoRI, ecoRI})
+	c.Assert(len(fs), check.Equals, 1)
+	c.Check(fs[0].Seq.ID, check.Equals, "p:1..21")
+	c.Check(fs[0].Seq.Circular, check.Equals, false)
+}
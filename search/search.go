@@ -0,0 +1,341 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package search provides approximate searching for nucleic acid patterns containing IUPAC
+// ambiguity codes. Hamming distance search uses the Shift-And algorithm with mismatches and
+// edit distance search uses the bit-vector algorithm described in:
+//  A fast bit-vector algorithm for approximate string matching based on dynamic programming.
+//   G. Myers. J. ACM 46:395-415 (1999).
+package search
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/exp/seq"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	"code.google.com/p/biogo/feat"
+	oseq "code.google.com/p/biogo/seq"
+	"fmt"
+	"sort"
+)
+
+// MaxLen is the maximum pattern length.
+const MaxLen = 64
+
+// Base sets of the IUPAC nucleotide codes.
+var iupac = func() (t [256]byte) {
+	const a, c, g, u = 1, 2, 4, 8
+	for b, v := range map[byte]byte{
+		'A': a, 'C': c, 'G': g, 'T': u, 'U': u,
+		'R': a | g, 'Y': c | u, 'S': c | g, 'W': a | u, 'K': g | u, 'M': a | c,
+		'B': c | g | u, 'D': a | g | u, 'H': a | c | u, 'V': a | c | g,
+		'N': a | c | g | u,
+	} {
+		t[b], t[b+'a'-'A'] = v, v
+	}
+	return
+}()
+
+// complement returns the IUPAC complement of b.
+func complement(b byte) byte {
+	for _, c := range []byte("ACGTRYSWKMBDHVN") {
+		if iupac[c] == reverseSet(iupac[b]) {
+			return c
+		}
+	}
+	return b
+}
+
+func reverseSet(s byte) byte {
+	return s&1<<3 | s&2<<1 | s&4>>1 | s&8>>3
+}
+
+// A Pattern is a compiled nucleic acid pattern.
+type Pattern struct {
+	pattern string
+	masks   [256]uint64 // Bit i of masks[c] is set if text letter c matches pattern position i.
+	high    uint64
+	mask    uint64
+}
+
+// Compile a pattern of IUPAC nucleotide codes. A text letter matches a pattern position when
+// all the bases it represents are represented by the pattern code, so an N in the text matches
+// only an N in the pattern.
+func Compile(pattern string) (*Pattern, error) {
+	switch {
+	case len(pattern) == 0:
+		return nil, bio.NewError("search: empty pattern", 0)
+	case len(pattern) > MaxLen:
+		return nil, bio.NewError(fmt.Sprintf("search: pattern longer than %d", MaxLen), 0, pattern)
+	}
+	self := &Pattern{
+		pattern: pattern,
+		high:    1 << uint(len(pattern)-1),
+		mask:    ^uint64(0) >> uint(MaxLen-len(pattern)),
+	}
+	for i := 0; i < len(pattern); i++ {
+		p := iupac[pattern[i]]
+		if p == 0 {
+			return nil, bio.NewError(fmt.Sprintf("search: invalid pattern letter %q", pattern[i]), 0, pattern)
+		}
+		for c, t := range iupac {
+			if t != 0 && t&^p == 0 {
+				self.masks[c] |= 1 << uint(i)
+			}
+		}
+	}
+	return self, nil
+}
+
+// Return the pattern string.
+func (self *Pattern) String() string { return self.pattern }
+
+// Return the length of the pattern.
+func (self *Pattern) Len() int { return len(self.pattern) }
+
+// Return the reverse complement of the pattern.
+func (self *Pattern) RevComp() *Pattern {
+	rc := make([]byte, len(self.pattern))
+	for i := range rc {
+		rc[len(rc)-1-i] = complement(self.pattern[i])
+	}
+	p, _ := Compile(string(rc))
+	return p
+}
+
+// A Hit is an approximate occurrence of a pattern in a text.
+type Hit struct {
+	Start, End int // Half-open interval of the text matching the pattern.
+	Errors     int
+	Strand     int8 // Strand of the text matched by the pattern; zero for palindromic patterns.
+}
+
+// Return the occurrences of the pattern in s with at most k mismatches.
+func (self *Pattern) Hamming(s []byte, k int) (hits []Hit) {
+	r := make([]uint64, k+1)
+	for j, c := range s {
+		b := self.masks[c]
+		prev := r[0]
+		r[0] = (r[0]<<1 | 1) & b
+		for e := 1; e <= k; e++ {
+			t := r[e]
+			r[e] = (r[e]<<1|1)&b | (prev<<1 | 1)
+			prev = t
+		}
+		for e, v := range r {
+			if v&self.high != 0 {
+				hits = append(hits, Hit{Start: j + 1 - len(self.pattern), End: j + 1, Errors: e, Strand: 1})
+				break
+			}
+		}
+	}
+	return
+}
+
+// Return the occurrences of the pattern in s with an edit distance of at most k. Of each run of
+// adjacent end positions within k edits, only the end with the fewest edits is reported, and the
+// start is chosen to minimise the edit distance.
+func (self *Pattern) Edit(s []byte, k int) (hits []Hit) {
+	m := len(self.pattern)
+	var (
+		pv    = self.mask
+		mv    uint64
+		score = m
+
+		inRun bool
+		best  Hit
+	)
+	for j, c := range s {
+		eq := self.masks[c]
+		xv := eq | mv
+		xh := ((eq&pv)+pv)^pv | eq
+		ph := mv | ^(xh | pv)
+		mh := pv & xh
+		if ph&self.high != 0 {
+			score++
+		} else if mh&self.high != 0 {
+			score--
+		}
+		ph <<= 1
+		mh <<= 1
+		pv = (mh | ^(xv | ph)) & self.mask
+		mv = ph & xv
+
+		if score <= k {
+			if !inRun || score < best.Errors {
+				best = Hit{End: j + 1, Errors: score, Strand: 1}
+			}
+			inRun = true
+		} else if inRun {
+			hits = append(hits, self.start(s, best))
+			inRun = false
+		}
+	}
+	if inRun {
+		hits = append(hits, self.start(s, best))
+	}
+	return
+}
+
+// start finds the start of the hit h by aligning the reversed pattern to the text preceding h.End.
+func (self *Pattern) start(s []byte, h Hit) Hit {
+	m := len(self.pattern)
+	w := m + h.Errors
+	if w > h.End {
+		w = h.End
+	}
+	// d[i][j] is the edit distance of the last i pattern letters to the last j window letters.
+	prev, cur := make([]int, w+1), make([]int, w+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= m; i++ {
+		cur[0] = i
+		for j := 1; j <= w; j++ {
+			d := prev[j-1]
+			if self.masks[s[h.End-j]]&(1<<uint(m-i)) == 0 {
+				d++
+			}
+			if v := prev[j] + 1; v < d {
+				d = v
+			}
+			if v := cur[j-1] + 1; v < d {
+				d = v
+			}
+			cur[j] = d
+		}
+		prev, cur = cur, prev
+	}
+	bestJ := -1
+	for j, d := range prev {
+		if bestJ < 0 || d < prev[bestJ] || (d == prev[bestJ] && abs(j-m) < abs(bestJ-m)) {
+			bestJ = j
+		}
+	}
+	h.Start = h.End - bestJ
+	h.Errors = prev[bestJ]
+	return h
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// A Searcher finds approximate occurrences of a pattern on both strands of a sequence.
+type Searcher struct {
+	Name   string // ID given to features describing hits.
+	K      int    // Maximum number of errors.
+	Indels bool   // Count insertions and deletions as errors by using edit distance.
+
+	fwd, rev *Pattern
+}
+
+// Return a new Searcher for pattern allowing up to k errors.
+func NewSearcher(name, pattern string, k int, indels bool) (*Searcher, error) {
+	p, err := Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if k < 0 || k >= p.Len() {
+		return nil, bio.NewError(fmt.Sprintf("search: illegal error count: %d", k), 0, k)
+	}
+	self := &Searcher{Name: name, K: k, Indels: indels, fwd: p}
+	if rc := p.RevComp(); rc.pattern != p.pattern {
+		self.rev = rc
+	}
+	return self, nil
+}
+
+// Return the hits of the pattern on both strands of s ordered by position. Hits of a pattern
+// that is its own reverse complement are reported once with a strand of zero.
+func (self *Searcher) Search(s []byte) []Hit {
+	find := (*Pattern).Hamming
+	if self.Indels {
+		find = (*Pattern).Edit
+	}
+	hits := find(self.fwd, s, self.K)
+	if self.rev == nil {
+		for i := range hits {
+			hits[i].Strand = 0
+		}
+		return hits
+	}
+	for _, h := range find(self.rev, s, self.K) {
+		h.Strand = -1
+		hits = append(hits, h)
+	}
+	sort.Sort(byStart(hits))
+	return hits
+}
+
+type byStart []Hit
+
+func (self byStart) Len() int { return len(self) }
+func (self byStart) Less(i, j int) bool {
+	if self[i].Start != self[j].Start {
+		return self[i].Start < self[j].Start
+	}
+	return self[i].Strand > self[j].Strand
+}
+func (self byStart) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+
+func (self *Searcher) features(hits []Hit, loc string, offset int, strand int8) []*feat.Feature {
+	f := make([]*feat.Feature, len(hits))
+	for i, h := range hits {
+		errs := float64(h.Errors)
+		f[i] = &feat.Feature{
+			ID:         self.Name,
+			Location:   loc,
+			Start:      offset + h.Start,
+			End:        offset + h.End,
+			Feature:    "match",
+			Score:      &errs,
+			Attributes: self.fwd.pattern,
+			Strand:     h.Strand * strand,
+			Frame:      -1,
+		}
+	}
+	return f
+}
+
+// Return features describing the hits of the pattern in s. Feature scores hold the number of
+// errors.
+func (self *Searcher) SearchSeq(s *oseq.Seq) []*feat.Feature {
+	strand := s.Strand
+	if strand == 0 {
+		strand = 1
+	}
+	f := self.features(self.Search(s.Seq), s.ID, s.Offset, strand)
+	for _, sf := range f {
+		sf.Moltype = s.Moltype
+	}
+	return f
+}
+
+// Return features describing the hits of the pattern in the nucleic acid sequence s. Feature
+// scores hold the number of errors.
+func (self *Searcher) SearchSequence(s nucleic.Sequence) []*feat.Feature {
+	b := make([]byte, 0, s.Len())
+	for i := s.Start(); i < s.End(); i++ {
+		b = append(b, byte(s.At(seq.Position{Pos: i}).L))
+	}
+	f := self.features(self.Search(b), *s.Name(), s.Start(), 1)
+	for _, sf := range f {
+		sf.Moltype = s.Alphabet().Moltype()
+	}
+	return f
+}
@@ -0,0 +1,226 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package search
+
+import (
+	"code.google.com/p/biogo/exp/alphabet"
+	"code.google.com/p/biogo/exp/seq/nucleic"
+	oseq "code.google.com/p/biogo/seq"
+	check "launchpad.net/gocheck"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Helpers
+func random(n int, letters string, rnd *rand.Rand) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = letters[rnd.Intn(len(letters))]
+	}
+	return s
+}
+
+func matches(t, p byte) bool { return iupac[t] != 0 && iupac[t]&^iupac[p] == 0 }
+
+func naiveHamming(s []byte, p string, k int) (hits []Hit) {
+	for i := 0; i+len(p) <= len(s); i++ {
+		e := 0
+		for j := range p {
+			if !matches(s[i+j], p[j]) {
+				e++
+			}
+		}
+		if e <= k {
+			hits = append(hits, Hit{Start: i, End: i + len(p), Errors: e, Strand: 1})
+		}
+	}
+	return
+}
+
+// edit returns the edit distance between p and t.
+func edit(t []byte, p string) int {
+	d := make([][]int, len(p)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(p); i++ {
+		for j := 1; j <= len(t); j++ {
+			c := d[i-1][j-1]
+			if !matches(t[j-1], p[i-1]) {
+				c++
+			}
+			d[i][j] = min(c, min(d[i-1][j]+1, d[i][j-1]+1))
+		}
+	}
+	return d[len(p)][len(t)]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// endScores returns the smallest edit distance of p to a substring of s ending at each position.
+func endScores(s []byte, p string) []int {
+	prev := make([]int, len(p)+1)
+	for i := range prev {
+		prev[i] = i
+	}
+	scores := make([]int, len(s)+1)
+	scores[0] = len(p)
+	for j := 1; j <= len(s); j++ {
+		cur := make([]int, len(p)+1)
+		for i := 1; i <= len(p); i++ {
+			c := prev[i-1]
+			if !matches(s[j-1], p[i-1]) {
+				c++
+			}
+			cur[i] = min(c, min(prev[i]+1, cur[i-1]+1))
+		}
+		scores[j] = cur[len(p)]
+		prev = cur
+	}
+	return scores
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestCompile(c *check.C) {
+	for _, p := range []string{"", "ACGTX", strings.Repeat("A", MaxLen+1)} {
+		_, err := Compile(p)
+		c.Check(err, check.NotNil)
+	}
+	p, err := Compile("ACGRYSWKMBDHVN")
+	c.Assert(err, check.Equals, nil)
+	c.Check(p.RevComp().String(), check.Equals, "NBDHVKMWSRYCGT")
+	c.Check(p.RevComp().RevComp().String(), check.Equals, p.String())
+	for _, t := range []struct {
+		t, p byte
+		ok   bool
+	}{
+		{'A', 'R', true}, {'g', 'R', true}, {'C', 'R', false}, {'N', 'A', false},
+		{'N', 'N', true}, {'R', 'N', true}, {'R', 'D', true}, {'R', 'A', false}, {'u', 'T', true},
+	} {
+		c.Check(matches(t.t, t.p), check.Equals, t.ok, check.Commentf("%c %c", t.t, t.p))
+	}
+}
+
+func (s *S) TestHamming(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(5000, "ACGTN", rnd)
+	for _, p := range []string{"ACGT", "GANTTC", "RYGCAWW", "ACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGTACGT"} {
+		pat, err := Compile(p)
+		c.Assert(err, check.Equals, nil)
+		for k := 0; k <= 2; k++ {
+			c.Check(pat.Hamming(text, k), check.DeepEquals, naiveHamming(text, p, k), check.Commentf("%s %d", p, k))
+		}
+	}
+}
+
+func (s *S) TestEdit(c *check.C) {
+	rnd := rand.New(rand.NewSource(1))
+	text := random(5000, "ACGT", rnd)
+	for _, p := range []string{"ACGTTGCA", "GGNCCRYAT"} {
+		pat, err := Compile(p)
+		c.Assert(err, check.Equals, nil)
+		for k := 0; k <= 2; k++ {
+			hits := pat.Edit(text, k)
+			scores := endScores(text, p)
+			var n int
+			for j := 1; j <= len(text); j++ {
+				if scores[j] <= k && scores[j-1] > k {
+					n++
+				}
+			}
+			c.Check(len(hits), check.Equals, n)
+			for _, h := range hits {
+				c.Check(h.Errors, check.Equals, scores[h.End])
+				c.Check(edit(text[h.Start:h.End], p), check.Equals, h.Errors)
+				for j := h.End - 1; j > 0 && scores[j] <= k; j-- {
+					c.Check(scores[j] >= h.Errors, check.Equals, true)
+				}
+				for j := h.End + 1; j <= len(text) && scores[j] <= k; j++ {
+					c.Check(scores[j] >= h.Errors, check.Equals, true)
+				}
+			}
+		}
+	}
+
+	// A deletion in the text.
+	pat, _ := Compile("GATTACAGATTACA")
+	hits := pat.Edit([]byte("CCCCGATTACGATTACACCCC"), 1)
+	c.Check(hits, check.DeepEquals, []Hit{{Start: 4, End: 17, Errors: 1, Strand: 1}})
+}
+
+func (s *S) TestSearcher(c *check.C) {
+	for _, t := range []struct {
+		p string
+		k int
+	}{{"ACGT", 4}, {"ACGT", -1}, {"ACGX", 0}} {
+		_, err := NewSearcher("", t.p, t.k, false)
+		c.Check(err, check.NotNil)
+	}
+
+	text := []byte("TTTTCCTAGGATTTTTTTCCTAAGATTTTTTGAATTCTTTT")
+	sr, err := NewSearcher("primer", "CCTAGG", 1, false)
+	c.Assert(err, check.Equals, nil)
+	// CCTAGG is palindromic; CCTAAG matches with one mismatch on the forward strand and
+	// its reverse complement CTTAGG also matches the pattern with one mismatch.
+	c.Check(sr.Search(text), check.DeepEquals, []Hit{
+		{Start: 4, End: 10, Errors: 0, Strand: 0},
+		{Start: 18, End: 24, Errors: 1, Strand: 0},
+	})
+
+	sr, err = NewSearcher("site", "GATTTTTTG", 0, true)
+	c.Assert(err, check.Equals, nil)
+	rc := []byte("CAAAAAATC")
+	text = append(append([]byte("TTT"), rc...), []byte("GATTTTTTGAA")...)
+	c.Check(sr.Search(text), check.DeepEquals, []Hit{
+		{Start: 3, End: 12, Errors: 0, Strand: -1},
+		{Start: 12, End: 21, Errors: 0, Strand: 1},
+	})
+
+	os := oseq.New("chr1", text, nil)
+	os.Offset = 100
+	f := sr.SearchSeq(os)
+	c.Assert(len(f), check.Equals, 2)
+	c.Check(f[0].ID, check.Equals, "site")
+	c.Check(f[0].Location, check.Equals, "chr1")
+	c.Check(f[0].Start, check.Equals, 103)
+	c.Check(f[0].End, check.Equals, 112)
+	c.Check(f[0].Strand, check.Equals, int8(-1))
+	c.Check(*f[0].Score, check.Equals, 0.)
+	c.Check(f[1].Strand, check.Equals, int8(1))
+
+	ns := nucleic.NewSeq("chr2", alphabet.BytesToLetters([]byte(strings.ToLower(string(text)))), alphabet.DNA)
+	f = sr.SearchSequence(ns)
+	c.Assert(len(f), check.Equals, 2)
+	c.Check(f[0].Location, check.Equals, "chr2")
+	c.Check(f[0].Start, check.Equals, 3)
+	c.Check(f[1].End, check.Equals, 21)
+}
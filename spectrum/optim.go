@@ -0,0 +1,105 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package spectrum
+
+import (
+	"math"
+	"sort"
+)
+
+// A vertex is a point of a Nelder-Mead simplex.
+type vertex struct {
+	x []float64
+	f float64
+}
+
+type simplex []vertex
+
+func (self simplex) Len() int           { return len(self) }
+func (self simplex) Less(i, j int) bool { return self[i].f < self[j].f }
+func (self simplex) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+
+// nelderMead minimises f starting from x0 using the Nelder-Mead downhill simplex method. It
+// returns the best point found, its value, the number of iterations performed and whether the
+// simplex converged to within tol before maxIter iterations.
+func nelderMead(f func([]float64) float64, x0 []float64, step, tol float64, maxIter int) (x []float64, fx float64, iter int, converged bool) {
+	n := len(x0)
+	s := make(simplex, n+1)
+	for i := range s {
+		v := append([]float64(nil), x0...)
+		if i > 0 {
+			v[i-1] += step
+		}
+		s[i] = vertex{x: v, f: f(v)}
+	}
+
+	point := func(c []float64, to []float64, coef float64) []float64 {
+		p := make([]float64, n)
+		for i := range p {
+			p[i] = c[i] + coef*(to[i]-c[i])
+		}
+		return p
+	}
+
+	centroid := make([]float64, n)
+	for iter = 0; iter < maxIter; iter++ {
+		sort.Sort(s)
+		if math.Abs(s[n].f-s[0].f) <= tol*(math.Abs(s[0].f)+math.Abs(s[n].f))+1e-300 {
+			converged = true
+			break
+		}
+
+		for i := range centroid {
+			centroid[i] = 0
+			for _, v := range s[:n] {
+				centroid[i] += v.x[i]
+			}
+			centroid[i] /= float64(n)
+		}
+
+		r := point(centroid, s[n].x, -1)
+		fr := f(r)
+		switch {
+		case fr < s[0].f:
+			e := point(centroid, s[n].x, -2)
+			if fe := f(e); fe < fr {
+				s[n] = vertex{e, fe}
+			} else {
+				s[n] = vertex{r, fr}
+			}
+		case fr < s[n-1].f:
+			s[n] = vertex{r, fr}
+		default:
+			var c []float64
+			if fr < s[n].f {
+				c = point(centroid, r, 0.5)
+			} else {
+				c = point(centroid, s[n].x, 0.5)
+			}
+			if fc := f(c); fc < math.Min(fr, s[n].f) {
+				s[n] = vertex{c, fc}
+				continue
+			}
+			for i := 1; i <= n; i++ {
+				s[i].x = point(s[0].x, s[i].x, 0.5)
+				s[i].f = f(s[i].x)
+			}
+		}
+	}
+	sort.Sort(s)
+
+	return s[0].x, s[0].f, iter, converged
+}
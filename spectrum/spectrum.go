@@ -0,0 +1,270 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package spectrum estimates genome characteristics from k-mer spectra by fitting the
+// diploid negative binomial mixture model described in:
+//  GenomeScope: fast reference-free genome profiling from short reads.
+//   G. W. Vurture, F. J. Sedlazeck, M. Nattestad, et al. Bioinformatics 33:2202-2204 (2017).
+//
+// The spectrum is modelled as four negative binomial peaks at one to four times the
+// per-haplotype k-mer coverage, weighted by the heterozygosity and duplication rates. Low
+// count k-mers in excess of the model are attributed to sequencing error.
+package spectrum
+
+import (
+	"code.google.com/p/biogo/bio"
+	"code.google.com/p/biogo/index/kmercount"
+	"code.google.com/p/biogo/index/kmerindex"
+	"fmt"
+	"math"
+)
+
+// Fitting parameters.
+var (
+	MaxIter   = 10000 // Maximum number of simplex iterations for each fit.
+	Tolerance = 1e-10 // Relative convergence tolerance of the fit.
+)
+
+// Return the k-mer spectrum of a kmerindex frequency map.
+func FromFrequencies(f map[kmerindex.Kmer]int) kmercount.Histogram {
+	var h kmercount.Histogram
+	for _, c := range f {
+		h = addCount(h, c)
+	}
+	return h
+}
+
+// Return the k-mer spectrum of a long kmerindex frequency map.
+func FromFrequencies64(f map[kmerindex.Kmer64]int) kmercount.Histogram {
+	var h kmercount.Histogram
+	for _, c := range f {
+		h = addCount(h, c)
+	}
+	return h
+}
+
+func addCount(h kmercount.Histogram, c int) kmercount.Histogram {
+	for len(h) <= c {
+		h = append(h, 0)
+	}
+	h[c]++
+	return h
+}
+
+// A Model is a fitted k-mer spectrum model.
+type Model struct {
+	K int // k-mer length.
+
+	Coverage       float64 // Per-haplotype k-mer coverage.
+	Bias           float64 // Negative binomial overdispersion relative to coverage.
+	Heterozygosity float64 // Per-base heterozygosity rate.
+	Duplication    float64 // Fraction of the genome present in two copies.
+	Length         float64 // Haploid genome length.
+	UniqueLength   float64 // Haploid length of single copy sequence.
+	RepeatFraction float64 // Fraction of the haploid genome not in UniqueLength.
+	ErrorKmers     float64 // Number of k-mer instances attributed to sequencing error.
+	ErrorRate      float64 // Per-base sequencing error rate.
+
+	// Fit diagnostics.
+	Min, Max   int     // Range of counts used in the fit.
+	RSS        float64 // Residual sum of squares over the fitted range.
+	Fit        float64 // One minus the sum of absolute residuals divided by the total fitted count.
+	Iterations int     // Simplex iterations performed by the best fit.
+	Converged  bool    // Whether the best fit converged.
+
+	amplitude float64
+}
+
+// Return the expected number of distinct k-mers seen x times under the model, excluding error.
+func (self *Model) Predict(x int) float64 {
+	return self.amplitude * mixture(x, self.K, self.Duplication, self.Heterozygosity, self.Coverage, self.Bias)
+}
+
+// String returns a summary of the model.
+func (self *Model) String() string {
+	return fmt.Sprintf("k=%d len=%.0f het=%.4g%% dup=%.4g repeat=%.4g err=%.4g%% cov=%.4g fit=%.4g%%",
+		self.K, self.Length, self.Heterozygosity*100, self.Duplication, self.RepeatFraction,
+		self.ErrorRate*100, self.Coverage, self.Fit*100)
+}
+
+// nbinom returns the negative binomial probability of x with mean mu and size parameter size.
+func nbinom(x int, size, mu float64) float64 {
+	if mu <= 0 || size <= 0 {
+		return 0
+	}
+	fx := float64(x)
+	lg1, _ := math.Lgamma(fx + size)
+	lg2, _ := math.Lgamma(size)
+	lg3, _ := math.Lgamma(fx + 1)
+	p := size / (size + mu)
+	return math.Exp(lg1 - lg2 - lg3 + size*math.Log(p) + fx*math.Log1p(-p))
+}
+
+// weights returns the mixture weights of the four peaks.
+func weights(k int, d, r float64) (a [4]float64) {
+	h := math.Pow(1-r, float64(k))
+	a[0] = 2 * (1 - d) * (1 - h)
+	a[1] = d*(1-h)*(1-h) + (1-2*d)*h
+	a[2] = 2 * d * h * (1 - h)
+	a[3] = d * h * h
+	return
+}
+
+func mixture(x, k int, d, r, cov, bias float64) (p float64) {
+	for i, a := range weights(k, d, r) {
+		m := cov * float64(i+1)
+		p += a * nbinom(x, m/bias, m)
+	}
+	return
+}
+
+// mixtureRange returns the mixture probabilities of counts from min to max inclusive. The
+// negative binomial terms are calculated by recurrence rather than with nbinom.
+func mixtureRange(min, max, k int, d, r, cov, bias float64) []float64 {
+	p := make([]float64, max-min+1)
+	for i, a := range weights(k, d, r) {
+		if a == 0 {
+			continue
+		}
+		mu := cov * float64(i+1)
+		size := mu / bias
+		lq := math.Log(mu / (size + mu))
+		lp := math.Log(nbinom(min, size, mu))
+		if math.IsInf(lp, -1) {
+			// Restart the recurrence from zero if the start underflows.
+			lp = size * math.Log(size/(size+mu))
+			for x := 0; x < min; x++ {
+				lp += math.Log((float64(x)+size)/float64(x+1)) + lq
+			}
+		}
+		for x := min; x <= max; x++ {
+			p[x-min] += a * math.Exp(lp)
+			lp += math.Log((float64(x)+size)/float64(x+1)) + lq
+		}
+	}
+	return p
+}
+
+func logistic(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+func logit(p float64) float64    { return math.Log(p / (1 - p)) }
+
+// params converts unconstrained fitting variables into model parameters.
+func params(v []float64) (d, r, cov, bias, amp float64) {
+	return 0.5 * logistic(v[0]), logistic(v[1]), math.Exp(v[2]), math.Exp(v[3]), math.Exp(v[4])
+}
+
+// Fit the model to the k-mer spectrum h, where h[i] is the number of distinct k-mers of length k
+// seen i times. The final element of h is ignored since it may aggregate all higher counts. The
+// fit excludes counts below the first minimum of the spectrum, which are dominated by error.
+func Fit(h kmercount.Histogram, k int) (*Model, error) {
+	if k < 1 {
+		return nil, bio.NewError(fmt.Sprintf("spectrum: illegal k: %d", k), 0, k)
+	}
+	max := len(h) - 2
+	min := 1
+	for min < max && h[min+1] < h[min] {
+		min++
+	}
+	if max-min < 5 {
+		return nil, bio.NewError("spectrum: too few counts beyond the error trough to fit", 0, min, max)
+	}
+	peak := min
+	for x := min; x <= max; x++ {
+		if h[x] > h[peak] {
+			peak = x
+		}
+	}
+
+	var total float64
+	for x := min; x <= max; x++ {
+		total += float64(x) * float64(h[x])
+	}
+
+	rss := func(v []float64) (s float64) {
+		d, r, cov, bias, amp := params(v)
+		if cov > float64(max) || bias > 1e3 {
+			return math.Inf(1)
+		}
+		for i, p := range mixtureRange(min, max, k, d, r, cov, bias) {
+			e := float64(h[min+i]) - amp*p
+			s += e * e
+		}
+		return
+	}
+
+	var (
+		best     []float64
+		bestRSS  = math.Inf(1)
+		bestIter int
+		bestConv bool
+	)
+	for _, cov := range []float64{float64(peak) / 2, float64(peak)} {
+		for _, r := range []float64{1e-3, 1e-2} {
+			v0 := []float64{logit(0.02), logit(r), math.Log(cov), math.Log(0.5), math.Log(total / (2 * cov))}
+			v, f, iter, conv := nelderMead(rss, v0, 0.1, Tolerance, MaxIter)
+			// Restart from the solution to escape premature simplex collapse.
+			if v2, f2, iter2, conv2 := nelderMead(rss, v, 0.05, Tolerance, MaxIter); f2 <= f {
+				v, f, iter, conv = v2, f2, iter+iter2, conv2
+			}
+			if f < bestRSS {
+				best, bestRSS, bestIter, bestConv = v, f, iter, conv
+			}
+		}
+	}
+	if best == nil {
+		return nil, bio.NewError("spectrum: model fit failed", 0)
+	}
+
+	m := &Model{K: k, Min: min, Max: max, RSS: bestRSS, Iterations: bestIter, Converged: bestConv}
+	m.Duplication, m.Heterozygosity, m.Coverage, m.Bias, m.amplitude = params(best)
+
+	var (
+		absResid, fitted float64
+		all, model       float64
+		unique           float64
+		a                = weights(k, m.Duplication, m.Heterozygosity)
+	)
+	for x := 1; x <= max; x++ {
+		p := m.Predict(x)
+		fx, y := float64(x), float64(h[x])
+		all += fx * y
+		if x < min {
+			if y > p {
+				m.ErrorKmers += fx * (y - p)
+			}
+			model += fx * math.Min(y, p)
+		} else {
+			model += fx * y
+			absResid += math.Abs(y - p)
+			fitted += y
+		}
+		unique += fx * m.amplitude * (a[0]*nbinom(x, m.Coverage/m.Bias, m.Coverage) +
+			(1-2*m.Duplication)*math.Pow(1-m.Heterozygosity, float64(k))*nbinom(x, 2*m.Coverage/m.Bias, 2*m.Coverage))
+	}
+	m.Length = model / (2 * m.Coverage)
+	m.UniqueLength = unique / (2 * m.Coverage)
+	if m.UniqueLength > m.Length {
+		m.UniqueLength = m.Length
+	}
+	m.RepeatFraction = 1 - m.UniqueLength/m.Length
+	if all > 0 {
+		m.ErrorRate = 1 - math.Pow(1-m.ErrorKmers/all, 1/float64(k))
+	}
+	if fitted > 0 {
+		m.Fit = 1 - absResid/fitted
+	}
+
+	return m, nil
+}
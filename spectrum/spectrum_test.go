@@ -0,0 +1,87 @@
+// Copyright ©2011-2012 Dan Kortschak <dan.kortschak@adelaide.edu.au>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package spectrum
+
+import (
+	"code.google.com/p/biogo/index/kmercount"
+	"code.google.com/p/biogo/index/kmerindex"
+	check "launchpad.net/gocheck"
+	"math"
+	"testing"
+)
+
+// Helpers
+func simulate(k int, length, cov, bias, r, d float64, errors []float64, max int) kmercount.Histogram {
+	h := make(kmercount.Histogram, max+2)
+	for x := 1; x <= max; x++ {
+		h[x] = int64(length*mixture(x, k, d, r, cov, bias) + 0.5)
+		if x-1 < len(errors) {
+			h[x] += int64(errors[x-1])
+		}
+	}
+	return h
+}
+
+func within(c *check.C, obtained, expected, tol float64, name string) {
+	c.Check(math.Abs(obtained-expected) <= tol*math.Abs(expected), check.Equals, true,
+		check.Commentf("%s: obtained %v expected %v", name, obtained, expected))
+}
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestFit(c *check.C) {
+	for _, t := range []struct {
+		length, cov, bias, r, d float64
+	}{
+		{5e6, 30, 1.2, 0.01, 0.05},
+		{2e6, 20, 1, 0.002, 0.01},
+		{1e7, 40, 2, 0.02, 0},
+	} {
+		const k = 21
+		errs := []float64{2e6, 2e5, 2e4, 2e3}
+		h := simulate(k, t.length, t.cov, t.bias, t.r, t.d, errs, 250)
+		m, err := Fit(h, k)
+		c.Assert(err, check.Equals, nil)
+		c.Logf("%v iter=%d conv=%v", m, m.Iterations, m.Converged)
+
+		var expectLen float64
+		for i, a := range weights(k, t.d, t.r) {
+			expectLen += a * float64(i+1) * t.length / 2
+		}
+		within(c, m.Coverage, t.cov, 0.02, "coverage")
+		within(c, m.Heterozygosity, t.r, 0.1, "heterozygosity")
+		within(c, m.Length, expectLen, 0.03, "length")
+		within(c, m.ErrorKmers, 2e6+2*2e5+3*2e4+4*2e3, 0.1, "error kmers")
+		c.Check(math.Abs(m.Duplication-t.d) < 0.01, check.Equals, true, check.Commentf("duplication: %v", m.Duplication))
+		c.Check(m.Fit > 0.99, check.Equals, true)
+		c.Check(m.ErrorRate > 0 && m.ErrorRate < 0.01, check.Equals, true)
+		c.Check(m.RepeatFraction >= 0 && m.RepeatFraction < 0.2, check.Equals, true)
+	}
+}
+
+func (s *S) TestFromFrequencies(c *check.C) {
+	h := FromFrequencies(map[kmerindex.Kmer]int{0: 1, 1: 3, 2: 3, 5: 2})
+	c.Check(h, check.DeepEquals, kmercount.Histogram{0, 1, 1, 2})
+	h = FromFrequencies64(map[kmerindex.Kmer64]int{0: 2})
+	c.Check(h, check.DeepEquals, kmercount.Histogram{0, 0, 1})
+	_, err := Fit(kmercount.Histogram{0, 10, 5, 1}, 21)
+	c.Check(err, check.Not(check.Equals), nil)
+}